@@ -0,0 +1,311 @@
+package bloom
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math"
+)
+
+// An Advisor wraps a BloomFilter and records its workload: the number of
+// adds and tests, the key sizes, and the false positive rate observed on
+// canaries, random keys which are never added to the filter. SuggestParameters
+// then turns these observations into a recommendation.
+//
+// Like the BloomFilter, an Advisor is not safe for concurrent use.
+type Advisor struct {
+	f          *BloomFilter
+	canaries   [][]byte
+	adds       uint64
+	tests      uint64
+	positives  uint64
+	keyBytes   uint64
+	maxKeySize int
+}
+
+// A Suggestion is the workload observed by an Advisor together with the
+// recommended parameters.
+type Suggestion struct {
+	Adds      uint64 // number of keys added
+	Tests     uint64 // number of keys tested
+	Positives uint64 // number of tests returning true
+
+	MeanKeySize float64 // mean size of the added and tested keys, in bytes
+	MaxKeySize  int     // size of the largest key, in bytes
+
+	EstimatedItems            uint    // approximated number of distinct items in the filter
+	ObservedFalsePositiveRate float64 // fraction of the canaries testing positive
+
+	// Variant is the suggested kind of filter, see Suggest, or "none" when
+	// almost all tests are positive: the filter then rarely saves a lookup
+	// and may be dropped.
+	Variant string
+	// M and K are the number of bits, or of counters, and of hash functions
+	// of the suggested variant, or of a BloomFilter if it is "none". They
+	// are zero for the variants storing fingerprints, "cuckoo.Filter" and
+	// "fuse.Filter".
+	M uint
+	K uint
+	// Bytes is the memory used by the suggested variant, and
+	// FalsePositiveRate its expected false positive rate for EstimatedItems,
+	// which is above the target when the memory limit is too low.
+	Bytes             uint64
+	FalsePositiveRate float64
+	// Reason explains the choice of the variant.
+	Reason string
+}
+
+// A Workload describes how a filter is used, beyond what an Advisor
+// observes, to choose its variant.
+type Workload struct {
+	Deletes  bool // keys must be removed from the filter
+	Static   bool // all the keys are known when the filter is built
+	MaxBytes uint // memory limit of the filter, 0 if there is none
+}
+
+// NewAdvisor wraps a filter, using the given number of canaries to measure
+// the false positive rate.
+func NewAdvisor(f *BloomFilter, canaries int) *Advisor {
+	a := &Advisor{f: f, canaries: make([][]byte, canaries)}
+	for i := range a.canaries {
+		a.canaries[i] = make([]byte, 16)
+		rand.Read(a.canaries[i]) // #nosec
+	}
+	return a
+}
+
+// Filter returns the wrapped filter.
+func (a *Advisor) Filter() *BloomFilter {
+	return a.f
+}
+
+// record accounts for the size of a key
+func (a *Advisor) record(data []byte) {
+	a.keyBytes += uint64(len(data))
+	if len(data) > a.maxKeySize {
+		a.maxKeySize = len(data)
+	}
+}
+
+// Add data to the filter. Returns the advisor (allows chaining)
+func (a *Advisor) Add(data []byte) *Advisor {
+	a.adds++
+	a.record(data)
+	a.f.Add(data)
+	return a
+}
+
+// Test returns true if the data is in the filter, false otherwise.
+// If true, the result might be a false positive. If false, the data
+// is definitely not in the set.
+func (a *Advisor) Test(data []byte) bool {
+	a.tests++
+	a.record(data)
+	present := a.f.Test(data)
+	if present {
+		a.positives++
+	}
+	return present
+}
+
+// TestAndAdd is equivalent to calling Test(data) then Add(data).
+// Returns the result of Test.
+func (a *Advisor) TestAndAdd(data []byte) bool {
+	a.tests++
+	a.adds++
+	a.record(data)
+	present := a.f.TestAndAdd(data)
+	if present {
+		a.positives++
+	}
+	return present
+}
+
+// SuggestParameters reports the workload observed so far and recommends
+// the parameters of a filter holding the items seen so far with a false
+// positive rate of fp. Add headroom to the recommendation if the set keeps
+// growing. It is Suggest for a workload without deletions nor memory limit.
+func (a *Advisor) SuggestParameters(fp float64) Suggestion {
+	return a.Suggest(fp, Workload{})
+}
+
+// Suggest reports the workload observed so far and recommends a variant of
+// filter holding the items seen so far with a false positive rate of fp,
+// within the memory limit of the workload:
+//
+//   - with deletions, "cuckoo.Filter" if its rate of 0.012% is low enough,
+//     "CountingBloomFilter" otherwise;
+//   - for a static set, "fuse.Filter" if its rate of 0.39% is low enough
+//     and it is smaller than a BloomFilter, like other sets otherwise;
+//   - for filters larger than 1 MiB, whose bits do not fit in the caches,
+//     "SplitBlockBloomFilter" if fp is between 0.1% and 2%, where its 8 hash
+//     functions are about optimal, "BlockedBloomFilter" otherwise: both
+//     touch a single cache line per key;
+//   - "BloomFilter" otherwise.
+//
+// A variant which does not fit in the memory limit is skipped. When none
+// fits, the suggestion is the most accurate filter of the limit, a
+// CountingBloomFilter or a cuckoo filter with deletions, and a BloomFilter
+// or a binary fuse filter otherwise.
+func (a *Advisor) Suggest(fp float64, w Workload) Suggestion {
+	s := Suggestion{
+		Adds:           a.adds,
+		Tests:          a.tests,
+		Positives:      a.positives,
+		MaxKeySize:     a.maxKeySize,
+		EstimatedItems: uint(a.f.ApproximatedSize()),
+	}
+	if a.adds+a.tests > 0 {
+		s.MeanKeySize = float64(a.keyBytes) / float64(a.adds+a.tests)
+	}
+	if len(a.canaries) > 0 {
+		fps := 0
+		for _, canary := range a.canaries {
+			if a.f.Test(canary) {
+				fps++
+			}
+		}
+		s.ObservedFalsePositiveRate = float64(fps) / float64(len(a.canaries))
+	}
+	v := suggestVariant(max(1, s.EstimatedItems), fp, w)
+	// A filter is only useful if it rejects some of the tested keys.
+	if a.tests >= 100 && a.positives*100 > a.tests*99 {
+		v = bloomVariant(max(1, s.EstimatedItems), fp)
+		v.name, v.reason = "none", "more than 99% of the tested keys are positive"
+	}
+	s.Variant, s.M, s.K = v.name, v.m, v.k
+	s.Bytes, s.FalsePositiveRate, s.Reason = v.bytes, v.rate, v.reason
+	return s
+}
+
+const (
+	// cuckooRate and fuseRate are the false positive rates of the filters
+	// of packages cuckoo and fuse, with 16-bit and 8-bit fingerprints
+	cuckooRate = 8.0 / (1 << 16)
+	fuseRate   = 1.0 / (1 << 8)
+	// blockedMinBytes is the size from which filters touching a single
+	// cache line per key are suggested
+	blockedMinBytes = 1 << 20
+)
+
+// A variant is a kind of filter for a number of items, with its parameters
+// and costs
+type variant struct {
+	name   string
+	m, k   uint
+	bytes  uint64
+	rate   float64
+	reason string
+}
+
+// fits returns true if the variant fits in maxBytes, 0 meaning no limit
+func (v variant) fits(maxBytes uint) bool {
+	return maxBytes == 0 || v.bytes <= uint64(maxBytes)
+}
+
+// bloomVariant returns a BloomFilter for n items with fp false positive rate
+func bloomVariant(n uint, fp float64) variant {
+	m, k := EstimateParameters(n, fp)
+	return variant{name: "BloomFilter", m: m, k: k, bytes: (uint64(m) + 63) / 64 * 8,
+		rate: EstimateFalsePositiveRate(m, k, n)}
+}
+
+// suggestVariant returns the variant of filter for n items with fp false
+// positive rate and the workload w, see Suggest
+func suggestVariant(n uint, fp float64, w Workload) variant {
+	plain := bloomVariant(n, fp)
+	var candidates []variant
+	switch {
+	case w.Deletes:
+		cuckoo := cuckooVariant(n)
+		if cuckoo.rate <= fp {
+			cuckoo.reason = "deletions, with a rate of at least 0.012%"
+			candidates = append(candidates, cuckoo)
+		}
+		counting := countingVariant(plain.m, plain.k, n)
+		counting.reason = "deletions"
+		candidates = append(candidates, counting)
+	case w.Static:
+		if fuse := fuseVariant(n); fuse.rate <= fp && fuse.bytes < plain.bytes {
+			fuse.reason = "static set, with a rate of at least 0.39%"
+			candidates = append(candidates, fuse)
+		}
+		fallthrough
+	default:
+		if plain.bytes >= blockedMinBytes {
+			if fp >= 0.001 && fp <= 0.02 {
+				sbbf := splitBlockVariant(n, fp)
+				sbbf.reason = "larger than the caches, with a rate between 0.1% and 2%"
+				candidates = append(candidates, sbbf)
+			}
+			blocked := plain
+			blocked.name, blocked.reason = "BlockedBloomFilter", "larger than the caches"
+			blocked.m = (plain.m + 511) / 512 * 512
+			blocked.bytes = uint64(blocked.m) / 8
+			candidates = append(candidates, blocked)
+		}
+		plain.reason = "default"
+		candidates = append(candidates, plain)
+	}
+	for _, v := range candidates {
+		if v.fits(w.MaxBytes) {
+			return v
+		}
+	}
+
+	// The most accurate filter within the limit
+	reason := fmt.Sprintf("most accurate within %d bytes", w.MaxBytes)
+	var best variant
+	if w.Deletes {
+		m := w.MaxBytes / 8 * 16
+		best = countingVariant(m, optimalHashes(m, n), n)
+		if cuckoo := cuckooVariant(n); cuckoo.fits(w.MaxBytes) && cuckoo.rate < best.rate {
+			best = cuckoo
+		}
+	} else {
+		m, k, rate := EstimateParametersForBudget(w.MaxBytes, n)
+		best = variant{name: "BloomFilter", m: m, k: k, bytes: uint64(m) / 8, rate: rate}
+		if fuse := fuseVariant(n); w.Static && fuse.fits(w.MaxBytes) && fuse.rate < best.rate {
+			best = fuse
+		}
+	}
+	best.reason = reason
+	return best
+}
+
+// countingVariant returns a CountingBloomFilter with m 4-bit counters
+func countingVariant(m, k, n uint) variant {
+	return variant{name: "CountingBloomFilter", m: m, k: k, bytes: (uint64(m)*4 + 63) / 64 * 8,
+		rate: EstimateFalsePositiveRate(m, k, n)}
+}
+
+// cuckooVariant returns a cuckoo filter for n items, sized as cuckoo.New
+func cuckooVariant(n uint) variant {
+	buckets := uint64(1)
+	for buckets*4*95/100 < uint64(n) {
+		buckets *= 2
+	}
+	return variant{name: "cuckoo.Filter", bytes: buckets * 4 * 2, rate: cuckooRate}
+}
+
+// fuseVariant returns a binary fuse filter for n items, with the size factor
+// of fuse.Build
+func fuseVariant(n uint) variant {
+	factor := 1.125
+	if n > 1 {
+		factor = math.Max(factor, 0.875+0.25*math.Log(1e6)/math.Log(float64(n)))
+	}
+	return variant{name: "fuse.Filter", bytes: uint64(math.Ceil(float64(n) * factor)), rate: fuseRate}
+}
+
+// splitBlockVariant returns a SplitBlockBloomFilter for n items with fp
+// false positive rate, sized as NewSplitBlockWithEstimates
+func splitBlockVariant(n uint, fp float64) variant {
+	bytes := uint64(sbbfMinBytes)
+	want := -8 * float64(n) / math.Log(1-math.Pow(fp, 1.0/8)) / 8
+	for float64(bytes) < want && bytes < sbbfMaxBytes {
+		bytes *= 2
+	}
+	m := uint(bytes * 8)
+	return variant{name: "SplitBlockBloomFilter", m: m, k: 8, bytes: bytes,
+		rate: math.Pow(1-math.Exp(-8*float64(n)/float64(m)), 8)}
+}
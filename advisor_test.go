@@ -0,0 +1,137 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+func TestAdvisor(t *testing.T) {
+	a := NewAdvisor(New(1000, 4), 1000)
+	n := make([]byte, 4)
+	for i := uint32(0); i < 1000; i++ {
+		binary.BigEndian.PutUint32(n, i)
+		a.Add(n)
+	}
+	for i := uint32(0); i < 1000; i++ {
+		binary.BigEndian.PutUint32(n, i+1000)
+		a.Test(n)
+	}
+	a.TestAndAdd([]byte("a longer key"))
+	s := a.SuggestParameters(0.01)
+	if s.Adds != 1001 || s.Tests != 1001 {
+		t.Errorf("unexpected counts %d %d", s.Adds, s.Tests)
+	}
+	if s.MaxKeySize != 12 {
+		t.Errorf("unexpected max key size %d", s.MaxKeySize)
+	}
+	if s.MeanKeySize <= 4 || s.MeanKeySize >= 5 {
+		t.Errorf("unexpected mean key size %v", s.MeanKeySize)
+	}
+	// 1000 items in 1000 bits: the filter is overloaded.
+	if s.ObservedFalsePositiveRate < 0.1 {
+		t.Errorf("unexpected observed false positive rate %v", s.ObservedFalsePositiveRate)
+	}
+	if s.EstimatedItems < 500 {
+		t.Errorf("unexpected estimated items %d", s.EstimatedItems)
+	}
+	m, k := EstimateParameters(s.EstimatedItems, 0.01)
+	if s.M != m || s.K != k {
+		t.Errorf("unexpected parameters %d %d", s.M, s.K)
+	}
+	if s.Variant != "BloomFilter" {
+		t.Errorf("unexpected variant %v", s.Variant)
+	}
+	if a.Filter().Cap() != 1000 {
+		t.Error("unexpected filter")
+	}
+}
+
+func TestAdvisorUselessFilter(t *testing.T) {
+	a := NewAdvisor(New(1000, 4), 10)
+	a.Add([]byte("hot"))
+	for i := 0; i < 1000; i++ {
+		a.Test([]byte("hot"))
+	}
+	s := a.SuggestParameters(0.01)
+	if s.Variant != "none" {
+		t.Errorf("unexpected variant %v", s.Variant)
+	}
+	if s.ObservedFalsePositiveRate != 0 {
+		t.Errorf("unexpected observed false positive rate %v", s.ObservedFalsePositiveRate)
+	}
+}
+
+func TestSuggestVariant(t *testing.T) {
+	for _, c := range []struct {
+		n       uint
+		fp      float64
+		w       Workload
+		variant string
+	}{
+		{1000, 0.01, Workload{}, "BloomFilter"},
+		{10000000, 0.01, Workload{}, "SplitBlockBloomFilter"},
+		{10000000, 0.0001, Workload{}, "BlockedBloomFilter"},
+		{10000000, 0.1, Workload{}, "BlockedBloomFilter"},
+		{1000, 0.01, Workload{Static: true}, "BloomFilter"},
+		{1000, 0.001, Workload{Static: true}, "BloomFilter"},
+		{1000, 0.1, Workload{Static: true}, "BloomFilter"},
+		{10000000, 0.01, Workload{Static: true}, "fuse.Filter"},
+		{1000, 0.01, Workload{Deletes: true}, "cuckoo.Filter"},
+		{1000, 0.00001, Workload{Deletes: true}, "CountingBloomFilter"},
+		{1000, 0.00001, Workload{Deletes: true, MaxBytes: 12000}, "CountingBloomFilter"},
+		{10000000, 0.01, Workload{MaxBytes: 13000000}, "BlockedBloomFilter"},
+	} {
+		v := suggestVariant(c.n, c.fp, c.w)
+		if v.name != c.variant {
+			t.Errorf("n = %d, fp = %v, %+v: %s (%s) instead of %s", c.n, c.fp, c.w, v.name, v.reason, c.variant)
+		}
+		if v.rate > 1.1*c.fp || !v.fits(c.w.MaxBytes) || v.bytes == 0 || v.reason == "" {
+			t.Errorf("n = %d, fp = %v, %+v: %+v", c.n, c.fp, c.w, v)
+		}
+	}
+
+	if v := suggestVariant(10000000, 0.01, Workload{}); v.bytes != uint64(len(NewSplitBlockWithEstimates(10000000, 0.01).words))*4 {
+		t.Errorf("the split block filter should be sized as NewSplitBlockWithEstimates: %d bytes", v.bytes)
+	}
+	if v := suggestVariant(100000, 0.01, Workload{Deletes: true}); v.bytes != 32768*4*2 {
+		t.Errorf("the cuckoo filter should be sized as cuckoo.New: %d bytes", v.bytes)
+	}
+}
+
+func TestSuggestVariantMemoryLimit(t *testing.T) {
+	for _, c := range []struct {
+		w       Workload
+		variant string
+	}{
+		{Workload{MaxBytes: 500}, "BloomFilter"},
+		{Workload{Static: true, MaxBytes: 1000}, "BloomFilter"},
+		{Workload{Static: true, MaxBytes: 1400}, "fuse.Filter"},
+		{Workload{Deletes: true, MaxBytes: 500}, "CountingBloomFilter"},
+		{Workload{Deletes: true, MaxBytes: 4096}, "cuckoo.Filter"},
+	} {
+		// None of the variants meeting a rate of 0.001% fits.
+		v := suggestVariant(1000, 0.00001, c.w)
+		if v.name != c.variant {
+			t.Errorf("%+v: %s instead of %s", c.w, v.name, c.variant)
+		}
+		if !v.fits(c.w.MaxBytes) || v.rate <= 0.00001 || v.rate >= 1 || v.reason != "most accurate within "+fmt.Sprint(c.w.MaxBytes)+" bytes" {
+			t.Errorf("%+v: %+v", c.w, v)
+		}
+	}
+}
+
+func TestAdvisorSuggest(t *testing.T) {
+	a := NewAdvisor(New(100000, 7), 100)
+	for i := 0; i < 1000; i++ {
+		a.Add([]byte(fmt.Sprint(i)))
+	}
+	s := a.Suggest(0.01, Workload{Deletes: true})
+	if s.Variant != "cuckoo.Filter" || s.M != 0 || s.K != 0 || s.Bytes != 4096 || s.FalsePositiveRate != cuckooRate {
+		t.Errorf("unexpected suggestion %+v", s)
+	}
+	s = a.Suggest(0.01, Workload{})
+	if s.Variant != "BloomFilter" || s.Bytes != uint64(s.M+63)/64*8 || s.FalsePositiveRate > 0.011 || s.Reason != "default" {
+		t.Errorf("unexpected suggestion %+v", s)
+	}
+}
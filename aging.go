@@ -0,0 +1,285 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// An AgingBloomFilter is a Bloom filter whose keys expire individually: it
+// tells whether a key was probably added within its time to live, the last
+// _ttl_ ticks. Instead of a bit, each of its _m_ locations holds a byte
+// which counts down the ticks left: Add sets the k bytes of a key to ttl,
+// and each Tick decrements all the non-zero bytes. A key is thus forgotten
+// exactly ttl ticks after it was last added, instead of all at once as in a
+// RotatingBloomFilter, at the cost of eight times the memory of a
+// BloomFilter and of a Tick which updates every byte.
+//
+// Ticks may be automatic, see SetInterval. A key whose bytes were set again
+// by more recent keys lives longer: this only adds false positives, with the
+// rate of a BloomFilter holding the keys added during the last ttl ticks.
+type AgingBloomFilter struct {
+	m        uint
+	k        uint
+	ttl      uint8
+	cells    []uint8
+	interval time.Duration // time between automatic ticks, if positive
+	last     time.Time     // time of the last automatic tick
+	now      func() time.Time
+}
+
+// NewAging creates a new aging Bloom filter with _m_ locations, _k_ hashing
+// functions and keys which expire after ttl ticks. We force _m_, _k_ and ttl
+// to be at least one, and ttl to be at most 255.
+func NewAging(m uint, k uint, ttl uint) *AgingBloomFilter {
+	if ttl > 255 {
+		ttl = 255
+	}
+	m = max(1, m)
+	return &AgingBloomFilter{
+		m:     m,
+		k:     max(1, k),
+		ttl:   uint8(max(1, ttl)),
+		cells: make([]uint8, m),
+		now:   time.Now,
+	}
+}
+
+// NewAgingWithEstimates creates a new aging Bloom filter for about n items
+// added within the time to live, with fp false positive rate, and keys which
+// expire after ttl ticks.
+func NewAgingWithEstimates(n uint, fp float64, ttl uint) *AgingBloomFilter {
+	m, k := EstimateParameters(n, fp)
+	return NewAging(m, k, ttl)
+}
+
+// Cap returns the capacity, _m_, of an aging Bloom filter
+func (f *AgingBloomFilter) Cap() uint {
+	return f.m
+}
+
+// K returns the number of hash functions used in the AgingBloomFilter
+func (f *AgingBloomFilter) K() uint {
+	return f.k
+}
+
+// TTL returns the number of ticks after which a key expires
+func (f *AgingBloomFilter) TTL() uint {
+	return uint(f.ttl)
+}
+
+// SetInterval makes the filter tick every d, starting now: Add and Expire
+// first tick once for each interval elapsed since the last tick, so that no
+// goroutine is needed, and Test takes these ticks into account without
+// modifying the filter. Keys then expire after ttl*d. A zero interval
+// disables automatic ticks.
+func (f *AgingBloomFilter) SetInterval(d time.Duration) {
+	f.interval = d
+	f.last = f.now()
+}
+
+// Interval returns the time between automatic ticks, zero if they are
+// disabled.
+func (f *AgingBloomFilter) Interval() time.Duration {
+	return f.interval
+}
+
+// Expire performs the automatic ticks which are due, see SetInterval.
+// Returns the filter (allows chaining)
+func (f *AgingBloomFilter) Expire() *AgingBloomFilter {
+	if n := f.pending(); n > 0 {
+		f.last = f.last.Add(n * f.interval)
+		if n > time.Duration(f.ttl) {
+			n = time.Duration(f.ttl)
+		}
+		f.tick(uint8(n))
+	}
+	return f
+}
+
+// pending returns the number of automatic ticks which are due, without
+// modifying the filter
+func (f *AgingBloomFilter) pending() time.Duration {
+	if f.interval <= 0 {
+		return 0
+	}
+	elapsed := f.now().Sub(f.last)
+	if elapsed < f.interval {
+		return 0
+	}
+	return elapsed / f.interval
+}
+
+// Tick ages all the keys by one tick, forgetting those which were added ttl
+// ticks ago. Returns the filter (allows chaining)
+func (f *AgingBloomFilter) Tick() *AgingBloomFilter {
+	f.tick(1)
+	return f
+}
+
+// tick ages all the keys by n ticks
+func (f *AgingBloomFilter) tick(n uint8) {
+	for i, c := range f.cells {
+		if c > n {
+			f.cells[i] = c - n
+		} else {
+			f.cells[i] = 0
+		}
+	}
+}
+
+// Add data to the aging Bloom filter, or renew its time to live. Returns the
+// filter (allows chaining)
+func (f *AgingBloomFilter) Add(data []byte) *AgingBloomFilter {
+	f.Expire()
+	h := baseHashes(data)
+	for i := uint(0); i < f.k; i++ {
+		f.cells[location(h, i)%uint64(f.m)] = f.ttl
+	}
+	return f
+}
+
+// AddString to the aging Bloom filter. Returns the filter (allows chaining)
+func (f *AgingBloomFilter) AddString(data string) *AgingBloomFilter {
+	return f.Add(stringToBytes(data))
+}
+
+// Test returns true if the data was added within its time to live, false
+// otherwise. If true, the result might be a false positive. If false, the
+// data is definitely not in the set. Test does not modify the filter, even
+// when automatic ticks are due, so it may be called concurrently with other
+// calls to Test.
+func (f *AgingBloomFilter) Test(data []byte) bool {
+	n := f.pending()
+	h := baseHashes(data)
+	for i := uint(0); i < f.k; i++ {
+		if time.Duration(f.cells[location(h, i)%uint64(f.m)]) <= n {
+			return false
+		}
+	}
+	return true
+}
+
+// TestString returns true if the string was added within its time to live,
+// false otherwise. If true, the result might be a false positive. If false,
+// the data is definitely not in the set.
+func (f *AgingBloomFilter) TestString(data string) bool {
+	return f.Test(stringToBytes(data))
+}
+
+// TestAndAdd is equivalent to calling Test(data) then Add(data).
+// Returns the result of Test.
+func (f *AgingBloomFilter) TestAndAdd(data []byte) bool {
+	present := f.Test(data)
+	f.Add(data)
+	return present
+}
+
+// ClearAll clears all the data in an aging Bloom filter, removing all keys
+func (f *AgingBloomFilter) ClearAll() *AgingBloomFilter {
+	for i := range f.cells {
+		f.cells[i] = 0
+	}
+	return f
+}
+
+// agingHeader is the header of the binary representation of an
+// AgingBloomFilter
+type agingHeader struct {
+	M        uint64
+	K        uint64
+	TTL      uint64
+	Interval int64 // nanoseconds
+	Last     int64 // Unix time in nanoseconds, if Interval is positive
+}
+
+// WriteTo writes a binary representation of the AgingBloomFilter to an i/o
+// stream: m, k, the time to live, the interval and the time of the last
+// automatic tick, followed by the m bytes of the filter. It returns the
+// number of bytes written.
+func (f *AgingBloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	header := agingHeader{
+		M:        uint64(f.m),
+		K:        uint64(f.k),
+		TTL:      uint64(f.ttl),
+		Interval: int64(f.interval),
+	}
+	if f.interval > 0 {
+		header.Last = f.last.UnixNano()
+	}
+	err := binary.Write(stream, binary.BigEndian, &header)
+	if err != nil {
+		return 0, err
+	}
+	n, err := stream.Write(f.cells)
+	return int64(binary.Size(&header) + n), err
+}
+
+// ReadFrom reads a binary representation of the AgingBloomFilter (such as
+// might have been written by WriteTo()) from an i/o stream. It returns the
+// number of bytes read. Automatic ticks resume from the time of the last
+// tick, so the keys which have expired since the filter was written are
+// forgotten.
+func (f *AgingBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	var header agingHeader
+	err := binary.Read(stream, binary.BigEndian, &header)
+	if err != nil {
+		return 0, err
+	}
+	if header.M == 0 || header.K == 0 || uint64(uint(header.M)) != header.M ||
+		uint64(uint(header.K)) != header.K || header.TTL == 0 || header.TTL > 255 ||
+		header.Interval < 0 {
+		return 0, fmt.Errorf("bloom: invalid aging filter parameters m=%d k=%d ttl=%d",
+			header.M, header.K, header.TTL)
+	}
+	n := int64(binary.Size(&header))
+	cells := make([]uint8, header.M)
+	numBytes, err := io.ReadFull(stream, cells)
+	n += int64(numBytes)
+	if err != nil {
+		return n, err
+	}
+	for _, c := range cells {
+		if uint64(c) > header.TTL {
+			return n, errors.New("bloom: aging filter cell exceeds the time to live")
+		}
+	}
+	g := &AgingBloomFilter{
+		m:        uint(header.M),
+		k:        uint(header.K),
+		ttl:      uint8(header.TTL),
+		cells:    cells,
+		interval: time.Duration(header.Interval),
+		now:      f.now,
+	}
+	if g.now == nil {
+		g.now = time.Now
+	}
+	if g.interval > 0 {
+		g.last = time.Unix(0, header.Last)
+	}
+	*f = *g
+	return n, nil
+}
+
+// MarshalBinary implements binary.BinaryMarshaler interface.
+func (f *AgingBloomFilter) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := f.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements binary.BinaryUnmarshaler interface.
+func (f *AgingBloomFilter) UnmarshalBinary(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := f.ReadFrom(buf)
+
+	return err
+}
@@ -0,0 +1,119 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestAging(t *testing.T) {
+	f := NewAgingWithEstimates(100, 0.01, 3)
+	if f.TTL() != 3 || f.Cap() == 0 || f.K() == 0 {
+		t.Fatal("unexpected parameters")
+	}
+	if f.TestAndAdd([]byte("a")) {
+		t.Error("a should not be in an empty filter")
+	}
+	f.Tick().AddString("b").Tick()
+	if !f.TestString("a") || !f.TestString("b") {
+		t.Error("keys should be remembered within their time to live")
+	}
+	f.Tick()
+	if f.TestString("a") || !f.TestString("b") {
+		t.Error("keys should expire individually")
+	}
+	f.AddString("b").Tick().Tick()
+	if !f.TestString("b") {
+		t.Error("Add should renew the time to live")
+	}
+	f.ClearAll()
+	if f.TestString("b") {
+		t.Error("ClearAll should forget all keys")
+	}
+	if NewAging(10, 1, 1000).TTL() != 255 || NewAging(10, 1, 0).TTL() != 1 {
+		t.Error("the time to live should be between 1 and 255")
+	}
+}
+
+func TestAgingFalsePositives(t *testing.T) {
+	f := NewAgingWithEstimates(1000, 0.01, 2)
+	key := make([]byte, 4)
+	// Only the last 1000 keys are within their time to live.
+	for i := uint32(0); i < 5000; i++ {
+		if i%500 == 0 {
+			f.Tick()
+		}
+		binary.BigEndian.PutUint32(key, i)
+		f.Add(key)
+	}
+	fp := 0
+	for i := uint32(5000); i < 15000; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		if f.Test(key) {
+			fp++
+		}
+	}
+	if rate := float64(fp) / 10000; rate > 0.02 {
+		t.Errorf("false positive rate %f is too high", rate)
+	}
+}
+
+func TestAgingEncodeDecode(t *testing.T) {
+	now := time.Unix(1000, 0)
+	f := NewAging(1000, 4, 3)
+	f.now = func() time.Time { return now }
+	f.SetInterval(time.Minute)
+	f.AddString("a")
+	now = now.Add(150 * time.Second)
+	f.AddString("b")
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &AgingBloomFilter{now: f.now}
+	if err := g.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if g.TTL() != 3 || !g.last.Equal(f.last) || g.Interval() != time.Minute {
+		t.Error("the aging state should be preserved")
+	}
+	if !g.TestString("a") || !g.TestString("b") {
+		t.Error("the keys should be preserved")
+	}
+	now = now.Add(time.Minute)
+	if g.TestString("a") || !g.TestString("b") {
+		t.Error("ticks should resume after decoding")
+	}
+	data[23] = 0 // ttl
+	if err := g.UnmarshalBinary(data); err == nil {
+		t.Error("invalid parameters should be rejected")
+	}
+}
+
+func TestAgingTestIsReadOnly(t *testing.T) {
+	now := time.Unix(1000, 0)
+	f := NewAging(1000, 4, 3)
+	f.now = func() time.Time { return now }
+	f.SetInterval(time.Minute)
+	f.AddString("a")
+	now = now.Add(2 * time.Minute)
+	f.AddString("b")
+	now = now.Add(time.Minute)
+	before, _ := f.MarshalBinary()
+	if f.TestString("a") || !f.TestString("b") {
+		t.Error("Test should take the ticks which are due into account")
+	}
+	after, _ := f.MarshalBinary()
+	if !bytes.Equal(before, after) {
+		t.Error("Test should not modify the filter")
+	}
+	f.Expire()
+	if !f.last.Equal(now) || f.TestString("a") || !f.TestString("b") {
+		t.Error("Expire should perform the ticks which are due")
+	}
+	now = now.Add(time.Hour)
+	if f.Expire().TestString("b") {
+		t.Error("b should have expired")
+	}
+}
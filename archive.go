@@ -0,0 +1,181 @@
+package bloom
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+const (
+	archiveMagic   = 0x424c4d41 // "BLMA"
+	archiveVersion = 1
+	// archiveEntrySize is the size of an entry of the index, without its name
+	archiveEntrySize = 2 + 8 + 8
+)
+
+// errInvalidArchive is returned when the index of an archive is inconsistent
+var errInvalidArchive = errors.New("bloom: invalid archive")
+
+// WriteArchive writes named filters to an i/o stream as an archive, which
+// OpenArchive reads. The archive starts with an index of the names, in
+// increasing order, and of the offsets and sizes of the filters, followed by
+// the filters as written by WriteTo. Names are at most 65535 bytes long.
+// It returns the number of bytes written.
+//
+// An archive starts with "BLMA" and a 4-byte version, followed by the
+// number of filters in 8 bytes, and, for each filter, the length of its name
+// in 2 bytes, its name, and the offset from the start of the archive and
+// the size of the filter in 8 bytes each, all in big-endian order.
+func WriteArchive(stream io.Writer, filters map[string]*BloomFilter) (int64, error) {
+	names := make([]string, 0, len(filters))
+	offset := int64(16)
+	for name := range filters {
+		if len(name) > math.MaxUint16 {
+			return 0, fmt.Errorf("bloom: the name %.32q... is longer than %d bytes", name, math.MaxUint16)
+		}
+		names = append(names, name)
+		offset += archiveEntrySize + int64(len(name))
+	}
+	sort.Strings(names)
+	total := offset
+
+	w := bufio.NewWriter(stream)
+	var buf [16]byte
+	binary.BigEndian.PutUint32(buf[:], archiveMagic)
+	binary.BigEndian.PutUint32(buf[4:], archiveVersion)
+	binary.BigEndian.PutUint64(buf[8:], uint64(len(names)))
+	w.Write(buf[:])
+	sizes := make([]int64, len(names))
+	for i, name := range names {
+		sizes[i] = int64(filters[name].binarySize(filters[name].header()))
+		binary.BigEndian.PutUint16(buf[:], uint16(len(name)))
+		w.Write(buf[:2])
+		w.WriteString(name)
+		binary.BigEndian.PutUint64(buf[:], uint64(offset))
+		binary.BigEndian.PutUint64(buf[8:], uint64(sizes[i]))
+		w.Write(buf[:])
+		offset += sizes[i]
+	}
+	if err := w.Flush(); err != nil {
+		return 0, err
+	}
+	for i, name := range names {
+		n, err := filters[name].WriteTo(stream)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n != sizes[i] {
+			return total, fmt.Errorf("bloom: the filter %q was written in %d bytes instead of %d", name, n, sizes[i])
+		}
+	}
+	return total, nil
+}
+
+// An Archive reads the filters of an archive written by WriteArchive, one at
+// a time, as they are needed: only the index is read by OpenArchive. It is
+// safe for concurrent use if its io.ReaderAt is.
+type Archive struct {
+	r       io.ReaderAt
+	names   []string
+	entries map[string]archiveEntry
+}
+
+// archiveEntry locates a filter in an archive
+type archiveEntry struct {
+	offset, size int64
+}
+
+// OpenArchive reads the index of an archive written by WriteArchive at the
+// start of r, and returns an Archive which reads the filters from r as they
+// are needed: r may be a file, or an object in a storage service read with
+// range requests.
+func OpenArchive(r io.ReaderAt) (*Archive, error) {
+	stream := bufio.NewReader(io.NewSectionReader(r, 0, math.MaxInt64))
+	var buf [16]byte
+	if _, err := io.ReadFull(stream, buf[:]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if binary.BigEndian.Uint32(buf[:]) != archiveMagic {
+		return nil, errors.New("bloom: not an archive")
+	}
+	if binary.BigEndian.Uint32(buf[4:]) != archiveVersion {
+		return nil, errUnsupportedFormat
+	}
+	count := binary.BigEndian.Uint64(buf[8:])
+	// The index must fit before the filters, so entries are allocated as
+	// they are read, rather than for a count which may be corrupted.
+	a := &Archive{r: r, entries: make(map[string]archiveEntry)}
+	end := int64(16)
+	var name []byte
+	for i := uint64(0); i < count; i++ {
+		if _, err := io.ReadFull(stream, buf[:2]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if n := int(binary.BigEndian.Uint16(buf[:])); cap(name) < n {
+			name = make([]byte, n)
+		} else {
+			name = name[:n]
+		}
+		if _, err := io.ReadFull(stream, name); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if _, err := io.ReadFull(stream, buf[:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		e := archiveEntry{int64(binary.BigEndian.Uint64(buf[:])), int64(binary.BigEndian.Uint64(buf[8:]))}
+		key := string(name)
+		if _, ok := a.entries[key]; ok || e.offset < 0 || e.size < 0 || e.offset > math.MaxInt64-e.size ||
+			len(a.names) > 0 && key < a.names[len(a.names)-1] {
+			return nil, errInvalidArchive
+		}
+		a.names = append(a.names, key)
+		a.entries[key] = e
+		end += archiveEntrySize + int64(len(key))
+	}
+	for _, e := range a.entries {
+		if e.offset < end {
+			return nil, errInvalidArchive
+		}
+	}
+	return a, nil
+}
+
+// Names returns the names of the filters of the archive, in increasing order
+func (a *Archive) Names() []string {
+	return append([]string(nil), a.names...)
+}
+
+// Section returns the bytes of the named filter, as written by WriteTo, and
+// whether the archive holds it. The section may be read with ReadFrom, for
+// instance into a filter created with NewKeyed, or tested in place with
+// NewReaderAt.
+func (a *Archive) Section(name string) (*io.SectionReader, bool) {
+	e, ok := a.entries[name]
+	if !ok {
+		return nil, false
+	}
+	return io.NewSectionReader(a.r, e.offset, e.size), true
+}
+
+// Filter reads the named filter from the archive. Keyed filters must be read
+// from their Section instead, into a filter created with NewKeyed.
+func (a *Archive) Filter(name string) (*BloomFilter, error) {
+	section, ok := a.Section(name)
+	if !ok {
+		return nil, fmt.Errorf("bloom: no filter %q in the archive", name)
+	}
+	f := &BloomFilter{}
+	n, err := f.ReadFrom(bufio.NewReader(section))
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if n != section.Size() {
+		return nil, errInvalidArchive
+	}
+	return f, nil
+}
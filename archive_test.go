@@ -0,0 +1,86 @@
+package bloom
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"testing"
+)
+
+func TestArchive(t *testing.T) {
+	filters := map[string]*BloomFilter{
+		"":         New(64, 1),
+		"tenant-a": NewWithEstimates(1000, 0.01),
+		"tenant-b": NewWithSeed(5000, 3, 42),
+		"tenant-c": NewWithScheme(100, 4, SchemeDoubleHashing),
+	}
+	for name, f := range filters {
+		for i := 0; i < 100; i++ {
+			f.AddString(name + strconv.Itoa(i))
+		}
+	}
+	var buf bytes.Buffer
+	n, err := WriteArchive(&buf, filters)
+	if err != nil || n != int64(buf.Len()) {
+		t.Fatalf("WriteArchive: %d, %v", n, err)
+	}
+	a, err := OpenArchive(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := a.Names(); len(names) != 4 || names[0] != "" || names[3] != "tenant-c" {
+		t.Errorf("unexpected names %q", names)
+	}
+	for name, f := range filters {
+		g, err := a.Filter(name)
+		if err != nil || !g.Equal(f) {
+			t.Errorf("%q: the filter should be read back: %v", name, err)
+		}
+		section, _ := a.Section(name)
+		r, err := NewReaderAt(section)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := r.TestString(name + "1"); err != nil || !ok {
+			t.Errorf("%q: the section should be tested in place: %v", name, err)
+		}
+	}
+	if _, err := a.Filter("tenant-d"); err == nil {
+		t.Error("a missing filter should not be found")
+	}
+
+	// Only the index is read by OpenArchive, and only the words of a filter
+	// by Filter.
+	counter := &countingReaderAt{r: bytes.NewReader(buf.Bytes())}
+	if a, err = OpenArchive(counter); err != nil {
+		t.Fatal(err)
+	}
+	if counter.n > 4096+16 {
+		t.Errorf("%d bytes read to open the archive", counter.n)
+	}
+	counter.n = 0
+	if _, err := a.Filter("tenant-b"); err != nil {
+		t.Fatal(err)
+	}
+	if section, _ := a.Section("tenant-b"); int64(counter.n) != section.Size() {
+		t.Errorf("%d bytes read for a filter of %d bytes", counter.n, section.Size())
+	}
+
+	for _, size := range []int{0, 10, 30, buf.Len() - 1} {
+		a, err := OpenArchive(bytes.NewReader(buf.Bytes()[:size]))
+		if err == nil {
+			_, err = a.Filter("tenant-c")
+		}
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("truncated to %d bytes: unexpected error %v", size, err)
+		}
+	}
+	corrupted := append([]byte(nil), buf.Bytes()...)
+	corrupted[16+2+7] = 0 // the offset of the first filter, whose name is empty
+	if _, err := OpenArchive(bytes.NewReader(corrupted)); err != errInvalidArchive {
+		t.Errorf("unexpected error %v for an offset within the index", err)
+	}
+	if _, err := OpenArchive(bytes.NewReader(mustMarshal(t, New(64, 1)))); err == nil {
+		t.Error("a filter is not an archive")
+	}
+}
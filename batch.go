@@ -0,0 +1,203 @@
+package bloom
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bits-and-blooms/bitset"
+)
+
+// batchSize is the number of keys which are hashed before their locations
+// are probed by AddBatch and TestBatch.
+const batchSize = 32
+
+// parallelChunk is the number of keys which each goroutine of
+// AddBatchParallel takes at once.
+const parallelChunk = 4096
+
+// words returns the words of the bitset if they cover the m bits of the
+// filter, so that its locations can be probed without the bounds checks of
+// the bitset, or nil otherwise (e.g., for a filter created by FromWithM from
+// a short slice).
+func (f *BloomFilter) words() []uint64 {
+	words := f.b.Words()
+	if uint64(len(words))*64 < uint64(f.m) {
+		return nil
+	}
+	return words
+}
+
+// AddBatch adds several keys to the Bloom filter, as calling Add for each
+// key would. The keys are hashed in batches, before their locations are
+// set, which amortizes the cost of the calls and lets the processor fetch
+// the words of several keys at once. Returns the filter (allows chaining)
+func (f *BloomFilter) AddBatch(keys [][]byte) *BloomFilter {
+	words := f.words()
+	if words == nil {
+		for _, key := range keys {
+			f.Add(key)
+		}
+		return f
+	}
+	c := f.checkpoint
+	var h [batchSize][4]uint64
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > batchSize {
+			n = batchSize
+		}
+		for j, key := range keys[:n] {
+			h[j] = f.hashes(key)
+		}
+		for j := range h[:n] {
+			for i := uint(0); i < f.k; i++ {
+				l := f.location(h[j], i)
+				words[l/64] |= 1 << (l % 64)
+				if c != nil {
+					c.changed.Set(l / 64)
+				}
+			}
+		}
+		keys = keys[n:]
+	}
+	return f
+}
+
+// AddBatchParallel adds several keys to the Bloom filter, as AddBatch does,
+// hashing them in up to parallelism goroutines, or GOMAXPROCS if
+// parallelism is not positive. The goroutines set the bits of the filter
+// itself with atomic operations, rather than building one filter each and
+// merging them, so that no memory is allocated for the bits, which may take
+// gigabytes for large key sets. The filter must not be used by other goroutines until
+// AddBatchParallel returns. Returns the filter (allows chaining)
+func (f *BloomFilter) AddBatchParallel(keys [][]byte, parallelism int) *BloomFilter {
+	if parallelism <= 0 {
+		parallelism = runtime.GOMAXPROCS(0)
+	}
+	if chunks := (len(keys) + parallelChunk - 1) / parallelChunk; parallelism > chunks {
+		parallelism = chunks
+	}
+	words := f.words()
+	if words == nil || parallelism <= 1 {
+		return f.AddBatch(keys)
+	}
+	f.changedAll()
+	// The goroutines take the chunks of keys in turn, so that they finish at
+	// about the same time even if some keys are longer than others.
+	var next int64
+	var wg sync.WaitGroup
+	for g := 0; g < parallelism; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var h [batchSize][4]uint64
+			for {
+				start := int(atomic.AddInt64(&next, parallelChunk)) - parallelChunk
+				if start >= len(keys) {
+					return
+				}
+				chunk := keys[start:]
+				if len(chunk) > parallelChunk {
+					chunk = chunk[:parallelChunk]
+				}
+				for len(chunk) > 0 {
+					n := len(chunk)
+					if n > batchSize {
+						n = batchSize
+					}
+					for j, key := range chunk[:n] {
+						h[j] = f.hashes(key)
+					}
+					for j := range h[:n] {
+						for i := uint(0); i < f.k; i++ {
+							setBit(words, uint64(f.location(h[j], i)))
+						}
+					}
+					chunk = chunk[n:]
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return f
+}
+
+// TestBatch tests several keys against the Bloom filter: results[i] is set
+// to what Test(keys[i]) would return. Like AddBatch, the keys are hashed in
+// batches before their locations are probed. It panics if results is
+// shorter than keys.
+func (f *BloomFilter) TestBatch(keys [][]byte, results []bool) {
+	results = results[:len(keys)]
+	words := f.words()
+	if words == nil {
+		for j, key := range keys {
+			results[j] = f.Test(key)
+		}
+		return
+	}
+	var h [batchSize][4]uint64
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > batchSize {
+			n = batchSize
+		}
+		for j, key := range keys[:n] {
+			h[j] = f.hashes(key)
+		}
+		for j := range h[:n] {
+			results[j] = true
+			for i := uint(0); i < f.k; i++ {
+				l := f.location(h[j], i)
+				if words[l/64]&(1<<(l%64)) == 0 {
+					results[j] = false
+					break
+				}
+			}
+		}
+		keys = keys[n:]
+		results = results[n:]
+	}
+}
+
+// TestBatchBits tests several keys against the Bloom filter, as TestBatch
+// does, into a bitset: the ith bit of out is set if Test(keys[i]) would
+// return true, and cleared otherwise. The bitset is extended if it is
+// shorter than keys; its bits beyond len(keys) are left unchanged.
+func (f *BloomFilter) TestBatchBits(keys [][]byte, out *bitset.BitSet) {
+	var results [64]bool
+	for start := 0; start < len(keys); start += len(results) {
+		chunk := keys[start:]
+		if len(chunk) > len(results) {
+			chunk = chunk[:len(results)]
+		}
+		f.TestBatch(chunk, results[:])
+		for j, present := range results[:len(chunk)] {
+			out.SetTo(uint(start+j), present)
+		}
+	}
+}
+
+// TestAny returns true if any of the keys is in the Bloom filter, as Test
+// would return for one of them, and false otherwise, for instance when there
+// are no keys. It stops at the first key found.
+func (f *BloomFilter) TestAny(keys ...[]byte) bool {
+	for _, key := range keys {
+		if f.testHashes(f.hashes(key)) {
+			return true
+		}
+	}
+	return false
+}
+
+// TestAll returns true if all the keys are in the Bloom filter, as Test
+// would return for each of them, and false otherwise. It stops at the first
+// key which is not found, and returns true if there are no keys.
+func (f *BloomFilter) TestAll(keys ...[]byte) bool {
+	for _, key := range keys {
+		if !f.testHashes(f.hashes(key)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,146 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/bits-and-blooms/bitset"
+)
+
+func batchKeys(n, offset int) [][]byte {
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = make([]byte, 4)
+		binary.BigEndian.PutUint32(keys[i], uint32(i+offset))
+	}
+	return keys
+}
+
+func TestBatch(t *testing.T) {
+	keys := batchKeys(1000, 0)
+	others := batchKeys(1000, 1000)
+	for _, create := range []func() *BloomFilter{
+		func() *BloomFilter { return NewWithEstimates(1000, 0.01) },
+		func() *BloomFilter { return NewWithEstimatesAndSeed(1000, 0.01, 42) },
+		func() *BloomFilter { return NewFastRangeWithEstimates(1000, 0.01) },
+		func() *BloomFilter { return FromWithM(make([]uint64, 2), 1000, 4) }, // shorter than m
+	} {
+		f, g := create(), create()
+		for _, key := range keys {
+			g.Add(key)
+		}
+		f.AddBatch(keys)
+		if !f.Equal(g) {
+			t.Errorf("AddBatch should set the same bits as Add")
+		}
+		results := make([]bool, len(keys)+1)
+		f.TestBatch(others, results)
+		for i, key := range others {
+			if results[i] != f.Test(key) {
+				t.Errorf("TestBatch should return the results of Test for %v", key)
+			}
+		}
+		f.TestBatch(keys, results)
+		for i := range keys {
+			if !results[i] {
+				t.Errorf("key %d should be in the filter", i)
+			}
+		}
+	}
+}
+
+func TestAddBatchParallel(t *testing.T) {
+	keys := batchKeys(3*parallelChunk+100, 0)
+	for _, create := range []func() *BloomFilter{
+		func() *BloomFilter { return NewWithEstimates(uint(len(keys)), 0.01) },
+		func() *BloomFilter { return NewFastRangeWithEstimates(uint(len(keys)), 0.01) },
+		func() *BloomFilter { return FromWithM(make([]uint64, 2), 1000, 4) }, // shorter than m
+	} {
+		for _, parallelism := range []int{0, 1, 2, 8} {
+			f, g := create(), create()
+			f.AddBatchParallel(keys, parallelism)
+			g.AddBatch(keys)
+			if !f.Equal(g) {
+				t.Errorf("AddBatchParallel(%d) should set the same bits as AddBatch", parallelism)
+			}
+		}
+	}
+}
+
+func TestBatchBits(t *testing.T) {
+	keys := append(batchKeys(100, 0), batchKeys(100, 1000)...)
+	f := NewWithEstimates(1000, 0.01).AddBatch(keys[:100])
+	out := bitset.New(10)
+	out.Set(150) // to be cleared, unless a false positive
+	out.Set(300)
+	f.TestBatchBits(keys, out)
+	for i, key := range keys {
+		if out.Test(uint(i)) != f.Test(key) {
+			t.Errorf("bit %d should be the result of Test", i)
+		}
+	}
+	if !out.Test(300) {
+		t.Error("the bits beyond the keys should be unchanged")
+	}
+}
+
+func TestAnyAll(t *testing.T) {
+	f := NewWithEstimates(1000, 0.001).AddString("a").AddString("b")
+	a, b, c := []byte("a"), []byte("b"), []byte("c")
+	if !f.TestAny(c, b) || f.TestAny(c) || f.TestAny() {
+		t.Error("unexpected result of TestAny")
+	}
+	if !f.TestAll(a, b) || f.TestAll(a, c) || !f.TestAll() {
+		t.Error("unexpected result of TestAll")
+	}
+}
+
+func BenchmarkAddBatch(b *testing.B) {
+	keys := batchKeys(1<<16, 0)
+	b.Run("Add", func(b *testing.B) {
+		f := NewWithEstimates(1<<20, 0.01)
+		for i := 0; i < b.N; i++ {
+			f.Add(keys[i%len(keys)])
+		}
+	})
+	b.Run("AddBatch", func(b *testing.B) {
+		f := NewWithEstimates(1<<20, 0.01)
+		for i := 0; i < b.N; i += len(keys) {
+			n := len(keys)
+			if b.N-i < n {
+				n = b.N - i
+			}
+			f.AddBatch(keys[:n])
+		}
+	})
+	b.Run("AddBatchParallel", func(b *testing.B) {
+		f := NewWithEstimates(1<<20, 0.01)
+		for i := 0; i < b.N; i += len(keys) {
+			n := len(keys)
+			if b.N-i < n {
+				n = b.N - i
+			}
+			f.AddBatchParallel(keys[:n], 0)
+		}
+	})
+}
+
+func BenchmarkTestBatch(b *testing.B) {
+	keys := batchKeys(1<<16, 0)
+	f := NewWithEstimates(1<<20, 0.01).AddBatch(keys)
+	results := make([]bool, len(keys))
+	b.Run("Test", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			results[0] = f.Test(keys[i%len(keys)])
+		}
+	})
+	b.Run("TestBatch", func(b *testing.B) {
+		for i := 0; i < b.N; i += len(keys) {
+			n := len(keys)
+			if b.N-i < n {
+				n = b.N - i
+			}
+			f.TestBatch(keys[:n], results)
+		}
+	})
+}
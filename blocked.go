@@ -0,0 +1,213 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// blockWords is the number of 64-bit words of a block: 512 bits, the size of
+// a cache line on most processors.
+const blockWords = 8
+
+// A BlockedBloomFilter is a Bloom filter whose bits are grouped in blocks of
+// 512 bits, as described by Putze et al., "Cache-, Hash- and Space-Efficient
+// Bloom Filters" (2007). All _k_ locations of a key are in one block, so that
+// adding or testing a key touches a single cache line instead of _k_ random
+// ones, which makes a large filter much faster.
+//
+// Since keys are not spread evenly across blocks, the false positive rate is
+// slightly higher than that of a BloomFilter with the same _m_ and _k_; for
+// instance about 1.2% instead of 1% with the parameters of
+// NewWithEstimates(n, 0.01).
+type BlockedBloomFilter struct {
+	m     uint
+	k     uint
+	words []uint64
+}
+
+// NewBlocked creates a new blocked Bloom filter with _m_ bits, rounded up to a
+// multiple of 512, and _k_ hashing functions. We force _m_ and _k_ to be at
+// least one block and one function.
+func NewBlocked(m uint, k uint) *BlockedBloomFilter {
+	blocks := (uint64(m) + 64*blockWords - 1) / (64 * blockWords)
+	if blocks == 0 {
+		blocks = 1
+	}
+	return &BlockedBloomFilter{
+		m:     uint(blocks * 64 * blockWords),
+		k:     max(1, k),
+		words: make([]uint64, blocks*blockWords),
+	}
+}
+
+// NewBlockedWithEstimates creates a new blocked Bloom filter for about n items
+// with a false positive rate a bit higher than fp. See BlockedBloomFilter.
+func NewBlockedWithEstimates(n uint, fp float64) *BlockedBloomFilter {
+	m, k := EstimateParameters(n, fp)
+	return NewBlocked(m, k)
+}
+
+// Cap returns the capacity, _m_, of a blocked Bloom filter
+func (f *BlockedBloomFilter) Cap() uint {
+	return f.m
+}
+
+// K returns the number of hash functions used in the BlockedBloomFilter
+func (f *BlockedBloomFilter) K() uint {
+	return f.k
+}
+
+// block returns the words of the block of a key, selected by the high bits
+// of its last base hash value
+func (f *BlockedBloomFilter) block(h [4]uint64) []uint64 {
+	blocks := uint64(len(f.words) / blockWords)
+	i := (h[3] >> 32) * blocks >> 32
+	return f.words[i*blockWords : (i+1)*blockWords]
+}
+
+// Add data to the Bloom Filter. Returns the filter (allows chaining)
+func (f *BlockedBloomFilter) Add(data []byte) *BlockedBloomFilter {
+	h := baseHashes(data)
+	b := f.block(h)
+	for i := uint(0); i < f.k; i++ {
+		l := location(h, i) % (64 * blockWords)
+		b[l/64] |= 1 << (l % 64)
+	}
+	return f
+}
+
+// AddString to the Bloom Filter. Returns the filter (allows chaining)
+func (f *BlockedBloomFilter) AddString(data string) *BlockedBloomFilter {
+	return f.Add(stringToBytes(data))
+}
+
+// Test returns true if the data is in the BlockedBloomFilter, false
+// otherwise. If true, the result might be a false positive. If false, the
+// data is definitely not in the set.
+func (f *BlockedBloomFilter) Test(data []byte) bool {
+	h := baseHashes(data)
+	b := f.block(h)
+	for i := uint(0); i < f.k; i++ {
+		l := location(h, i) % (64 * blockWords)
+		if b[l/64]&(1<<(l%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// TestString returns true if the string is in the BlockedBloomFilter, false
+// otherwise. If true, the result might be a false positive. If false, the
+// data is definitely not in the set.
+func (f *BlockedBloomFilter) TestString(data string) bool {
+	return f.Test(stringToBytes(data))
+}
+
+// TestAndAdd is equivalent to calling Test(data) then Add(data).
+// Returns the result of Test.
+func (f *BlockedBloomFilter) TestAndAdd(data []byte) bool {
+	h := baseHashes(data)
+	b := f.block(h)
+	present := true
+	for i := uint(0); i < f.k; i++ {
+		l := location(h, i) % (64 * blockWords)
+		if b[l/64]&(1<<(l%64)) == 0 {
+			present = false
+			b[l/64] |= 1 << (l % 64)
+		}
+	}
+	return present
+}
+
+// Merge the data from two blocked Bloom filters.
+func (f *BlockedBloomFilter) Merge(g *BlockedBloomFilter) error {
+	if f.m != g.m {
+		return fmt.Errorf("m's don't match: %d != %d", f.m, g.m)
+	}
+	if f.k != g.k {
+		return fmt.Errorf("k's don't match: %d != %d", f.k, g.k)
+	}
+	for i, w := range g.words {
+		f.words[i] |= w
+	}
+	return nil
+}
+
+// ClearAll clears all the data in a blocked Bloom filter, removing all keys
+func (f *BlockedBloomFilter) ClearAll() *BlockedBloomFilter {
+	for i := range f.words {
+		f.words[i] = 0
+	}
+	return f
+}
+
+// Equal tests for the equality of two blocked Bloom filters
+func (f *BlockedBloomFilter) Equal(g *BlockedBloomFilter) bool {
+	if f.m != g.m || f.k != g.k {
+		return false
+	}
+	for i := range f.words {
+		if f.words[i] != g.words[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteTo writes a binary representation of the BlockedBloomFilter to an i/o
+// stream: m and k followed by the words of the filter, all as big-endian
+// 64-bit words. It returns the number of bytes written.
+func (f *BlockedBloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	err := binary.Write(stream, binary.BigEndian, [2]uint64{uint64(f.m), uint64(f.k)})
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, f.words)
+	if err != nil {
+		return 0, err
+	}
+	return int64(8 * (2 + len(f.words))), nil
+}
+
+// ReadFrom reads a binary representation of the BlockedBloomFilter (such as
+// might have been written by WriteTo()) from an i/o stream. It returns the
+// number of bytes read.
+func (f *BlockedBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	var parameters [2]uint64
+	err := binary.Read(stream, binary.BigEndian, &parameters)
+	if err != nil {
+		return 0, err
+	}
+	m, k := parameters[0], parameters[1]
+	if m == 0 || m%(64*blockWords) != 0 || uint64(uint(m)) != m || k == 0 || uint64(uint(k)) != k {
+		return 0, fmt.Errorf("bloom: invalid parameters m=%d k=%d", m, k)
+	}
+	g := NewBlocked(uint(m), uint(k))
+	err = binary.Read(stream, binary.BigEndian, g.words)
+	if err != nil {
+		return 0, err
+	}
+	*f = *g
+	return int64(8 * (2 + len(f.words))), nil
+}
+
+// MarshalBinary implements binary.BinaryMarshaler interface.
+func (f *BlockedBloomFilter) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := f.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements binary.BinaryUnmarshaler interface.
+func (f *BlockedBloomFilter) UnmarshalBinary(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := f.ReadFrom(buf)
+
+	return err
+}
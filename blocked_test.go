@@ -0,0 +1,121 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestBlockedBasic(t *testing.T) {
+	f := NewBlocked(1000, 4)
+	if f.Cap() != 1024 || f.K() != 4 {
+		t.Errorf("unexpected parameters %d %d", f.Cap(), f.K())
+	}
+	n1 := []byte("Bess")
+	n2 := []byte("Jane")
+	if f.TestAndAdd(n1) || !f.TestAndAdd(n1) || !f.Test(n1) {
+		t.Errorf("%v should be in.", n1)
+	}
+	if f.Test(n2) {
+		t.Errorf("%v should not be in.", n2)
+	}
+	f.AddString("Jane")
+	if !f.TestString("Jane") {
+		t.Errorf("%v should be in.", n2)
+	}
+	f.ClearAll()
+	if f.Test(n1) || f.Test(n2) {
+		t.Error("ClearAll should remove all keys")
+	}
+	if g := NewBlocked(0, 0); g.Cap() != 512 || g.K() != 1 {
+		t.Errorf("unexpected parameters %d %d", g.Cap(), g.K())
+	}
+}
+
+func TestBlockedSingleBlock(t *testing.T) {
+	f := NewBlocked(1<<20, 7)
+	f.AddString("key")
+	set := 0
+	for i := 0; i < len(f.words); i += blockWords {
+		for _, w := range f.words[i : i+blockWords] {
+			if w != 0 {
+				set++
+				break
+			}
+		}
+	}
+	if set != 1 {
+		t.Errorf("a key should set bits in a single block, not %d", set)
+	}
+}
+
+func TestBlockedFPP(t *testing.T) {
+	n := uint32(100000)
+	f := NewBlockedWithEstimates(uint(n), 0.01)
+	key := make([]byte, 4)
+	for i := uint32(0); i < n; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		f.Add(key)
+	}
+	for i := uint32(0); i < n; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		if !f.Test(key) {
+			t.Fatalf("key %d should be in", i)
+		}
+	}
+	positives := 0
+	for i := n; i < 2*n; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		if f.Test(key) {
+			positives++
+		}
+	}
+	if rate := float64(positives) / float64(n); rate > 0.015 {
+		t.Errorf("false positive rate %f is too high", rate)
+	}
+}
+
+func TestBlockedMergeEncodeDecode(t *testing.T) {
+	f := NewBlocked(2000, 5)
+	g := NewBlocked(2000, 5)
+	f.AddString("a")
+	g.AddString("b")
+	if err := f.Merge(g); err != nil {
+		t.Fatal(err)
+	}
+	if !f.TestString("a") || !f.TestString("b") {
+		t.Error("Merge should add the keys of the other filter")
+	}
+	if f.Merge(NewBlocked(4000, 5)) == nil || f.Merge(NewBlocked(2000, 4)) == nil {
+		t.Error("filters with different parameters should not be merged")
+	}
+
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var h BlockedBloomFilter
+	if err := h.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Equal(&h) {
+		t.Error("binary round trip changed the filter")
+	}
+	binary.BigEndian.PutUint64(data, 1000)
+	if err := h.UnmarshalBinary(data); err == nil {
+		t.Error("m should be a multiple of the block size")
+	}
+}
+
+func BenchmarkBlockedTest(b *testing.B) {
+	f := NewBlockedWithEstimates(10000000, 0.01)
+	key := make([]byte, 4)
+	for i := uint32(0); i < 10000000; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		f.Add(key)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		binary.BigEndian.PutUint32(key, uint32(i))
+		f.Test(key)
+	}
+}
@@ -38,35 +38,39 @@ for example, to add a uint32 to the filter:
 	binary.BigEndian.PutUint32(n1,i)
 	f.Add(n1)
 
-Finally, there is a method to estimate the false positive rate of a
+Finally, there is a method to compute the expected false positive rate of a
 Bloom filter with _m_ bits and _k_ hashing functions for a set of size _n_:
 
 	if bloom.EstimateFalsePositiveRate(20*n, 5, n) > 0.001 ...
 
-You can use it to validate the computed m, k parameters:
+The SimulateFalsePositiveRate function measures it instead, and you can use it
+to validate the computed m, k parameters:
 
 	m, k := bloom.EstimateParameters(n, fp)
-	ActualfpRate := bloom.EstimateFalsePositiveRate(m, k, n)
+	ActualfpRate := bloom.SimulateFalsePositiveRate(m, k, n)
 
 or
 
 	f := bloom.NewWithEstimates(n, fp)
-	ActualfpRate := bloom.EstimateFalsePositiveRate(f.m, f.k, n)
+	ActualfpRate := bloom.SimulateFalsePositiveRate(f.m, f.k, n)
 
 You would expect ActualfpRate to be close to the desired fp in these cases.
 
-The EstimateFalsePositiveRate function creates a temporary Bloom filter. It is
+The SimulateFalsePositiveRate function creates a temporary Bloom filter. It is
 also relatively expensive and only meant for validation.
 */
 package bloom
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
+	"math/bits"
 
 	"github.com/bits-and-blooms/bitset"
 )
@@ -78,6 +82,9 @@ type BloomFilter struct {
 	m uint
 	k uint
 	b *bitset.BitSet
+	hashing
+	fastRange  bool        // see NewFastRange
+	checkpoint *Checkpoint // latest checkpoint, see Checkpoint
 }
 
 func max(x, y uint) uint {
@@ -90,7 +97,7 @@ func max(x, y uint) uint {
 // New creates a new Bloom filter with _m_ bits and _k_ hashing functions
 // We force _m_ and _k_ to be at least one to avoid panics.
 func New(m uint, k uint) *BloomFilter {
-	return &BloomFilter{max(1, m), max(1, k), bitset.New(m)}
+	return &BloomFilter{m: max(1, m), k: max(1, k), b: bitset.New(m)}
 }
 
 // From creates a new Bloom filter with len(_data_) * 64 bits and _k_ hashing
@@ -103,19 +110,72 @@ func From(data []uint64, k uint) *BloomFilter {
 // FromWithM creates a new Bloom filter with _m_ length, _k_ hashing functions.
 // The data slice is not going to be reset.
 func FromWithM(data []uint64, m, k uint) *BloomFilter {
-	return &BloomFilter{m, k, bitset.From(data)}
+	return &BloomFilter{m: m, k: k, b: bitset.From(data)}
+}
+
+// FromBitSet creates a new Bloom filter with b.Len() bits and _k_ hashing
+// functions, which uses the bitset directly: the filter and the caller
+// share it, so that changes made through either are seen by the other.
+func FromBitSet(b *bitset.BitSet, k uint) *BloomFilter {
+	return FromBitSetWithM(b, b.Len(), k)
+}
+
+// FromBitSetWithM creates a new Bloom filter with _m_ length, _k_ hashing
+// functions, which uses the bitset directly, as FromBitSet does. The bitset
+// may hold more than _m_ bits, of which the filter only uses the first _m_.
+func FromBitSetWithM(b *bitset.BitSet, m, k uint) *BloomFilter {
+	return &BloomFilter{m: m, k: k, b: b}
 }
 
 // baseHashes returns the four hash values of data that are used to create k
 // hashes
 func baseHashes(data []byte) [4]uint64 {
+	return seededHashes(data, 0)
+}
+
+// seededHashes is like baseHashes, with a murmur3 seed
+func seededHashes(data []byte, seed uint64) [4]uint64 {
 	var d digest128 // murmur hashing
-	hash1, hash2, hash3, hash4 := d.sum256(data)
+	hash1, hash2, hash3, hash4 := d.sum256(data, seed)
 	return [4]uint64{
 		hash1, hash2, hash3, hash4,
 	}
 }
 
+// hashing selects the hash functions of a filter. The zero value selects
+// murmur3 with a zero seed, the original hash functions.
+type hashing struct {
+	seed   uint64         // murmur3 seed, see NewWithSeed
+	key    *sipKey        // secret SipHash key, see NewKeyed
+	scheme LocationScheme // see NewWithScheme
+}
+
+// hashes returns the four hash values of data that are used to create k
+// hashes, with the selected hash functions
+func (h hashing) hashes(data []byte) [4]uint64 {
+	if h.scheme == SchemeDoubleHashing {
+		if h.key != nil {
+			return doubleHashes(h.key.sum128(data))
+		}
+		return doubleHashes(seededHashes128(data, h.seed))
+	}
+	if h.key != nil {
+		return h.key.hashes(data)
+	}
+	return seededHashes(data, h.seed)
+}
+
+// same returns true if both select the same hash functions
+func (h hashing) same(g hashing) bool {
+	if h.scheme != g.scheme {
+		return false
+	}
+	if h.key == nil || g.key == nil {
+		return h.key == g.key && h.seed == g.seed
+	}
+	return *h.key == *g.key
+}
+
 // location returns the ith hashed location using the four base hash values
 func location(h [4]uint64, i uint) uint64 {
 	ii := uint64(i)
@@ -124,18 +184,69 @@ func location(h [4]uint64, i uint) uint64 {
 
 // location returns the ith hashed location using the four base hash values
 func (f *BloomFilter) location(h [4]uint64, i uint) uint {
-	return uint(location(h, i) % uint64(f.m))
+	return f.reduce(location(h, i))
+}
+
+// reduce maps a hashed location to one of the m bits of the filter. When m
+// is a power of two, the modulo is a mask, which avoids a division.
+func (f *BloomFilter) reduce(l uint64) uint {
+	if f.fastRange {
+		return uint(fastRange(l, uint64(f.m)))
+	}
+	if f.m&(f.m-1) == 0 {
+		return uint(l & uint64(f.m-1))
+	}
+	return uint(l % uint64(f.m))
+}
+
+// fastRange maps x to [0, m) with a multiplication and a shift instead of a
+// modulo, see https://lemire.me/blog/2016/06/27/a-fast-alternative-to-the-modulo-reduction/
+// It uses the high bits of x, rather than the low ones.
+func fastRange(x, m uint64) uint64 {
+	hi, _ := bits.Mul64(x, m)
+	return hi
 }
 
 // EstimateParameters estimates requirements for m and k.
 // Based on https://bitbucket.org/ww/bloom/src/829aa19d01d9/bloom.go
 // used with permission.
+//
+// If the estimated m does not fit in a uint, as may happen on 32-bit
+// platforms, m is the largest multiple of 64 which does, and k is optimal for
+// that m: the false positive rate of the filter is then higher than p.
 func EstimateParameters(n uint, p float64) (m uint, k uint) {
-	m = uint(math.Ceil(-1 * float64(n) * math.Log(p) / math.Pow(math.Log(2), 2)))
+	bits := math.Ceil(-1 * float64(n) * math.Log(p) / math.Pow(math.Log(2), 2))
+	if bits >= float64(^uint(0)) {
+		m = ^uint(0) &^ 63
+	} else {
+		m = uint(bits)
+	}
 	k = uint(math.Ceil(math.Log(2) * float64(m) / float64(n)))
 	return
 }
 
+// EstimateParameters64 is like EstimateParameters with a 64-bit number of
+// items and of bits, for filters of more than 4 Gbits on 32-bit platforms,
+// see NewSegmented64. Like m, k saturates instead of overflowing, and it is
+// at least one.
+func EstimateParameters64(n uint64, p float64) (m uint64, k uint) {
+	bits := math.Ceil(-1 * float64(n) * math.Log(p) / math.Pow(math.Log(2), 2))
+	if bits >= math.MaxUint64 {
+		m = math.MaxUint64 &^ 63
+	} else {
+		m = uint64(bits)
+	}
+	switch hashes := math.Ceil(math.Log(2) * float64(m) / float64(n)); {
+	case hashes >= float64(^uint(0)):
+		k = ^uint(0)
+	case hashes >= 1:
+		k = uint(hashes)
+	default: // no items
+		k = 1
+	}
+	return
+}
+
 // NewWithEstimates creates a new Bloom filter for about n items with fp
 // false positive rate
 func NewWithEstimates(n uint, fp float64) *BloomFilter {
@@ -143,6 +254,140 @@ func NewWithEstimates(n uint, fp float64) *BloomFilter {
 	return New(m, k)
 }
 
+// EstimateParametersForBudget returns the parameters of the most accurate
+// filter for about n items whose bitset takes at most maxBytes bytes: m is
+// the largest multiple of 64 bits fitting the budget (but at least 64), and
+// k is the optimal number of hash functions for m and n. It also returns
+// the expected false positive rate of the filter, see
+// EstimateFalsePositiveRate.
+func EstimateParametersForBudget(maxBytes uint, n uint) (m uint, k uint, fp float64) {
+	m = maxBytes / 8 * 64
+	if m/64 != maxBytes/8 { // overflow
+		m = ^uint(0) &^ 63
+	}
+	m = max(64, m)
+	if n == 0 {
+		return m, 1, 0
+	}
+	k = optimalHashes(m, n)
+	return m, k, EstimateFalsePositiveRate(m, k, n)
+}
+
+// NewWithMemoryBudget creates a new Bloom filter for about n items whose
+// bitset takes at most maxBytes bytes, with the parameters of
+// EstimateParametersForBudget. It returns the filter and its expected false
+// positive rate with n items.
+func NewWithMemoryBudget(maxBytes uint, n uint) (*BloomFilter, float64) {
+	m, k, fp := EstimateParametersForBudget(maxBytes, n)
+	return New(m, k), fp
+}
+
+// roundUpPow2 returns the smallest power of two which is at least m, or the
+// largest power of two if there is none.
+func roundUpPow2(m uint) uint {
+	p := uint(1)
+	for p < m && p<<1 != 0 {
+		p <<= 1
+	}
+	return p
+}
+
+// EstimateParametersPow2 is like EstimateParameters, with m rounded up to a
+// power of two, and k adjusted to the larger m. The false positive rate is
+// thus at most p, and usually lower.
+func EstimateParametersPow2(n uint, p float64) (m uint, k uint) {
+	m, _ = EstimateParameters(n, p)
+	m = roundUpPow2(m)
+	k = uint(math.Ceil(math.Log(2) * float64(m) / float64(max(1, n))))
+	return
+}
+
+// NewPow2 creates a new Bloom filter with _m_ bits, rounded up to a power of
+// two, and _k_ hashing functions. The locations of the keys are then
+// computed with a bitmask instead of a modulo, which saves a division per
+// location, at the cost of up to twice as many bits. Any filter whose m is a
+// power of two benefits from this, so the filter is otherwise a regular
+// filter, with the same serialization.
+func NewPow2(m uint, k uint) *BloomFilter {
+	return New(roundUpPow2(m), k)
+}
+
+// NewPow2WithEstimates creates a new Bloom filter for about n items with fp
+// false positive rate, with a power of two bits. See NewPow2.
+func NewPow2WithEstimates(n uint, fp float64) *BloomFilter {
+	m, k := EstimateParametersPow2(n, fp)
+	return New(m, k)
+}
+
+// NewFastRange creates a new Bloom filter with _m_ bits and _k_ hashing
+// functions which maps the hashed locations to its bits with Lemire's
+// multiply-shift reduction instead of a modulo. This saves a division per
+// location, like NewPow2, without rounding m up. The same keys set other bits
+// than in a filter created with New, so the mapping is recorded when the
+// filter is serialized, and such filters can only be merged with each other.
+// WriteCHeader does not support them.
+func NewFastRange(m uint, k uint) *BloomFilter {
+	f := New(m, k)
+	f.fastRange = true
+	return f
+}
+
+// NewFastRangeWithEstimates creates a new Bloom filter for about n items with
+// fp false positive rate, with the fast range reduction. See NewFastRange.
+func NewFastRangeWithEstimates(n uint, fp float64) *BloomFilter {
+	m, k := EstimateParameters(n, fp)
+	return NewFastRange(m, k)
+}
+
+// NewWithSeed creates a new Bloom filter with _m_ bits and _k_ hashing
+// functions which hashes data with murmur3 and the given seed, instead of a
+// zero seed. Filters with different seeds set unrelated bits for the same
+// keys, so that their false positives are independent, e.g., when several
+// filters over the same keys are stacked. Filters with a zero seed are
+// equivalent to those created by New.
+func NewWithSeed(m uint, k uint, seed uint64) *BloomFilter {
+	f := New(m, k)
+	f.seed = seed
+	return f
+}
+
+// NewWithEstimatesAndSeed creates a new Bloom filter for about n items with
+// fp false positive rate, hashing data with the given seed. See NewWithSeed.
+func NewWithEstimatesAndSeed(n uint, fp float64, seed uint64) *BloomFilter {
+	m, k := EstimateParameters(n, fp)
+	return NewWithSeed(m, k, seed)
+}
+
+// Seed returns the murmur3 seed of the filter, zero by default
+func (f *BloomFilter) Seed() uint64 {
+	return f.seed
+}
+
+// NewKeyed creates a new Bloom filter with _m_ bits and _k_ hashing functions
+// which hashes data with SipHash-2-4 and a secret 128-bit key, instead of
+// murmur3. Murmur3 is not meant to resist attacks: someone who controls the
+// keys added to, or tested against, a filter can craft keys that collide and
+// thus force false positives. Without the secret key, they cannot. The key
+// should come from a cryptographically secure source, such as crypto/rand.
+// Keyed filters are a bit slower.
+//
+// The key is not part of the serialized filter: ReadFrom and the other
+// decoding methods only accept a keyed filter if they are called on a filter
+// created with NewKeyed, whose key is kept. Locations, TestSerialized and
+// WriteCHeader, which assume murmur3, do not support keyed filters.
+func NewKeyed(m uint, k uint, key [16]byte) *BloomFilter {
+	f := New(m, k)
+	f.key = newSipKey(key)
+	return f
+}
+
+// NewKeyedWithEstimates creates a new keyed Bloom filter for about n items
+// with fp false positive rate. See NewKeyed.
+func NewKeyedWithEstimates(n uint, fp float64, key [16]byte) *BloomFilter {
+	m, k := EstimateParameters(n, fp)
+	return NewKeyed(m, k, key)
+}
+
 // Cap returns the capacity, _m_, of a Bloom filter
 func (f *BloomFilter) Cap() uint {
 	return f.m
@@ -158,47 +403,135 @@ func (f *BloomFilter) BitSet() *bitset.BitSet {
 	return f.b
 }
 
+// NextSet returns the first location of the filter from i on whose bit is
+// set, and true, or false if there is none. The set bits can be listed with
+//
+//	for i, ok := f.NextSet(0); ok; i, ok = f.NextSet(i + 1) {
+//		...
+//	}
+func (f *BloomFilter) NextSet(i uint) (uint, bool) {
+	return f.b.NextSet(i)
+}
+
 // Add data to the Bloom Filter. Returns the filter (allows chaining)
 func (f *BloomFilter) Add(data []byte) *BloomFilter {
-	h := baseHashes(data)
+	h := f.hashes(data)
 	for i := uint(0); i < f.k; i++ {
-		f.b.Set(f.location(h, i))
+		f.set(f.location(h, i))
 	}
 	return f
 }
 
-// Merge the data from two Bloom Filters.
-func (f *BloomFilter) Merge(g *BloomFilter) error {
+// set sets a bit of the filter, recording its word as changed since the
+// latest checkpoint
+func (f *BloomFilter) set(l uint) {
+	f.b.Set(l)
+	if f.checkpoint != nil {
+		f.checkpoint.changed.Set(l / 64)
+	}
+}
+
+// changedAll records all the words of the filter as possibly changed since
+// the latest checkpoint
+func (f *BloomFilter) changedAll() {
+	if f.checkpoint != nil {
+		f.checkpoint.all = true
+	}
+}
+
+// compatible returns an error unless both filters set the same bits for the
+// same keys, so that their bitsets can be combined.
+func (f *BloomFilter) compatible(g *BloomFilter) error {
 	// Make sure the m's and k's are the same, otherwise merging has no real use.
 	if f.m != g.m {
 		return fmt.Errorf("m's don't match: %d != %d", f.m, g.m)
 	}
 
 	if f.k != g.k {
-		return fmt.Errorf("k's don't match: %d != %d", f.m, g.m)
+		return fmt.Errorf("k's don't match: %d != %d", f.k, g.k)
+	}
+
+	if err := f.Fingerprint().mismatch(g.Fingerprint()); err != nil {
+		return err
 	}
 
+	if !f.hashing.same(g.hashing) {
+		return errors.New("SipHash keys don't match")
+	}
+	return nil
+}
+
+// Merge the data from two Bloom Filters.
+func (f *BloomFilter) Merge(g *BloomFilter) error {
+	err := f.compatible(g)
+	if err != nil {
+		return err
+	}
+
+	f.changedAll()
 	f.b.InPlaceUnion(g.b)
 	return nil
 }
 
+// Intersect keeps only the bits set in both Bloom filters, which must have
+// the same m, k and hash functions, as for Merge. The result holds every key
+// of both filters, so it approximates their intersection without false
+// negatives. But it has more false positives than a filter holding only the
+// common keys: a bit may be set by different keys in each filter, and keys
+// of only one of the filters usually remain positive. ApproximatedSize thus
+// overestimates the size of the intersection.
+func (f *BloomFilter) Intersect(g *BloomFilter) error {
+	err := f.compatible(g)
+	if err != nil {
+		return err
+	}
+
+	f.changedAll()
+	f.b.InPlaceIntersection(g.b)
+	return nil
+}
+
+// Union returns a new Bloom filter holding the keys of both filters, which
+// must have the same m, k and hash functions, as for Merge. The filters are
+// not modified.
+func Union(a, b *BloomFilter) (*BloomFilter, error) {
+	err := a.compatible(b)
+	if err != nil {
+		return nil, err
+	}
+	return &BloomFilter{m: a.m, k: a.k, b: a.b.Union(b.b), hashing: a.hashing, fastRange: a.fastRange}, nil
+}
+
+// Intersection returns a new Bloom filter holding the bits set in both
+// filters, which must have the same m, k and hash functions. See Intersect
+// for the false positives of the result. The filters are not modified.
+func Intersection(a, b *BloomFilter) (*BloomFilter, error) {
+	err := a.compatible(b)
+	if err != nil {
+		return nil, err
+	}
+	return &BloomFilter{m: a.m, k: a.k, b: a.b.Intersection(b.b), hashing: a.hashing, fastRange: a.fastRange}, nil
+}
+
 // Copy creates a copy of a Bloom filter.
 func (f *BloomFilter) Copy() *BloomFilter {
 	fc := New(f.m, f.k)
+	fc.hashing = f.hashing
+	fc.fastRange = f.fastRange
 	fc.Merge(f) // #nosec
 	return fc
 }
 
 // AddString to the Bloom Filter. Returns the filter (allows chaining)
 func (f *BloomFilter) AddString(data string) *BloomFilter {
-	return f.Add([]byte(data))
+	return f.Add(stringToBytes(data))
 }
 
 // Test returns true if the data is in the BloomFilter, false otherwise.
 // If true, the result might be a false positive. If false, the data
 // is definitely not in the set.
 func (f *BloomFilter) Test(data []byte) bool {
-	h := baseHashes(data)
+	h := f.hashes(data)
 	for i := uint(0); i < f.k; i++ {
 		if !f.b.Test(f.location(h, i)) {
 			return false
@@ -211,14 +544,110 @@ func (f *BloomFilter) Test(data []byte) bool {
 // If true, the result might be a false positive. If false, the data
 // is definitely not in the set.
 func (f *BloomFilter) TestString(data string) bool {
-	return f.Test([]byte(data))
+	return f.Test(stringToBytes(data))
+}
+
+// TestAtMost is like Test but only checks the first j of the k locations,
+// trading accuracy for latency. If false, the data is definitely not in the
+// set. If true, the result is a false positive with a probability of about
+// (1 - exp(-k*n/m))^j instead of (1 - exp(-k*n/m))^k for a filter holding n
+// items, so it is meant as a first-stage check when a second, exact check
+// is cheap. If j is at least k, TestAtMost is equivalent to Test.
+func (f *BloomFilter) TestAtMost(data []byte, j uint) bool {
+	if j > f.k {
+		j = f.k
+	}
+	h := f.hashes(data)
+	for i := uint(0); i < j; i++ {
+		if !f.b.Test(f.location(h, i)) {
+			return false
+		}
+	}
+	return true
 }
 
 // TestLocations returns true if all locations are set in the BloomFilter, false
 // otherwise.
 func (f *BloomFilter) TestLocations(locs []uint64) bool {
 	for i := 0; i < len(locs); i++ {
-		if !f.b.Test(uint(locs[i] % uint64(f.m))) {
+		if !f.b.Test(f.reduce(locs[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// AddLocations sets all the locations in the BloomFilter, as Add does for the
+// locations of a key, see Locations. Returns the filter (allows chaining)
+func (f *BloomFilter) AddLocations(locs []uint64) *BloomFilter {
+	for _, l := range locs {
+		f.set(f.reduce(l))
+	}
+	return f
+}
+
+// TestAndAddLocations is equivalent to calling TestLocations(locs) then
+// AddLocations(locs). The filter is written to unconditionally, as with
+// TestAndAdd. Returns the result of TestLocations.
+func (f *BloomFilter) TestAndAddLocations(locs []uint64) bool {
+	present := true
+	for _, l := range locs {
+		r := f.reduce(l)
+		if !f.b.Test(r) {
+			present = false
+		}
+		f.set(r)
+	}
+	return present
+}
+
+// TestOrAddLocations is equivalent to calling TestLocations(locs) then if
+// not present AddLocations(locs). If the locations are all set, then the
+// filter is unchanged. Returns the result of TestLocations.
+func (f *BloomFilter) TestOrAddLocations(locs []uint64) bool {
+	present := true
+	for _, l := range locs {
+		r := f.reduce(l)
+		if !f.b.Test(r) {
+			present = false
+			f.set(r)
+		}
+	}
+	return present
+}
+
+// TestAcross tests the data against several filters, hashing it only once
+// per group of filters with the same hash functions (see NewWithSeed,
+// NewKeyed and NewWithScheme), when the first filter of the group is tested.
+// The ith result is true if the data is in the ith filter, with the same
+// semantics as Test. It is meant for loops pruning many segments with the
+// same key.
+func TestAcross(data []byte, filters []*BloomFilter) []bool {
+	results := make([]bool, len(filters))
+	// Filters rarely use more than a few hash functions, so the groups are
+	// searched linearly, in arrays which do not escape.
+	var groupsArray [4]hashing
+	var hashesArray [4][4]uint64
+	groups, hashes := groupsArray[:0], hashesArray[:0]
+	for j, f := range filters {
+		i := 0
+		for i < len(groups) && !groups[i].same(f.hashing) {
+			i++
+		}
+		if i == len(groups) {
+			groups = append(groups, f.hashing)
+			hashes = append(hashes, f.hashes(data))
+		}
+		results[j] = f.testHashes(hashes[i])
+	}
+	return results
+}
+
+// testHashes returns true if all the locations derived from the four base
+// hash values are set.
+func (f *BloomFilter) testHashes(h [4]uint64) bool {
+	for i := uint(0); i < f.k; i++ {
+		if !f.b.Test(f.location(h, i)) {
 			return false
 		}
 	}
@@ -231,13 +660,13 @@ func (f *BloomFilter) TestLocations(locs []uint64) bool {
 // Returns the result of Test.
 func (f *BloomFilter) TestAndAdd(data []byte) bool {
 	present := true
-	h := baseHashes(data)
+	h := f.hashes(data)
 	for i := uint(0); i < f.k; i++ {
 		l := f.location(h, i)
 		if !f.b.Test(l) {
 			present = false
 		}
-		f.b.Set(l)
+		f.set(l)
 	}
 	return present
 }
@@ -247,7 +676,7 @@ func (f *BloomFilter) TestAndAdd(data []byte) bool {
 // the corresponding bits are still set. See also TestOrAdd.
 // Returns the result of Test.
 func (f *BloomFilter) TestAndAddString(data string) bool {
-	return f.TestAndAdd([]byte(data))
+	return f.TestAndAdd(stringToBytes(data))
 }
 
 // TestOrAdd is equivalent to calling Test(data) then if not present Add(data).
@@ -255,12 +684,12 @@ func (f *BloomFilter) TestAndAddString(data string) bool {
 // Returns the result of Test.
 func (f *BloomFilter) TestOrAdd(data []byte) bool {
 	present := true
-	h := baseHashes(data)
+	h := f.hashes(data)
 	for i := uint(0); i < f.k; i++ {
 		l := f.location(h, i)
 		if !f.b.Test(l) {
 			present = false
-			f.b.Set(l)
+			f.set(l)
 		}
 	}
 	return present
@@ -270,23 +699,96 @@ func (f *BloomFilter) TestOrAdd(data []byte) bool {
 // If the string is already in the filter, then the filter is unchanged.
 // Returns the result of Test.
 func (f *BloomFilter) TestOrAddString(data string) bool {
-	return f.TestOrAdd([]byte(data))
+	return f.TestOrAdd(stringToBytes(data))
 }
 
 // ClearAll clears all the data in a Bloom filter, removing all keys
 func (f *BloomFilter) ClearAll() *BloomFilter {
+	f.changedAll()
 	f.b.ClearAll()
 	return f
 }
 
-// EstimateFalsePositiveRate returns, for a BloomFilter of m bits
+// Reset clears the filter and gives it _m_ bits and _k_ hashing functions,
+// as New would, reusing the words of its bitset when they can hold _m_ bits:
+// new words are only allocated to grow the filter. The seed, key, location
+// scheme and fast range reduction of the filter are kept. This lets filters
+// of varying sizes be recycled, for instance with a sync.Pool:
+//
+//	var filters = sync.Pool{New: func() interface{} { return bloom.New(1, 1) }}
+//
+//	f := filters.Get().(*bloom.BloomFilter).Reset(m, k)
+//	defer filters.Put(f)
+//
+// As with ClearAll, a bitset shared with the filter, as with FromBitSet or
+// UnmarshalBinaryZeroCopy, is cleared, and it is resized in place.
+func (f *BloomFilter) Reset(m uint, k uint) *BloomFilter {
+	m, k = max(1, m), max(1, k)
+	f.changedAll()
+	if f.b == nil || uint64(cap(f.b.Words()))*64 < uint64(m) {
+		f.b = bitset.New(m)
+	} else {
+		words := f.b.Words()
+		n := int((uint64(m) + 63) / 64)
+		// The words beyond the length of a bitset must stay zero, since
+		// it extends itself over them.
+		used := words[:cap(words)][:max(uint(n), uint(len(words)))]
+		for i := range used {
+			used[i] = 0
+		}
+		*f.b = *bitset.FromWithLength(m, words[:n])
+	}
+	f.m, f.k = m, k
+	return f
+}
+
+// EstimateFalsePositiveRate returns, for a BloomFilter of m bits and k hash
+// functions, the expected false positive rate when storing n entries:
+// (1 - exp(-k*n/m))^k. It is computed in constant time, so it may be used to
+// plan the parameters of filters. See SimulateFalsePositiveRate to measure
+// the rate of the implementation instead.
+func EstimateFalsePositiveRate(m, k, n uint) (fpRate float64) {
+	m, k = max(1, m), max(1, k)
+	return math.Pow(1-math.Exp(-float64(k)*float64(n)/float64(m)), float64(k))
+}
+
+// EstimateMaxCapacity returns, for a BloomFilter of m bits and k hash
+// functions, the largest number of entries it can store while keeping an
+// expected false positive rate of at most p, as EstimateFalsePositiveRate
+// computes it: -m/k * ln(1 - p^(1/k)). It returns 0 if p is not positive.
+func EstimateMaxCapacity(m, k uint, p float64) uint {
+	m, k = max(1, m), max(1, k)
+	return capacityFrom(0, m, k, p)
+}
+
+// capacityFrom returns the number of entries which a filter of m bits and k
+// hash functions with a fill ratio r can store while keeping a false positive
+// rate of at most p. Each entry leaves a bit unset with probability
+// exp(-k/m), so the fill ratio reaches p^(1/k) after
+// m/k * ln((1-r) / (1-p^(1/k))) entries.
+func capacityFrom(r float64, m, k uint, p float64) uint {
+	if !(p > 0) {
+		return 0
+	}
+	target := math.Pow(p, 1/float64(k))
+	if r >= target {
+		return 0
+	}
+	n := math.Floor(float64(m) / float64(k) * math.Log((1-r)/(1-target)))
+	if n >= float64(^uint(0)) {
+		return ^uint(0)
+	}
+	return uint(n)
+}
+
+// SimulateFalsePositiveRate returns, for a BloomFilter of m bits
 // and k hash functions, an estimation of the false positive rate when
 //
 //	storing n entries. This is an empirical, relatively slow
 //
 // test using integers as keys.
 // This function is useful to validate the implementation.
-func EstimateFalsePositiveRate(m, k, n uint) (fpRate float64) {
+func SimulateFalsePositiveRate(m, k, n uint) (fpRate float64) {
 	rounds := uint32(100000)
 	// We construct a new filter.
 	f := New(m, k)
@@ -310,24 +812,96 @@ func EstimateFalsePositiveRate(m, k, n uint) (fpRate float64) {
 
 // Approximating the number of items
 // https://en.wikipedia.org/wiki/Bloom_filter#Approximating_the_number_of_items_in_a_Bloom_filter
+// The estimate is capped at math.MaxUint32, which it reaches when all the
+// bits are set.
 func (f *BloomFilter) ApproximatedSize() uint32 {
-	x := float64(f.b.Count())
-	m := float64(f.Cap())
-	k := float64(f.K())
-	size := -1 * m / k * math.Log(1-x/m) / math.Log(math.E)
+	size := f.ApproximatedSizeFloat()
+	if size >= math.MaxUint32 {
+		return math.MaxUint32
+	}
 	return uint32(math.Floor(size + 0.5)) // round
 }
 
+// ApproximatedSizeFloat returns the estimate of ApproximatedSize, before it
+// is rounded. It is +Inf when all the bits are set.
+func (f *BloomFilter) ApproximatedSizeFloat() float64 {
+	size, _ := approximatedSize(f.b.Count(), f.m, f.k)
+	return size
+}
+
+// ApproximatedSizeInterval returns a confidence interval of the number of
+// items, at the given confidence level, such as 0.95. It is the estimate of
+// ApproximatedSizeFloat plus or minus a multiple of its standard deviation,
+// which comes from the variance of the number of bits set by that many
+// items. The interval is narrow for filters about half full, and widens as
+// the filter fills up: when all the bits are set, its upper bound is +Inf.
+func (f *BloomFilter) ApproximatedSizeInterval(confidence float64) (low, high float64) {
+	z := math.Sqrt2 * math.Erfinv(confidence)
+	x := f.b.Count()
+	if x >= f.m {
+		// The lower bound is the one of a filter with one bit unset.
+		size, sd := approximatedSize(f.m-1, f.m, f.k)
+		return math.Max(0, size-z*sd), math.Inf(1)
+	}
+	size, sd := approximatedSize(x, f.m, f.k)
+	return math.Max(0, size-z*sd), size + z*sd
+}
+
+// approximatedSize returns the estimate of the number of items of a filter
+// of m bits and k hash functions with x bits set, and its standard
+// deviation. The number of bits set by n items has a variance of
+// m*q*(1-(1+k*n/m)*q), where q = exp(-k*n/m) is the probability that a bit
+// is unset, and the estimate a derivative of 1/(k*q) in x.
+func approximatedSize(x, m, k uint) (size, sd float64) {
+	fm, fk := float64(m), float64(k)
+	q := 1 - float64(x)/fm
+	size = -1 * fm / fk * math.Log(q)
+	variance := fm * q * (1 - (1+fk*size/fm)*q)
+	return size, math.Sqrt(math.Max(0, variance)) / (fk * q)
+}
+
+// FillRatio returns the fraction of the bits of the filter which are set.
+// A filter holding as many keys as it was sized for with NewWithEstimates
+// has about half of its bits set; a higher ratio means it is overloaded.
+func (f *BloomFilter) FillRatio() float64 {
+	return float64(f.b.Count()) / float64(f.m)
+}
+
+// CurrentFalsePositiveRate returns the false positive rate of the filter
+// with the keys it holds, FillRatio()^k: the probability that the k
+// locations of a key which was not added are all set. Unlike the rate the
+// filter was sized for, it grows as keys are added, so it can be monitored
+// to detect overloaded filters.
+func (f *BloomFilter) CurrentFalsePositiveRate() float64 {
+	return math.Pow(f.FillRatio(), float64(f.k))
+}
+
+// RemainingCapacity returns the number of new keys which may be added to the
+// filter before its false positive rate, see CurrentFalsePositiveRate,
+// exceeds p. It is computed from the fill ratio of the filter, rather than a
+// count of the keys added, so it takes duplicates and merged filters into
+// account, and can tell when to rotate a filter. It is 0 once the rate is
+// above p.
+func (f *BloomFilter) RemainingCapacity(p float64) uint {
+	return capacityFrom(f.FillRatio(), f.m, f.k, p)
+}
+
 // bloomFilterJSON is an unexported type for marshaling/unmarshaling BloomFilter struct.
 type bloomFilterJSON struct {
-	M uint           `json:"m"`
-	K uint           `json:"k"`
-	B *bitset.BitSet `json:"b"`
+	M         uint           `json:"m"`
+	K         uint           `json:"k"`
+	B         *bitset.BitSet `json:"b"`
+	Seed      uint64         `json:"seed,omitempty"`
+	Keyed     bool           `json:"keyed,omitempty"`
+	FastRange bool           `json:"fastrange,omitempty"`
+	Scheme    LocationScheme `json:"scheme,omitempty"`
 }
 
-// MarshalJSON implements json.Marshaler interface.
+// MarshalJSON implements json.Marshaler interface. The bitset is marshaled as
+// a single base64 string of its binary representation, so the JSON is about
+// 4/3 the size of the output of WriteTo.
 func (f BloomFilter) MarshalJSON() ([]byte, error) {
-	return json.Marshal(bloomFilterJSON{f.m, f.k, f.b})
+	return json.Marshal(bloomFilterJSON{f.m, f.k, f.b, f.seed, f.key != nil, f.fastRange, f.scheme})
 }
 
 // UnmarshalJSON implements json.Unmarshaler interface.
@@ -337,14 +911,23 @@ func (f *BloomFilter) UnmarshalJSON(data []byte) error {
 	if err != nil {
 		return err
 	}
+	err = f.checkKeyed(j.Keyed)
+	if err != nil {
+		return err
+	}
+	f.changedAll()
 	f.m = j.M
 	f.k = j.K
 	f.b = j.B
+	f.seed = j.Seed
+	f.fastRange = j.FastRange
+	f.scheme = j.Scheme
 	return nil
 }
 
 // WriteTo writes a binary representation of the BloomFilter to an i/o stream.
-// It returns the number of bytes written.
+// The bitset is written in chunks of 1 KB, so no buffer of the size of the
+// filter is allocated. It returns the number of bytes written.
 //
 // Performance: if this function is used to write to a disk or network
 // connection, it might be beneficial to wrap the stream in a bufio.Writer.
@@ -353,21 +936,19 @@ func (f *BloomFilter) UnmarshalJSON(data []byte) error {
 //	      f, err := os.Create("myfile")
 //		       w := bufio.NewWriter(f)
 func (f *BloomFilter) WriteTo(stream io.Writer) (int64, error) {
-	err := binary.Write(stream, binary.BigEndian, uint64(f.m))
-	if err != nil {
-		return 0, err
-	}
-	err = binary.Write(stream, binary.BigEndian, uint64(f.k))
+	n, err := f.header().writeTo(stream)
 	if err != nil {
 		return 0, err
 	}
 	numBytes, err := f.b.WriteTo(stream)
-	return numBytes + int64(2*binary.Size(uint64(0))), err
+	return numBytes + n, err
 }
 
 // ReadFrom reads a binary representation of the BloomFilter (such as might
-// have been written by WriteTo()) from an i/o stream. It returns the number
-// of bytes read.
+// have been written by WriteTo(), WriteEncodedTo() or WriteFramedTo()) from
+// an i/o stream. It returns the number of bytes read. On 32-bit platforms,
+// filters of more than 4 Gbits cannot be read: SegmentedBloomFilter.ReadFrom
+// reads raw ones.
 //
 // Performance: if this function is used to read from a disk or network
 // connection, it might be beneficial to wrap the stream in a bufio.Reader.
@@ -375,31 +956,64 @@ func (f *BloomFilter) WriteTo(stream io.Writer) (int64, error) {
 //
 //	f, err := os.Open("myfile")
 //	r := bufio.NewReader(f)
+//
+// Use ReadFromLimited to read filters from untrusted sources.
 func (f *BloomFilter) ReadFrom(stream io.Reader) (int64, error) {
-	var m, k uint64
-	err := binary.Read(stream, binary.BigEndian, &m)
+	return f.readFrom(stream, false, 0)
+}
+
+// readFrom reads a filter like ReadFrom. If limited, the header and the
+// length of the bitset are checked as ReadFromLimited documents.
+func (f *BloomFilter) readFrom(stream io.Reader, limited bool, maxBits uint64) (int64, error) {
+	h, n, err := readHeader(stream)
 	if err != nil {
 		return 0, err
 	}
-	err = binary.Read(stream, binary.BigEndian, &k)
+	if !h.fitsUint() {
+		return 0, errTooLarge
+	}
+	err = f.checkKeyed(h.keyed)
 	if err != nil {
 		return 0, err
 	}
-	b := &bitset.BitSet{}
-	numBytes, err := b.ReadFrom(stream)
+	l := noLimit
+	if limited {
+		l, err = h.limit(maxBits)
+		if err != nil {
+			return 0, err
+		}
+	}
+	b, numBytes, err := readPayload(stream, h, l)
 	if err != nil {
 		return 0, err
 	}
-	f.m = uint(m)
-	f.k = uint(k)
+	f.changedAll()
+	f.m = uint(h.m)
+	f.k = uint(h.k)
 	f.b = b
-	return numBytes + int64(2*binary.Size(uint64(0))), nil
+	f.seed = h.seed
+	f.fastRange = h.fastRange
+	f.scheme = h.scheme
+	return numBytes + n, nil
+}
+
+// checkKeyed returns an error unless a serialized filter, keyed or not, can
+// be decoded into the filter: keyed filters need the key of the filter, and
+// the key of the filter must not be dropped silently.
+func (f *BloomFilter) checkKeyed(keyed bool) error {
+	if keyed && f.key == nil {
+		return errors.New("bloom: a keyed filter can only be decoded into a filter created with NewKeyed")
+	}
+	if !keyed && f.key != nil {
+		return errors.New("bloom: the serialized filter is not keyed")
+	}
+	return nil
 }
 
 // GobEncode implements gob.GobEncoder interface.
 func (f *BloomFilter) GobEncode() ([]byte, error) {
-	var buf bytes.Buffer
-	_, err := f.WriteTo(&buf)
+	buf := bytes.NewBuffer(make([]byte, 0, f.binarySize(f.header())))
+	_, err := f.WriteTo(buf)
 	if err != nil {
 		return nil, err
 	}
@@ -415,10 +1029,20 @@ func (f *BloomFilter) GobDecode(data []byte) error {
 	return err
 }
 
+// binarySize returns the number of bytes of the filter serialized with the
+// header h and the raw encoding, so that buffers are allocated once
+func (f *BloomFilter) binarySize(h header) int {
+	n, _ := h.writeTo(io.Discard)
+	if h.checksum {
+		n += 4
+	}
+	return int(n) + f.b.BinaryStorageSize()
+}
+
 // MarshalBinary implements binary.BinaryMarshaler interface.
 func (f *BloomFilter) MarshalBinary() ([]byte, error) {
-	var buf bytes.Buffer
-	_, err := f.WriteTo(&buf)
+	buf := bytes.NewBuffer(make([]byte, 0, f.binarySize(f.header())))
+	_, err := f.WriteTo(buf)
 	if err != nil {
 		return nil, err
 	}
@@ -434,20 +1058,83 @@ func (f *BloomFilter) UnmarshalBinary(data []byte) error {
 	return err
 }
 
+// MarshalText implements encoding.TextMarshaler interface, for text-based
+// formats such as YAML. The text is the base64 encoding of the framed format
+// (see WriteFramedTo), which starts with the version of the format, m and k,
+// and ends with a checksum.
+func (f *BloomFilter) MarshalText() ([]byte, error) {
+	h := f.header()
+	h.checksum = true
+	size := base64.StdEncoding.EncodedLen(f.binarySize(h))
+	text := bytes.NewBuffer(make([]byte, 0, size))
+	w := base64.NewEncoder(base64.StdEncoding, text)
+	_, err := f.WriteFramedTo(w, EncodingRaw)
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return text.Bytes(), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler interface. It accepts
+// the base64 encoding of any binary representation read by ReadFrom.
+func (f *BloomFilter) UnmarshalText(text []byte) error {
+	data := make([]byte, base64.StdEncoding.DecodedLen(len(text)))
+	n, err := base64.StdEncoding.Decode(data, text)
+	if err != nil {
+		return err
+	}
+	buf := bytes.NewBuffer(data[:n])
+	if _, err := f.ReadFrom(buf); err != nil {
+		return err
+	}
+	if buf.Len() != 0 {
+		return errors.New("bloom: unexpected data after the filter")
+	}
+	return nil
+}
+
 // Equal tests for the equality of two Bloom filters
 func (f *BloomFilter) Equal(g *BloomFilter) bool {
-	return f.m == g.m && f.k == g.k && f.b.Equal(g.b)
+	return f.compatible(g) == nil && f.b.Equal(g.b)
 }
 
 // Locations returns a list of hash locations representing a data item.
+//
+// The locations are part of the serialized format, so that they are stable:
+// changing them would require a new version of the format. Other systems can
+// compute them as follows:
+//
+//  1. h[0] and h[1] are the two 64-bit halves of the 128-bit x64 MurmurHash3
+//     of the data, with a seed of zero, and h[2] and h[3] those of the data
+//     followed by a byte of value 1.
+//  2. The ith location, for i from 0 to k-1, is h[i%2] + i*h[2+((i+i%2)%4)/2],
+//     modulo 2^64.
+//  3. A filter of m bits uses the bit at l % m of each location l, or at
+//     the high 64 bits of the 128-bit product l*m with NewFastRange.
+//
+// Filters created with NewWithSeed hash with their seed instead of zero, for
+// both halves of the MurmurHash3 state; keyed filters hash with SipHash, see
+// NewKeyed, and have no public locations. Filters created with NewWithScheme
+// may derive their locations with another scheme, see LocationScheme.
 func Locations(data []byte, k uint) []uint64 {
-	locs := make([]uint64, k)
+	return LocationsInto(data, make([]uint64, k))
+}
 
-	// calculate locations
+// LocationsInto is like Locations, with k the length of buf: it computes the
+// locations into buf, without allocating, and returns it.
+func LocationsInto(data []byte, buf []uint64) []uint64 {
 	h := baseHashes(data)
-	for i := uint(0); i < k; i++ {
-		locs[i] = location(h, i)
+	for i := range buf {
+		buf[i] = location(h, uint(i))
 	}
+	return buf
+}
 
-	return locs
+// LocationsString returns a list of hash locations representing a string,
+// like Locations, without converting the string to a byte slice.
+func LocationsString(data string, k uint) []uint64 {
+	return Locations(stringToBytes(data), k)
 }
@@ -3,13 +3,19 @@ package bloom
 import (
 	"fmt"
 	"bytes"
+	"encoding"
+	"encoding/base64"
 	"encoding/binary"
 	"encoding/gob"
 	"encoding/json"
+	"io"
 	"math"
+	"math/bits"
+	"strings"
 	"testing"
 
 	"github.com/bits-and-blooms/bitset"
+	"github.com/twmb/murmur3"
 )
 
 // This implementation of Bloom filters is _not_
@@ -176,7 +182,7 @@ func TestString(t *testing.T) {
 
 func testEstimated(n uint, maxFp float64, t *testing.T) {
 	m, k := EstimateParameters(n, maxFp)
-	fpRate := EstimateFalsePositiveRate(m, k, n)
+	fpRate := SimulateFalsePositiveRate(m, k, n)
 	if fpRate > 1.5*maxFp {
 		t.Errorf("False positive rate too high: n: %v; m: %v; k: %v; maxFp: %f; fpRate: %f, fpRate/maxFp: %f", n, m, k, maxFp, fpRate, fpRate/maxFp)
 	}
@@ -317,7 +323,7 @@ func TestMarshalUnmarshalJSON(t *testing.T) {
 
 
 func TestMarshalUnmarshalJSONValue(t *testing.T) {
-	f:= BloomFilter{1000, 4, bitset.New(1000)}
+	f:= BloomFilter{m: 1000, k: 4, b: bitset.New(1000)}
 	data, err := json.Marshal(f)
 	if err != nil {
 		t.Fatal(err.Error())
@@ -353,6 +359,80 @@ func TestUnmarshalInvalidJSON(t *testing.T) {
 	}
 }
 
+func TestMarshalJSONCompact(t *testing.T) {
+	f := NewWithEstimates(10000, 0.01)
+	for i := uint32(0); i < 10000; i++ {
+		f.AddUint32(i)
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var j struct {
+		B json.RawMessage `json:"b"`
+	}
+	if err := json.Unmarshal(data, &j); err != nil || j.B[0] != '"' {
+		t.Fatalf("the bitset should be a string: %v", err)
+	}
+	raw, _ := f.MarshalBinary()
+	if ratio := float64(len(data)) / float64(len(raw)); ratio > 1.4 {
+		t.Errorf("JSON is %.2f times the size of the binary representation", ratio)
+	}
+}
+
+func TestMarshalUnmarshalText(t *testing.T) {
+	for _, f := range []*BloomFilter{
+		New(1000, 4),
+		NewWithEstimatesAndSeed(1000, 0.01, 42),
+		NewFastRangeWithEstimates(1000, 0.01),
+	} {
+		for i := uint32(0); i < 100; i++ {
+			f.AddUint32(i)
+		}
+		var m encoding.TextMarshaler = f
+		text, err := m.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The text starts with the magic number of the extended header, BLOM.
+		if !strings.HasPrefix(string(text), "QkxPTQ") {
+			t.Errorf("unexpected text %s", text)
+		}
+		var g BloomFilter
+		if err := g.UnmarshalText(text); err != nil || !f.Equal(&g) {
+			t.Errorf("text round trip changed the filter: %v", err)
+		}
+		// JSON is not affected.
+		if data, _ := json.Marshal(f); data[0] != '{' {
+			t.Errorf("unexpected JSON %s", data)
+		}
+	}
+
+	f := New(1000, 4).AddString("Love")
+	raw, _ := f.MarshalBinary()
+	var g BloomFilter
+	if err := g.UnmarshalText([]byte(base64.StdEncoding.EncodeToString(raw))); err != nil || !g.TestString("Love") {
+		t.Errorf("any binary representation should be accepted: %v", err)
+	}
+
+	text, _ := f.MarshalText()
+	corrupted := append([]byte(nil), text...)
+	corrupted[len(text)/2] ^= 1
+	for name, bad := range map[string][]byte{
+		"corrupted text": corrupted,
+		"invalid base64": append(append([]byte(nil), text[:20]...), '!'),
+		"trailing data":  []byte(base64.StdEncoding.EncodeToString(append(raw, 0))),
+	} {
+		if err := g.UnmarshalText(bad); err == nil {
+			t.Errorf("%s should not be accepted", name)
+		}
+	}
+	text, _ = NewKeyed(1000, 4, [16]byte{1}).MarshalText()
+	if err := g.UnmarshalText(text); err == nil {
+		t.Error("keyed filters should only be decoded into keyed filters")
+	}
+}
+
 func TestWriteToReadFrom(t *testing.T) {
 	var b bytes.Buffer
 	f := New(1000, 4)
@@ -479,7 +559,7 @@ func BenchmarkEstimated(b *testing.B) {
 	for n := uint(100000); n <= 100000; n *= 10 {
 		for fp := 0.1; fp >= 0.0001; fp /= 10.0 {
 			f := NewWithEstimates(n, fp)
-			EstimateFalsePositiveRate(f.m, f.k, n)
+			SimulateFalsePositiveRate(f.m, f.k, n)
 		}
 	}
 }
@@ -553,6 +633,76 @@ func TestMerge(t *testing.T) {
 	}
 }
 
+func TestIntersect(t *testing.T) {
+	f := New(1000, 4)
+	g := New(1000, 4)
+	for _, key := range []string{"a", "b", "c"} {
+		f.AddString(key)
+	}
+	for _, key := range []string{"b", "c", "d"} {
+		g.AddString(key)
+	}
+	err := f.Intersect(g)
+	if err != nil {
+		t.Errorf("There should be no error when intersecting two similar filters")
+	}
+	if !f.TestString("b") || !f.TestString("c") {
+		t.Errorf("The common values should exist after an intersection")
+	}
+	if f.TestString("a") || f.TestString("d") {
+		t.Errorf("The other values should not exist after an intersection")
+	}
+	if err = f.Intersect(New(999, 4)); err == nil {
+		t.Errorf("There should be an error when intersecting filters with mismatched m")
+	}
+	if err = f.Intersect(New(1000, 5)); err == nil {
+		t.Errorf("There should be an error when intersecting filters with mismatched k")
+	}
+	if err = f.Intersect(NewWithSeed(1000, 4, 1)); err == nil {
+		t.Errorf("There should be an error when intersecting filters with mismatched hash functions")
+	}
+	if !f.TestString("b") {
+		t.Errorf("The value doesn't exist after an invalid intersection")
+	}
+}
+
+func TestUnionIntersection(t *testing.T) {
+	a := NewWithSeed(1000, 4, 7)
+	b := NewWithSeed(1000, 4, 7)
+	a.AddString("a").AddString("b")
+	b.AddString("b").AddString("c")
+	ac, bc := a.Copy(), b.Copy()
+
+	u, err := Union(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !u.TestString("a") || !u.TestString("b") || !u.TestString("c") || u.Seed() != 7 {
+		t.Error("the union should hold the keys of both filters")
+	}
+	i, err := Intersection(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.TestString("a") || !i.TestString("b") || i.TestString("c") {
+		t.Error("the intersection should hold the common keys")
+	}
+	if !a.Equal(ac) || !b.Equal(bc) {
+		t.Error("the filters should not be modified")
+	}
+	u.AddString("d")
+	if a.TestString("d") || b.TestString("d") {
+		t.Error("the union should not share the bits of the filters")
+	}
+
+	if _, err := Union(a, New(1000, 4)); err == nil {
+		t.Error("There should be an error for mismatched hash functions")
+	}
+	if _, err := Intersection(a, NewWithSeed(1000, 5, 7)); err == nil {
+		t.Error("There should be an error for mismatched k")
+	}
+}
+
 func TestCopy(t *testing.T) {
 	f := New(1000, 4)
 	n1 := []byte("f")
@@ -616,6 +766,31 @@ func TestFrom(t *testing.T) {
 	}
 }
 
+func TestFromBitSet(t *testing.T) {
+	b := bitset.New(1000)
+	f := FromBitSet(b, 5)
+	if f.Cap() != 1000 || f.K() != 5 || f.BitSet() != b {
+		t.Errorf("the filter should wrap the bitset")
+	}
+	f.AddString("test")
+	if b.Count() == 0 {
+		t.Errorf("the bitset should be shared with the filter")
+	}
+	if !FromBitSet(b.Clone(), 5).Equal(New(1000, 5).AddString("test")) {
+		t.Errorf("the filter should hold the keys of the bitset")
+	}
+
+	f = FromBitSetWithM(bitset.New(1024), 1000, 5).AddString("test")
+	if f.Cap() != 1000 || !f.Test([]byte("test")) || f.TestString("other") {
+		t.Errorf("unexpected filter with m smaller than the bitset")
+	}
+	for i, ok := f.NextSet(0); ok; i, ok = f.NextSet(i + 1) {
+		if i >= 1000 {
+			t.Errorf("bit %d is beyond m", i)
+		}
+	}
+}
+
 func TestTestLocations(t *testing.T) {
 	f := NewWithEstimates(1000, 0.001)
 	n1 := []byte("Love")
@@ -658,6 +833,144 @@ func TestApproximatedSize(t *testing.T) {
 	}
 }
 
+func TestApproximatedSizeFull(t *testing.T) {
+	f := New(64, 1)
+	f.b.SetAll()
+	if size := f.ApproximatedSize(); size != math.MaxUint32 {
+		t.Errorf("%d should equal %d for a full filter", size, uint32(math.MaxUint32))
+	}
+	if size := f.ApproximatedSizeFloat(); !math.IsInf(size, 1) {
+		t.Errorf("%v should be +Inf for a full filter", size)
+	}
+	if low, high := f.ApproximatedSizeInterval(0.95); low <= 0 || math.IsInf(low, 0) || !math.IsInf(high, 1) {
+		t.Errorf("[%v, %v] should be bounded below only", low, high)
+	}
+}
+
+func TestApproximatedSizeInterval(t *testing.T) {
+	f := NewWithEstimates(1000, 0.01)
+	if size := f.ApproximatedSizeFloat(); size != 0 {
+		t.Errorf("%v should be 0 for an empty filter", size)
+	}
+	if low, high := f.ApproximatedSizeInterval(0.95); low != 0 || high != 0 {
+		t.Errorf("[%v, %v] should be empty for an empty filter", low, high)
+	}
+	f.AddString("Love")
+	if size := f.ApproximatedSizeFloat(); math.Abs(size-1) > 0.01 {
+		t.Errorf("%v should be about 1", size)
+	}
+
+	// About 95% of the intervals should hold the number of items.
+	n := make([]byte, 4)
+	covered, trials := 0, 200
+	for trial := 0; trial < trials; trial++ {
+		f.ClearAll()
+		for i := 0; i < 1000; i++ {
+			binary.BigEndian.PutUint32(n, uint32(trial*1000+i))
+			f.Add(n)
+		}
+		low, high := f.ApproximatedSizeInterval(0.95)
+		size := f.ApproximatedSizeFloat()
+		if !(low < size && size < high) || high-low > 200 {
+			t.Fatalf("unexpected interval [%v, %v] around %v", low, high, size)
+		}
+		if low <= 1000 && 1000 <= high {
+			covered++
+		}
+	}
+	if covered < trials*88/100 || covered > trials*99/100 {
+		t.Errorf("%d intervals out of %d hold the number of items", covered, trials)
+	}
+}
+
+func TestEstimateParametersOverflow(t *testing.T) {
+	// The optimal m for these parameters does not fit in 64 bits.
+	n := ^uint(0) >> 2
+	m, k := EstimateParameters(n, 1e-10)
+	if m != ^uint(0)&^63 {
+		t.Errorf("m = %d, should saturate at %d", m, ^uint(0)&^63)
+	}
+	if k != 3 {
+		t.Errorf("k = %d, should be optimal for the saturated m", k)
+	}
+	if m, _ := EstimateParameters(1000, 0.01); m != 9586 {
+		t.Errorf("m = %d, should be 9586", m)
+	}
+}
+
+func TestEstimateMaxCapacity(t *testing.T) {
+	for _, c := range []struct {
+		m, k uint
+		p    float64
+	}{{9586, 7, 0.01}, {1000, 3, 0.1}, {1 << 20, 10, 0.0001}, {64, 1, 0.5}} {
+		n := EstimateMaxCapacity(c.m, c.k, c.p)
+		if EstimateFalsePositiveRate(c.m, c.k, n) > c.p || EstimateFalsePositiveRate(c.m, c.k, n+1) <= c.p {
+			t.Errorf("m = %d, k = %d: %d is not the largest capacity for %v", c.m, c.k, n, c.p)
+		}
+	}
+	if n := EstimateMaxCapacity(9586, 7, 0.01); n < 990 || n > 1010 {
+		t.Errorf("%d should be about 1000", n)
+	}
+	if EstimateMaxCapacity(1000, 4, 0) != 0 || EstimateMaxCapacity(1000, 4, 1) != ^uint(0) {
+		t.Error("capacities should be bounded")
+	}
+}
+
+func TestRemainingCapacity(t *testing.T) {
+	f := NewWithEstimates(1000, 0.01)
+	if f.RemainingCapacity(0.01) != EstimateMaxCapacity(f.m, f.k, 0.01) {
+		t.Error("an empty filter should have its full capacity")
+	}
+	n := make([]byte, 4)
+	for i := uint32(0); i < 500; i++ {
+		binary.BigEndian.PutUint32(n, i)
+		f.Add(n)
+	}
+	remaining := f.RemainingCapacity(0.01)
+	if remaining < 450 || remaining > 550 {
+		t.Errorf("%d keys should remain after adding half of the capacity", remaining)
+	}
+	for i := uint32(0); i < uint32(remaining); i++ {
+		binary.BigEndian.PutUint32(n, 500+i)
+		f.Add(n)
+	}
+	if r := f.CurrentFalsePositiveRate(); math.Abs(r-0.01) > 0.002 {
+		t.Errorf("the false positive rate %v should be about 0.01 once full", r)
+	}
+	for i := uint32(0); i < 200; i++ {
+		binary.BigEndian.PutUint32(n, 2000+i)
+		f.Add(n)
+	}
+	if f.RemainingCapacity(0.01) != 0 || f.RemainingCapacity(0.1) == 0 {
+		t.Error("an overloaded filter should have no capacity left")
+	}
+}
+
+func TestFillRatio(t *testing.T) {
+	f := NewWithEstimates(1000, 0.01)
+	if f.FillRatio() != 0 || f.CurrentFalsePositiveRate() != 0 {
+		t.Error("an empty filter should have no bits set")
+	}
+	n := make([]byte, 4)
+	for i := uint32(0); i < 1000; i++ {
+		binary.BigEndian.PutUint32(n, i)
+		f.Add(n)
+	}
+	if r := f.FillRatio(); math.Abs(r-0.5) > 0.02 {
+		t.Errorf("fill ratio %f should be about 0.5 at capacity", r)
+	}
+	if r := f.CurrentFalsePositiveRate(); math.Abs(r-0.01) > 0.002 {
+		t.Errorf("false positive rate %f should be about 0.01 at capacity", r)
+	}
+	for i := uint32(1000); i < 2000; i++ {
+		binary.BigEndian.PutUint32(n, i)
+		f.Add(n)
+	}
+	if r := f.CurrentFalsePositiveRate(); r < 0.1 {
+		t.Errorf("false positive rate %f should grow beyond capacity", r)
+	}
+}
+
 func TestFPP(t *testing.T) {
 	f := NewWithEstimates(1000, 0.001)
 	for i := uint32(0); i < 1000; i++ {
@@ -716,3 +1029,443 @@ func TestEncodeDecodeBinary(t *testing.T) {
 		t.Errorf("missing value 'one'")
 	}
 }
+
+func TestTestAtMost(t *testing.T) {
+	f := NewWithEstimates(1000, 0.001)
+	n1 := []byte("Love")
+	n2 := []byte("is")
+	f.Add(n1)
+	for j := uint(0); j <= f.K()+1; j++ {
+		if !f.TestAtMost(n1, j) {
+			t.Errorf("%v should be in when checking %d locations.", n1, j)
+		}
+	}
+	if f.TestAtMost(n2, f.K()) {
+		t.Errorf("%v should not be in.", n2)
+	}
+	if !f.TestAtMost(n2, 0) {
+		t.Errorf("checking no location should always succeed")
+	}
+	// Checking fewer locations can only increase the number of positives.
+	count, countAtMost := 0, 0
+	for i := uint32(0); i < 1000; i++ {
+		n := make([]byte, 4)
+		binary.BigEndian.PutUint32(n, i)
+		f.Add(n)
+	}
+	for i := uint32(0); i < 10000; i++ {
+		n := make([]byte, 4)
+		binary.BigEndian.PutUint32(n, i+1000)
+		if f.Test(n) {
+			count++
+		}
+		if f.TestAtMost(n, 2) {
+			countAtMost++
+		}
+	}
+	if countAtMost < count {
+		t.Errorf("TestAtMost found fewer positives (%d) than Test (%d)", countAtMost, count)
+	}
+}
+
+func TestTestAcross(t *testing.T) {
+	filters := []*BloomFilter{New(1000, 4), New(2000, 3), New(1000, 4), New(64, 1)}
+	filters[0].AddString("Love")
+	filters[1].AddString("Love")
+	filters[3].AddString("bloom")
+	for _, key := range []string{"Love", "bloom", "is"} {
+		results := TestAcross([]byte(key), filters)
+		if len(results) != len(filters) {
+			t.Fatalf("unexpected number of results %d", len(results))
+		}
+		for i, f := range filters {
+			if results[i] != f.TestString(key) {
+				t.Errorf("%v: TestAcross disagrees with Test for filter %d", key, i)
+			}
+		}
+	}
+}
+
+func TestAddLocations(t *testing.T) {
+	for _, create := range []func() *BloomFilter{
+		func() *BloomFilter { return NewWithEstimates(1000, 0.001) },
+		func() *BloomFilter { return NewFastRangeWithEstimates(1000, 0.001) },
+	} {
+		f, g := create(), create()
+		locs := Locations([]byte("Love"), f.K())
+		f.AddLocations(locs)
+		g.AddString("Love")
+		if !f.Equal(g) {
+			t.Errorf("AddLocations should set the bits Add sets")
+		}
+		if !f.TestAndAddLocations(locs) || !f.TestOrAddLocations(locs) {
+			t.Errorf("the locations should be set")
+		}
+		other := Locations([]byte("other"), f.K())
+		if f.TestAndAddLocations(other) || !f.TestLocations(other) {
+			t.Errorf("TestAndAddLocations should add the locations")
+		}
+		other = Locations([]byte("another"), f.K())
+		if f.TestOrAddLocations(other) || !f.TestLocations(other) {
+			t.Errorf("TestOrAddLocations should add the locations")
+		}
+		g.AddString("other").AddString("another")
+		if !f.Equal(g) {
+			t.Errorf("the filters should hold the same keys")
+		}
+	}
+}
+
+func TestLocationsString(t *testing.T) {
+	for _, s := range []string{"", "Love", "a string which is longer than thirty-two bytes"} {
+		locs := LocationsString(s, 7)
+		want := Locations([]byte(s), 7)
+		for i := range want {
+			if locs[i] != want[i] {
+				t.Errorf("%q: location %d differs", s, i)
+			}
+		}
+	}
+}
+
+func TestLocationsInto(t *testing.T) {
+	buf := make([]uint64, 7)
+	for _, s := range []string{"", "Love", "fifteen bytes!!", "a string which is longer than thirty-two bytes"} {
+		data := []byte(s)
+		// The documented derivation of the locations.
+		var h [4]uint64
+		h[0], h[1] = murmur3.Sum128(data)
+		h[2], h[3] = murmur3.Sum128(append(data, 1))
+		for i, l := range LocationsInto(data, buf) {
+			ii := uint64(i)
+			if l != h[ii%2]+ii*h[2+((ii+ii%2)%4)/2] {
+				t.Errorf("%q: location %d does not follow the documented scheme", s, i)
+			}
+		}
+		for _, f := range []*BloomFilter{New(1000, 7), NewFastRange(1000, 7)} {
+			g := New(1000, 7)
+			for _, l := range buf {
+				if f.fastRange {
+					hi, _ := bits.Mul64(l, 1000)
+					g.b.Set(uint(hi))
+				} else {
+					g.b.Set(uint(l % 1000))
+				}
+			}
+			if !f.Add(data).BitSet().Equal(g.BitSet()) {
+				t.Errorf("%q: the filter should set the documented bits", s)
+			}
+		}
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		LocationsInto([]byte("Love"), buf)
+	})
+	if allocs != 0 {
+		t.Errorf("LocationsInto should not allocate, got %v allocations", allocs)
+	}
+}
+
+func TestStringNoAllocation(t *testing.T) {
+	f := NewWithEstimates(1000, 0.001)
+	s := "a string which is longer than thirty-two bytes"
+	allocs := testing.AllocsPerRun(100, func() {
+		f.AddString(s)
+		f.TestString(s)
+		f.TestAndAddString(s)
+		f.TestOrAddString(s)
+	})
+	if allocs != 0 {
+		t.Errorf("string methods should not allocate, got %v allocations", allocs)
+	}
+	allocs = testing.AllocsPerRun(100, func() {
+		LocationsString(s, f.K())
+	})
+	if allocs != 1 {
+		t.Errorf("LocationsString should only allocate its result, got %v allocations", allocs)
+	}
+}
+
+func TestSeed(t *testing.T) {
+	f := NewWithEstimatesAndSeed(1000, 0.001, 42)
+	g := NewWithEstimatesAndSeed(1000, 0.001, 43)
+	z := NewWithSeed(f.Cap(), f.K(), 0)
+	h := New(f.Cap(), f.K())
+	n1 := []byte("Bess")
+	for _, x := range []*BloomFilter{f, g, z, h} {
+		x.Add(n1)
+	}
+	if !f.Test(n1) || f.TestString("Jane") || f.Seed() != 42 {
+		t.Error("seeded filters should behave as filters")
+	}
+	if f.Equal(g) || f.BitSet().Equal(g.BitSet()) || f.BitSet().Equal(h.BitSet()) || !z.Equal(h) {
+		t.Error("seeds should change the locations, except a zero seed")
+	}
+	if f.Merge(g) == nil || f.Merge(h) == nil {
+		t.Error("filters with different seeds should not be merged")
+	}
+	if c := f.Copy(); !c.Equal(f) || c.Seed() != 42 {
+		t.Error("copies should keep the seed")
+	}
+	if r := TestAcross(n1, []*BloomFilter{f, h, g}); !r[0] || !r[1] || !r[2] {
+		t.Errorf("TestAcross should hash with the seed of each filter: %v", r)
+	}
+	if c := NewConcurrentFrom(f); !c.Test(n1) || !c.Snapshot().Equal(f) {
+		t.Error("concurrent copies should keep the seed")
+	}
+}
+
+func TestSeedEncodeDecode(t *testing.T) {
+	f := NewWithSeed(1000, 4, 42)
+	f.AddString("a")
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var g BloomFilter
+	if err := g.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !g.Equal(f) || g.Seed() != 42 || !g.TestString("a") {
+		t.Error("binary round trip changed the filter")
+	}
+	if ok, err := TestSerialized(data, []byte("a")); err != nil || !ok {
+		t.Errorf("TestSerialized should hash with the seed: %v", err)
+	}
+	if _, err := New(1000, 4).MergeFromReader(bytes.NewReader(data)); err == nil {
+		t.Error("MergeFromReader should not merge filters with different seeds")
+	}
+
+	js, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var h BloomFilter
+	if err := json.Unmarshal(js, &h); err != nil || !h.Equal(f) {
+		t.Errorf("JSON round trip changed the filter: %v", err)
+	}
+	if js, _ := json.Marshal(New(10, 1)); bytes.Contains(js, []byte("seed")) {
+		t.Errorf("unseeded filters should not change their JSON: %s", js)
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	m, k, fp := EstimateParametersForBudget(1200, 1000)
+	if m != 9600 || k != 7 || math.Abs(fp-0.0099) > 0.0005 {
+		t.Errorf("unexpected parameters %d %d %f", m, k, fp)
+	}
+	f, fp := NewWithMemoryBudget(1<<20, 100000)
+	if data, _ := f.MarshalBinary(); len(data) > 1<<20+24 {
+		t.Errorf("the filter takes %d bytes", len(data))
+	}
+	if f.Cap() != 1<<23 || fp != EstimateFalsePositiveRate(f.Cap(), f.K(), 100000) {
+		t.Errorf("unexpected filter m=%d k=%d fp=%f", f.Cap(), f.K(), fp)
+	}
+	if m, k, _ := EstimateParametersForBudget(3, 0); m != 64 || k != 1 {
+		t.Errorf("tiny budgets should give one word, got %d %d", m, k)
+	}
+}
+
+func TestPow2(t *testing.T) {
+	for _, c := range []struct{ m, expected uint }{{0, 1}, {1, 1}, {3, 4}, {1000, 1024}, {1024, 1024}} {
+		if f := NewPow2(c.m, 3); f.Cap() != c.expected {
+			t.Errorf("NewPow2(%d) has %d bits, expected %d", c.m, f.Cap(), c.expected)
+		}
+	}
+	m, k := EstimateParametersPow2(1000, 0.01)
+	if m != 16384 || k != 12 {
+		t.Errorf("unexpected parameters %d %d", m, k)
+	}
+	// The mask selects the same bits as the modulo.
+	f := NewPow2WithEstimates(1000, 0.01)
+	g := From(make([]uint64, f.Cap()/64), f.K())
+	key := make([]byte, 4)
+	for i := uint32(0); i < 1000; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		f.Add(key)
+		h := baseHashes(key)
+		for j := uint(0); j < f.K(); j++ {
+			g.b.Set(uint(location(h, j) % uint64(f.Cap())))
+		}
+	}
+	if !f.BitSet().Equal(g.BitSet()) {
+		t.Error("masked locations should be the same as with a modulo")
+	}
+	if rate := SimulateFalsePositiveRate(f.Cap(), f.K(), 1000); rate > 0.01 {
+		t.Errorf("false positive rate %f is too high", rate)
+	}
+}
+
+func BenchmarkTestPow2(b *testing.B) {
+	for _, c := range []struct {
+		name string
+		f    *BloomFilter
+	}{
+		{"modulo", New(1<<20+1, 7)},
+		{"mask", NewPow2(1<<20, 7)},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			key := make([]byte, 8)
+			for i := 0; i < b.N; i++ {
+				binary.BigEndian.PutUint32(key, uint32(i))
+				c.f.Test(key)
+			}
+		})
+	}
+}
+
+func TestFastRange(t *testing.T) {
+	f := NewFastRangeWithEstimates(1000, 0.01)
+	g := New(f.Cap(), f.K())
+	key := make([]byte, 4)
+	fp := 0
+	for i := uint32(0); i < 1000; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		f.Add(key)
+		g.Add(key)
+	}
+	for i := uint32(1000); i < 101000; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		if f.Test(key) {
+			fp++
+		}
+	}
+	if rate := float64(fp) / 100000; rate > 0.012 {
+		t.Errorf("false positive rate %f is too high", rate)
+	}
+	if f.BitSet().Equal(g.BitSet()) || f.Equal(g) || f.Merge(g) == nil {
+		t.Error("fast range filters should not be mixed with other filters")
+	}
+	if c := f.Copy(); !c.Equal(f) {
+		t.Error("copies should keep the range reduction")
+	}
+	binary.BigEndian.PutUint32(key, 0)
+	if c := NewConcurrentFrom(f); !c.Test(key) || !c.Snapshot().Equal(f) {
+		t.Error("concurrent copies should keep the range reduction")
+	}
+	if err := f.WriteCHeader(io.Discard, "f"); err == nil {
+		t.Error("fast range filters should not be exported to C")
+	}
+}
+
+func TestFastRangeEncodeDecode(t *testing.T) {
+	f := NewFastRange(1000, 4)
+	f.AddString("a")
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, _, err := readHeader(bytes.NewReader(data))
+	if err != nil || !h.fastRange {
+		t.Errorf("the header should record the range reduction: %v", err)
+	}
+	var g BloomFilter
+	if err := g.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !g.Equal(f) || !g.TestString("a") {
+		t.Error("binary round trip changed the filter")
+	}
+	if ok, err := TestSerialized(data, []byte("a")); err != nil || !ok {
+		t.Errorf("TestSerialized should use the range reduction: %v", err)
+	}
+	if _, err := New(1000, 4).MergeFromReader(bytes.NewReader(data)); err == nil {
+		t.Error("MergeFromReader should not merge filters with different range reductions")
+	}
+
+	js, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var j BloomFilter
+	if err := json.Unmarshal(js, &j); err != nil || !j.Equal(f) {
+		t.Errorf("JSON round trip changed the filter: %v", err)
+	}
+}
+
+func TestEstimateFalsePositiveRate(t *testing.T) {
+	for _, c := range []struct{ m, k, n uint }{{9586, 7, 1000}, {20000, 5, 1000}, {1 << 16, 3, 10000}} {
+		expected := SimulateFalsePositiveRate(c.m, c.k, c.n)
+		if rate := EstimateFalsePositiveRate(c.m, c.k, c.n); math.Abs(rate-expected) > 0.2*expected+0.0005 {
+			t.Errorf("m=%d k=%d n=%d: rate %f should be close to the measured %f", c.m, c.k, c.n, rate, expected)
+		}
+	}
+	if EstimateFalsePositiveRate(1000, 3, 0) != 0 {
+		t.Error("an empty filter should have no false positives")
+	}
+}
+
+func TestReset(t *testing.T) {
+	f := NewWithSeed(10000, 5, 42)
+	words := f.b.Words()
+	f.AddString("Love")
+	if f.Reset(1000, 3); f.Cap() != 1000 || f.K() != 3 || f.b.Len() != 1000 || f.Seed() != 42 {
+		t.Errorf("m = %d, k = %d, len = %d, seed = %d", f.Cap(), f.K(), f.b.Len(), f.Seed())
+	}
+	if f.b.Any() || &f.b.Words()[0] != &words[0] {
+		t.Error("the filter should be cleared in its words")
+	}
+	if !f.AddString("Love").Equal(NewWithSeed(1000, 3, 42).AddString("Love")) {
+		t.Error("a reset filter should be as a new one")
+	}
+	// Shrinking clears the words beyond the new length, which growing
+	// within the capacity uses again.
+	for i := range words {
+		words[i] = ^uint64(0)
+	}
+	f.Reset(64, 3).Reset(10000, 3)
+	if f.b.Any() || &f.b.Words()[0] != &words[0] {
+		t.Error("the filter should be cleared in its words")
+	}
+	if f.Reset(20000, 4); f.Cap() != 20000 || f.b.Len() != 20000 || f.b.Any() {
+		t.Errorf("m = %d, len = %d", f.Cap(), f.b.Len())
+	}
+	if f.Reset(0, 0); f.Cap() != 1 || f.K() != 1 {
+		t.Errorf("m = %d, k = %d should be at least 1", f.Cap(), f.K())
+	}
+	if g := (&BloomFilter{}).Reset(100, 2); g.Cap() != 100 || g.b.Len() != 100 {
+		t.Error("a zero filter should be allocated")
+	}
+
+	if n := testing.AllocsPerRun(100, func() { f.Reset(5000, 4).AddString("Love") }); n != 0 {
+		t.Errorf("Reset allocates %v times", n)
+	}
+}
+
+func TestTestAcrossHashing(t *testing.T) {
+	// Two filters of each kind, in different orders, whose SipHash keys are
+	// equal but not shared.
+	var filters []*BloomFilter
+	for _, c := range hashingFilters() {
+		filters = append(filters, c.f.AddString("Love"))
+	}
+	for _, c := range hashingFilters() {
+		filters = append([]*BloomFilter{c.f.AddString("bloom")}, filters...)
+	}
+	for _, key := range []string{"Love", "bloom", "is"} {
+		results := TestAcross([]byte(key), filters)
+		for i, f := range filters {
+			if results[i] != f.TestString(key) {
+				t.Errorf("%v: TestAcross disagrees with Test for filter %d", key, i)
+			}
+		}
+	}
+	if r := TestAcross([]byte("Love"), nil); len(r) != 0 {
+		t.Errorf("unexpected results %v", r)
+	}
+	keyed := []*BloomFilter{NewKeyed(1000, 4, [16]byte{1}), NewKeyed(1000, 4, [16]byte{1})}
+	if n := testing.AllocsPerRun(10, func() { TestAcross([]byte("Love"), keyed) }); n > 1 {
+		t.Errorf("TestAcross allocates %v times", n)
+	}
+}
+
+func BenchmarkTestAcross(b *testing.B) {
+	filters := make([]*BloomFilter, 256)
+	for i := range filters {
+		filters[i] = NewWithSeed(10000, 7, uint64(i%2))
+	}
+	key := []byte("Love")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		TestAcross(key, filters)
+	}
+}
@@ -0,0 +1,236 @@
+/*
+Package bloomhttp serves a Bloom filter over HTTP, for services which tell
+whether keys were seen before:
+
+	h := bloomhttp.New(bloom.NewWithEstimates(1000000, 0.001))
+	go h.Persist(ctx, "seen.bloom", time.Minute)
+	http.Handle("/seen/", http.StripPrefix("/seen", h))
+
+The handler serves three endpoints, relative to where it is mounted:
+
+	POST /add     adds the keys of the request body, one per line, and
+	              responds with {"added": n}, the number of keys read.
+	GET  /test    tests the keys of the key query parameters, e.g.,
+	              /test?key=a&key=b, and responds with {"present": [true,
+	              false]}, one result per key in order.
+	GET  /stats   responds with the parameters and the fill of the filter,
+	              see Stats.
+
+Responses are JSON objects. Errors are reported with a 4xx status and a plain
+text message: 400 for a request without keys, 405 for a wrong method, and
+404 for other paths. A trailing '\r' is part of a key: send keys separated by
+'\n' only.
+*/
+package bloomhttp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// A Handler serves a Bloom filter over HTTP. It is safe for concurrent use.
+type Handler struct {
+	mu      sync.RWMutex
+	f       *bloom.BloomFilter
+	added   uint64 // keys added since the handler was created
+	version uint64 // number of requests which added keys, see Persist
+	mux     *http.ServeMux
+}
+
+// Stats is the response of GET /stats.
+type Stats struct {
+	M                 uint    `json:"m"`
+	K                 uint    `json:"k"`
+	BitsSet           uint    `json:"bits_set"`
+	FillRatio         float64 `json:"fill_ratio"`
+	EstimatedKeys     uint32  `json:"estimated_keys"`      // see ApproximatedSize
+	FalsePositiveRate float64 `json:"false_positive_rate"` // see CurrentFalsePositiveRate
+	Added             uint64  `json:"added"`               // keys added through the handler
+}
+
+// New returns a handler serving the filter, which it takes ownership of: the
+// filter must not be used directly afterwards.
+func New(f *bloom.BloomFilter) *Handler {
+	h := &Handler{f: f, mux: http.NewServeMux()}
+	h.mux.HandleFunc("/add", h.add)
+	h.mux.HandleFunc("/test", h.test)
+	h.mux.HandleFunc("/stats", h.stats)
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) add(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodPost) {
+		return
+	}
+	h.mu.Lock()
+	n, err := h.f.AddFromReaderCount(r.Body, '\n')
+	h.added += n
+	if n > 0 {
+		h.version++
+	}
+	h.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	reply(w, struct {
+		Added uint64 `json:"added"`
+	}{n})
+}
+
+func (h *Handler) test(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) {
+		return
+	}
+	keys := r.URL.Query()["key"]
+	if len(keys) == 0 {
+		http.Error(w, "no key parameter", http.StatusBadRequest)
+		return
+	}
+	present := make([]bool, len(keys))
+	h.mu.RLock()
+	for i, key := range keys {
+		present[i] = h.f.TestString(key)
+	}
+	h.mu.RUnlock()
+	reply(w, struct {
+		Present []bool `json:"present"`
+	}{present})
+}
+
+func (h *Handler) stats(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) {
+		return
+	}
+	reply(w, h.Stats())
+}
+
+// Stats returns the statistics served by GET /stats.
+func (h *Handler) Stats() Stats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return Stats{
+		M:                 h.f.Cap(),
+		K:                 h.f.K(),
+		BitsSet:           h.f.BitSet().Count(),
+		FillRatio:         h.f.FillRatio(),
+		EstimatedKeys:     h.f.ApproximatedSize(),
+		FalsePositiveRate: h.f.CurrentFalsePositiveRate(),
+		Added:             h.added,
+	}
+}
+
+// allow reports whether the request has the method, and replies with an
+// error otherwise
+func allow(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
+
+func reply(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v) // #nosec
+}
+
+// Filter returns a copy of the filter.
+func (h *Handler) Filter() *bloom.BloomFilter {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.f.Copy()
+}
+
+// Save writes the filter to a file at path, as WriteTo does, replacing any
+// existing file. The filter is written to a temporary file in the same
+// directory, which is then renamed, so that path never holds a partial
+// filter. Requests are only blocked while the filter is copied.
+func (h *Handler) Save(path string) error {
+	_, err := h.save(path)
+	return err
+}
+
+// save saves the filter and returns the version saved
+func (h *Handler) save(path string) (uint64, error) {
+	h.mu.RLock()
+	f, version := h.f.Copy(), h.version
+	h.mu.RUnlock()
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return 0, err
+	}
+	w := bufio.NewWriter(tmp)
+	_, err = f.WriteTo(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	return version, nil
+}
+
+// Persist saves the filter to path every interval, if keys were added since
+// the last save, until the context is done; it then saves the filter a last
+// time, if needed, and returns nil. It returns the error of the first save
+// which fails. The filter can be read back with ReadFrom:
+//
+//	f := &bloom.BloomFilter{}
+//	file, err := os.Open("seen.bloom")
+//	...
+//	_, err = f.ReadFrom(bufio.NewReader(file))
+func (h *Handler) Persist(ctx context.Context, path string, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var saved uint64
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return h.persist(path, &saved)
+		}
+		if err := h.persist(path, &saved); err != nil {
+			return err
+		}
+	}
+}
+
+// persist saves the filter if its version is not the saved one
+func (h *Handler) persist(path string, saved *uint64) error {
+	h.mu.RLock()
+	version := h.version
+	h.mu.RUnlock()
+	if version == *saved {
+		return nil
+	}
+	version, err := h.save(path)
+	if err == nil {
+		*saved = version
+	}
+	return err
+}
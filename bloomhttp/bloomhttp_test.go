@@ -0,0 +1,99 @@
+package bloomhttp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+func request(t *testing.T, h http.Handler, method, target, body string, v interface{}) int {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: %v", method, target, err)
+		}
+	}
+	return w.Code
+}
+
+func TestHandler(t *testing.T) {
+	h := New(bloom.NewWithEstimates(1000, 0.001))
+	var added struct{ Added uint64 }
+	if code := request(t, h, "POST", "/add", "a\nb\nc", &added); code != http.StatusOK || added.Added != 3 {
+		t.Fatalf("POST /add: %d %+v", code, added)
+	}
+	var test struct{ Present []bool }
+	if code := request(t, h, "GET", "/test?key=b&key=d&key=a", "", &test); code != http.StatusOK ||
+		len(test.Present) != 3 || !test.Present[0] || test.Present[1] || !test.Present[2] {
+		t.Errorf("GET /test: %d %+v", code, test)
+	}
+	var stats Stats
+	if code := request(t, h, "GET", "/stats", "", &stats); code != http.StatusOK {
+		t.Fatalf("GET /stats: %d", code)
+	}
+	if stats.M != h.Filter().Cap() || stats.K != h.Filter().K() || stats.Added != 3 || stats.EstimatedKeys != 3 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	for _, c := range []struct {
+		method, target string
+		code           int
+	}{
+		{"GET", "/add", http.StatusMethodNotAllowed},
+		{"POST", "/test?key=a", http.StatusMethodNotAllowed},
+		{"GET", "/test", http.StatusBadRequest},
+		{"GET", "/other", http.StatusNotFound},
+	} {
+		if code := request(t, h, c.method, c.target, "", nil); code != c.code {
+			t.Errorf("%s %s: got %d, expected %d", c.method, c.target, code, c.code)
+		}
+	}
+
+	// The handler can be mounted under a prefix.
+	mux := http.NewServeMux()
+	mux.Handle("/seen/", http.StripPrefix("/seen", h))
+	if code := request(t, mux, "GET", "/seen/test?key=c", "", &test); code != http.StatusOK || !test.Present[0] {
+		t.Errorf("GET /seen/test: %d %+v", code, test)
+	}
+}
+
+func TestPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seen.bloom")
+	h := New(bloom.NewWithEstimates(1000, 0.001))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- h.Persist(ctx, path, time.Millisecond) }()
+	request(t, h, "POST", "/add", "a\nb", &struct{}{})
+	time.Sleep(20 * time.Millisecond)
+	request(t, h, "POST", "/add", "c", &struct{}{})
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	f := &bloom.BloomFilter{}
+	if _, err := f.ReadFrom(bufio.NewReader(file)); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Equal(h.Filter()) {
+		t.Error("the saved filter should hold all the keys")
+	}
+	if err := New(bloom.New(64, 1).AddString("a")).Save(filepath.Join(path, "x")); err == nil {
+		t.Error("saving to a missing directory should fail")
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Package bloomtest provides test helpers to check the statistical behavior
+of Bloom filters, typically in the tests of projects using them:
+
+	func TestBlocklist(t *testing.T) {
+		f := bloom.NewWithEstimates(uint(len(blocked)), 0.01)
+		for _, key := range blocked {
+			f.Add(key)
+		}
+		bloomtest.AssertNoFalseNegatives(t, f, blocked)
+		bloomtest.AssertFalsePositiveRate(t, f, nil, 0.01)
+	}
+
+The helpers accept any filter with a Test method, such as *bloom.BloomFilter.
+*/
+package bloomtest
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// A Filter is a membership test.
+type Filter interface {
+	Test(data []byte) bool
+}
+
+// z is the normal quantile of the 99% confidence intervals.
+const z = 2.576
+
+// maxReported is the number of failing keys reported before giving up.
+const maxReported = 10
+
+// SampleSize returns the number of negatives AssertFalsePositiveRate needs
+// to check a false positive rate of maxFP: enough to expect ten false
+// positives at the limit.
+func SampleSize(maxFP float64) int {
+	return int(math.Ceil(10 / maxFP))
+}
+
+// RandomKeys returns n random keys of the given size. The keys are the same
+// from one run to the next, so that failures are reproducible.
+func RandomKeys(n int, size int) [][]byte {
+	r := rand.New(rand.NewSource(int64(n)*31 + int64(size)))
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = make([]byte, size)
+		r.Read(keys[i]) // #nosec
+	}
+	return keys
+}
+
+// ConfidenceInterval returns the 99% Wilson score interval of a rate
+// observed as positives out of n trials.
+func ConfidenceInterval(positives, n int) (low, high float64) {
+	if n == 0 {
+		return 0, 1
+	}
+	p := float64(positives) / float64(n)
+	nf := float64(n)
+	center := (p + z*z/(2*nf)) / (1 + z*z/nf)
+	margin := z / (1 + z*z/nf) * math.Sqrt(p*(1-p)/nf+z*z/(4*nf*nf))
+	return math.Max(0, center-margin), math.Min(1, center+margin)
+}
+
+// AssertFalsePositiveRate tests the negatives, keys which were not added to
+// the filter, and reports an error if the false positive rate is above maxFP
+// with 99% confidence. Statistical noise alone thus rarely fails a test. If
+// negatives is nil, SampleSize(maxFP) random keys of 16 bytes are used.
+// An error is also reported when there are too few negatives to check the
+// rate.
+func AssertFalsePositiveRate(t testing.TB, f Filter, negatives [][]byte, maxFP float64) {
+	t.Helper()
+	if negatives == nil {
+		negatives = RandomKeys(SampleSize(maxFP), 16)
+	}
+	if len(negatives) < SampleSize(maxFP) {
+		t.Errorf("bloomtest: %d negatives are too few to check a false positive rate of %v, need %d",
+			len(negatives), maxFP, SampleSize(maxFP))
+		return
+	}
+	positives := 0
+	for _, key := range negatives {
+		if f.Test(key) {
+			positives++
+		}
+	}
+	low, high := ConfidenceInterval(positives, len(negatives))
+	if low > maxFP {
+		t.Errorf("bloomtest: false positive rate %v (99%% confidence interval [%v, %v]) exceeds %v",
+			float64(positives)/float64(len(negatives)), low, high, maxFP)
+	}
+}
+
+// AssertNoFalseNegatives reports an error for each member, a key which was
+// added to the filter, that tests negative. Bloom filters never have false
+// negatives, so any failure points to a bug, e.g., keys added to another
+// filter or a corrupted filter.
+func AssertNoFalseNegatives(t testing.TB, f Filter, members [][]byte) {
+	t.Helper()
+	failures := 0
+	for _, key := range members {
+		if !f.Test(key) {
+			failures++
+			if failures <= maxReported {
+				t.Errorf("bloomtest: member %q tests negative", key)
+			}
+		}
+	}
+	if failures > maxReported {
+		t.Errorf("bloomtest: %d members test negative in total", failures)
+	}
+}
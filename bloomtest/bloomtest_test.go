@@ -0,0 +1,77 @@
+package bloomtest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// recorder records the errors reported by the assertions.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertions(t *testing.T) {
+	members := RandomKeys(1000, 8)
+	f := bloom.NewWithEstimates(1000, 0.01)
+	for _, key := range members {
+		f.Add(key)
+	}
+	AssertNoFalseNegatives(t, f, members)
+	AssertFalsePositiveRate(t, f, nil, 0.01)
+	AssertFalsePositiveRate(t, f, RandomKeys(5000, 4), 0.01)
+}
+
+func TestAssertionsFailures(t *testing.T) {
+	members := RandomKeys(1000, 8)
+	f := bloom.New(1000, 4) // overloaded
+	for _, key := range members[:900] {
+		f.Add(key)
+	}
+	r := &recorder{}
+	AssertFalsePositiveRate(r, f, nil, 0.01)
+	if len(r.errors) != 1 {
+		t.Errorf("expected one error, got %v", r.errors)
+	}
+	r = &recorder{}
+	AssertFalsePositiveRate(r, f, RandomKeys(10, 16), 0.01)
+	if len(r.errors) != 1 {
+		t.Errorf("expected one error for a small sample, got %v", r.errors)
+	}
+	r = &recorder{}
+	AssertNoFalseNegatives(r, bloom.New(1000, 4), members)
+	if len(r.errors) != maxReported+1 {
+		t.Errorf("expected %d errors, got %d", maxReported+1, len(r.errors))
+	}
+}
+
+func TestConfidenceInterval(t *testing.T) {
+	low, high := ConfidenceInterval(10, 1000)
+	if low >= 0.01 || high <= 0.01 || low <= 0 {
+		t.Errorf("unexpected interval [%v, %v]", low, high)
+	}
+	low, high = ConfidenceInterval(0, 1000)
+	if low != 0 || high <= 0 || high > 0.01 {
+		t.Errorf("unexpected interval [%v, %v]", low, high)
+	}
+	if low, high = ConfidenceInterval(0, 0); low != 0 || high != 1 {
+		t.Errorf("unexpected interval [%v, %v]", low, high)
+	}
+}
+
+func TestRandomKeys(t *testing.T) {
+	a, b := RandomKeys(10, 4), RandomKeys(10, 4)
+	for i := range a {
+		if string(a[i]) != string(b[i]) || len(a[i]) != 4 {
+			t.Fatal("random keys should be reproducible")
+		}
+	}
+}
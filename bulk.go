@@ -0,0 +1,75 @@
+package bloom
+
+import (
+	"bufio"
+	"io"
+)
+
+// bulkBufferSize is the size of the buffer AddFromReader reads through, if
+// the stream is not buffered
+const bulkBufferSize = 64 << 10
+
+// AddFromReader adds the keys read from an i/o stream, each terminated by
+// the delimiter, as in a file of lines with '\n'. See AddFromReaderCount.
+func (f *BloomFilter) AddFromReader(r io.Reader, delim byte) error {
+	_, err := f.AddFromReaderCount(r, delim)
+	return err
+}
+
+// AddFromReaderCount adds the keys read from an i/o stream, each terminated
+// by the delimiter, and returns the number of keys added. The delimiters are
+// not part of the keys: consecutive delimiters delimit an empty key, and the
+// last key need not be followed by one. Keys are added in batches, see
+// AddBatch, without allocating memory for each key. If reading fails, the
+// keys read before the error are added.
+func (f *BloomFilter) AddFromReaderCount(r io.Reader, delim byte) (uint64, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReaderSize(r, bulkBufferSize)
+	}
+	var (
+		count uint64
+		buf   []byte // keys of the current batch, back to back
+		ends  [batchSize]int
+		keys  [batchSize][]byte
+		n     int // keys in the current batch
+		start int // start of the current key in buf
+	)
+	flush := func() {
+		begin := 0
+		for i, end := range ends[:n] {
+			keys[i] = buf[begin:end]
+			begin = end
+		}
+		f.AddBatch(keys[:n])
+		count += uint64(n)
+		buf, n, start = buf[:0], 0, 0
+	}
+	for {
+		line, err := br.ReadSlice(delim)
+		buf = append(buf, line...)
+		switch err {
+		case nil:
+			buf = buf[:len(buf)-1]
+		case bufio.ErrBufferFull:
+			continue // the key goes on
+		case io.EOF:
+			if len(buf) > start {
+				ends[n] = len(buf)
+				n++
+			}
+			flush()
+			return count, nil
+		default:
+			buf = buf[:start]
+			flush()
+			return count, err
+		}
+		ends[n] = len(buf)
+		n++
+		start = len(buf)
+		if n == batchSize {
+			flush()
+		}
+	}
+}
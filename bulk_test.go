@@ -0,0 +1,74 @@
+package bloom
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestAddFromReader(t *testing.T) {
+	var lines []string
+	for i := 0; i < 1000; i++ {
+		lines = append(lines, strings.Repeat(string(rune('a'+i%26)), i%50))
+	}
+	lines = append(lines, strings.Repeat("long", 10000)) // longer than the buffer
+	for _, input := range []string{
+		strings.Join(lines, "\n"),
+		strings.Join(lines, "\n") + "\n",
+	} {
+		f := NewWithEstimates(1000, 0.01)
+		n, err := f.AddFromReaderCount(iotest.OneByteReader(strings.NewReader(input)), '\n')
+		if err != nil || n != uint64(len(lines)) {
+			t.Errorf("got %d keys (%v), expected %d", n, err, len(lines))
+		}
+		g := NewWithEstimates(1000, 0.01)
+		for _, line := range lines {
+			g.AddString(line)
+		}
+		if !f.Equal(g) {
+			t.Error("AddFromReader should add the same keys as AddString")
+		}
+	}
+
+	f := NewWithEstimates(1000, 0.01)
+	if err := f.AddFromReader(strings.NewReader("a\x00\x00b"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if !f.TestString("a") || !f.TestString("") || !f.TestString("b") {
+		t.Error("the keys should be a, the empty key and b")
+	}
+
+	// The complete keys read before an error are added.
+	f = NewWithEstimates(1000, 0.01)
+	r := iotest.TimeoutReader(bufio.NewReaderSize(strings.NewReader("abc\ndef\nghi"), 16))
+	n, err := f.AddFromReaderCount(iotest.DataErrReader(r), '\n')
+	if !errors.Is(err, iotest.ErrTimeout) || n != 2 {
+		t.Errorf("got %d keys (%v)", n, err)
+	}
+	if !f.TestString("abc") || !f.TestString("def") {
+		t.Error("the keys read before the error should be added")
+	}
+}
+
+func TestAddFromReaderAllocations(t *testing.T) {
+	var input bytes.Buffer
+	for i := 0; i < 10000; i++ {
+		input.WriteString("key")
+		input.WriteString(strings.Repeat("x", i%20))
+		input.WriteByte('\n')
+	}
+	f := NewWithEstimates(10000, 0.01)
+	r := bytes.NewReader(input.Bytes())
+	br := bufio.NewReaderSize(r, bulkBufferSize)
+	allocs := testing.AllocsPerRun(10, func() {
+		r.Reset(input.Bytes())
+		br.Reset(r)
+		f.AddFromReader(br, '\n')
+	})
+	if allocs > 10 {
+		t.Errorf("AddFromReader should not allocate for each key: %v allocations", allocs)
+	}
+}
@@ -0,0 +1,138 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// CassandraFormat is the layout of the bitset of a Cassandra Bloom filter
+type CassandraFormat int
+
+const (
+	// CassandraLongs is the layout of the SSTable versions which Cassandra
+	// reads with oldBfFormat: the bitset is written as big-endian longs, bit
+	// i being bit i%64 of long i/64.
+	CassandraLongs CassandraFormat = iota
+	// CassandraBytes is the layout of later SSTable versions: the bitset is
+	// written as laid out in memory, bit i being bit i%8 of byte i/8.
+	CassandraBytes
+)
+
+// A CassandraBloomFilter is the Bloom filter of the partition keys of a
+// Cassandra SSTable, as stored in its Filter.db component. It is read-only:
+// it answers Test as Cassandra does, so that SSTables can be analyzed
+// offline.
+//
+// Keys are the serialized partition keys, as hashed by Murmur3Partitioner:
+// for instance, the UTF-8 bytes of a text key or the 4 big-endian bytes of
+// an int key. Composite partition keys are serialized as Cassandra does,
+// each component prefixed by its 16-bit length and followed by a zero byte.
+type CassandraBloomFilter struct {
+	k     uint
+	words []uint64
+}
+
+// ReadCassandraFilter reads a filter from an i/o stream, such as a Filter.db
+// component: the number of hash functions and the number of longs of the
+// bitset as big-endian 32-bit integers, then the bitset in the given format.
+func ReadCassandraFilter(stream io.Reader, format CassandraFormat) (*CassandraBloomFilter, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(stream, header[:]); err != nil {
+		return nil, err
+	}
+	k := int32(binary.BigEndian.Uint32(header[:]))
+	length := int32(binary.BigEndian.Uint32(header[4:]))
+	if k <= 0 || k > maxReadHashes || length <= 0 {
+		return nil, fmt.Errorf("bloom: invalid Cassandra Bloom filter with %d hash functions and %d longs", k, length)
+	}
+	var order binary.ByteOrder
+	switch format {
+	case CassandraLongs:
+		order = binary.BigEndian
+	case CassandraBytes:
+		order = binary.LittleEndian
+	default:
+		return nil, fmt.Errorf("bloom: unknown Cassandra Bloom filter format %d", format)
+	}
+	words, err := readUint64s(stream, uint64(length), order)
+	if err != nil {
+		return nil, err
+	}
+	return &CassandraBloomFilter{k: uint(k), words: words}, nil
+}
+
+// Cap returns the number of bits of the filter
+func (f *CassandraBloomFilter) Cap() uint {
+	return uint(64 * len(f.words))
+}
+
+// K returns the number of hash functions
+func (f *CassandraBloomFilter) K() uint {
+	return f.k
+}
+
+// cassandraHash returns the 128-bit MurmurHash3 of data with a zero seed, as
+// computed by Cassandra: like the reference implementation, except that the
+// bytes of the tail are sign-extended.
+func cassandraHash(data []byte) (h1, h2 uint64) {
+	var d digest128
+	d.bmix(data)
+	h1, h2 = d.h1, d.h2
+	tail := data[len(data)-len(data)%block_size:]
+	var k1, k2 uint64
+	for i := len(tail) - 1; i >= 0; i-- {
+		v := uint64(int64(int8(tail[i])))
+		if i >= 8 {
+			k2 ^= v << (8 * uint(i-8))
+		} else {
+			k1 ^= v << (8 * uint(i))
+		}
+	}
+	k2 *= c2_128
+	k2 = bits.RotateLeft64(k2, 33)
+	k2 *= c1_128
+	h2 ^= k2
+	k1 *= c1_128
+	k1 = bits.RotateLeft64(k1, 31)
+	k1 *= c2_128
+	h1 ^= k1
+
+	h1 ^= uint64(len(data))
+	h2 ^= uint64(len(data))
+	h1 += h2
+	h2 += h1
+	h1 = fmix64(h1)
+	h2 = fmix64(h2)
+	h1 += h2
+	h2 += h1
+	return h1, h2
+}
+
+// Test returns true if the serialized partition key is in the filter, false
+// otherwise. If true, the result might be a false positive. If false, the
+// key is definitely not in the SSTable.
+func (f *CassandraBloomFilter) Test(key []byte) bool {
+	h1, h2 := cassandraHash(key)
+	size := 64 * int64(len(f.words))
+	base := int64(h2)
+	for i := uint(0); i < f.k; i++ {
+		x := base % size
+		if x < 0 {
+			x = -x
+		}
+		if f.words[x>>6]&(1<<(uint(x)&63)) == 0 {
+			return false
+		}
+		base += int64(h1)
+	}
+	return true
+}
+
+// TestString returns true if the string is in the filter, false otherwise.
+// If true, the result might be a false positive. If false, the data
+// is definitely not in the set.
+func (f *CassandraBloomFilter) TestString(key string) bool {
+	return f.Test(stringToBytes(key))
+}
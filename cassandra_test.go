@@ -0,0 +1,140 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/twmb/murmur3"
+)
+
+func TestCassandraHash(t *testing.T) {
+	// The tokens of Murmur3Partitioner are the first half of the hash: those
+	// of the int keys 1, 2 and 3.
+	for i, token := range []int64{-4069959284402364209, -3248873570005575792, 9010454139840013625} {
+		key := make([]byte, 4)
+		binary.BigEndian.PutUint32(key, uint32(i+1))
+		if h1, _ := cassandraHash(key); int64(h1) != token {
+			t.Errorf("token of %d is %d, expected %d", i+1, int64(h1), token)
+		}
+	}
+	// Without bytes above 0x7f in the tail, the hash is the reference one.
+	r := rand.New(rand.NewSource(1))
+	for length := 0; length < 100; length++ {
+		data := make([]byte, length)
+		for i := range data {
+			data[i] = byte(r.Intn(0x80))
+		}
+		h1, h2 := cassandraHash(data)
+		if e1, e2 := murmur3.Sum128(data); h1 != e1 || h2 != e2 {
+			t.Fatalf("%d bytes: hashes %x, %x, expected %x, %x", length, h1, h2, e1, e2)
+		}
+	}
+	// Otherwise, the sign-extended bytes change it.
+	for _, c := range []struct {
+		data   string
+		h1, h2 uint64
+	}{
+		{"é", 0x4bcacd1ed0f55280, 0x19f7a5a335def7ad},
+		{"\x80", 0xb6aa75aff6f3b434, 0x6ec0210d9ab133c5},
+		{"0123456789abcdef\xff\xfe\xfd\xfc\xfb\xfa\xf9\xf8\xf7", 0x76f653e8e29d5177, 0xa0bee114fa8761d3},
+	} {
+		if h1, h2 := cassandraHash([]byte(c.data)); h1 != c.h1 || h2 != c.h2 {
+			t.Errorf("hashes of %q are %x, %x, expected %x, %x", c.data, h1, h2, c.h1, c.h2)
+		}
+	}
+}
+
+// cassandraFilter returns a filter holding the keys, serialized as by
+// BloomFilterSerializer in the given format
+func cassandraFilter(k int, longs int, keys []string, format CassandraFormat) []byte {
+	words := make([]uint64, longs)
+	size := int64(64 * longs)
+	for _, key := range keys {
+		h1, h2 := cassandraHash([]byte(key))
+		base := int64(h2)
+		for i := 0; i < k; i++ {
+			x := base % size
+			if x < 0 {
+				x = -x
+			}
+			words[x/64] |= 1 << uint(x%64)
+			base += int64(h1)
+		}
+	}
+	data := make([]byte, 8+8*longs)
+	binary.BigEndian.PutUint32(data, uint32(k))
+	binary.BigEndian.PutUint32(data[4:], uint32(longs))
+	for i, w := range words {
+		if format == CassandraLongs {
+			binary.BigEndian.PutUint64(data[8+8*i:], w)
+		} else {
+			binary.LittleEndian.PutUint64(data[8+8*i:], w)
+		}
+	}
+	return data
+}
+
+func TestReadCassandraFilter(t *testing.T) {
+	n := 10000
+	var keys []string
+	for i := 0; i < n; i++ {
+		keys = append(keys, strconv.Itoa(i)+"é")
+	}
+	for _, format := range []CassandraFormat{CassandraLongs, CassandraBytes} {
+		data := cassandraFilter(7, 1500, keys, format)
+		stream := bytes.NewReader(append(data, "tail"...))
+		f, err := ReadCassandraFilter(stream, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.K() != 7 || f.Cap() != 96000 || stream.Len() != 4 {
+			t.Fatalf("%d hash functions, %d bits, %d bytes left", f.K(), f.Cap(), stream.Len())
+		}
+		positives := 0
+		for i, key := range keys {
+			if !f.TestString(key) {
+				t.Fatalf("format %d: %s should be in", format, key)
+			}
+			if f.Test([]byte(strconv.Itoa(i) + "è")) {
+				positives++
+			}
+		}
+		if rate := float64(positives) / float64(n); rate > 0.02 {
+			t.Errorf("format %d: false positive rate %f is too high", format, rate)
+		}
+
+		for i := range data {
+			if _, err := ReadCassandraFilter(bytes.NewReader(data[:i]), format); err == nil {
+				t.Fatalf("%d bytes out of %d should not be accepted", i, len(data))
+			}
+		}
+	}
+
+	data := cassandraFilter(3, 2, []string{"a"}, CassandraLongs)
+	for name, corrupt := range map[string]func([]byte){
+		"hash functions": func(b []byte) { b[3] = 0 },
+		"negative":       func(b []byte) { b[0] = 0x80 },
+		"length":         func(b []byte) { b[7] = 0 },
+	} {
+		bad := append([]byte(nil), data...)
+		corrupt(bad)
+		if _, err := ReadCassandraFilter(bytes.NewReader(bad), CassandraLongs); err == nil {
+			t.Errorf("invalid %s should not be accepted", name)
+		}
+	}
+	if _, err := ReadCassandraFilter(bytes.NewReader(data), 2); err == nil {
+		t.Error("unknown formats should not be accepted")
+	}
+	// The formats only differ in the order of the bytes of each long.
+	f, _ := ReadCassandraFilter(bytes.NewReader(data), CassandraLongs)
+	swapped := append([]byte(nil), data...)
+	for i := 8; i < len(swapped); i += 8 {
+		binary.LittleEndian.PutUint64(swapped[i:], binary.BigEndian.Uint64(data[i:]))
+	}
+	if g, _ := ReadCassandraFilter(bytes.NewReader(swapped), CassandraBytes); !g.TestString("a") || g.words[0] != f.words[0] {
+		t.Error("both formats should hold the same bits")
+	}
+}
@@ -0,0 +1,56 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+
+	"github.com/bits-and-blooms/bitset"
+)
+
+// castagnoli is the CRC-32C table, which most processors compute in hardware
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrChecksum is returned when a framed filter (see WriteFramedTo) does not
+// match its checksum.
+var ErrChecksum = errors.New("bloom: checksum mismatch")
+
+// WriteFramedTo writes a binary representation of the BloomFilter to an i/o
+// stream in the framed format: the extended header, with the hash functions
+// and the encoding of the bitset, then the bitset, in the given encoding,
+// and a CRC-32C checksum of both. ReadFrom checks the checksum, so that
+// corrupted or truncated filters return an error instead of a different
+// filter. Filters written by WriteTo are read as before, without checksum.
+// It returns the number of bytes written.
+func (f *BloomFilter) WriteFramedTo(stream io.Writer, e Encoding) (int64, error) {
+	h := f.header()
+	h.encoding = e
+	h.checksum = true
+	return f.writeFilter(stream, h)
+}
+
+// readPayload reads the bitset of a serialized filter, after its header,
+// and checks its checksum, if any. The length of the bitset must be within
+// the limit. It returns the number of bytes read.
+func readPayload(stream io.Reader, h header, l limit) (*bitset.BitSet, int64, error) {
+	if !h.checksum {
+		return readBitSet(stream, h, l)
+	}
+	// The header read is hashed as it was written: a corrupted header would
+	// have been read as a different header.
+	sum := crc32.New(castagnoli)
+	h.writeTo(sum)
+	b, n, err := readBitSet(io.TeeReader(stream, sum), h, l)
+	if err != nil {
+		return nil, 0, err
+	}
+	var trailer [4]byte
+	if _, err := io.ReadFull(stream, trailer[:]); err != nil {
+		return nil, 0, unexpectedEOF(err)
+	}
+	if binary.BigEndian.Uint32(trailer[:]) != sum.Sum32() {
+		return nil, 0, ErrChecksum
+	}
+	return b, n + 4, nil
+}
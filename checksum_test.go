@@ -0,0 +1,89 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestWriteFramedTo(t *testing.T) {
+	for _, e := range []Encoding{EncodingRaw, EncodingGolomb, EncodingGzip} {
+		for _, create := range []func() *BloomFilter{
+			func() *BloomFilter { return NewWithEstimates(1000, 0.01) },
+			func() *BloomFilter { return NewWithEstimatesAndSeed(1000, 0.01, 42) },
+			func() *BloomFilter { return NewKeyed(1000, 7, [16]byte{1}) },
+		} {
+			f := create()
+			for i := uint32(0); i < 300; i++ {
+				f.AddUint32(i)
+			}
+			var buf bytes.Buffer
+			n, err := f.WriteFramedTo(&buf, e)
+			if err != nil || n != int64(buf.Len()) {
+				t.Fatalf("wrote %d bytes out of %d: %v", n, buf.Len(), err)
+			}
+			data := buf.Bytes()
+			if binary.BigEndian.Uint32(data) != formatMagic {
+				t.Errorf("framed filters should start with the magic word: %x", data[:4])
+			}
+			g := create()
+			m, err := g.ReadFrom(bytes.NewReader(data))
+			if err != nil || m != n || !f.Equal(g) {
+				t.Fatalf("encoding %d: read %d bytes out of %d: %v", e, m, n, err)
+			}
+			h := create()
+			if _, err := h.MergeFromReader(bytes.NewReader(data)); err != nil || !h.Equal(f) {
+				t.Errorf("MergeFromReader should read framed filters: %v", err)
+			}
+
+			for i := range data {
+				if _, err := g.ReadFrom(bytes.NewReader(data[:i])); err == nil {
+					t.Fatalf("%d bytes out of %d should not be accepted", i, len(data))
+				}
+				if i < 4 {
+					// Without the magic word, the filter is read in the
+					// original format, which cannot detect corruption.
+					continue
+				}
+				bad := append([]byte(nil), data...)
+				bad[i] ^= 0xff
+				if _, err := g.ReadFrom(bytes.NewReader(bad)); err == nil {
+					t.Fatalf("encoding %d: corrupted byte %d out of %d should not be accepted", e, i, len(data))
+				}
+				if _, err := h.MergeFromReader(bytes.NewReader(bad)); err == nil {
+					t.Fatalf("encoding %d: corrupted byte %d out of %d should not be merged", e, i, len(data))
+				}
+			}
+		}
+	}
+}
+
+func TestFramedHeader(t *testing.T) {
+	f := New(1000, 4)
+	var buf bytes.Buffer
+	f.WriteFramedTo(&buf, EncodingRaw)
+	h, _, err := readHeader(&buf)
+	if err != nil || !h.checksum || h.m != 1000 || h.k != 4 {
+		t.Errorf("unexpected header %v: %v", h, err)
+	}
+	// The hash functions are explicit, after m and k.
+	buf.Reset()
+	f.WriteFramedTo(&buf, EncodingRaw)
+	data := buf.Bytes()
+	if data[24] != optionHash || binary.BigEndian.Uint64(data[25:]) != hashMurmur {
+		t.Errorf("unexpected options %x", data[24:])
+	}
+
+	// The checksum covers the header.
+	var g BloomFilter
+	bad := append([]byte(nil), data...)
+	bad[15]++ // m
+	if _, err := g.ReadFrom(bytes.NewReader(bad)); err != ErrChecksum {
+		t.Errorf("corrupted m should not match the checksum: %v", err)
+	}
+	bad = append([]byte(nil), data...)
+	bad[len(bad)-1]++
+	if _, err := g.ReadFrom(bytes.NewReader(bad)); err != ErrChecksum {
+		t.Errorf("corrupted checksums should not match: %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+package bloom
+
+import (
+	"errors"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// compactChecks is the number of times per period of WithAutoCompact
+	// that a CompactingBloomFilter estimates the number of its keys
+	compactChecks = 8
+	// compactMinBits is the size below which filters are not folded
+	compactMinBits = 64
+)
+
+// A CompactingBloomFilter is a Bloom filter for long-lived services, safe for
+// concurrent use, which reclaims memory when it is heavily over-provisioned:
+// with WithAutoCompact(threshold, period), once its approximated size has
+// stayed below threshold times the number of keys it is sized for, n, during
+// period, it folds itself in half (see Fold) and swaps the folded filter in.
+// It is then sized for n/2 keys, and may be folded again later, down to the
+// minimum number of bits of WithMinBits, or 64.
+//
+// Folding keeps the keys and k, so with a threshold of at most 0.5, the false
+// positive rate of the folded filter is at most the rate it was created for.
+// It grows faster than before with the keys added afterwards, though: a
+// folded filter is meant for workloads whose size has durably decreased.
+//
+// The size is estimated by Add, eight times per period, so that no goroutine
+// is needed; the Add doing it then takes time proportional to m.
+// Add and Test share a read lock, which a compaction holds for writing, so
+// that no key added concurrently is lost.
+type CompactingBloomFilter struct {
+	// next is the time of the next check, in Unix nanoseconds. It is
+	// accessed atomically, and thus first, to be 64-bit aligned on 32-bit
+	// platforms.
+	next int64
+
+	mu     sync.RWMutex // held for writing to replace filter
+	filter *ConcurrentBloomFilter
+	n      uint // number of keys filter is sized for, guarded by mu
+
+	threshold float64
+	period    time.Duration
+	minBits   uint
+	checking  sync.Mutex // held by check, guards below
+	below     time.Time  // start of the checks below the threshold, if any
+	now       func() time.Time
+}
+
+// NewCompacting creates a new compacting Bloom filter for about n items with
+// fp false positive rate, as NewWithOptions does, with the number of bits
+// rounded up to a multiple of 64 unless the options say otherwise. It only
+// folds itself with WithAutoCompact.
+func NewCompacting(n uint, fp float64, opts ...Option) (*CompactingBloomFilter, error) {
+	f, err := NewWithOptions(n, fp, append([]Option{WithRoundUp(64)}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.compactThreshold != 0 && !(o.compactThreshold > 0 && o.compactThreshold < 1 && o.compactPeriod > 0) {
+		return nil, errors.New("bloom: the compaction threshold must be within (0, 1) and its period positive")
+	}
+	c := &CompactingBloomFilter{
+		filter:    NewConcurrentFrom(f),
+		n:         n,
+		threshold: o.compactThreshold,
+		period:    o.compactPeriod,
+		minBits:   max(compactMinBits, o.minBits),
+		now:       time.Now,
+	}
+	c.next = c.now().Add(c.period / compactChecks).UnixNano()
+	return c, nil
+}
+
+// Cap returns the capacity, _m_, of the filter, which compactions halve
+func (c *CompactingBloomFilter) Cap() uint {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.filter.m
+}
+
+// K returns the number of hash functions used in the filter
+func (c *CompactingBloomFilter) K() uint {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.filter.k
+}
+
+// N returns the number of keys the filter is sized for, which compactions
+// halve
+func (c *CompactingBloomFilter) N() uint {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.n
+}
+
+// Add data to the filter, after checking whether it must be compacted.
+// Returns the filter (allows chaining)
+func (c *CompactingBloomFilter) Add(data []byte) *CompactingBloomFilter {
+	if c.threshold > 0 {
+		now := c.now()
+		next := atomic.LoadInt64(&c.next)
+		if now.UnixNano() >= next && atomic.CompareAndSwapInt64(&c.next, next, now.Add(c.period/compactChecks).UnixNano()) {
+			c.check(now)
+		}
+	}
+	c.mu.RLock()
+	c.filter.Add(data)
+	c.mu.RUnlock()
+	return c
+}
+
+// AddString to the filter. Returns the filter (allows chaining)
+func (c *CompactingBloomFilter) AddString(data string) *CompactingBloomFilter {
+	return c.Add(stringToBytes(data))
+}
+
+// Test returns true if the data is in the filter, false otherwise. If true,
+// the result might be a false positive. If false, the data is definitely
+// not in the set.
+func (c *CompactingBloomFilter) Test(data []byte) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.filter.Test(data)
+}
+
+// TestString returns true if the string is in the filter, false otherwise.
+// See Test.
+func (c *CompactingBloomFilter) TestString(data string) bool {
+	return c.Test(stringToBytes(data))
+}
+
+// Snapshot returns a BloomFilter holding a copy of the keys of the filter.
+// Keys added concurrently may or may not be in the copy.
+func (c *CompactingBloomFilter) Snapshot() *BloomFilter {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.filter.Snapshot()
+}
+
+// check estimates the number of keys of the filter, and compacts it if it
+// has been below the threshold for a period
+func (c *CompactingBloomFilter) check(now time.Time) {
+	c.checking.Lock()
+	defer c.checking.Unlock()
+	c.mu.RLock()
+	size, _ := approximatedSize(c.filter.count(), c.filter.m, c.filter.k)
+	n := c.n
+	c.mu.RUnlock()
+	if size >= c.threshold*float64(n) {
+		c.below = time.Time{}
+		return
+	}
+	if c.below.IsZero() {
+		c.below = now
+	}
+	if now.Sub(c.below) < c.period {
+		return
+	}
+	c.below = time.Time{}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.filter.m%2 != 0 || c.filter.m/2 < c.minBits {
+		return
+	}
+	folded, err := c.filter.Snapshot().Fold(2)
+	if err != nil {
+		return
+	}
+	c.filter = NewConcurrentFrom(folded)
+	c.n = max(1, c.n/2)
+}
+
+// count returns the number of bits set in the filter, reading each word
+// atomically
+func (f *ConcurrentBloomFilter) count() uint {
+	n := 0
+	for i := range f.words {
+		n += bits.OnesCount64(atomic.LoadUint64(&f.words[i]))
+	}
+	return uint(n)
+}
@@ -0,0 +1,194 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestCompacting returns a compacting filter for 10000 keys with a clock
+// which the test advances
+func newTestCompacting(t *testing.T, opts ...Option) (*CompactingBloomFilter, *time.Time) {
+	c, err := NewCompacting(10000, 0.01, append([]Option{WithAutoCompact(0.25, time.Hour)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := time.Unix(0, 0)
+	c.now = func() time.Time { return clock }
+	c.next = clock.Add(time.Hour / compactChecks).UnixNano()
+	return c, &clock
+}
+
+func TestCompacting(t *testing.T) {
+	c, clock := newTestCompacting(t)
+	m := c.Cap()
+	if m%64 != 0 || c.N() != 10000 || c.K() != 7 {
+		t.Errorf("m = %d, n = %d, k = %d", m, c.N(), c.K())
+	}
+	n := make([]byte, 4)
+	for i := uint32(0); i < 1000; i++ {
+		binary.BigEndian.PutUint32(n, i)
+		c.Add(n)
+	}
+	// The filter must stay below the threshold for a period.
+	for i := 0; i <= compactChecks; i++ {
+		if c.Cap() != m {
+			t.Fatalf("the filter was compacted after %d checks", i)
+		}
+		*clock = clock.Add(time.Hour / compactChecks)
+		c.AddString("Love")
+	}
+	if c.Cap() != m/2 || c.N() != 5000 {
+		t.Errorf("m = %d, n = %d, the filter should have been folded", c.Cap(), c.N())
+	}
+	for i := uint32(0); i < 1000; i++ {
+		binary.BigEndian.PutUint32(n, i)
+		if !c.Test(n) {
+			t.Errorf("%v should be in.", i)
+		}
+	}
+	if !c.TestString("Love") {
+		t.Error("Love should be in.")
+	}
+
+	// 1000 keys are above a quarter of 2500.
+	for i := 0; i < 10*compactChecks; i++ {
+		*clock = clock.Add(time.Hour / compactChecks)
+		c.AddString("Love")
+	}
+	if c.Cap() != m/4 || c.N() != 2500 {
+		t.Errorf("m = %d, n = %d, the filter should have been folded once more", c.Cap(), c.N())
+	}
+	if rate := c.Snapshot().CurrentFalsePositiveRate(); rate > 0.01 {
+		t.Errorf("the false positive rate %v should be below 0.01", rate)
+	}
+}
+
+func TestCompactingAboveThreshold(t *testing.T) {
+	c, clock := newTestCompacting(t)
+	m := c.Cap()
+	n := make([]byte, 4)
+	for i := uint32(0); i < 3000; i++ {
+		binary.BigEndian.PutUint32(n, i)
+		c.Add(n)
+	}
+	for i := 0; i < 10*compactChecks; i++ {
+		*clock = clock.Add(time.Hour / compactChecks)
+		c.AddString("Love")
+	}
+	if c.Cap() != m {
+		t.Errorf("m = %d, the filter should not have been folded", c.Cap())
+	}
+
+	// Going above the threshold restarts the period.
+	c, clock = newTestCompacting(t)
+	for i := 0; i < compactChecks; i++ {
+		*clock = clock.Add(time.Hour / compactChecks)
+		c.AddString("Love")
+	}
+	for i := uint32(0); i < 3000; i++ {
+		binary.BigEndian.PutUint32(n, i)
+		c.Add(n)
+	}
+	*clock = clock.Add(time.Hour / compactChecks)
+	c.AddString("Love")
+	if c.Cap() != m {
+		t.Errorf("m = %d, the filter should not have been folded", c.Cap())
+	}
+}
+
+func TestCompactingMinBits(t *testing.T) {
+	c, clock := newTestCompacting(t, WithMinBits(30000))
+	for i := 0; i < 100*compactChecks; i++ {
+		*clock = clock.Add(time.Hour / compactChecks)
+		c.AddString("Love")
+	}
+	if c.Cap() < 30000 || c.Cap() >= 60000 {
+		t.Errorf("m = %d, the filter should have been folded down to 30000 bits", c.Cap())
+	}
+
+	// Without WithAutoCompact, the filter is never folded.
+	d, err := NewCompacting(10000, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := d.Cap()
+	d.next = 0
+	d.AddString("Love")
+	if d.Cap() != m {
+		t.Errorf("m = %d, the filter should not have been folded", d.Cap())
+	}
+}
+
+func TestCompactingInvalid(t *testing.T) {
+	for _, opt := range []Option{
+		WithAutoCompact(-1, time.Hour),
+		WithAutoCompact(1, time.Hour),
+		WithAutoCompact(0.25, 0),
+	} {
+		if _, err := NewCompacting(10000, 0.01, opt); err == nil {
+			t.Error("an error was expected")
+		}
+	}
+	if _, err := NewCompacting(0, 0.01); err == nil {
+		t.Error("an error was expected")
+	}
+}
+
+func TestCompactingConcurrent(t *testing.T) {
+	c, err := NewCompacting(100000, 0.01, WithAutoCompact(0.5, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := c.Cap()
+	// The accessors must not race with compactions.
+	done := make(chan struct{})
+	accessors := make(chan struct{})
+	go func() {
+		defer close(accessors)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				if c.K() == 0 {
+					t.Error("k should be positive")
+				}
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			n := make([]byte, 4)
+			for i := 0; i < 2000; i++ {
+				binary.BigEndian.PutUint32(n, uint32(g<<16|i))
+				c.Add(n)
+				if !c.Test(n) {
+					t.Errorf("%d should be in.", g<<16|i)
+				}
+				if i%100 == 0 {
+					time.Sleep(time.Millisecond)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(done)
+	<-accessors
+	n := make([]byte, 4)
+	for g := 0; g < 4; g++ {
+		for i := 0; i < 2000; i++ {
+			binary.BigEndian.PutUint32(n, uint32(g<<16|i))
+			if !c.Test(n) {
+				t.Fatalf("%d should be in.", g<<16|i)
+			}
+		}
+	}
+	if c.Cap() >= m {
+		t.Errorf("m = %d, the filter should have been folded", c.Cap())
+	}
+}
@@ -0,0 +1,81 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/twmb/murmur3"
+)
+
+// The fixtures in testdata are a filter with m=1000 and k=4 holding the
+// keys below, in the binary and JSON formats of the v2 and v3 releases.
+var legacyKeys = []string{"Love", "Hate", "bloom", "filter"}
+
+// legacyLocations returns the locations of a key as the v2 releases
+// computed them, with the murmur3 hasher rather than sum256
+func legacyLocations(key string, m, k uint64) []uint64 {
+	hasher := murmur3.New128()
+	hasher.Write([]byte(key))
+	v1, v2 := hasher.Sum128()
+	hasher.Write([]byte{1})
+	v3, v4 := hasher.Sum128()
+	h := [4]uint64{v1, v2, v3, v4}
+	locs := make([]uint64, k)
+	for i := uint64(0); i < k; i++ {
+		locs[i] = (h[i%2] + i*h[2+(((i+(i%2))%4)/2)]) % m
+	}
+	return locs
+}
+
+func TestLegacyFixtures(t *testing.T) {
+	raw, err := os.ReadFile("testdata/legacy.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := os.ReadFile("testdata/legacy.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f, g, h BloomFilter
+	if _, err := f.ReadFrom(bytes.NewReader(raw)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.ReadFromLimited(bytes.NewReader(raw), 1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(text, &h); err != nil {
+		t.Fatal(err)
+	}
+	if f.Cap() != 1000 || f.K() != 4 || !f.Equal(&g) || !f.Equal(&h) {
+		t.Fatalf("unexpected filters %d, %d", f.Cap(), f.K())
+	}
+
+	// The filter holds the bits set by the v2 hashing, and no other.
+	expected := New(1000, 4)
+	for _, key := range legacyKeys {
+		if !f.TestString(key) {
+			t.Errorf("%s should be in the filter", key)
+		}
+		for _, l := range legacyLocations(key, 1000, 4) {
+			if !f.b.Test(uint(l)) {
+				t.Errorf("%s: bit %d should be set", key, l)
+			}
+			expected.b.Set(uint(l))
+		}
+	}
+	if !f.Equal(expected) {
+		t.Error("the filter has unexpected bits set")
+	}
+
+	// Filters are still written byte for byte the same.
+	data, err := f.MarshalBinary()
+	if err != nil || !bytes.Equal(data, raw) {
+		t.Errorf("the binary format changed: %x", data)
+	}
+	data, err = json.Marshal(&f)
+	if err != nil || !bytes.Equal(data, text) {
+		t.Errorf("the JSON format changed: %s", data)
+	}
+}
@@ -0,0 +1,189 @@
+package bloom
+
+import (
+	"io"
+	"sync/atomic"
+
+	"github.com/bits-and-blooms/bitset"
+)
+
+// A ConcurrentBloomFilter is a Bloom filter which is safe for concurrent use
+// without locking: Add sets bits with atomic compare-and-swap operations on
+// the words of the filter and Test reads them with atomic loads. It has the
+// same bit layout, hashing and binary representation as a BloomFilter of the
+// same size.
+//
+// Each operation is atomic bit by bit, not as a whole: a Test running
+// concurrently with the Add of the same key may return either result, but a
+// Test which starts after an Add returns is always true.
+type ConcurrentBloomFilter struct {
+	m     uint
+	k     uint
+	words []uint64
+	hashing
+	fastRange bool
+}
+
+// NewConcurrent creates a new concurrent Bloom filter with _m_ bits and _k_
+// hashing functions. We force _m_ and _k_ to be at least one to avoid panics.
+func NewConcurrent(m uint, k uint) *ConcurrentBloomFilter {
+	m = max(1, m)
+	return &ConcurrentBloomFilter{
+		m:     m,
+		k:     max(1, k),
+		words: make([]uint64, (uint64(m)+63)/64),
+	}
+}
+
+// NewConcurrentWithEstimates creates a new concurrent Bloom filter for about
+// n items with fp false positive rate
+func NewConcurrentWithEstimates(n uint, fp float64) *ConcurrentBloomFilter {
+	m, k := EstimateParameters(n, fp)
+	return NewConcurrent(m, k)
+}
+
+// NewConcurrentFrom creates a new concurrent Bloom filter holding a copy of
+// the keys of a Bloom filter, with the same hash functions.
+func NewConcurrentFrom(f *BloomFilter) *ConcurrentBloomFilter {
+	g := NewConcurrent(f.m, f.k)
+	copy(g.words, f.b.Words())
+	g.hashing = f.hashing
+	g.fastRange = f.fastRange
+	return g
+}
+
+// Cap returns the capacity, _m_, of a Bloom filter
+func (f *ConcurrentBloomFilter) Cap() uint {
+	return f.m
+}
+
+// K returns the number of hash functions used in the ConcurrentBloomFilter
+func (f *ConcurrentBloomFilter) K() uint {
+	return f.k
+}
+
+// location returns the ith hashed location using the four base hash values
+func (f *ConcurrentBloomFilter) location(h [4]uint64, i uint) uint64 {
+	if f.fastRange {
+		return fastRange(location(h, i), uint64(f.m))
+	}
+	return location(h, i) % uint64(f.m)
+}
+
+// set atomically sets the bit at a location and returns true if it was
+// already set
+func (f *ConcurrentBloomFilter) set(l uint64) bool {
+	return setBit(f.words, l)
+}
+
+// setBit atomically sets bit l of the words and returns true if it was
+// already set
+func setBit(words []uint64, l uint64) bool {
+	addr := &words[l/64]
+	mask := uint64(1) << (l % 64)
+	for {
+		old := atomic.LoadUint64(addr)
+		if old&mask != 0 {
+			return true
+		}
+		if atomic.CompareAndSwapUint64(addr, old, old|mask) {
+			return false
+		}
+	}
+}
+
+// isSet atomically reads the bit at a location
+func (f *ConcurrentBloomFilter) isSet(l uint64) bool {
+	return atomic.LoadUint64(&f.words[l/64])&(uint64(1)<<(l%64)) != 0
+}
+
+// Add data to the Bloom Filter. Returns the filter (allows chaining)
+func (f *ConcurrentBloomFilter) Add(data []byte) *ConcurrentBloomFilter {
+	f.TestAndAdd(data)
+	return f
+}
+
+// AddString to the Bloom Filter. Returns the filter (allows chaining)
+func (f *ConcurrentBloomFilter) AddString(data string) *ConcurrentBloomFilter {
+	return f.Add(stringToBytes(data))
+}
+
+// Test returns true if the data is in the ConcurrentBloomFilter, false
+// otherwise. If true, the result might be a false positive. If false, the
+// data is definitely not in the set.
+func (f *ConcurrentBloomFilter) Test(data []byte) bool {
+	h := f.hashes(data)
+	for i := uint(0); i < f.k; i++ {
+		if !f.isSet(f.location(h, i)) {
+			return false
+		}
+	}
+	return true
+}
+
+// TestString returns true if the string is in the ConcurrentBloomFilter,
+// false otherwise. If true, the result might be a false positive. If false,
+// the data is definitely not in the set.
+func (f *ConcurrentBloomFilter) TestString(data string) bool {
+	return f.Test(stringToBytes(data))
+}
+
+// TestAndAdd is equivalent to calling Test(data) then Add(data), with the
+// bits tested as they are set. When several goroutines add the same key
+// concurrently, more than one of them may get false.
+func (f *ConcurrentBloomFilter) TestAndAdd(data []byte) bool {
+	h := f.hashes(data)
+	present := true
+	for i := uint(0); i < f.k; i++ {
+		if !f.set(f.location(h, i)) {
+			present = false
+		}
+	}
+	return present
+}
+
+// TestAndAddString is the equivalent to calling Test(string) then
+// Add(string). See TestAndAdd.
+func (f *ConcurrentBloomFilter) TestAndAddString(data string) bool {
+	return f.TestAndAdd(stringToBytes(data))
+}
+
+// ClearAll clears all the data in a Bloom filter, removing all keys. Keys
+// added concurrently may or may not be removed.
+func (f *ConcurrentBloomFilter) ClearAll() *ConcurrentBloomFilter {
+	for i := range f.words {
+		atomic.StoreUint64(&f.words[i], 0)
+	}
+	return f
+}
+
+// Snapshot returns a BloomFilter holding a copy of the keys of the filter.
+// Keys added concurrently may or may not be in the copy.
+func (f *ConcurrentBloomFilter) Snapshot() *BloomFilter {
+	b := bitset.New(f.m)
+	words := b.Words()
+	for i := range f.words {
+		words[i] = atomic.LoadUint64(&f.words[i])
+	}
+	return &BloomFilter{m: f.m, k: f.k, b: b, hashing: f.hashing, fastRange: f.fastRange}
+}
+
+// WriteTo writes a binary representation of a snapshot of the filter to an
+// i/o stream, in the format of BloomFilter.WriteTo. It returns the number of
+// bytes written.
+func (f *ConcurrentBloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	return f.Snapshot().WriteTo(stream)
+}
+
+// ReadFrom reads a binary representation of a BloomFilter (such as might
+// have been written by WriteTo()) from an i/o stream. It returns the number
+// of bytes read. It must not be called concurrently with other methods.
+func (f *ConcurrentBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	g := BloomFilter{hashing: f.hashing}
+	n, err := g.ReadFrom(stream)
+	if err != nil {
+		return n, err
+	}
+	*f = *NewConcurrentFrom(&g)
+	return n, nil
+}
@@ -0,0 +1,96 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentBasic(t *testing.T) {
+	f := NewConcurrent(1000, 4)
+	n1 := []byte("Bess")
+	n2 := []byte("Jane")
+	if f.TestAndAdd(n1) {
+		t.Errorf("%v should not be in before being added.", n1)
+	}
+	if !f.Test(n1) || !f.TestAndAddString("Bess") {
+		t.Errorf("%v should be in.", n1)
+	}
+	if f.Test(n2) {
+		t.Errorf("%v should not be in.", n2)
+	}
+	f.AddString("Jane")
+	if !f.TestString("Jane") {
+		t.Errorf("%v should be in.", n2)
+	}
+	f.ClearAll()
+	if f.Test(n1) || f.Test(n2) {
+		t.Error("ClearAll should remove all keys")
+	}
+}
+
+func TestConcurrentSameAsBloomFilter(t *testing.T) {
+	f := NewConcurrentWithEstimates(1000, 0.01)
+	g := NewWithEstimates(1000, 0.01)
+	key := make([]byte, 4)
+	for i := uint32(0); i < 1000; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		f.Add(key)
+		g.Add(key)
+	}
+	if !f.Snapshot().Equal(g) || !NewConcurrentFrom(g).Snapshot().Equal(g) {
+		t.Fatal("the concurrent filter should have the layout of a BloomFilter")
+	}
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var h BloomFilter
+	if _, err := h.ReadFrom(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	var c ConcurrentBloomFilter
+	if _, err := c.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !h.Equal(g) || !c.Snapshot().Equal(g) {
+		t.Error("serialization should match BloomFilter")
+	}
+}
+
+func TestConcurrentAdd(t *testing.T) {
+	f := NewConcurrentWithEstimates(80000, 0.01)
+	var wg sync.WaitGroup
+	for w := uint32(0); w < 8; w++ {
+		wg.Add(1)
+		go func(w uint32) {
+			defer wg.Done()
+			key := make([]byte, 4)
+			// All workers add the same keys, and the keys of their own.
+			for i := uint32(0); i < 10000; i++ {
+				binary.BigEndian.PutUint32(key, i)
+				f.TestAndAdd(key)
+				binary.BigEndian.PutUint32(key, (w+1)<<20|i)
+				f.Add(key)
+			}
+		}(w)
+	}
+	wg.Wait()
+	key := make([]byte, 4)
+	for i := uint32(0); i < 10000; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		if !f.TestAndAdd(key) {
+			t.Fatalf("shared key %d was lost", i)
+		}
+	}
+	for w := uint32(0); w < 8; w++ {
+		for i := uint32(0); i < 10000; i++ {
+			binary.BigEndian.PutUint32(key, (w+1)<<20|i)
+			if !f.Test(key) {
+				t.Fatalf("key %d of worker %d was lost", i, w)
+			}
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"time"
+)
+
+// A CountingBloomFilter is a Bloom filter which keeps a small counter,
+// instead of a bit, at each of its _m_ locations, so that keys can be
+// removed. Adding a key increments its _k_ counters and removing it
+// decrements them.
+//
+// Counters are packed in 64-bit words and have a configurable width: with
+// the default 4-bit counters, the filter uses four times the memory of a
+// BloomFilter. A counter which reaches its maximum value (15 for 4-bit
+// counters) saturates: it is no longer incremented nor decremented, since
+// its true value is unknown. A saturated location thus stays set forever,
+// which may add false positives but never false negatives.
+//
+// Only remove keys which were added: removing a false positive decrements
+// counters of other keys, which may then test negative.
+//
+// Keys may also expire, see Sweep, SetSweepRate and SetStaleness: a clock
+// hand goes around the counters and decrements them, so that keys which are
+// not added again are forgotten.
+type CountingBloomFilter struct {
+	m        uint
+	k        uint
+	width    uint
+	counters []uint64
+
+	step     uint64        // amount added to the counters by Add, see SetStaleness
+	hand     uint64        // location of the next counter swept
+	sweep    uint64        // number of counters swept per interval
+	interval time.Duration // time between automatic sweeps, if positive
+	last     time.Time     // time of the last automatic sweep
+	now      func() time.Time
+}
+
+// NewCounting creates a new counting Bloom filter with _m_ counters of
+// _width_ bits and _k_ hashing functions. The width is rounded up to a power
+// of two between 1 and 32, so that counters do not straddle words. We force
+// _m_ and _k_ to be at least one to avoid panics.
+func NewCounting(m uint, k uint, width uint) *CountingBloomFilter {
+	m = max(1, m)
+	w := uint(1)
+	for w < width && w < 32 {
+		w *= 2
+	}
+	return &CountingBloomFilter{
+		m:        m,
+		k:        max(1, k),
+		width:    w,
+		counters: make([]uint64, (uint64(m)*uint64(w)+63)/64),
+		step:     1,
+		now:      time.Now,
+	}
+}
+
+// NewCountingWithEstimates creates a new counting Bloom filter with 4-bit
+// counters for about n items with fp false positive rate
+func NewCountingWithEstimates(n uint, fp float64) *CountingBloomFilter {
+	m, k := EstimateParameters(n, fp)
+	return NewCounting(m, k, 4)
+}
+
+// Cap returns the capacity, _m_, of a counting Bloom filter
+func (f *CountingBloomFilter) Cap() uint {
+	return f.m
+}
+
+// K returns the number of hash functions used in the CountingBloomFilter
+func (f *CountingBloomFilter) K() uint {
+	return f.k
+}
+
+// CounterWidth returns the size of the counters in bits
+func (f *CountingBloomFilter) CounterWidth() uint {
+	return f.width
+}
+
+// location returns the ith hashed location using the four base hash values
+func (f *CountingBloomFilter) location(h [4]uint64, i uint) uint64 {
+	return location(h, i) % uint64(f.m)
+}
+
+// maxCount returns the value of saturated counters
+func (f *CountingBloomFilter) maxCount() uint64 {
+	return 1<<f.width - 1
+}
+
+// get returns the value of the counter at a location
+func (f *CountingBloomFilter) get(l uint64) uint64 {
+	offset := l * uint64(f.width)
+	return f.counters[offset/64] >> (offset % 64) & f.maxCount()
+}
+
+// add adds delta, modulo 2^64, to the counter at a location
+func (f *CountingBloomFilter) add(l uint64, delta uint64) {
+	offset := l * uint64(f.width)
+	f.counters[offset/64] += delta << (offset % 64)
+}
+
+// Add data to the counting Bloom filter, after the automatic sweeps which
+// are due. Returns the filter (allows chaining)
+func (f *CountingBloomFilter) Add(data []byte) *CountingBloomFilter {
+	f.Expire()
+	h := baseHashes(data)
+	for i := uint(0); i < f.k; i++ {
+		l := f.location(h, i)
+		if c := f.get(l); c < f.maxCount() {
+			f.add(l, min64(f.step, f.maxCount()-c))
+		}
+	}
+	return f
+}
+
+// AddString to the counting Bloom filter. Returns the filter (allows chaining)
+func (f *CountingBloomFilter) AddString(data string) *CountingBloomFilter {
+	return f.Add(stringToBytes(data))
+}
+
+// Test returns true if the data is in the CountingBloomFilter, false
+// otherwise. If true, the result might be a false positive. If false, the
+// data is definitely not in the set. Keys swept automatically (see
+// SetSweepRate) are absent, but Test does not modify the filter.
+func (f *CountingBloomFilter) Test(data []byte) bool {
+	h := baseHashes(data)
+	pending, _ := f.pending()
+	for i := uint(0); i < f.k; i++ {
+		if f.swept(f.location(h, i), pending) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// TestString returns true if the string is in the CountingBloomFilter, false
+// otherwise. If true, the result might be a false positive. If false, the
+// data is definitely not in the set.
+func (f *CountingBloomFilter) TestString(data string) bool {
+	return f.Test(stringToBytes(data))
+}
+
+// Count returns an estimate of the number of times the data was added to
+// the CountingBloomFilter, minus the times it was removed: the minimum of its
+// k counters, as in a spectral Bloom filter (Cohen and Matias, 2003). The
+// estimate is never too low, and is too high when every counter of the data
+// is shared with other keys, with the probability of a false positive. A
+// zero count means that the data is definitely not in the set.
+//
+// Counters saturate, so a count equal to the maximum value of the counters
+// (see CounterWidth) means at least that value: use NewCounting with 16-bit
+// or 32-bit counters to count frequent keys. With SetStaleness, counts are
+// rounded up to whole adds, and decrease as the counters are swept.
+func (f *CountingBloomFilter) Count(data []byte) uint64 {
+	h := baseHashes(data)
+	pending, _ := f.pending()
+	count := f.maxCount()
+	for i := uint(0); i < f.k && count > 0; i++ {
+		if c := f.swept(f.location(h, i), pending); c < count {
+			count = c
+		}
+	}
+	return (count + f.step - 1) / f.step
+}
+
+// CountString returns an estimate of the number of times the string was
+// added to the CountingBloomFilter. See Count.
+func (f *CountingBloomFilter) CountString(data string) uint64 {
+	return f.Count(stringToBytes(data))
+}
+
+// Remove data from the counting Bloom filter, decrementing its counters
+// except the saturated ones, after the automatic sweeps which are due. If
+// the data is not in the filter (Test returns false), the filter is
+// unchanged and Remove returns false.
+func (f *CountingBloomFilter) Remove(data []byte) bool {
+	f.Expire()
+	h := baseHashes(data)
+	for i := uint(0); i < f.k; i++ {
+		if f.get(f.location(h, i)) == 0 {
+			return false
+		}
+	}
+	for i := uint(0); i < f.k; i++ {
+		l := f.location(h, i)
+		if c := f.get(l); c < f.maxCount() {
+			f.add(l, -min64(f.step, c))
+		}
+	}
+	return true
+}
+
+// RemoveString removes a string from the counting Bloom filter. See Remove.
+func (f *CountingBloomFilter) RemoveString(data string) bool {
+	return f.Remove(stringToBytes(data))
+}
+
+// ClearAll clears all the data in a counting Bloom filter, removing all keys
+func (f *CountingBloomFilter) ClearAll() *CountingBloomFilter {
+	for i := range f.counters {
+		f.counters[i] = 0
+	}
+	return f
+}
+
+// Equal tests for the equality of two counting Bloom filters
+func (f *CountingBloomFilter) Equal(g *CountingBloomFilter) bool {
+	if f.m != g.m || f.k != g.k || f.width != g.width {
+		return false
+	}
+	for i := range f.counters {
+		if f.counters[i] != g.counters[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// countingFilterJSON is an unexported type for marshaling/unmarshaling
+// CountingBloomFilter struct. The counters are encoded as big-endian words,
+// which encoding/json represents as a base64 string.
+type countingFilterJSON struct {
+	M        uint   `json:"m"`
+	K        uint   `json:"k"`
+	Width    uint   `json:"width"`
+	Counters []byte `json:"counters"`
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (f CountingBloomFilter) MarshalJSON() ([]byte, error) {
+	counters := make([]byte, 8*len(f.counters))
+	for i, w := range f.counters {
+		binary.BigEndian.PutUint64(counters[8*i:], w)
+	}
+	return json.Marshal(countingFilterJSON{f.m, f.k, f.width, counters})
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (f *CountingBloomFilter) UnmarshalJSON(data []byte) error {
+	var j countingFilterJSON
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		return err
+	}
+	g, err := newCountingFromParameters(uint64(j.M), uint64(j.K), uint64(j.Width))
+	if err != nil {
+		return err
+	}
+	if len(j.Counters) != 8*len(g.counters) {
+		return errors.New("bloom: counters don't match the parameters")
+	}
+	for i := range g.counters {
+		g.counters[i] = binary.BigEndian.Uint64(j.Counters[8*i:])
+	}
+	*f = *g
+	return nil
+}
+
+// newCountingFromParameters creates an empty filter from decoded parameters,
+// rejecting those which NewCounting would have adjusted.
+func newCountingFromParameters(m, k, width uint64) (*CountingBloomFilter, error) {
+	if m == 0 || k == 0 || uint64(uint(m)) != m || uint64(uint(k)) != k {
+		return nil, fmt.Errorf("bloom: invalid parameters m=%d k=%d", m, k)
+	}
+	if width == 0 || width > 32 || bits.OnesCount64(width) != 1 {
+		return nil, fmt.Errorf("bloom: invalid counter width %d", width)
+	}
+	return NewCounting(uint(m), uint(k), uint(width)), nil
+}
+
+// WriteTo writes a binary representation of the CountingBloomFilter to an
+// i/o stream: m, k and the counter width, followed by the packed counters,
+// all as big-endian 64-bit words. It returns the number of bytes written.
+func (f *CountingBloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	for _, v := range []uint64{uint64(f.m), uint64(f.k), uint64(f.width)} {
+		err := binary.Write(stream, binary.BigEndian, v)
+		if err != nil {
+			return 0, err
+		}
+	}
+	err := binary.Write(stream, binary.BigEndian, f.counters)
+	if err != nil {
+		return 0, err
+	}
+	return int64(8 * (3 + len(f.counters))), nil
+}
+
+// ReadFrom reads a binary representation of the CountingBloomFilter (such as
+// might have been written by WriteTo()) from an i/o stream. It returns the
+// number of bytes read.
+func (f *CountingBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	var parameters [3]uint64
+	err := binary.Read(stream, binary.BigEndian, &parameters)
+	if err != nil {
+		return 0, err
+	}
+	g, err := newCountingFromParameters(parameters[0], parameters[1], parameters[2])
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, g.counters)
+	if err != nil {
+		return 0, err
+	}
+	*f = *g
+	return int64(8 * (3 + len(f.counters))), nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (f *CountingBloomFilter) GobEncode() ([]byte, error) {
+	return f.MarshalBinary()
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (f *CountingBloomFilter) GobDecode(data []byte) error {
+	return f.UnmarshalBinary(data)
+}
+
+// MarshalBinary implements binary.BinaryMarshaler interface.
+func (f *CountingBloomFilter) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := f.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements binary.BinaryUnmarshaler interface.
+func (f *CountingBloomFilter) UnmarshalBinary(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := f.ReadFrom(buf)
+
+	return err
+}
@@ -0,0 +1,205 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"testing"
+)
+
+func TestCountingBasic(t *testing.T) {
+	f := NewCounting(1000, 4, 4)
+	n1 := []byte("Bess")
+	n2 := []byte("Jane")
+	f.Add(n1).Add(n1)
+	if !f.Test(n1) {
+		t.Errorf("%v should be in.", n1)
+	}
+	if f.Test(n2) {
+		t.Errorf("%v should not be in.", n2)
+	}
+	if f.Remove(n2) {
+		t.Errorf("%v should not have been removed.", n2)
+	}
+	if !f.Remove(n1) || !f.Test(n1) {
+		t.Errorf("%v was added twice and removed once, it should be in.", n1)
+	}
+	if !f.Remove(n1) || f.Test(n1) {
+		t.Errorf("%v should not be in after removal.", n1)
+	}
+	f.AddString("Emma")
+	if !f.TestString("Emma") || !f.RemoveString("Emma") || f.TestString("Emma") {
+		t.Error("strings should be added and removed")
+	}
+}
+
+func TestCountingParameters(t *testing.T) {
+	for _, c := range []struct{ width, expected uint }{{0, 1}, {1, 1}, {3, 4}, {4, 4}, {5, 8}, {16, 16}, {64, 32}} {
+		f := NewCounting(0, 0, c.width)
+		if f.Cap() != 1 || f.K() != 1 || f.CounterWidth() != c.expected {
+			t.Errorf("width %d: unexpected parameters %d %d %d", c.width, f.Cap(), f.K(), f.CounterWidth())
+		}
+	}
+}
+
+func TestCountingNoCrossTalk(t *testing.T) {
+	// Neighbouring counters must not carry into each other.
+	for _, width := range []uint{1, 2, 4, 8, 16, 32} {
+		f := NewCounting(100, 1, width)
+		for l := uint64(0); l < 100; l++ {
+			f.add(l, 1)
+		}
+		for l := uint64(0); l < 100; l++ {
+			if f.get(l) != 1 {
+				t.Fatalf("width %d: counter %d is %d", width, l, f.get(l))
+			}
+		}
+		f.add(50, ^uint64(0))
+		if f.get(49) != 1 || f.get(50) != 0 || f.get(51) != 1 {
+			t.Errorf("width %d: decrement leaked to neighbours", width)
+		}
+	}
+}
+
+func TestCountingSaturation(t *testing.T) {
+	f := NewCounting(10, 1, 2)
+	key := []byte("saturated")
+	for i := 0; i < 5; i++ {
+		f.Add(key)
+	}
+	// The counter is stuck at 3: removing the key never clears it.
+	for i := 0; i < 10; i++ {
+		if !f.Remove(key) {
+			t.Fatalf("removal %d failed", i)
+		}
+	}
+	if !f.Test(key) {
+		t.Error("saturated counters should never be decremented")
+	}
+	f.ClearAll()
+	if f.Test(key) {
+		t.Error("ClearAll should reset saturated counters")
+	}
+}
+
+func TestCountingRemoveMany(t *testing.T) {
+	n := uint(10000)
+	f := NewCountingWithEstimates(n, 0.001)
+	key := make([]byte, 4)
+	for i := uint32(0); i < uint32(n); i++ {
+		binary.BigEndian.PutUint32(key, i)
+		f.Add(key)
+	}
+	for i := uint32(0); i < uint32(n); i += 2 {
+		binary.BigEndian.PutUint32(key, i)
+		if !f.Remove(key) {
+			t.Fatalf("key %d should have been removed", i)
+		}
+	}
+	positives := 0
+	for i := uint32(0); i < uint32(n); i++ {
+		binary.BigEndian.PutUint32(key, i)
+		switch {
+		case i%2 == 1 && !f.Test(key):
+			t.Fatalf("key %d should still be in", i)
+		case i%2 == 0 && f.Test(key):
+			positives++
+		}
+	}
+	if positives > 50 {
+		t.Errorf("too many removed keys test positive: %d", positives)
+	}
+}
+
+func TestCountingCount(t *testing.T) {
+	f := NewCounting(10000, 5, 16)
+	if f.CountString("a") != 0 {
+		t.Error("the count of a key which was not added should be zero")
+	}
+	key := make([]byte, 4)
+	for i := uint32(0); i < 500; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		for j := uint32(0); j <= i%10; j++ {
+			f.Add(key)
+		}
+	}
+	exact := 0
+	for i := uint32(0); i < 500; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		count := f.Count(key)
+		if count < uint64(i%10+1) {
+			t.Fatalf("the count %d of key %d should be at least %d", count, i, i%10+1)
+		}
+		if count == uint64(i%10+1) {
+			exact++
+		}
+	}
+	if exact < 490 {
+		t.Errorf("only %d counts out of 500 are exact", exact)
+	}
+	binary.BigEndian.PutUint32(key, 0)
+	f.Remove(key)
+	if f.Count(key) != 0 {
+		t.Error("the count should decrease when the key is removed")
+	}
+
+	g := NewCounting(1000, 3, 2)
+	for i := 0; i < 10; i++ {
+		g.AddString("a")
+	}
+	if g.CountString("a") != 3 {
+		t.Errorf("the count %d should saturate at 3", g.CountString("a"))
+	}
+}
+
+func TestCountingEncodeDecode(t *testing.T) {
+	f := NewCounting(1000, 4, 8)
+	f.AddString("a").AddString("a").AddString("b")
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var g CountingBloomFilter
+	if _, err := g.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Equal(&g) {
+		t.Error("binary round trip changed the filter")
+	}
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var h CountingBloomFilter
+	if err := json.Unmarshal(data, &h); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Equal(&h) {
+		t.Error("JSON round trip changed the filter")
+	}
+
+	buf.Reset()
+	if err := gob.NewEncoder(&buf).Encode(f); err != nil {
+		t.Fatal(err)
+	}
+	var i CountingBloomFilter
+	if err := gob.NewDecoder(&buf).Decode(&i); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Equal(&i) || !i.Remove([]byte("a")) || !i.TestString("a") {
+		t.Error("gob round trip changed the filter")
+	}
+
+	for _, bad := range []string{
+		`{"m":1000,"k":4,"width":3,"counters":""}`,
+		`{"m":0,"k":4,"width":4,"counters":""}`,
+		`{"m":1000,"k":4,"width":4,"counters":"AAAA"}`,
+	} {
+		if err := json.Unmarshal([]byte(bad), &h); err == nil {
+			t.Errorf("%s should not be accepted", bad)
+		}
+	}
+}
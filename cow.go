@@ -0,0 +1,196 @@
+package bloom
+
+import (
+	"sync/atomic"
+
+	"github.com/bits-and-blooms/bitset"
+)
+
+// cowPageWords is the number of words of a page of a COWBloomFilter, which
+// is copied on the first write after a snapshot
+const cowPageWords = 512
+
+// A COWBloomFilter is a Bloom filter for a single writer and many readers.
+// The writer adds keys and publishes snapshots, which are immutable views of
+// the filter: readers test keys against the latest one, see View, without
+// ever blocking the writer or observing an Add half done.
+//
+// Snapshots share the bits of the filter. The bitset is split in pages of 4
+// KB, and a page shared with the latest snapshot is copied by the writer the
+// first time it is modified after the snapshot. Snapshot itself only copies
+// the table of the pages, of 8 bytes per page.
+//
+// Add, AddString and Snapshot must be called by the writer only, or be
+// synchronized by the caller. View, and the methods of the views, are safe
+// for concurrent use.
+type COWBloomFilter struct {
+	m uint
+	k uint
+	hashing
+	fastRange bool
+	pages     [][]uint64
+	owned     *bitset.BitSet // pages which are not shared with a snapshot
+	latest    atomic.Value   // *ReadOnlyView
+}
+
+// NewCOW creates a new copy-on-write Bloom filter with _m_ bits and _k_
+// hashing functions. We force _m_ and _k_ to be at least one to avoid panics.
+func NewCOW(m uint, k uint) *COWBloomFilter {
+	m = max(1, m)
+	words := (m + 63) / 64
+	f := &COWBloomFilter{
+		m:     m,
+		k:     max(1, k),
+		pages: make([][]uint64, (words+cowPageWords-1)/cowPageWords),
+	}
+	for i := range f.pages {
+		size := words - uint(i)*cowPageWords
+		if size > cowPageWords {
+			size = cowPageWords
+		}
+		f.pages[i] = make([]uint64, size)
+	}
+	f.owned = bitset.New(uint(len(f.pages)))
+	f.Snapshot()
+	return f
+}
+
+// NewCOWWithEstimates creates a new copy-on-write Bloom filter for about n
+// items with fp false positive rate
+func NewCOWWithEstimates(n uint, fp float64) *COWBloomFilter {
+	m, k := EstimateParameters(n, fp)
+	return NewCOW(m, k)
+}
+
+// NewCOWFrom creates a new copy-on-write Bloom filter holding a copy of the
+// keys of a Bloom filter, with the same hash functions.
+func NewCOWFrom(f *BloomFilter) *COWBloomFilter {
+	g := NewCOW(f.m, f.k)
+	words := f.b.Words()
+	for i, page := range g.pages {
+		copy(page, words[i*cowPageWords:])
+	}
+	g.hashing = f.hashing
+	g.fastRange = f.fastRange
+	g.Snapshot()
+	return g
+}
+
+// Cap returns the capacity, _m_, of a Bloom filter
+func (f *COWBloomFilter) Cap() uint {
+	return f.m
+}
+
+// K returns the number of hash functions used in the COWBloomFilter
+func (f *COWBloomFilter) K() uint {
+	return f.k
+}
+
+// cowLocation returns the ith hashed location, of a filter of m bits
+func cowLocation(h [4]uint64, i uint, m uint, useFastRange bool) uint64 {
+	if useFastRange {
+		return fastRange(location(h, i), uint64(m))
+	}
+	return location(h, i) % uint64(m)
+}
+
+// Add data to the filter, copying the pages shared with the latest snapshot.
+// Returns the filter (allows chaining)
+func (f *COWBloomFilter) Add(data []byte) *COWBloomFilter {
+	h := f.hashes(data)
+	for i := uint(0); i < f.k; i++ {
+		l := cowLocation(h, i, f.m, f.fastRange)
+		w := uint(l / 64)
+		p := w / cowPageWords
+		if !f.owned.Test(p) {
+			f.pages[p] = append([]uint64(nil), f.pages[p]...)
+			f.owned.Set(p)
+		}
+		f.pages[p][w%cowPageWords] |= 1 << (l % 64)
+	}
+	return f
+}
+
+// AddString to the filter, copying the pages shared with the latest
+// snapshot. Returns the filter (allows chaining)
+func (f *COWBloomFilter) AddString(data string) *COWBloomFilter {
+	return f.Add(stringToBytes(data))
+}
+
+// Snapshot publishes the keys added so far as an immutable view, which View
+// returns until the next snapshot, and returns it.
+func (f *COWBloomFilter) Snapshot() *ReadOnlyView {
+	v := &ReadOnlyView{
+		m:         f.m,
+		k:         f.k,
+		hashing:   f.hashing,
+		fastRange: f.fastRange,
+		pages:     append([][]uint64(nil), f.pages...),
+	}
+	f.owned.ClearAll()
+	f.latest.Store(v)
+	return v
+}
+
+// View returns the latest snapshot. It is safe to call from any goroutine.
+func (f *COWBloomFilter) View() *ReadOnlyView {
+	return f.latest.Load().(*ReadOnlyView)
+}
+
+// A ReadOnlyView is an immutable snapshot of a COWBloomFilter, which is safe
+// for concurrent use.
+type ReadOnlyView struct {
+	m uint
+	k uint
+	hashing
+	fastRange bool
+	pages     [][]uint64
+}
+
+// Cap returns the capacity, _m_, of a Bloom filter
+func (v *ReadOnlyView) Cap() uint {
+	return v.m
+}
+
+// K returns the number of hash functions used in the ReadOnlyView
+func (v *ReadOnlyView) K() uint {
+	return v.k
+}
+
+// Test returns true if the data is in the view, false otherwise.
+// If true, the result might be a false positive. If false, the data
+// is definitely not in the set.
+func (v *ReadOnlyView) Test(data []byte) bool {
+	h := v.hashes(data)
+	for i := uint(0); i < v.k; i++ {
+		l := cowLocation(h, i, v.m, v.fastRange)
+		w := uint(l / 64)
+		if v.pages[w/cowPageWords][w%cowPageWords]&(1<<(l%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// TestString returns true if the string is in the view, false otherwise.
+// If true, the result might be a false positive. If false, the data
+// is definitely not in the set.
+func (v *ReadOnlyView) TestString(data string) bool {
+	return v.Test(stringToBytes(data))
+}
+
+// BloomFilter returns a copy of the view as a Bloom filter, for instance to
+// serialize it with WriteTo.
+func (v *ReadOnlyView) BloomFilter() *BloomFilter {
+	words := make([]uint64, 0, (uint64(v.m)+63)/64)
+	for _, page := range v.pages {
+		words = append(words, page...)
+	}
+	return &BloomFilter{
+		m:         v.m,
+		k:         v.k,
+		b:         bitset.FromWithLength(v.m, words),
+		hashing:   v.hashing,
+		fastRange: v.fastRange,
+	}
+}
@@ -0,0 +1,104 @@
+package bloom
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestCOW(t *testing.T) {
+	f := NewCOWWithEstimates(100000, 0.01)
+	before := f.View()
+	for i := 0; i < 1000; i++ {
+		f.AddString(strconv.Itoa(i))
+	}
+	if before.TestString("1") || f.View() != before {
+		t.Fatal("keys should only be visible after a snapshot")
+	}
+	v := f.Snapshot()
+	if f.View() != v {
+		t.Fatal("View should return the latest snapshot")
+	}
+	for i := 1000; i < 2000; i++ {
+		f.AddString(strconv.Itoa(i))
+	}
+	w := f.Snapshot()
+	for i := 0; i < 2000; i++ {
+		key := strconv.Itoa(i)
+		if !w.TestString(key) || v.TestString(key) != (i < 1000) || before.TestString(key) {
+			t.Fatalf("%s: unexpected membership", key)
+		}
+	}
+	// Snapshots share the pages which were not modified since.
+	x := f.AddString("Love").Snapshot()
+	shared := 0
+	for i := range w.pages {
+		if &w.pages[i][0] == &x.pages[i][0] {
+			shared++
+		}
+	}
+	if shared < len(w.pages)-int(f.K()) || shared == len(w.pages) {
+		t.Errorf("%d pages out of %d are shared", shared, len(w.pages))
+	}
+	if w.TestString("Love") || !x.TestString("Love") {
+		t.Error("the new key should only be in the new snapshot")
+	}
+	f.AddString("Hate")
+
+	g := NewWithEstimates(100000, 0.01)
+	for i := 0; i < 2000; i++ {
+		g.AddString(strconv.Itoa(i))
+	}
+	g.AddString("Love")
+	if !x.BloomFilter().Equal(g) {
+		t.Error("the view should hold the same bits as a BloomFilter")
+	}
+	for _, g := range []*BloomFilter{g, NewWithSeed(1000, 4, 42).AddString("Love"), NewFastRange(3000, 3).AddString("Love")} {
+		if h := NewCOWFrom(g).View(); !h.BloomFilter().Equal(g) || h.Cap() != g.Cap() || h.K() != g.K() {
+			t.Error("NewCOWFrom should copy the filter")
+		}
+	}
+	if f := NewCOW(0, 0); f.Cap() != 1 || f.K() != 1 {
+		t.Error("m and k should be at least one")
+	}
+}
+
+func TestCOWConcurrent(t *testing.T) {
+	f := NewCOWWithEstimates(10000, 0.01)
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				// Keys are added in order, so a snapshot holding a key
+				// holds all the previous ones.
+				v := f.View()
+				last := -1
+				for i := 0; i < 1000 && v.TestString(strconv.Itoa(i)); i++ {
+					last = i
+				}
+				for i := 0; i < last; i++ {
+					if !v.TestString(strconv.Itoa(i)) {
+						t.Errorf("%d should be in the snapshot", i)
+						return
+					}
+				}
+			}
+		}()
+	}
+	for i := 0; i < 1000; i++ {
+		f.AddString(strconv.Itoa(i))
+		if i%10 == 0 {
+			f.Snapshot()
+		}
+	}
+	close(done)
+	wg.Wait()
+}
@@ -0,0 +1,394 @@
+/*
+Package cuckoo implements a cuckoo filter, as described in Fan et al.,
+"Cuckoo Filter: Practically Better Than Bloom" (2014).
+
+Like a Bloom filter, a cuckoo filter answers approximate membership queries
+with false positives but no false negatives. It stores a 16-bit fingerprint
+per key in one of two candidate buckets of four entries, which makes it
+possible to delete keys and, at false positive rates below about 3%, uses
+less memory than a Bloom filter. Its false positive rate is about 8/2^16,
+that is 0.012%.
+
+The filter mirrors the API of bloom.BloomFilter (Add, Test, their String
+variants, ClearAll and the same serialization methods) plus Delete, so that
+one can replace the other with few code changes:
+
+	f := cuckoo.New(1000000)
+	f.AddString("Love")
+	if f.TestString("Love") {
+		f.DeleteString("Love")
+	}
+
+Unlike a Bloom filter, a cuckoo filter can be full: Add returns ErrFull once
+the filter holds about 95% of its capacity.
+*/
+package cuckoo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+const (
+	// bucketSize is the number of entries of a bucket
+	bucketSize = 4
+	// maxKicks is the number of fingerprints moved before giving up
+	maxKicks = 500
+)
+
+// ErrFull is returned by Add when the filter cannot hold more keys.
+var ErrFull = errors.New("cuckoo: filter is full")
+
+// A Filter is a cuckoo filter. It is not safe for concurrent use.
+type Filter struct {
+	buckets uint64   // number of buckets, a power of two
+	entries []uint16 // bucketSize fingerprints per bucket, zero when empty
+	count   uint
+	// The victim is the fingerprint evicted by the last failed insertion,
+	// kept aside so that no key is lost.
+	victim       uint16
+	victimBucket uint64
+	rand         uint64
+}
+
+// New creates a new cuckoo filter for about n items. The number of buckets
+// is rounded up to a power of two, so the capacity may be up to twice as
+// large as n.
+func New(n uint) *Filter {
+	buckets := uint64(1)
+	for buckets*bucketSize*95/100 < uint64(n) {
+		buckets *= 2
+	}
+	return newWithBuckets(buckets)
+}
+
+func newWithBuckets(buckets uint64) *Filter {
+	return &Filter{
+		buckets: buckets,
+		entries: make([]uint16, buckets*bucketSize),
+		rand:    1,
+	}
+}
+
+// Cap returns the capacity of the filter, the number of fingerprints it can
+// store
+func (f *Filter) Cap() uint {
+	return uint(len(f.entries))
+}
+
+// Count returns the number of keys in the filter
+func (f *Filter) Count() uint {
+	return f.count
+}
+
+// hashes returns the fingerprint and the first candidate bucket of a key
+func (f *Filter) hashes(data []byte) (uint16, uint64) {
+	h := bloom.Locations(data, 2)
+	fp := uint16(h[1] >> 48)
+	if fp == 0 {
+		fp = 1
+	}
+	return fp, h[0] & (f.buckets - 1)
+}
+
+// altBucket returns the other candidate bucket of a fingerprint stored in
+// bucket i; it can be computed from either bucket.
+func (f *Filter) altBucket(i uint64, fp uint16) uint64 {
+	return (i ^ uint64(fp)*0x5bd1e995) & (f.buckets - 1)
+}
+
+// bucket returns the entries of bucket i
+func (f *Filter) bucket(i uint64) []uint16 {
+	return f.entries[i*bucketSize : (i+1)*bucketSize]
+}
+
+// insert stores a fingerprint in bucket i if it has an empty entry
+func (f *Filter) insert(i uint64, fp uint16) bool {
+	b := f.bucket(i)
+	for j := range b {
+		if b[j] == 0 {
+			b[j] = fp
+			return true
+		}
+	}
+	return false
+}
+
+// next returns a pseudo-random number (xorshift64)
+func (f *Filter) next() uint64 {
+	f.rand ^= f.rand << 13
+	f.rand ^= f.rand >> 7
+	f.rand ^= f.rand << 17
+	return f.rand
+}
+
+// Add data to the filter. Adding the same key twice stores it twice, and it
+// must then be deleted twice. It returns ErrFull, and leaves the filter
+// unchanged, if the filter is full.
+func (f *Filter) Add(data []byte) error {
+	if f.victim != 0 {
+		return ErrFull
+	}
+	fp, i := f.hashes(data)
+	if f.insert(i, fp) || f.insert(f.altBucket(i, fp), fp) {
+		f.count++
+		return nil
+	}
+	// Move fingerprints to their other bucket until one finds an empty entry.
+	if f.next()%2 == 0 {
+		i = f.altBucket(i, fp)
+	}
+	for kick := 0; kick < maxKicks; kick++ {
+		b := f.bucket(i)
+		j := f.next() % bucketSize
+		fp, b[j] = b[j], fp
+		i = f.altBucket(i, fp)
+		if f.insert(i, fp) {
+			f.count++
+			return nil
+		}
+	}
+	f.victim, f.victimBucket = fp, i
+	f.count++
+	return nil
+}
+
+// AddString to the filter. See Add.
+func (f *Filter) AddString(data string) error {
+	return f.Add([]byte(data))
+}
+
+// contains returns true if the fingerprint is in bucket i
+func (f *Filter) contains(i uint64, fp uint16) bool {
+	for _, e := range f.bucket(i) {
+		if e == fp {
+			return true
+		}
+	}
+	return false
+}
+
+// Test returns true if the data is in the filter, false otherwise.
+// If true, the result might be a false positive. If false, the data
+// is definitely not in the set.
+func (f *Filter) Test(data []byte) bool {
+	fp, i := f.hashes(data)
+	j := f.altBucket(i, fp)
+	if f.victim == fp && (f.victimBucket == i || f.victimBucket == j) {
+		return true
+	}
+	return f.contains(i, fp) || f.contains(j, fp)
+}
+
+// TestString returns true if the string is in the filter, false otherwise.
+// If true, the result might be a false positive. If false, the data
+// is definitely not in the set.
+func (f *Filter) TestString(data string) bool {
+	return f.Test([]byte(data))
+}
+
+// remove deletes one occurrence of the fingerprint from bucket i
+func (f *Filter) remove(i uint64, fp uint16) bool {
+	b := f.bucket(i)
+	for j := range b {
+		if b[j] == fp {
+			b[j] = 0
+			return true
+		}
+	}
+	return false
+}
+
+// Delete removes the data from the filter and returns true if it was found.
+// Only delete keys that were added: deleting a false positive deletes the
+// key it collides with.
+func (f *Filter) Delete(data []byte) bool {
+	fp, i := f.hashes(data)
+	j := f.altBucket(i, fp)
+	if f.victim == fp && (f.victimBucket == i || f.victimBucket == j) {
+		f.victim = 0
+		f.count--
+		return true
+	}
+	if !f.remove(i, fp) && !f.remove(j, fp) {
+		return false
+	}
+	f.count--
+	if f.victim != 0 {
+		// Try to move the victim back to the table.
+		v, b := f.victim, f.victimBucket
+		if f.insert(b, v) || f.insert(f.altBucket(b, v), v) {
+			f.victim = 0
+		}
+	}
+	return true
+}
+
+// DeleteString removes a string from the filter. See Delete.
+func (f *Filter) DeleteString(data string) bool {
+	return f.Delete([]byte(data))
+}
+
+// ClearAll clears all the data in the filter, removing all keys
+func (f *Filter) ClearAll() *Filter {
+	for i := range f.entries {
+		f.entries[i] = 0
+	}
+	f.count = 0
+	f.victim, f.victimBucket = 0, 0
+	return f
+}
+
+// Equal tests for the equality of two cuckoo filters
+func (f *Filter) Equal(g *Filter) bool {
+	if f.buckets != g.buckets || f.count != g.count || f.victim != g.victim ||
+		(f.victim != 0 && f.victimBucket != g.victimBucket) {
+		return false
+	}
+	for i := range f.entries {
+		if f.entries[i] != g.entries[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// header is the fixed-size part of the binary representation
+type header struct {
+	Buckets      uint64
+	Count        uint64
+	Victim       uint16
+	VictimBucket uint64
+}
+
+// check returns an error if the header cannot describe a filter
+func (h header) check() error {
+	if h.Buckets == 0 || h.Buckets&(h.Buckets-1) != 0 || h.Buckets > 1<<40 {
+		return fmt.Errorf("cuckoo: invalid number of buckets %d", h.Buckets)
+	}
+	if h.Count > h.Buckets*bucketSize+1 || h.VictimBucket >= h.Buckets {
+		return errors.New("cuckoo: invalid filter")
+	}
+	return nil
+}
+
+// filter returns an empty filter with the header's parameters
+func (h header) filter() *Filter {
+	f := newWithBuckets(h.Buckets)
+	f.count = uint(h.Count)
+	f.victim, f.victimBucket = h.Victim, h.VictimBucket
+	return f
+}
+
+// filterJSON is an unexported type for marshaling/unmarshaling Filter struct.
+type filterJSON struct {
+	Buckets      uint64 `json:"buckets"`
+	Count        uint64 `json:"count"`
+	Victim       uint16 `json:"victim"`
+	VictimBucket uint64 `json:"victim_bucket"`
+	Entries      []byte `json:"entries"`
+}
+
+// MarshalJSON implements json.Marshaler interface. The entries are encoded
+// as big-endian 16-bit fingerprints, which encoding/json represents as a
+// base64 string.
+func (f Filter) MarshalJSON() ([]byte, error) {
+	entries := make([]byte, 2*len(f.entries))
+	for i, e := range f.entries {
+		binary.BigEndian.PutUint16(entries[2*i:], e)
+	}
+	return json.Marshal(filterJSON{f.buckets, uint64(f.count), f.victim, f.victimBucket, entries})
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (f *Filter) UnmarshalJSON(data []byte) error {
+	var j filterJSON
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		return err
+	}
+	h := header{j.Buckets, j.Count, j.Victim, j.VictimBucket}
+	if err := h.check(); err != nil {
+		return err
+	}
+	g := h.filter()
+	if len(j.Entries) != 2*len(g.entries) {
+		return errors.New("cuckoo: entries don't match the number of buckets")
+	}
+	for i := range g.entries {
+		g.entries[i] = binary.BigEndian.Uint16(j.Entries[2*i:])
+	}
+	*f = *g
+	return nil
+}
+
+// WriteTo writes a binary representation of the filter to an i/o stream.
+// It returns the number of bytes written.
+func (f *Filter) WriteTo(stream io.Writer) (int64, error) {
+	h := header{f.buckets, uint64(f.count), f.victim, f.victimBucket}
+	err := binary.Write(stream, binary.BigEndian, h)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, f.entries)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.Size(h) + 2*len(f.entries)), nil
+}
+
+// ReadFrom reads a binary representation of the filter (such as might
+// have been written by WriteTo()) from an i/o stream. It returns the number
+// of bytes read.
+func (f *Filter) ReadFrom(stream io.Reader) (int64, error) {
+	var h header
+	err := binary.Read(stream, binary.BigEndian, &h)
+	if err != nil {
+		return 0, err
+	}
+	if err := h.check(); err != nil {
+		return 0, err
+	}
+	g := h.filter()
+	err = binary.Read(stream, binary.BigEndian, g.entries)
+	if err != nil {
+		return 0, err
+	}
+	*f = *g
+	return int64(binary.Size(h) + 2*len(f.entries)), nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (f *Filter) GobEncode() ([]byte, error) {
+	return f.MarshalBinary()
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (f *Filter) GobDecode(data []byte) error {
+	return f.UnmarshalBinary(data)
+}
+
+// MarshalBinary implements binary.BinaryMarshaler interface.
+func (f *Filter) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := f.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements binary.BinaryUnmarshaler interface.
+func (f *Filter) UnmarshalBinary(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := f.ReadFrom(buf)
+
+	return err
+}
@@ -0,0 +1,186 @@
+package cuckoo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"testing"
+)
+
+func TestBasic(t *testing.T) {
+	f := New(1000)
+	n1 := []byte("Bess")
+	n2 := []byte("Jane")
+	if err := f.Add(n1); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Test(n1) {
+		t.Errorf("%v should be in.", n1)
+	}
+	if f.Test(n2) {
+		t.Errorf("%v should not be in.", n2)
+	}
+	if f.Delete(n2) {
+		t.Errorf("%v should not have been deleted.", n2)
+	}
+	if !f.Delete(n1) || f.Test(n1) || f.Count() != 0 {
+		t.Errorf("%v should not be in after deletion.", n1)
+	}
+	if err := f.AddString("Emma"); err != nil {
+		t.Fatal(err)
+	}
+	if !f.TestString("Emma") || !f.DeleteString("Emma") || f.TestString("Emma") {
+		t.Error("strings should be added and deleted")
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	for _, n := range []uint{0, 1, 100, 1000, 1 << 20} {
+		f := New(n)
+		if f.Cap()*95/100 < n || f.buckets&(f.buckets-1) != 0 {
+			t.Errorf("capacity %d for %d items", f.Cap(), n)
+		}
+	}
+}
+
+func TestFill(t *testing.T) {
+	n := uint32(100000)
+	f := New(uint(n))
+	key := make([]byte, 4)
+	for i := uint32(0); i < n; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		if err := f.Add(key); err != nil {
+			t.Fatalf("key %d: %v at load %f", i, err, float64(i)/float64(f.Cap()))
+		}
+	}
+	if f.Count() != uint(n) {
+		t.Errorf("count %d, expected %d", f.Count(), n)
+	}
+	for i := uint32(0); i < n; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		if !f.Test(key) {
+			t.Fatalf("key %d should be in", i)
+		}
+	}
+	positives := 0
+	for i := n; i < 11*n; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		if f.Test(key) {
+			positives++
+		}
+	}
+	if rate := float64(positives) / float64(10*n); rate > 0.0003 {
+		t.Errorf("false positive rate %f is too high", rate)
+	}
+	for i := uint32(0); i < n; i += 2 {
+		binary.BigEndian.PutUint32(key, i)
+		if !f.Delete(key) {
+			t.Fatalf("key %d should have been deleted", i)
+		}
+	}
+	for i := uint32(1); i < n; i += 2 {
+		binary.BigEndian.PutUint32(key, i)
+		if !f.Test(key) {
+			t.Fatalf("key %d should still be in", i)
+		}
+	}
+}
+
+func TestFull(t *testing.T) {
+	f := New(100)
+	key := make([]byte, 4)
+	var i uint32
+	for ; ; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		if f.Add(key) == ErrFull {
+			break
+		}
+	}
+	if f.Count() != uint(i) || f.victim == 0 {
+		t.Fatalf("count %d after %d keys", f.Count(), i)
+	}
+	// No key was lost, including the victim.
+	for j := uint32(0); j < i; j++ {
+		binary.BigEndian.PutUint32(key, j)
+		if !f.Test(key) {
+			t.Fatalf("key %d should be in", j)
+		}
+	}
+	// Deleting keys makes room again.
+	for j := uint32(0); j < i/2; j++ {
+		binary.BigEndian.PutUint32(key, j)
+		if !f.Delete(key) {
+			t.Fatalf("key %d should have been deleted", j)
+		}
+	}
+	binary.BigEndian.PutUint32(key, i)
+	if err := f.Add(key); err != nil {
+		t.Errorf("the filter should have room again: %v", err)
+	}
+	for j := i / 2; j <= i; j++ {
+		binary.BigEndian.PutUint32(key, j)
+		if !f.Test(key) {
+			t.Fatalf("key %d should be in", j)
+		}
+	}
+	f.ClearAll()
+	if f.Count() != 0 || f.Test(key) || f.Add(key) != nil {
+		t.Error("ClearAll should empty the filter")
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	f := New(100)
+	key := make([]byte, 4)
+	for i := uint32(0); f.victim == 0; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		f.Add(key)
+	}
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var g Filter
+	if _, err := g.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Equal(&g) {
+		t.Error("binary round trip changed the filter")
+	}
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var h Filter
+	if err := json.Unmarshal(data, &h); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Equal(&h) {
+		t.Error("JSON round trip changed the filter")
+	}
+
+	buf.Reset()
+	if err := gob.NewEncoder(&buf).Encode(f); err != nil {
+		t.Fatal(err)
+	}
+	var i Filter
+	if err := gob.NewDecoder(&buf).Decode(&i); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Equal(&i) || !i.Test(key) {
+		t.Error("gob round trip changed the filter")
+	}
+
+	for _, bad := range []string{
+		`{"buckets":3,"count":0,"entries":""}`,
+		`{"buckets":4,"count":0,"entries":"AAAA"}`,
+		`{"buckets":4,"count":100,"entries":""}`,
+	} {
+		if err := json.Unmarshal([]byte(bad), &h); err == nil {
+			t.Errorf("%s should not be accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+//go:build go1.18
+// +build go1.18
+
+package dedup
+
+// Chan passes on the values of a channel whose keys are seen for the first
+// time by the filter, as Bytes does. The key function must return the same
+// bytes for equal values; the returned slice is not retained, so it may be
+// reused across calls.
+func Chan[T any](in <-chan T, d *Filter, key func(T) []byte) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for x := range in {
+			if d.First(key(x)) {
+				out <- x
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,100 @@
+/*
+Package dedup removes duplicates from streams of keys with a Bloom filter,
+passing on only the keys seen for the first time:
+
+	d := dedup.New(1000000, 0.001)
+	for line := range dedup.Strings(lines, d) {
+		...
+	}
+
+A Filter remembers a bounded number of recent keys, so that it can run over
+unbounded streams in constant memory: it is made of two generations of Bloom
+filters, and the oldest one is cleared once the current one holds as many
+keys as it was sized for. Like any Bloom filter, it may take a key for a
+duplicate when it is not (with the false positive rate given to New), so a
+few first-seen keys are dropped; it never passes on a duplicate of a key it
+still remembers.
+*/
+package dedup
+
+import "github.com/bits-and-blooms/bloom/v3"
+
+// A Filter tells whether keys were seen before. It is not safe for
+// concurrent use.
+type Filter struct {
+	r     *bloom.RotatingBloomFilter
+	n     uint // keys per generation
+	added uint // keys added to the current generation
+}
+
+// New creates a Filter which remembers at least the last n distinct keys, and
+// at most the last 2n, with a false positive rate of about fp. It takes about
+// twice the memory of a Bloom filter for n keys at that rate.
+func New(n uint, fp float64) *Filter {
+	if n == 0 {
+		n = 1
+	}
+	// Each generation gets half the false positive rate, since a key is
+	// tested against both.
+	return &Filter{r: bloom.NewRotatingWithEstimates(2, n, fp/2), n: n}
+}
+
+// First returns true if the key is seen for the first time, and remembers it.
+// It returns false if the key was seen before, or, with the false positive
+// rate of the filter, if it was not.
+func (d *Filter) First(key []byte) bool {
+	if d.r.Test(key) {
+		return false
+	}
+	if d.added == d.n {
+		d.r.Rotate()
+		d.added = 0
+	}
+	d.r.Add(key)
+	d.added++
+	return true
+}
+
+// FirstString returns true if the string is seen for the first time, and
+// remembers it, as First does.
+func (d *Filter) FirstString(key string) bool {
+	return d.First([]byte(key))
+}
+
+// Reset forgets all the keys.
+func (d *Filter) Reset() {
+	d.r.ClearAll()
+	d.added = 0
+}
+
+// Bytes passes on the keys of a channel seen for the first time by the
+// filter, in order, to the returned channel, which is closed once in is. The
+// filter is used by a goroutine until then, and the returned channel must be
+// drained for it to exit.
+func Bytes(in <-chan []byte, d *Filter) <-chan []byte {
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+		for key := range in {
+			if d.First(key) {
+				out <- key
+			}
+		}
+	}()
+	return out
+}
+
+// Strings passes on the strings of a channel seen for the first time by the
+// filter, as Bytes does.
+func Strings(in <-chan string, d *Filter) <-chan string {
+	out := make(chan string)
+	go func() {
+		defer close(out)
+		for key := range in {
+			if d.FirstString(key) {
+				out <- key
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,61 @@
+package dedup
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestFirst(t *testing.T) {
+	d := New(1000, 0.001)
+	if !d.FirstString("a") {
+		t.Error("a is seen for the first time")
+	}
+	if d.FirstString("a") || d.First([]byte("a")) {
+		t.Error("a was seen before")
+	}
+	d.Reset()
+	if !d.FirstString("a") {
+		t.Error("a should be forgotten by Reset")
+	}
+}
+
+func TestRotation(t *testing.T) {
+	const n = 1000
+	d := New(n, 0.001)
+	dropped := map[int]bool{}
+	for i := 0; i < 10*n; i++ {
+		if !d.FirstString(strconv.Itoa(i)) {
+			dropped[i] = true // a false positive, which was not added
+		}
+		// The last n keys are remembered.
+		for _, j := range []int{i, i - n/2, i - n + 1} {
+			if j >= 0 && !dropped[j] && d.FirstString(strconv.Itoa(j)) {
+				t.Fatalf("key %d should be remembered after key %d", j, i)
+			}
+		}
+	}
+	if len(dropped) > 10*n*2/100 {
+		t.Errorf("too many keys taken for duplicates: %d", len(dropped))
+	}
+	// Keys older than 2n are forgotten.
+	if !d.FirstString("0") {
+		t.Error("key 0 should be forgotten")
+	}
+}
+
+func TestStrings(t *testing.T) {
+	in := make(chan string)
+	go func() {
+		for _, s := range []string{"a", "b", "a", "c", "b", "d"} {
+			in <- s
+		}
+		close(in)
+	}()
+	var got []string
+	for s := range Strings(in, New(100, 0.001)) {
+		got = append(got, s)
+	}
+	if len(got) != 4 || got[0] != "a" || got[1] != "b" || got[2] != "c" || got[3] != "d" {
+		t.Errorf("unexpected keys %v", got)
+	}
+}
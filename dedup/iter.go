@@ -0,0 +1,20 @@
+//go:build go1.23
+// +build go1.23
+
+package dedup
+
+import "iter"
+
+// Seq returns an iterator over the values of seq whose keys are seen for the
+// first time by the filter. The key function must return the same bytes for
+// equal values; the returned slice is not retained, so it may be reused
+// across calls.
+func Seq[T any](seq iter.Seq[T], d *Filter, key func(T) []byte) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for x := range seq {
+			if d.First(key(x)) && !yield(x) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,47 @@
+//go:build go1.23
+// +build go1.23
+
+package dedup
+
+import (
+	"slices"
+	"testing"
+)
+
+type event struct {
+	id   string
+	time int
+}
+
+func eventID(e event) []byte { return []byte(e.id) }
+
+func TestChan(t *testing.T) {
+	in := make(chan event, 4)
+	in <- event{"a", 1}
+	in <- event{"b", 2}
+	in <- event{"a", 3}
+	in <- event{"c", 4}
+	close(in)
+	var got []int
+	for e := range Chan(in, New(100, 0.001), eventID) {
+		got = append(got, e.time)
+	}
+	if !slices.Equal(got, []int{1, 2, 4}) {
+		t.Errorf("unexpected events %v", got)
+	}
+}
+
+func TestSeq(t *testing.T) {
+	events := []event{{"a", 1}, {"b", 2}, {"a", 3}, {"c", 4}, {"b", 5}}
+	got := slices.Collect(Seq(slices.Values(events), New(100, 0.001), eventID))
+	if !slices.Equal(got, []event{{"a", 1}, {"b", 2}, {"c", 4}}) {
+		t.Errorf("unexpected events %v", got)
+	}
+	// Breaking out of the loop stops the iteration.
+	for e := range Seq(slices.Values(events), New(100, 0.001), eventID) {
+		if e.id != "a" {
+			t.Errorf("unexpected event %v", e)
+		}
+		break
+	}
+}
@@ -0,0 +1,176 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/bits-and-blooms/bitset"
+)
+
+// deltaMagic starts the deltas written by WriteDelta
+const deltaMagic = 0x424c4d44 // "BLMD"
+
+// A Checkpoint marks the state of a filter at some point, see WriteDelta.
+// Once a filter has a checkpoint, it records which of its words change,
+// which takes one bit per word of the filter for each checkpoint still in
+// use.
+type Checkpoint struct {
+	f       *BloomFilter
+	header  header         // parameters of the filter at the checkpoint
+	changed *bitset.BitSet // words changed between this checkpoint and the next
+	all     bool           // whether all the words may have changed
+	next    *Checkpoint
+}
+
+// Checkpoint marks the current state of the filter, so that the words
+// changed since can be written by WriteDelta. It does not copy the filter:
+// the filter then records which words its methods change. Changes made to
+// the bitset returned by BitSet, or to the words returned by Words, are not
+// recorded.
+func (f *BloomFilter) Checkpoint() *Checkpoint {
+	c := &Checkpoint{f: f, header: f.header(), changed: bitset.New(uint(len(f.b.Words())))}
+	if f.checkpoint != nil {
+		f.checkpoint.next = c
+	}
+	f.checkpoint = c
+	return c
+}
+
+// changedSince returns the indexes of the words of the filter which may
+// have changed since a checkpoint, or nil for all of them
+func (f *BloomFilter) changedSince(since *Checkpoint) *bitset.BitSet {
+	changed := bitset.New(uint(len(f.b.Words())))
+	c := since
+	for ; c != nil; c = c.next {
+		if c.all {
+			return nil
+		}
+		changed.InPlaceUnion(c.changed)
+		if c == f.checkpoint {
+			return changed
+		}
+	}
+	// The filter was replaced, e.g., by ReadFrom or Fold, and lost track
+	// of its checkpoints.
+	return nil
+}
+
+// WriteDelta writes the words of the filter which changed since the
+// checkpoint to an i/o stream: after the header of the filter, the number
+// of changed words, then the gap between the index of each word and that of
+// the previous one as varints, each followed by the value of the word. A
+// follower holding the filter as it was at the checkpoint can then catch up
+// with ApplyDelta. Words changed by methods replacing all the bits of the
+// filter, such as Merge or ReadFrom, are all written. It returns the number
+// of bytes written, or an error if the checkpoint is not of this filter or
+// if m, k or the hash functions of the filter changed since.
+func (f *BloomFilter) WriteDelta(stream io.Writer, since *Checkpoint) (int64, error) {
+	if since.f != f {
+		return 0, errors.New("bloom: the checkpoint is of another filter")
+	}
+	if since.header != f.header() {
+		return 0, errors.New("bloom: the filter changed size or hash functions since the checkpoint")
+	}
+	words := f.b.Words()
+	var changed []int
+	if set := f.changedSince(since); set != nil {
+		for i, ok := set.NextSet(0); ok; i, ok = set.NextSet(i + 1) {
+			changed = append(changed, int(i))
+		}
+	} else {
+		changed = make([]int, len(words))
+		for i := range changed {
+			changed[i] = i
+		}
+	}
+	buf := make([]byte, 4, 4+binary.MaxVarintLen64*(1+len(changed))+8*len(changed))
+	binary.BigEndian.PutUint32(buf, deltaMagic)
+	n, err := stream.Write(buf)
+	if err != nil {
+		return int64(n), err
+	}
+	headerSize, err := f.header().writeTo(stream)
+	if err != nil {
+		return int64(n) + headerSize, err
+	}
+	buf = appendUvarint(buf[:0], uint64(len(changed)))
+	next := 0
+	for _, i := range changed {
+		buf = appendUvarint(buf, uint64(i-next))
+		buf = append(buf, 0, 0, 0, 0, 0, 0, 0, 0)
+		bitset.BinaryOrder().PutUint64(buf[len(buf)-8:], words[i])
+		next = i + 1
+	}
+	m, err := stream.Write(buf)
+	return int64(n) + headerSize + int64(m), err
+}
+
+// ApplyDelta reads a delta written by WriteDelta from an i/o stream and sets
+// the changed words of the filter, which must have the same m, k and hash
+// functions; the keys of keyed filters are not serialized, so they are
+// assumed to be the same. The delta is only applied once it has been read
+// entirely. It returns the number of bytes read.
+func (f *BloomFilter) ApplyDelta(stream io.Reader) (int64, error) {
+	var magic [4]byte
+	if _, err := io.ReadFull(stream, magic[:]); err != nil {
+		return 0, err
+	}
+	if binary.BigEndian.Uint32(magic[:]) != deltaMagic {
+		return 0, errors.New("bloom: not a delta")
+	}
+	h, headerSize, err := readHeader(stream)
+	if err != nil {
+		return 0, err
+	}
+	if h != f.header() {
+		return 0, errors.New("bloom: the delta is of another filter")
+	}
+	r := &thriftReader{r: stream}
+	count, err := r.varint()
+	if err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	words := f.b.Words()
+	if count > uint64(len(words)) {
+		return 0, errors.New("bloom: the delta has too many words")
+	}
+	indexes, values, err := readDeltaWords(r, count, uint64(len(words)))
+	if err != nil {
+		return 0, err
+	}
+	for j, i := range indexes {
+		words[i] = values[j]
+		if f.checkpoint != nil {
+			f.checkpoint.changed.Set(uint(i))
+		}
+	}
+	return 4 + headerSize + r.n, nil
+}
+
+// readDeltaWords reads the indexes and values of the count changed words of
+// a delta, checking that the indexes are less than n
+func readDeltaWords(r *thriftReader, count, n uint64) ([]uint64, []uint64, error) {
+	indexes := make([]uint64, count)
+	values := make([]uint64, count)
+	var word [8]byte
+	next := uint64(0)
+	for j := range indexes {
+		gap, err := r.varint()
+		if err != nil {
+			return nil, nil, unexpectedEOF(err)
+		}
+		if gap >= n-next {
+			return nil, nil, errors.New("bloom: the delta has words beyond m")
+		}
+		indexes[j] = next + gap
+		next = indexes[j] + 1
+		m, err := io.ReadFull(r.r, word[:])
+		r.n += int64(m)
+		if err != nil {
+			return nil, nil, unexpectedEOF(err)
+		}
+		values[j] = bitset.BinaryOrder().Uint64(word[:])
+	}
+	return indexes, values, nil
+}
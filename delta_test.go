@@ -0,0 +1,171 @@
+package bloom
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+)
+
+func TestDelta(t *testing.T) {
+	leader := NewWithEstimates(100000, 0.01)
+	for i := 0; i < 50000; i++ {
+		leader.AddString(strconv.Itoa(i))
+	}
+	follower := leader.Copy()
+	checkpoint := leader.Checkpoint()
+	for i := 0; i < 10; i++ {
+		leader.AddString("new" + strconv.Itoa(i))
+	}
+
+	var buf bytes.Buffer
+	n, err := leader.WriteDelta(&buf, checkpoint)
+	if err != nil || n != int64(buf.Len()) {
+		t.Fatalf("wrote %d bytes out of %d: %v", n, buf.Len(), err)
+	}
+	full, _ := leader.MarshalBinary()
+	if buf.Len() > 2*len(full)/100 {
+		t.Errorf("the delta of %d bytes should be much smaller than the filter of %d bytes", buf.Len(), len(full))
+	}
+	delta := buf.Bytes()
+	stream := bytes.NewReader(append(delta, "tail"...))
+	n, err = follower.ApplyDelta(stream)
+	if err != nil || n != int64(len(delta)) || stream.Len() != 4 {
+		t.Fatalf("read %d bytes out of %d: %v", n, len(delta), err)
+	}
+	if !follower.Equal(leader) {
+		t.Fatal("the follower should catch up with the leader")
+	}
+
+	// Words can be cleared as well as set.
+	checkpoint = leader.Checkpoint()
+	leader.ClearAll()
+	buf.Reset()
+	if _, err := leader.WriteDelta(&buf, checkpoint); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := follower.ApplyDelta(&buf); err != nil || !follower.Equal(leader) {
+		t.Errorf("the follower should be cleared: %v", err)
+	}
+	// Without changes, the delta is only a header.
+	buf.Reset()
+	if _, err := leader.WriteDelta(&buf, leader.Checkpoint()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := follower.ApplyDelta(&buf); err != nil || !follower.Equal(leader) {
+		t.Errorf("an empty delta should be applied: %v", err)
+	}
+}
+
+func TestDeltaCheckpoints(t *testing.T) {
+	leader := New(64*1000, 4)
+	follower := leader.Copy()
+	first := leader.Checkpoint()
+	leader.AddString("Love")
+	second := leader.Checkpoint()
+	leader.AddBatch([][]byte{[]byte("Hate")})
+	if first.changed.Count() == 0 || first.changed.Count() > 4 || second.changed.Count() == 0 {
+		t.Errorf("the checkpoints should record the changed words: %d, %d", first.changed.Count(), second.changed.Count())
+	}
+
+	// A delta since an older checkpoint includes the words changed after
+	// the newer ones.
+	var buf bytes.Buffer
+	if _, err := leader.WriteDelta(&buf, first); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := follower.ApplyDelta(&buf); err != nil || !follower.Equal(leader) {
+		t.Fatalf("the follower should catch up since the first checkpoint: %v", err)
+	}
+	buf.Reset()
+	leader.WriteDelta(&buf, second) // #nosec
+	if buf.Len() > 100 {
+		t.Errorf("the delta of two keys should only hold their words, got %d bytes", buf.Len())
+	}
+
+	// Methods changing many words are written in full.
+	third := leader.Checkpoint()
+	other := New(64*1000, 4).AddString("Emma")
+	if err := leader.Merge(other); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	leader.WriteDelta(&buf, third) // #nosec
+	if buf.Len() < 8*1000 {
+		t.Errorf("a merge should write all the words, got %d bytes", buf.Len())
+	}
+	if _, err := follower.ApplyDelta(&buf); err != nil || !follower.Equal(leader) {
+		t.Fatalf("the follower should catch up after the merge: %v", err)
+	}
+
+	// A filter replaced by ReadFrom loses track of its checkpoints.
+	fourth := leader.Checkpoint()
+	data, _ := New(64*1000, 4).AddString("Jane").MarshalBinary()
+	if err := leader.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if _, err := leader.WriteDelta(&buf, fourth); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := follower.ApplyDelta(&buf); err != nil || !follower.Equal(leader) {
+		t.Fatalf("the follower should catch up after the filter is read: %v", err)
+	}
+
+	// A filter which changed size cannot write a delta.
+	fifth := leader.Checkpoint()
+	leader.Reset(1000, 4)
+	if _, err := leader.WriteDelta(&buf, fifth); err == nil {
+		t.Error("a filter which changed size should not write a delta")
+	}
+}
+
+func TestDeltaInvalid(t *testing.T) {
+	f := New(1000, 4)
+	if _, err := f.WriteDelta(&bytes.Buffer{}, New(1000, 5).Checkpoint()); err == nil {
+		t.Error("checkpoints of other filters should not be accepted")
+	}
+	if _, err := f.WriteDelta(&bytes.Buffer{}, NewWithSeed(1000, 4, 1).Checkpoint()); err == nil {
+		t.Error("checkpoints with other hash functions should not be accepted")
+	}
+
+	checkpoint := f.Checkpoint()
+	f.AddString("Love").AddString("Hate")
+	var buf bytes.Buffer
+	if _, err := f.WriteDelta(&buf, checkpoint); err != nil {
+		t.Fatal(err)
+	}
+	delta := buf.Bytes()
+	for name, g := range map[string]*BloomFilter{
+		"m":    New(2000, 4),
+		"k":    New(1000, 3),
+		"seed": NewWithSeed(1000, 4, 1),
+	} {
+		if _, err := g.ApplyDelta(bytes.NewReader(delta)); err == nil {
+			t.Errorf("a delta with another %s should not be accepted", name)
+		}
+	}
+	for i := range delta {
+		g := New(1000, 4)
+		if _, err := g.ApplyDelta(bytes.NewReader(delta[:i])); err == nil {
+			t.Fatalf("%d bytes out of %d should not be accepted", i, len(delta))
+		}
+		if g.TestString("Love") || g.TestString("Hate") {
+			t.Fatal("a truncated delta should not be applied")
+		}
+	}
+	data, _ := f.MarshalBinary()
+	if _, err := New(1000, 4).ApplyDelta(bytes.NewReader(data)); err == nil {
+		t.Error("a filter is not a delta")
+	}
+	// The header is that of the legacy format: 4+16 bytes, then the count.
+	bad := append([]byte(nil), delta...)
+	bad[20] = 100
+	if _, err := New(1000, 4).ApplyDelta(bytes.NewReader(bad)); err == nil {
+		t.Error("a delta with too many words should not be accepted")
+	}
+	bad = append([]byte(nil), delta...)
+	bad[21] = 15
+	if _, err := New(1000, 4).ApplyDelta(bytes.NewReader(bad)); err == nil {
+		t.Error("a delta with words beyond m should not be accepted")
+	}
+}
@@ -0,0 +1,62 @@
+package bloom
+
+import "errors"
+
+// A Digest holds the hash values of a key, from which the locations of the
+// key in any Bloom filter with the same hash functions are derived. When
+// the same key is added to, or tested against, many filters (e.g., one per
+// shard or per segment), computing its digest once and calling AddDigest or
+// TestDigest saves hashing the key for each filter; only its k locations
+// are computed for each filter.
+//
+// A digest records the hash functions which produced it: NewDigest uses the
+// default ones, and the Digest method of a filter those of the filter, as
+// selected by NewWithSeed, NewKeyed or NewWithScheme.
+type Digest struct {
+	h [4]uint64
+	hashing
+}
+
+// ErrDigestHashing is returned by AddDigest and TestDigest when the digest
+// was not produced by the hash functions of the filter
+var ErrDigestHashing = errors.New("bloom: the digest was produced by other hash functions than those of the filter")
+
+// NewDigest returns the digest of a key with the default hash functions
+func NewDigest(data []byte) Digest {
+	return Digest{h: baseHashes(data)}
+}
+
+// NewDigestString returns the digest of a string, like NewDigest, without
+// converting the string to a byte slice.
+func NewDigestString(data string) Digest {
+	return NewDigest(stringToBytes(data))
+}
+
+// Digest returns the digest of a key with the hash functions of the filter,
+// which may be used with any filter with the same hash functions
+func (f *BloomFilter) Digest(data []byte) Digest {
+	return Digest{h: f.hashes(data), hashing: f.hashing}
+}
+
+// AddDigest adds the key of a digest to the Bloom filter, as Add would. It
+// returns ErrDigestHashing, and leaves the filter unchanged, if the digest
+// was produced by other hash functions than those of the filter.
+func (f *BloomFilter) AddDigest(d Digest) error {
+	if !f.same(d.hashing) {
+		return ErrDigestHashing
+	}
+	for i := uint(0); i < f.k; i++ {
+		f.set(f.location(d.h, i))
+	}
+	return nil
+}
+
+// TestDigest returns what Test would return for the key of a digest. Like
+// AddDigest, it returns ErrDigestHashing if the digest was produced by
+// other hash functions than those of the filter.
+func (f *BloomFilter) TestDigest(d Digest) (bool, error) {
+	if !f.same(d.hashing) {
+		return false, ErrDigestHashing
+	}
+	return f.testHashes(d.h), nil
+}
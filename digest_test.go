@@ -0,0 +1,106 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestDigest(t *testing.T) {
+	filters := []*BloomFilter{New(1000, 4), New(2000, 5), NewFastRange(1500, 3)}
+	others := []*BloomFilter{New(1000, 4), New(2000, 5), NewFastRange(1500, 3)}
+	key := make([]byte, 4)
+	for i := uint32(0); i < 100; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		d := NewDigest(key)
+		for j, f := range filters {
+			if err := f.AddDigest(d); err != nil {
+				t.Fatal(err)
+			}
+			others[j].Add(key)
+			if ok, err := f.TestDigest(d); !ok || err != nil {
+				t.Errorf("key %d should be in filter %d", i, j)
+			}
+		}
+	}
+	for j, f := range filters {
+		if !f.Equal(others[j]) {
+			t.Errorf("AddDigest should set the same bits as Add in filter %d", j)
+		}
+	}
+	for i := uint32(100); i < 200; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		d := NewDigest(key)
+		for j, f := range filters {
+			if ok, _ := f.TestDigest(d); ok != f.Test(key) {
+				t.Errorf("TestDigest should return the result of Test for key %d in filter %d", i, j)
+			}
+		}
+	}
+	if NewDigestString("a") != NewDigest([]byte("a")) {
+		t.Error("NewDigestString should return the digest of the string")
+	}
+}
+
+func TestDigestHashing(t *testing.T) {
+	filters := []*BloomFilter{
+		NewWithSeed(1000, 4, 42),
+		NewKeyed(1000, 4, [16]byte{1, 2, 3}),
+		NewWithScheme(1000, 4, SchemeDoubleHashing),
+	}
+	key := []byte("Bess")
+	for j, f := range filters {
+		g := f.Copy()
+		if err := f.AddDigest(NewDigest(key)); err != ErrDigestHashing {
+			t.Errorf("filter %d: a default digest should be rejected, got %v", j, err)
+		}
+		if _, err := f.TestDigest(NewDigest(key)); err != ErrDigestHashing {
+			t.Errorf("filter %d: a default digest should not be tested, got %v", j, err)
+		}
+		if !f.Equal(g) {
+			t.Errorf("filter %d: a rejected digest should not be added", j)
+		}
+		d := f.Digest(key)
+		if err := g.AddDigest(d); err != nil {
+			t.Fatalf("filter %d: %v", j, err)
+		}
+		f.Add(key)
+		if !f.Equal(g) {
+			t.Errorf("filter %d: AddDigest should set the same bits as Add", j)
+		}
+		if ok, err := g.TestDigest(d); !ok || err != nil {
+			t.Errorf("filter %d: the key of the digest should be in", j)
+		}
+		if err := New(1000, 4).AddDigest(d); err != ErrDigestHashing {
+			t.Errorf("filter %d: its digests should be rejected by default filters", j)
+		}
+	}
+	other := NewWithSeed(2000, 3, 42)
+	if err := other.AddDigest(filters[0].Digest(key)); err != nil || !other.Test(key) {
+		t.Error("a digest should be usable with any filter with the same hash functions")
+	}
+}
+
+func BenchmarkDigest(b *testing.B) {
+	filters := make([]*BloomFilter, 16)
+	for i := range filters {
+		filters[i] = NewWithEstimates(10000, 0.01)
+	}
+	key := make([]byte, 8)
+	b.Run("Test", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			binary.BigEndian.PutUint64(key, uint64(i))
+			for _, f := range filters {
+				f.Test(key)
+			}
+		}
+	})
+	b.Run("TestDigest", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			binary.BigEndian.PutUint64(key, uint64(i))
+			d := NewDigest(key)
+			for _, f := range filters {
+				f.TestDigest(d)
+			}
+		}
+	})
+}
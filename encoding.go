@@ -0,0 +1,462 @@
+package bloom
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+
+	"github.com/bits-and-blooms/bitset"
+)
+
+// An Encoding is a binary representation of the bitset of a filter, see
+// WriteEncodedTo. ReadFrom detects the encoding of a serialized filter.
+type Encoding uint8
+
+const (
+	// EncodingRaw writes the words of the bitset, as WriteTo does.
+	EncodingRaw Encoding = iota
+	// EncodingGolomb writes the gaps between the set bits with Golomb-Rice
+	// coding. It is smaller than the raw bitset as long as fewer than about
+	// a third of the bits are set: at a 10% fill ratio, it takes less than
+	// half the size, about 4.9 bits per set bit instead of 10.
+	EncodingGolomb
+	// EncodingGzip compresses the raw bitset with gzip, at its fastest
+	// level: the bitset of a filter near its capacity is about random, so
+	// it only pays off for filters with few bits set, or very few unset.
+	EncodingGzip
+)
+
+// errInvalidEncoding is returned for compressed bitsets which cannot be
+// decoded.
+var errInvalidEncoding = errors.New("bloom: invalid compressed bitset")
+
+// WriteEncodedTo writes a binary representation of the BloomFilter to an
+// i/o stream, with the bitset in the given encoding, which only matters
+// on the wire: ReadFrom decodes it back to the usual bitset. The encoding
+// is recorded in the header, so older versions of the package reject
+// encoded filters. It returns the number of bytes written.
+func (f *BloomFilter) WriteEncodedTo(stream io.Writer, e Encoding) (int64, error) {
+	h := f.header()
+	h.encoding = e
+	return f.writeFilter(stream, h)
+}
+
+// writeFilter writes the header, then the bitset in the encoding of the
+// header, and returns the number of bytes written
+func (f *BloomFilter) writeFilter(stream io.Writer, h header) (int64, error) {
+	if h.encoding > EncodingGzip {
+		return 0, fmt.Errorf("bloom: unknown encoding %d", h.encoding)
+	}
+	var sum hash.Hash32
+	w := stream
+	if h.checksum {
+		sum = crc32.New(castagnoli)
+		w = io.MultiWriter(stream, sum)
+	}
+	n, err := h.writeTo(w)
+	if err != nil {
+		return 0, err
+	}
+	var numBytes int64
+	switch h.encoding {
+	case EncodingRaw:
+		numBytes, err = f.b.WriteTo(w)
+	case EncodingGolomb:
+		numBytes, err = writeGolomb(w, f.b)
+	case EncodingGzip:
+		numBytes, err = writeGzip(w, f.b)
+	}
+	n += numBytes
+	if err != nil || sum == nil {
+		return n, err
+	}
+	m, err := stream.Write(sum.Sum(nil))
+	return n + int64(m), err
+}
+
+// readBitSet reads the bitset of a serialized filter, in the encoding given
+// by its header, and returns the number of bytes read. The length of the
+// bitset is checked against the limit before the bitset is allocated.
+func readBitSet(stream io.Reader, h header, l limit) (*bitset.BitSet, int64, error) {
+	switch h.encoding {
+	case EncodingGolomb:
+		return readGolomb(stream, l)
+	case EncodingGzip:
+		return readGzip(stream, l)
+	}
+	return readWords(stream, l)
+}
+
+// riceParameter returns the number of bits of the remainders of the gaps
+// between count set bits among length bits, so that the quotients, coded in
+// unary, are small: the gaps are about geometrically distributed, and their
+// best parameter is about log2(ln(2) * mean gap).
+func riceParameter(length, count uint64) uint {
+	if count == 0 {
+		return 0
+	}
+	mean := math.Ln2 * float64(length) / float64(count)
+	if mean < 2 {
+		return 0
+	}
+	return uint(math.Log2(mean))
+}
+
+// A Golomb-Rice coded bitset is written as its length in bits, its number
+// of set bits, the Rice parameter and the number of bytes of the code, as
+// big-endian 64-bit words, followed by the code: for each set bit, the gap
+// since the previous one (or the start) is split into a quotient, written
+// in unary as ones ending with a zero, and a remainder of parameter bits.
+// The bits are written most significant first.
+
+// writeGolomb writes a bitset as Golomb-Rice coded gaps and returns the
+// number of bytes written
+func writeGolomb(stream io.Writer, b *bitset.BitSet) (int64, error) {
+	length := uint64(b.Len())
+	param := riceParameter(length, uint64(b.Count()))
+	var w bitWriter
+	count, next := uint64(0), uint64(0)
+	for i, ok := b.NextSet(0); ok && uint64(i) < length; i, ok = b.NextSet(i + 1) {
+		gap := uint64(i) - next
+		w.writeUnary(gap >> param)
+		w.writeBits(gap, param)
+		count++
+		next = uint64(i) + 1
+	}
+	code := w.bytes()
+	head := make([]byte, 32)
+	binary.BigEndian.PutUint64(head, length)
+	binary.BigEndian.PutUint64(head[8:], count)
+	binary.BigEndian.PutUint64(head[16:], uint64(param))
+	binary.BigEndian.PutUint64(head[24:], uint64(len(code)))
+	n, err := stream.Write(head)
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := stream.Write(code)
+	return int64(n + m), err
+}
+
+// readGolomb reads a bitset written by writeGolomb and returns the number of
+// bytes read
+func readGolomb(stream io.Reader, l limit) (*bitset.BitSet, int64, error) {
+	var head [4]uint64
+	err := binary.Read(stream, binary.BigEndian, &head)
+	if err != nil {
+		return nil, 0, err
+	}
+	length, count, param, size := head[0], head[1], head[2], head[3]
+	if err := l.check(length); err != nil {
+		return nil, 0, err
+	}
+	// The parameter follows from the length and the number of set bits, so
+	// that a corrupted length is detected before the bitset is allocated.
+	if count > length || uint64(riceParameter(length, count)) != param {
+		return nil, 0, errInvalidEncoding
+	}
+	// The code is read as it arrives, so that a corrupted size does not
+	// allocate more than the stream holds.
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, stream, int64(size))
+	if err == io.EOF || (err == nil && uint64(n) != size) {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	b := bitset.New(uint(length))
+	r := bitReader{data: buf.Bytes()}
+	next := uint64(0)
+	for i := uint64(0); i < count; i++ {
+		q, ok := r.readUnary(length >> param)
+		if !ok {
+			return nil, 0, errInvalidEncoding
+		}
+		rem, ok := r.readBits(uint(param))
+		if !ok {
+			return nil, 0, errInvalidEncoding
+		}
+		gap := q<<param | rem
+		if gap >= length-next {
+			return nil, 0, errInvalidEncoding
+		}
+		b.Set(uint(next + gap))
+		next += gap + 1
+	}
+	return b, 32 + n, nil
+}
+
+// A bitWriter appends bits to a byte slice, most significant first.
+type bitWriter struct {
+	buf []byte
+	acc uint64 // the n last bits written, not yet in buf
+	n   uint
+}
+
+// writeBits writes the n low bits of v
+func (w *bitWriter) writeBits(v uint64, n uint) {
+	if n > 32 {
+		w.writeBits(v>>32, n-32)
+		n = 32
+	}
+	w.acc = w.acc<<n | v&(1<<n-1)
+	w.n += n
+	for w.n >= 8 {
+		w.n -= 8
+		w.buf = append(w.buf, byte(w.acc>>w.n))
+	}
+}
+
+// writeUnary writes q ones followed by a zero
+func (w *bitWriter) writeUnary(q uint64) {
+	for ; q >= 32; q -= 32 {
+		w.writeBits(math.MaxUint32, 32)
+	}
+	w.writeBits((1<<q-1)<<1, uint(q)+1)
+}
+
+// bytes returns the bits written, padded with zeros to a byte
+func (w *bitWriter) bytes() []byte {
+	if w.n > 0 {
+		w.writeBits(0, 8-w.n)
+	}
+	return w.buf
+}
+
+// A bitReader reads the bits of a byte slice, most significant first.
+type bitReader struct {
+	data []byte
+	pos  uint64 // in bits
+}
+
+// readBits reads n bits and returns false if there are fewer left
+func (r *bitReader) readBits(n uint) (uint64, bool) {
+	if uint64(len(r.data))*8-r.pos < uint64(n) {
+		return 0, false
+	}
+	var v uint64
+	for ; n > 0; n-- {
+		bit := r.data[r.pos/8] >> (7 - r.pos%8) & 1
+		v = v<<1 | uint64(bit)
+		r.pos++
+	}
+	return v, true
+}
+
+// readUnary reads ones up to a zero and returns their number, or false if
+// there are more than max ones or the data ends first
+func (r *bitReader) readUnary(max uint64) (uint64, bool) {
+	var q uint64
+	for r.pos < uint64(len(r.data))*8 {
+		bit := r.data[r.pos/8] >> (7 - r.pos%8) & 1
+		r.pos++
+		if bit == 0 {
+			return q, true
+		}
+		if q == max {
+			return 0, false
+		}
+		q++
+	}
+	return 0, false
+}
+
+// A gzip compressed bitset is written in chunks, each preceded by its
+// length as a big-endian 32-bit word, and followed by an empty chunk: the
+// end of the compressed bitset is thus known without reading past it, so
+// that other data may follow the filter in the stream.
+
+// chunkSize is the largest chunk of a compressed bitset
+const chunkSize = 1 << 16
+
+// writeGzip writes a bitset compressed with gzip and returns the number of
+// bytes written
+func writeGzip(stream io.Writer, b *bitset.BitSet) (int64, error) {
+	w := &chunkWriter{stream: stream}
+	zw, _ := gzip.NewWriterLevel(w, gzip.BestSpeed)
+	_, err := b.WriteTo(zw)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	return w.n, err
+}
+
+// readGzip reads a bitset written by writeGzip and returns the number of
+// bytes read
+func readGzip(stream io.Reader, l limit) (*bitset.BitSet, int64, error) {
+	r := &chunkReader{stream: stream}
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, 0, unexpectedEOF(err)
+	}
+	b, _, err := readWords(zr, l)
+	if err != nil {
+		return nil, 0, err
+	}
+	// Read up to the end of the compressed data, which checks its checksum,
+	// and up to the final chunk.
+	_, err = io.Copy(io.Discard, zr)
+	if err == nil {
+		_, err = io.Copy(io.Discard, r)
+	}
+	if err != nil {
+		return nil, 0, unexpectedEOF(err)
+	}
+	return b, r.n, nil
+}
+
+// readWords reads a bitset as written by its WriteTo method, and returns
+// the number of bytes read. Unlike its ReadFrom method, the words are read
+// in chunks, so that a corrupted length does not allocate more than the
+// stream holds: checksums are only checked after the bitset.
+func readWords(stream io.Reader, l limit) (*bitset.BitSet, int64, error) {
+	var length uint64
+	err := binary.Read(stream, bitset.BinaryOrder(), &length)
+	if err != nil {
+		return nil, 0, unexpectedEOF(err)
+	}
+	if err := l.check(length); err != nil {
+		return nil, 0, err
+	}
+	n := length/64 + (length%64+63)/64
+	words, err := readUint64s(stream, n, bitset.BinaryOrder())
+	if err != nil {
+		return nil, 0, err
+	}
+	return bitset.FromWithLength(uint(length), words), int64(8 + 8*n), nil
+}
+
+// readUint64s reads n words in the given byte order. Beyond 8 MB, the words
+// are allocated as they are read, doubling their capacity up to n, so that
+// at most about twice the size of the words is allocated.
+func readUint64s(stream io.Reader, n uint64, order binary.ByteOrder) ([]uint64, error) {
+	capacity := n
+	if capacity > 1<<20 {
+		capacity = 1 << 20
+	}
+	words := make([]uint64, 0, capacity)
+	buffer := make([]byte, 128*8)
+	for uint64(len(words)) < n {
+		if len(words) == cap(words) {
+			capacity = 2 * uint64(cap(words))
+			if capacity > n {
+				capacity = n
+			}
+			grown := make([]uint64, len(words), capacity)
+			copy(grown, words)
+			words = grown
+		}
+		chunk := n - uint64(len(words))
+		if chunk > 128 {
+			chunk = 128
+		}
+		if _, err := io.ReadFull(stream, buffer[:8*chunk]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		for j := uint64(0); j < chunk; j++ {
+			words = append(words, order.Uint64(buffer[8*j:]))
+		}
+	}
+	return words, nil
+}
+
+// unexpectedEOF returns io.ErrUnexpectedEOF for io.EOF: the stream ended
+// before the end of the filter
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// A chunkWriter writes data in chunks preceded by their length.
+type chunkWriter struct {
+	stream io.Writer
+	buf    []byte
+	n      int64 // bytes written to stream
+}
+
+// Write implements io.Writer
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		if w.buf == nil {
+			w.buf = make([]byte, 4, 4+chunkSize)
+		}
+		c := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+c]
+		p = p[c:]
+		if len(w.buf) == cap(w.buf) {
+			if err := w.flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// flush writes the buffered chunk, even if it is empty
+func (w *chunkWriter) flush() error {
+	if w.buf == nil {
+		w.buf = make([]byte, 4, 4+chunkSize)
+	}
+	binary.BigEndian.PutUint32(w.buf, uint32(len(w.buf)-4))
+	n, err := w.stream.Write(w.buf)
+	w.n += int64(n)
+	w.buf = w.buf[:4]
+	return err
+}
+
+// Close writes the last chunk, if any, and the final empty chunk
+func (w *chunkWriter) Close() error {
+	if w.buf != nil && len(w.buf) > 4 {
+		if err := w.flush(); err != nil {
+			return err
+		}
+	}
+	return w.flush()
+}
+
+// A chunkReader reads data written by a chunkWriter, up to its final chunk.
+type chunkReader struct {
+	stream io.Reader
+	left   uint32 // bytes left in the current chunk
+	done   bool
+	n      int64 // bytes read from stream
+}
+
+// Read implements io.Reader
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for r.left == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		var length [4]byte
+		n, err := io.ReadFull(r.stream, length[:])
+		r.n += int64(n)
+		if err != nil {
+			return 0, unexpectedEOF(err)
+		}
+		r.left = binary.BigEndian.Uint32(length[:])
+		r.done = r.left == 0
+	}
+	if uint64(len(p)) > uint64(r.left) {
+		p = p[:r.left]
+	}
+	n, err := r.stream.Read(p)
+	r.n += int64(n)
+	r.left -= uint32(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
@@ -0,0 +1,200 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"runtime"
+	"testing"
+)
+
+func TestWriteEncodedTo(t *testing.T) {
+	for _, e := range []Encoding{EncodingGolomb, EncodingGzip} {
+		for _, f := range []*BloomFilter{
+			New(1, 1),
+			NewWithEstimates(1000, 0.01),
+			NewWithEstimatesAndSeed(1000, 0.01, 42),
+			NewFastRangeWithEstimates(1000, 0.01),
+			New(100000, 3),
+			From(make([]uint64, 3), 2), // the bitset is longer than m
+		} {
+			testWriteEncodedTo(t, f, e)
+		}
+	}
+
+	if _, err := New(10, 1).WriteEncodedTo(&bytes.Buffer{}, 3); err == nil {
+		t.Error("unknown encodings should not be accepted")
+	}
+}
+
+func testWriteEncodedTo(t *testing.T, f *BloomFilter, e Encoding) {
+	t.Helper()
+	for i := uint32(0); i < 300; i++ {
+		f.AddUint32(i)
+	}
+	var raw, encoded bytes.Buffer
+	if _, err := f.WriteEncodedTo(&raw, EncodingRaw); err != nil {
+		t.Fatal(err)
+	}
+	n, err := f.WriteEncodedTo(&encoded, e)
+	if err != nil || n != int64(encoded.Len()) {
+		t.Fatalf("wrote %d bytes out of %d: %v", n, encoded.Len(), err)
+	}
+	data := encoded.Bytes()
+	var g BloomFilter
+	m, err := g.ReadFrom(bytes.NewReader(data))
+	if err != nil || m != n {
+		t.Fatalf("read %d bytes out of %d: %v", m, n, err)
+	}
+	if !f.Equal(&g) || f.b.Len() != g.b.Len() {
+		t.Errorf("%d, %d: encoding %d changed the filter", f.m, f.k, e)
+	}
+	if !bytes.Equal(raw.Bytes(), mustMarshal(t, f)) {
+		t.Error("EncodingRaw should write what WriteTo writes")
+	}
+
+	// Encoded filters can be merged, but not tested serialized.
+	h := f.Copy().ClearAll()
+	if _, err := h.MergeFromReader(bytes.NewReader(data)); err != nil || !h.Equal(f) {
+		t.Errorf("MergeFromReader should decode the filter: %v", err)
+	}
+	if _, err := TestSerialized(data, []byte("x")); err == nil {
+		t.Error("TestSerialized should not accept encoded filters")
+	}
+
+	// The filter is read up to its end, and not beyond, even from streams
+	// which are not buffered.
+	stream := bytes.NewReader(append(append([]byte(nil), data...), "tail"...))
+	if _, err := g.ReadFrom(struct{ io.Reader }{stream}); err != nil || stream.Len() != 4 {
+		t.Errorf("ReadFrom should only read the filter: %v, %d bytes left", err, stream.Len())
+	}
+
+	for i := range data {
+		if _, err := g.ReadFrom(bytes.NewReader(data[:i])); err == nil {
+			t.Fatalf("%d bytes out of %d should not be accepted", i, len(data))
+		}
+	}
+}
+
+func mustMarshal(t *testing.T, f *BloomFilter) []byte {
+	t.Helper()
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestEncodingGolombSize(t *testing.T) {
+	for _, c := range []struct {
+		fill  float64
+		ratio float64 // at most, of the raw size
+	}{
+		{0.01, 0.12},
+		{0.1, 0.56},
+		{0.3, 0.98},
+	} {
+		f := New(1<<20, 1)
+		for i := uint32(0); f.FillRatio() < c.fill; i++ {
+			for j := uint32(0); j < 1000; j++ {
+				f.AddUint32(1000*i + j)
+			}
+		}
+		var raw, encoded bytes.Buffer
+		f.WriteTo(&raw)
+		f.WriteEncodedTo(&encoded, EncodingGolomb)
+		ratio := float64(encoded.Len()) / float64(raw.Len())
+		if ratio > c.ratio {
+			t.Errorf("fill ratio %v: encoded in %.3f of the raw size", c.fill, ratio)
+		}
+		bits := 8 * float64(encoded.Len()) / float64(f.b.Count())
+		t.Logf("fill ratio %v: %.3f of the raw size, %.2f bits per set bit", c.fill, ratio, bits)
+	}
+}
+
+func TestEncodingGolombCorrupted(t *testing.T) {
+	f := NewWithEstimates(1000, 0.01)
+	for i := uint32(0); i < 300; i++ {
+		f.AddUint32(i)
+	}
+	var buf bytes.Buffer
+	f.WriteEncodedTo(&buf, EncodingGolomb)
+	data := buf.Bytes()
+	// The fields of the encoded bitset follow the 34-byte header.
+	for name, corrupt := range map[string]func([]byte){
+		"count":     func(b []byte) { binary.BigEndian.PutUint64(b[42:], 10000) },
+		"parameter": func(b []byte) { binary.BigEndian.PutUint64(b[50:], 64) },
+		"length":    func(b []byte) { binary.BigEndian.PutUint64(b[34:], 100) },
+		"gaps": func(b []byte) {
+			for i := 66; i < len(b); i++ {
+				b[i] = 0xff
+			}
+		},
+	} {
+		bad := append([]byte(nil), data...)
+		corrupt(bad)
+		var g BloomFilter
+		if _, err := g.ReadFrom(bytes.NewReader(bad)); err == nil {
+			t.Errorf("invalid %s should not be accepted", name)
+		}
+	}
+}
+
+func TestEncodingGzipCorrupted(t *testing.T) {
+	f := NewWithEstimates(1000, 0.01)
+	for i := uint32(0); i < 300; i++ {
+		f.AddUint32(i)
+	}
+	var buf bytes.Buffer
+	f.WriteEncodedTo(&buf, EncodingGzip)
+	data := buf.Bytes()
+	// The compressed data follows the 34-byte header, a chunk length and
+	// the 10-byte gzip header, and is followed by the final empty chunk.
+	for i := 34 + 4 + 10; i < len(data)-4; i++ {
+		bad := append([]byte(nil), data...)
+		bad[i] ^= 0xff
+		var g BloomFilter
+		if _, err := g.ReadFrom(bytes.NewReader(bad)); err == nil {
+			t.Errorf("byte %d out of %d: corrupted data should not be accepted", i, len(data))
+		}
+	}
+}
+
+// allocated returns the number of bytes allocated by fn
+func allocated(fn func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	fn()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+func TestSerializationAllocations(t *testing.T) {
+	if testing.Short() {
+		t.Skip("allocates a 16 MB filter")
+	}
+	f := New(1<<27, 5)
+	size := uint64(f.b.BinaryStorageSize())
+	// WriteTo streams the bitset in chunks, whatever m.
+	if n := allocated(func() { f.WriteTo(io.Discard) }); n > 64<<10 {
+		t.Errorf("WriteTo allocated %d bytes", n)
+	}
+	// Other methods allocate their result once, or grow it geometrically.
+	var data, text []byte
+	for _, c := range []struct {
+		name  string
+		fn    func()
+		ratio float64
+	}{
+		{"MarshalBinary", func() { data, _ = f.MarshalBinary() }, 1.1},
+		{"GobEncode", func() { f.GobEncode() }, 1.1},
+		{"MarshalText", func() { text, _ = f.MarshalText() }, 1.5},
+		{"ReadFrom", func() { new(BloomFilter).ReadFrom(bytes.NewReader(data)) }, 2.1},
+		{"UnmarshalText", func() { new(BloomFilter).UnmarshalText(text) }, 3.1},
+	} {
+		if n := allocated(c.fn); float64(n) > c.ratio*float64(size) {
+			t.Errorf("%s allocated %d bytes for a bitset of %d bytes", c.name, n, size)
+		}
+	}
+}
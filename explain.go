@@ -0,0 +1,68 @@
+package bloom
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A LocationInfo describes one of the k probes of a key.
+type LocationInfo struct {
+	Probe    uint // index of the probe, from 0 to k-1
+	Location uint // bit location in the filter
+	Word     uint // index of the 64-bit word holding the bit
+	Set      bool // whether the bit is set
+}
+
+// An Explanation details how a key was tested against a filter.
+type Explanation struct {
+	M         uint
+	K         uint
+	Locations []LocationInfo
+	// FirstMiss is the probe of the first unset location, the one which
+	// makes Test return false, or -1 if all the locations are set.
+	FirstMiss int
+}
+
+// Present returns the result of Test for the explained key.
+func (e Explanation) Present() bool {
+	return e.FirstMiss < 0
+}
+
+// String formats the explanation over several lines, for logs and
+// debugging sessions.
+func (e Explanation) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "m=%d k=%d present=%v", e.M, e.K, e.Present())
+	if !e.Present() {
+		fmt.Fprintf(&sb, " first miss=%d", e.FirstMiss)
+	}
+	for _, l := range e.Locations {
+		fmt.Fprintf(&sb, "\nprobe %d: location %d (word %d) set=%v", l.Probe, l.Location, l.Word, l.Set)
+	}
+	return sb.String()
+}
+
+// Explain returns the k locations of the data in the filter, whether each
+// of them is set, and which probe causes Test to fail. Unlike Test, it does
+// not stop at the first miss. It is meant for debugging, e.g., to find out
+// why a key matches, and comparing explanations across serialized copies of
+// a filter.
+func (f *BloomFilter) Explain(data []byte) Explanation {
+	e := Explanation{M: f.m, K: f.k, Locations: make([]LocationInfo, f.k), FirstMiss: -1}
+	h := f.hashes(data)
+	for i := uint(0); i < f.k; i++ {
+		l := f.location(h, i)
+		set := f.b.Test(l)
+		e.Locations[i] = LocationInfo{Probe: i, Location: l, Word: l / 64, Set: set}
+		if !set && e.FirstMiss < 0 {
+			e.FirstMiss = int(i)
+		}
+	}
+	return e
+}
+
+// ExplainString returns the explanation of how the string is tested against
+// the filter, see Explain.
+func (f *BloomFilter) ExplainString(data string) Explanation {
+	return f.Explain(stringToBytes(data))
+}
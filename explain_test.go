@@ -0,0 +1,44 @@
+package bloom
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	f := NewWithEstimates(1000, 0.001)
+	f.AddString("Love")
+	e := f.Explain([]byte("Love"))
+	if !e.Present() || e.FirstMiss != -1 {
+		t.Errorf("Love should be present: %v", e)
+	}
+	if e.M != f.Cap() || e.K != f.K() || uint(len(e.Locations)) != f.K() {
+		t.Errorf("unexpected explanation %v", e)
+	}
+	locs := Locations([]byte("Love"), f.K())
+	for i, l := range e.Locations {
+		if l.Probe != uint(i) || uint64(l.Location) != locs[i]%uint64(f.Cap()) || l.Word != l.Location/64 || !l.Set {
+			t.Errorf("unexpected location %+v", l)
+		}
+	}
+
+	if es := f.ExplainString("Love"); es.String() != e.String() {
+		t.Errorf("ExplainString and Explain disagree: %v", es)
+	}
+
+	e = f.Explain([]byte("Hate"))
+	if e.Present() != f.TestString("Hate") {
+		t.Errorf("Explain and Test disagree: %v", e)
+	}
+	if e.FirstMiss < 0 || e.Locations[e.FirstMiss].Set {
+		t.Errorf("unexpected first miss: %v", e)
+	}
+	for i := 0; i < e.FirstMiss; i++ {
+		if !e.Locations[i].Set {
+			t.Errorf("probe %d is an earlier miss", i)
+		}
+	}
+	if !strings.Contains(e.String(), "first miss=") {
+		t.Errorf("unexpected string %q", e.String())
+	}
+}
@@ -0,0 +1,169 @@
+package bloom
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// WriteCHeader writes the filter as a self-contained C header to an i/o stream.
+// The header defines the constants <NAME>_M, <NAME>_K and <NAME>_SEED, the
+// filter words as a static array and a reference query function
+//
+//	int <name>_test(const void *key, size_t len);
+//
+// which returns 1 if the key might be in the set and 0 otherwise, exactly as
+// Test would. The name must be a valid C identifier; it prefixes every symbol
+// so that several filters may be compiled into the same firmware image.
+//
+// The generated code only depends on stdint.h and stddef.h and performs no
+// allocation, so it is suitable for embedded targets.
+func (f *BloomFilter) WriteCHeader(stream io.Writer, name string) error {
+	if f.key != nil {
+		return errors.New("bloom: keyed filters cannot be exported to C")
+	}
+	if f.fastRange {
+		return errors.New("bloom: fast range filters cannot be exported to C")
+	}
+	if f.scheme != SchemeDefault {
+		return errors.New("bloom: only filters with the default location scheme can be exported to C")
+	}
+	if !isCIdentifier(name) {
+		return fmt.Errorf("bloom: %q is not a valid C identifier", name)
+	}
+	upper := make([]byte, len(name))
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		upper[i] = c
+	}
+	words := make([]uint64, (f.m+63)/64)
+	copy(words, f.b.Words())
+
+	w := bufio.NewWriter(stream)
+	fmt.Fprintf(w, "/* Code generated by github.com/bits-and-blooms/bloom. DO NOT EDIT. */\n\n")
+	fmt.Fprintf(w, "#ifndef %s_BLOOM_H\n#define %s_BLOOM_H\n\n", upper, upper)
+	fmt.Fprintf(w, "#include <stddef.h>\n#include <stdint.h>\n\n")
+	fmt.Fprintf(w, "#define %s_M %dULL\n", upper, f.m)
+	fmt.Fprintf(w, "#define %s_K %dU\n", upper, f.k)
+	fmt.Fprintf(w, "#define %s_SEED %dULL\n\n", upper, f.seed)
+	fmt.Fprintf(w, "static const uint64_t %s_words[%d] = {", name, len(words))
+	for i, word := range words {
+		if i%4 == 0 {
+			fmt.Fprintf(w, "\n\t")
+		} else {
+			fmt.Fprintf(w, " ")
+		}
+		fmt.Fprintf(w, "0x%016xULL,", word)
+	}
+	fmt.Fprintf(w, "\n};\n")
+	fmt.Fprintf(w, cHeaderFunctions, name, upper)
+	fmt.Fprintf(w, "\n#endif /* %s_BLOOM_H */\n", upper)
+	return w.Flush()
+}
+
+// isCIdentifier reports whether s can be used as a C identifier.
+func isCIdentifier(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// cHeaderFunctions is the reference query code. It is a port of sum256 and
+// location: murmur3 (x64, 128 bits) is computed over the key, and then over
+// the key with an extra byte of value 1 appended. The format verbs are the
+// lower-case and upper-case prefixes.
+const cHeaderFunctions = `
+static uint64_t %[1]s_rotl64(uint64_t x, int r) {
+	return (x << r) | (x >> (64 - r));
+}
+
+static uint64_t %[1]s_fmix64(uint64_t k) {
+	k ^= k >> 33;
+	k *= 0xff51afd7ed558ccdULL;
+	k ^= k >> 33;
+	k *= 0xc4ceb9fe1a85ec53ULL;
+	k ^= k >> 33;
+	return k;
+}
+
+/* Returns byte i of the key, followed by a virtual byte of value 1. */
+static uint64_t %[1]s_byte(const uint8_t *p, size_t len, size_t i) {
+	return i < len ? p[i] : 1;
+}
+
+/* murmur3 x64 128 over the first n bytes of the key (n is len or len+1). */
+static void %[1]s_murmur(const uint8_t *p, size_t len, size_t n, uint64_t out[2]) {
+	const uint64_t c1 = 0x87c37b91114253d5ULL;
+	const uint64_t c2 = 0x4cf5ad432745937fULL;
+	uint64_t h1 = %[2]s_SEED, h2 = %[2]s_SEED, k1, k2;
+	size_t i, j, tail = n & ~(size_t)15;
+	for (i = 0; i < tail; i += 16) {
+		k1 = 0;
+		k2 = 0;
+		for (j = 0; j < 8; j++) {
+			k1 |= %[1]s_byte(p, len, i + j) << (8 * j);
+			k2 |= %[1]s_byte(p, len, i + 8 + j) << (8 * j);
+		}
+		k1 *= c1; k1 = %[1]s_rotl64(k1, 31); k1 *= c2; h1 ^= k1;
+		h1 = %[1]s_rotl64(h1, 27); h1 += h2; h1 = h1 * 5 + 0x52dce729;
+		k2 *= c2; k2 = %[1]s_rotl64(k2, 33); k2 *= c1; h2 ^= k2;
+		h2 = %[1]s_rotl64(h2, 31); h2 += h1; h2 = h2 * 5 + 0x38495ab5;
+	}
+	k1 = 0;
+	k2 = 0;
+	for (j = 0; tail + j < n; j++) {
+		if (j < 8) {
+			k1 |= %[1]s_byte(p, len, tail + j) << (8 * j);
+		} else {
+			k2 |= %[1]s_byte(p, len, tail + j) << (8 * (j - 8));
+		}
+	}
+	if (n - tail > 8) {
+		k2 *= c2; k2 = %[1]s_rotl64(k2, 33); k2 *= c1; h2 ^= k2;
+	}
+	if (n - tail > 0) {
+		k1 *= c1; k1 = %[1]s_rotl64(k1, 31); k1 *= c2; h1 ^= k1;
+	}
+	h1 ^= (uint64_t)n;
+	h2 ^= (uint64_t)n;
+	h1 += h2;
+	h2 += h1;
+	h1 = %[1]s_fmix64(h1);
+	h2 = %[1]s_fmix64(h2);
+	h1 += h2;
+	h2 += h1;
+	out[0] = h1;
+	out[1] = h2;
+}
+
+/* Returns 1 if the key might be in the filter, 0 if it is definitely not. */
+static int %[1]s_test(const void *key, size_t len) {
+	const uint8_t *p = (const uint8_t *)key;
+	uint64_t h[4], loc;
+	uint32_t i;
+	%[1]s_murmur(p, len, len, h);
+	%[1]s_murmur(p, len, len + 1, h + 2);
+	for (i = 0; i < %[2]s_K; i++) {
+		loc = h[i %% 2] + (uint64_t)i * h[2 + (((i + (i %% 2)) %% 4) / 2)];
+		loc %%= %[2]s_M;
+		if (!((%[1]s_words[loc >> 6] >> (loc & 63)) & 1)) {
+			return 0;
+		}
+	}
+	return 1;
+}
+`
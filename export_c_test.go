@@ -0,0 +1,135 @@
+package bloom
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteCHeader(t *testing.T) {
+	f := New(1000, 4)
+	f.Add([]byte("Love"))
+	var buf bytes.Buffer
+	err := f.WriteCHeader(&buf, "blocklist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := buf.String()
+	for _, want := range []string{
+		"#define BLOCKLIST_M 1000ULL",
+		"#define BLOCKLIST_K 4U",
+		"#define BLOCKLIST_SEED 0ULL",
+		"static const uint64_t blocklist_words[16] = {",
+		"static int blocklist_test(const void *key, size_t len)",
+	} {
+		if !strings.Contains(header, want) {
+			t.Errorf("header is missing %q", want)
+		}
+	}
+	for _, word := range f.b.Words() {
+		if !strings.Contains(header, fmt.Sprintf("0x%016xULL,", word)) {
+			t.Errorf("header is missing word %x", word)
+		}
+	}
+}
+
+func TestWriteCHeaderInvalidName(t *testing.T) {
+	f := New(1000, 4)
+	for _, name := range []string{"", "1filter", "my-filter", "my filter"} {
+		var buf bytes.Buffer
+		if err := f.WriteCHeader(&buf, name); err == nil {
+			t.Errorf("expected an error for name %q", name)
+		}
+	}
+}
+
+func TestWriteCHeaderSeed(t *testing.T) {
+	f := NewWithSeed(1000, 4, 42)
+	var buf bytes.Buffer
+	if err := f.WriteCHeader(&buf, "seeded"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "#define SEEDED_SEED 42ULL") {
+		t.Error("header should define the seed of the filter")
+	}
+}
+
+// cDriver tests each line of its input against the filters of plain.h and
+// seeded.h, and prints the two answers.
+const cDriver = `#include <stdio.h>
+#include <string.h>
+#include "plain.h"
+#include "seeded.h"
+
+int main(void) {
+	char line[256];
+	while (fgets(line, sizeof line, stdin)) {
+		size_t len = strcspn(line, "\n");
+		printf("%d%d\n", plain_test(line, len), seeded_test(line, len));
+	}
+	return 0;
+}
+`
+
+func TestWriteCHeaderCompiled(t *testing.T) {
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler")
+	}
+	filters := map[string]*BloomFilter{
+		"plain":  NewWithEstimates(400, 0.05),
+		"seeded": NewWithSeed(3000, 5, 42),
+	}
+	// Keys of all lengths up to 40 bytes exercise the tail of murmur3.
+	keys := make([]string, 800)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%d%s", i, strings.Repeat("x", i%40))
+	}
+	dir := t.TempDir()
+	for name, f := range filters {
+		for _, key := range keys[:400] {
+			f.AddString(key)
+		}
+		var buf bytes.Buffer
+		if err := f.WriteCHeader(&buf, name); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name+".h"), buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "driver.c"), []byte(cDriver), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	driver := filepath.Join(dir, "driver")
+	if out, err := exec.Command(cc, "-std=c99", "-o", driver, filepath.Join(dir, "driver.c")).CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	cmd := exec.Command(driver)
+	cmd.Stdin = strings.NewReader(strings.Join(keys, "\n") + "\n")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	answers := strings.Fields(string(out))
+	if len(answers) != len(keys) {
+		t.Fatalf("%d answers for %d keys", len(answers), len(keys))
+	}
+	for i, key := range keys {
+		want := ""
+		for _, name := range []string{"plain", "seeded"} {
+			if filters[name].TestString(key) {
+				want += "1"
+			} else {
+				want += "0"
+			}
+		}
+		if answers[i] != want {
+			t.Errorf("%q: the C filters answered %s, Test %s", key, answers[i], want)
+		}
+	}
+}
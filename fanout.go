@@ -0,0 +1,89 @@
+package bloom
+
+import (
+	"context"
+	"sort"
+)
+
+// A Shard is a filter which can be queried by FanOut. Remote filters
+// implement it by performing the query over the network, honoring the
+// context.
+type Shard interface {
+	TestContext(ctx context.Context, data []byte) (bool, error)
+}
+
+// localShard adapts a BloomFilter to the Shard interface.
+type localShard struct {
+	f *BloomFilter
+}
+
+func (s localShard) TestContext(ctx context.Context, data []byte) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return s.f.Test(data), nil
+}
+
+// LocalShard returns a Shard querying an in-memory filter. The filter must
+// not be modified while it is queried.
+func LocalShard(f *BloomFilter) Shard {
+	return localShard{f}
+}
+
+// readerAtShard adapts a ReaderAtBloomFilter to the Shard interface.
+type readerAtShard struct {
+	f *ReaderAtBloomFilter
+}
+
+func (s readerAtShard) TestContext(ctx context.Context, data []byte) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return s.f.Test(data)
+}
+
+// ReaderAtShard returns a Shard querying a filter read from a file or an
+// object, see NewReaderAt. The context is checked before the words are read,
+// not while they are.
+func ReaderAtShard(f *ReaderAtBloomFilter) Shard {
+	return readerAtShard{f}
+}
+
+// FanOut tests the data against all the shards concurrently and returns the
+// indexes, in increasing order, of the shards that may contain it. If a shard
+// fails or the context is done before all the shards have answered, FanOut
+// returns the first error encountered.
+func FanOut(ctx context.Context, data []byte, shards []Shard) ([]int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		shard   int
+		present bool
+		err     error
+	}
+	results := make(chan result, len(shards))
+	for i, s := range shards {
+		go func(i int, s Shard) {
+			present, err := s.TestContext(ctx, data)
+			results <- result{i, present, err}
+		}(i, s)
+	}
+
+	var candidates []int
+	for range shards {
+		select {
+		case r := <-results:
+			if r.err != nil {
+				return nil, r.err
+			}
+			if r.present {
+				candidates = append(candidates, r.shard)
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	sort.Ints(candidates)
+	return candidates, nil
+}
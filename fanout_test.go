@@ -0,0 +1,111 @@
+package bloom
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFanOut(t *testing.T) {
+	shards := make([]Shard, 8)
+	for i := range shards {
+		f := New(1000, 4)
+		f.AddString("everywhere")
+		if i%3 == 0 {
+			f.AddString("some")
+		}
+		shards[i] = LocalShard(f)
+	}
+	candidates, err := FanOut(context.Background(), []byte("some"), shards)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 3 || candidates[0] != 0 || candidates[1] != 3 || candidates[2] != 6 {
+		t.Errorf("unexpected candidates %v", candidates)
+	}
+	candidates, err = FanOut(context.Background(), []byte("everywhere"), shards)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != len(shards) {
+		t.Errorf("unexpected candidates %v", candidates)
+	}
+	candidates, err = FanOut(context.Background(), []byte("nowhere"), shards)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 0 {
+		t.Errorf("unexpected candidates %v", candidates)
+	}
+}
+
+func TestFanOutReaderAt(t *testing.T) {
+	shards := make([]Shard, 4)
+	for i := range shards {
+		f := New(1000, 4)
+		if i%2 == 1 {
+			f.AddString("odd")
+		}
+		data, err := f.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := NewReaderAt(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		shards[i] = ReaderAtShard(r)
+	}
+	g := New(1000, 4)
+	g.AddString("odd")
+	shards = append(shards, LocalShard(g))
+	candidates, err := FanOut(context.Background(), []byte("odd"), shards)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 3 || candidates[0] != 1 || candidates[1] != 3 || candidates[2] != 4 {
+		t.Errorf("unexpected candidates %v", candidates)
+	}
+
+	// Errors reading the words are returned.
+	data, _ := g.MarshalBinary()
+	r, err := NewReaderAt(bytes.NewReader(data[:len(data)-8*len(g.b.Words())]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FanOut(context.Background(), []byte("odd"), []Shard{ReaderAtShard(r)}); err == nil {
+		t.Error("expected an error from a truncated filter")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ReaderAtShard(r).TestContext(ctx, []byte("odd")); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+type failingShard struct{}
+
+func (failingShard) TestContext(ctx context.Context, data []byte) (bool, error) {
+	return false, errors.New("unreachable")
+}
+
+type blockingShard struct{}
+
+func (blockingShard) TestContext(ctx context.Context, data []byte) (bool, error) {
+	<-ctx.Done()
+	return false, ctx.Err()
+}
+
+func TestFanOutErrors(t *testing.T) {
+	shards := []Shard{LocalShard(New(1000, 4)), failingShard{}}
+	if _, err := FanOut(context.Background(), []byte("key"), shards); err == nil {
+		t.Error("expected an error from a failing shard")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	shards = []Shard{LocalShard(New(1000, 4)), blockingShard{}}
+	if _, err := FanOut(ctx, []byte("key"), shards); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package bloom
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/bits-and-blooms/bitset"
+)
+
+// filePageWords is the number of words of a page of a FileBloomFilter, the
+// unit written by Flush: 4 KiB, the size of a page of most file systems. The
+// bitset starts after the header, at an offset which is not a multiple of
+// 4 KiB, so the pages of the filter are not aligned with those of the file
+// system: writing one usually updates two pages of the file system.
+const filePageWords = 512
+
+// A FileBloomFilter is a Bloom filter backed by a file, as written by
+// WriteTo, which it updates in place: Flush only writes the pages of the
+// bitset holding bits set since the last flush, rather than the whole filter.
+//
+// No write-ahead log is needed to reopen the file safely after a crash: bits
+// are only ever set, so a page partially written by an interrupted Flush
+// holds, byte by byte, either its previous or its new contents. The file is
+// then a valid filter which may lack the keys added since the last Sync, but
+// never holds keys which were not added.
+//
+// Like a BloomFilter, it is not safe for concurrent use. Keyed filters are not
+// supported, since their key is not written to the file.
+type FileBloomFilter struct {
+	filter *BloomFilter
+	file   *os.File
+	offset int64          // offset of the first word of the bitset
+	dirty  *bitset.BitSet // pages to write on Flush
+}
+
+// CreateFile writes the filter to a new file at path, replacing any existing
+// file, and returns a FileBloomFilter which updates it. The file is written
+// to a temporary file in the same directory, which is then renamed, so that
+// path never holds a partial filter, and the directory is synced, so that
+// the rename is durable. The FileBloomFilter takes ownership of
+// f, which must not be used afterwards.
+func CreateFile(path string, f *BloomFilter) (*FileBloomFilter, error) {
+	if f.key != nil {
+		return nil, errors.New("bloom: keyed filters cannot be backed by a file")
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(tmp)
+	_, err = f.WriteTo(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	err = syncDir(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return newFileBloomFilter(f, file), nil
+}
+
+// OpenFile opens a file written by WriteTo or CreateFile, reads the filter
+// and returns a FileBloomFilter which updates it. Encoded and framed filters
+// (see WriteEncodedTo and WriteFramedTo) are not supported, since their bits
+// cannot be updated in place.
+func OpenFile(path string) (*FileBloomFilter, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	h, _, err := readHeader(bufio.NewReader(file))
+	if err == nil && (h.encoding != EncodingRaw || h.checksum) {
+		err = errors.New("bloom: encoded and framed filters cannot be updated in place")
+	}
+	if err == nil {
+		_, err = file.Seek(0, 0)
+	}
+	f := &BloomFilter{}
+	if err == nil {
+		_, err = f.ReadFrom(bufio.NewReader(file))
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("bloom: %s: %w", path, err)
+	}
+	return newFileBloomFilter(f, file), nil
+}
+
+// syncDir commits a directory, e.g., the renaming of one of its files, to
+// stable storage. Directories cannot be synced on Windows, where it does
+// nothing.
+func syncDir(path string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	err = dir.Sync()
+	if closeErr := dir.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func newFileBloomFilter(f *BloomFilter, file *os.File) *FileBloomFilter {
+	n, _ := f.header().writeTo(io.Discard)
+	pages := (uint(len(f.b.Words())) + filePageWords - 1) / filePageWords
+	return &FileBloomFilter{
+		filter: f,
+		file:   file,
+		offset: n + 8,
+		dirty:  bitset.New(pages),
+	}
+}
+
+// Cap returns the capacity, _m_, of the filter
+func (f *FileBloomFilter) Cap() uint {
+	return f.filter.Cap()
+}
+
+// K returns the number of hash functions used in the filter
+func (f *FileBloomFilter) K() uint {
+	return f.filter.K()
+}
+
+// Add data to the filter. The file is only updated by Flush, Sync or Close.
+// Returns the filter (allows chaining)
+func (f *FileBloomFilter) Add(data []byte) *FileBloomFilter {
+	h := f.filter.hashes(data)
+	for i := uint(0); i < f.filter.k; i++ {
+		l := f.filter.location(h, i)
+		f.filter.set(l)
+		f.dirty.Set(l / 64 / filePageWords)
+	}
+	return f
+}
+
+// AddString to the filter. The file is only updated by Flush, Sync or Close.
+// Returns the filter (allows chaining)
+func (f *FileBloomFilter) AddString(data string) *FileBloomFilter {
+	return f.Add(stringToBytes(data))
+}
+
+// Test returns true if the data is in the filter, false otherwise. If true,
+// the result might be a false positive. If false, the data is definitely not
+// in the set.
+func (f *FileBloomFilter) Test(data []byte) bool {
+	return f.filter.Test(data)
+}
+
+// TestString returns true if the string is in the filter, false otherwise.
+// If true, the result might be a false positive. If false, the data
+// is definitely not in the set.
+func (f *FileBloomFilter) TestString(data string) bool {
+	return f.filter.TestString(data)
+}
+
+// Flush writes the pages modified since the last flush to the file. They
+// might not be durable until Sync is called.
+func (f *FileBloomFilter) Flush() error {
+	words := f.filter.b.Words()
+	order := bitset.BinaryOrder()
+	buf := make([]byte, 8*filePageWords)
+	for p, ok := f.dirty.NextSet(0); ok; p, ok = f.dirty.NextSet(p + 1) {
+		page := words[p*filePageWords:]
+		if len(page) > filePageWords {
+			page = page[:filePageWords]
+		}
+		for i, w := range page {
+			order.PutUint64(buf[8*i:], w)
+		}
+		_, err := f.file.WriteAt(buf[:8*len(page)], f.offset+int64(8*p*filePageWords))
+		if err != nil {
+			return err
+		}
+		f.dirty.Clear(p)
+	}
+	return nil
+}
+
+// Sync flushes the filter and commits the file to stable storage.
+func (f *FileBloomFilter) Sync() error {
+	if err := f.Flush(); err != nil {
+		return err
+	}
+	return f.file.Sync()
+}
+
+// Close syncs the filter and closes the file.
+func (f *FileBloomFilter) Close() error {
+	err := f.Sync()
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
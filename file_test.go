@@ -0,0 +1,143 @@
+package bloom
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestFileBloomFilter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter")
+	f, err := CreateFile(path, NewWithSeed(1<<20, 5, 42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Cap() != 1<<20 || f.K() != 5 {
+		t.Fatalf("%d bits and %d hash functions", f.Cap(), f.K())
+	}
+	for i := 0; i < 100; i++ {
+		f.AddString(strconv.Itoa(i))
+	}
+	// Keys added and not flushed are not in the file.
+	if g := readFilterFile(t, path); g.TestString("1") {
+		t.Error("the file should only be written by Flush")
+	}
+	if err := f.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	g := readFilterFile(t, path)
+	if !g.Equal(f.filter) {
+		t.Fatal("the file should hold the filter after Flush")
+	}
+
+	// Flush only writes the pages holding new bits.
+	before, _ := os.ReadFile(path)
+	h := f.filter.hashes([]byte("Love"))
+	page := f.filter.location(h, 0) / 64 / filePageWords
+	offset := f.offset + int64(8*filePageWords*page)
+	corrupted := append([]byte(nil), before...)
+	for i := range corrupted[f.offset:] {
+		corrupted[f.offset+int64(i)] ^= 0xff
+	}
+	if err := os.WriteFile(path, corrupted, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f.AddString("Love")
+	if err := f.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := os.ReadFile(path)
+	if bytes.Equal(after[offset:offset+8*filePageWords], corrupted[offset:offset+8*filePageWords]) {
+		t.Error("the page of the new key should be written")
+	}
+	written := 0
+	for p := f.offset; p < int64(len(after)); p += 8 * filePageWords {
+		end := p + 8*filePageWords
+		if end > int64(len(after)) {
+			end = int64(len(after))
+		}
+		if !bytes.Equal(after[p:end], corrupted[p:end]) {
+			written++
+		}
+	}
+	if written > int(f.K()) {
+		t.Errorf("%d pages were written for a key", written)
+	}
+	// Restore the pages which were not written.
+	if err := os.WriteFile(path, before, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f.dirty.SetAll()
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err = OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if !f.TestString(strconv.Itoa(i)) {
+			t.Fatalf("%d should be in the reopened filter", i)
+		}
+	}
+	if !f.TestString("Love") || f.K() != 5 || f.filter.seed != 42 {
+		t.Error("the reopened filter should be the same")
+	}
+	f.AddString("Hate").AddString("bloom")
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if g := readFilterFile(t, path); !g.TestString("Hate") || !g.TestString("bloom") {
+		t.Error("Close should flush the filter")
+	}
+}
+
+func TestFileBloomFilterInvalid(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := CreateFile(filepath.Join(dir, "keyed"), NewKeyed(1000, 4, [16]byte{1})); err == nil {
+		t.Error("keyed filters should not be accepted")
+	}
+	f := New(1000, 4)
+	for name, write := range map[string]func(*bytes.Buffer){
+		"gzip":   func(b *bytes.Buffer) { f.WriteEncodedTo(b, EncodingGzip) },
+		"framed": func(b *bytes.Buffer) { f.WriteFramedTo(b, EncodingRaw) },
+		"short":  func(b *bytes.Buffer) { f.WriteTo(b); b.Truncate(b.Len() - 1) },
+	} {
+		var buf bytes.Buffer
+		write(&buf)
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := OpenFile(path); err == nil {
+			t.Errorf("%s filters should not be accepted", name)
+		}
+	}
+	if _, err := OpenFile(filepath.Join(dir, "missing")); err == nil {
+		t.Error("missing files should not be accepted")
+	}
+	if runtime.GOOS != "windows" && syncDir(filepath.Join(dir, "missing")) == nil {
+		t.Error("syncing a missing directory should fail")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 3 {
+		t.Errorf("%d files in the directory, temporary files should be removed", len(entries))
+	}
+}
+
+// readFilterFile reads the filter written in a file
+func readFilterFile(t *testing.T, path string) *BloomFilter {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f BloomFilter
+	if err := f.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	return &f
+}
@@ -0,0 +1,218 @@
+package bloom
+
+import (
+	"math"
+)
+
+// A FingerprintFilter is a Bloom filter variant which stores an _r_-bit
+// fingerprint per key in one of _k_ hash-addressed slots, instead of setting
+// _k_ bits. A key is reported as present if one of its _k_ candidate slots
+// holds its fingerprint, so the false positive rate is about
+// k * load / (2^r - 1), where load is the fraction of occupied slots.
+//
+// As in a cuckoo filter, the candidate slots are two buckets of k/2 slots:
+// the first one is selected by the key, and the second one by the first one
+// and the fingerprint, so that keys with the same fingerprint have either the
+// same candidate slots or none in common. Keys are added to the emptier
+// bucket, and a key added twice, or two keys with the same fingerprint, take
+// two slots.
+//
+// When all candidate slots of a key are occupied, the key is added to a small
+// plain Bloom filter (the overflow) instead, so that there are never false
+// negatives. Keys stored in a slot can be removed with Remove; keys that went
+// to the overflow cannot.
+type FingerprintFilter struct {
+	slots    uint
+	r        uint
+	k        uint
+	bucket   uint // number of slots per bucket, k/2, or 1 if k is 1
+	words    []uint64
+	overflow *BloomFilter
+}
+
+// NewFingerprint creates a new fingerprint filter with _slots_ slots of _r_
+// bits and _k_ candidate slots per key. We force _slots_ and _k_ to be at least
+// one and _r_ to be between 2 and 32. An odd _k_ above one is rounded up, and
+// _slots_ is rounded up to a multiple of k/2, the size of the buckets.
+func NewFingerprint(slots uint, r uint, k uint) *FingerprintFilter {
+	if r > 32 {
+		r = 32
+	}
+	r = max(2, r)
+	k = max(1, k)
+	bucket := (k + 1) / 2
+	if k > 1 {
+		k = 2 * bucket
+	}
+	slots = (max(1, slots) + bucket - 1) / bucket * bucket
+	return &FingerprintFilter{
+		slots:  slots,
+		r:      r,
+		k:      k,
+		bucket: bucket,
+		words:  make([]uint64, (uint64(slots)*uint64(r)+63)/64),
+	}
+}
+
+// NewFingerprintWithEstimates creates a new fingerprint filter for about n
+// items with fp false positive rate. It uses eight candidate slots per key
+// and enough slots for a load of 75%, so that less than 1% of the keys end up
+// in the overflow.
+func NewFingerprintWithEstimates(n uint, fp float64) *FingerprintFilter {
+	const k = 8
+	const load = 0.75
+	r := uint(math.Ceil(math.Log2(k*load/fp + 1)))
+	slots := uint(math.Ceil(float64(n) / load))
+	return NewFingerprint(slots, r, k)
+}
+
+// Cap returns the number of slots of the filter
+func (f *FingerprintFilter) Cap() uint {
+	return f.slots
+}
+
+// K returns the number of candidate slots per key
+func (f *FingerprintFilter) K() uint {
+	return f.k
+}
+
+// FingerprintBits returns the size, _r_, of the fingerprints in bits
+func (f *FingerprintFilter) FingerprintBits() uint {
+	return f.r
+}
+
+// fingerprint returns the non-zero r-bit fingerprint of a key; zero marks
+// an empty slot.
+func (f *FingerprintFilter) fingerprint(h [4]uint64) uint64 {
+	fp := fmix64(h[0]^h[3]) >> (64 - f.r)
+	if fp == 0 {
+		fp = 1
+	}
+	return fp
+}
+
+// buckets returns the first slots of the two candidate buckets of a key. The
+// second bucket is a function of the first one and of the fingerprint which
+// is its own inverse, so that it maps the second bucket back to the first one.
+func (f *FingerprintFilter) buckets(h [4]uint64, fp uint64) (uint64, uint64) {
+	n := uint64(f.slots / f.bucket)
+	b1 := h[1] % n
+	if f.k == 1 {
+		return b1 * uint64(f.bucket), b1 * uint64(f.bucket)
+	}
+	b2 := (fmix64(fp)%n + n - b1) % n
+	return b1 * uint64(f.bucket), b2 * uint64(f.bucket)
+}
+
+// find returns the slot of the bucket starting at b holding v, if any
+func (f *FingerprintFilter) find(b uint64, v uint64) (uint64, bool) {
+	for s := b; s < b+uint64(f.bucket); s++ {
+		if f.get(s) == v {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+// free returns the first empty slot of the bucket starting at b, and the
+// number of empty slots of the bucket
+func (f *FingerprintFilter) free(b uint64) (first uint64, n uint) {
+	for s := b + uint64(f.bucket); s > b; s-- {
+		if f.get(s-1) == 0 {
+			first = s - 1
+			n++
+		}
+	}
+	return first, n
+}
+
+// get returns the content of a slot
+func (f *FingerprintFilter) get(slot uint64) uint64 {
+	offset := slot * uint64(f.r)
+	word, shift := offset/64, offset%64
+	v := f.words[word] >> shift
+	if shift+uint64(f.r) > 64 {
+		v |= f.words[word+1] << (64 - shift)
+	}
+	return v & (1<<f.r - 1)
+}
+
+// set replaces the content of a slot
+func (f *FingerprintFilter) set(slot uint64, v uint64) {
+	offset := slot * uint64(f.r)
+	word, shift := offset/64, offset%64
+	mask := uint64(1)<<f.r - 1
+	f.words[word] = f.words[word]&^(mask<<shift) | v<<shift
+	if shift+uint64(f.r) > 64 {
+		f.words[word+1] = f.words[word+1]&^(mask>>(64-shift)) | v>>(64-shift)
+	}
+}
+
+// Add data to the filter. Returns the filter (allows chaining)
+func (f *FingerprintFilter) Add(data []byte) *FingerprintFilter {
+	h := baseHashes(data)
+	fp := f.fingerprint(h)
+	b1, b2 := f.buckets(h, fp)
+	s1, n1 := f.free(b1)
+	s2, n2 := f.free(b2)
+	switch {
+	case n1 > 0 && n1 >= n2:
+		f.set(s1, fp)
+	case n2 > 0:
+		f.set(s2, fp)
+	default:
+		if f.overflow == nil {
+			f.overflow = New(f.slots, f.k)
+		}
+		f.overflow.Add(data)
+	}
+	return f
+}
+
+// Test returns true if the data is in the filter, false otherwise.
+// If true, the result might be a false positive. If false, the data
+// is definitely not in the set.
+func (f *FingerprintFilter) Test(data []byte) bool {
+	h := baseHashes(data)
+	fp := f.fingerprint(h)
+	b1, b2 := f.buckets(h, fp)
+	if _, ok := f.find(b1, fp); ok {
+		return true
+	}
+	if _, ok := f.find(b2, fp); ok {
+		return true
+	}
+	return f.overflow != nil && f.overflow.Test(data)
+}
+
+// Remove deletes a fingerprint of the data from the filter and returns true
+// if it was found in a slot. Only remove keys that were added: removing a key
+// that merely collides with the fingerprint of another key (a false positive)
+// deletes that other key. A key added twice must be removed twice. Keys
+// which the overflow may hold are never removed, since the fingerprints in
+// their slots then belong to other keys, so they keep testing positive.
+func (f *FingerprintFilter) Remove(data []byte) bool {
+	if f.overflow != nil && f.overflow.Test(data) {
+		return false
+	}
+	h := baseHashes(data)
+	fp := f.fingerprint(h)
+	b1, b2 := f.buckets(h, fp)
+	s, ok := f.find(b1, fp)
+	if !ok {
+		s, ok = f.find(b2, fp)
+	}
+	if ok {
+		f.set(s, 0)
+	}
+	return ok
+}
+
+// ClearAll clears all the data in the filter, removing all keys
+func (f *FingerprintFilter) ClearAll() *FingerprintFilter {
+	for i := range f.words {
+		f.words[i] = 0
+	}
+	f.overflow = nil
+	return f
+}
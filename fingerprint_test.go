@@ -0,0 +1,117 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestFingerprintBasic(t *testing.T) {
+	f := NewFingerprint(1000, 12, 4)
+	n1 := []byte("Bess")
+	n2 := []byte("Jane")
+	f.Add(n1)
+	if !f.Test(n1) {
+		t.Errorf("%v should be in.", n1)
+	}
+	if f.Test(n2) {
+		t.Errorf("%v should not be in.", n2)
+	}
+	if !f.Remove(n1) {
+		t.Errorf("%v should have been removed.", n1)
+	}
+	if f.Test(n1) {
+		t.Errorf("%v should not be in after removal.", n1)
+	}
+	if f.Remove(n2) {
+		t.Errorf("%v should not have been removed.", n2)
+	}
+}
+
+func TestFingerprintParameters(t *testing.T) {
+	f := NewFingerprint(0, 64, 0)
+	if f.Cap() != 1 || f.K() != 1 || f.FingerprintBits() != 32 {
+		t.Errorf("unexpected parameters %d %d %d", f.Cap(), f.K(), f.FingerprintBits())
+	}
+}
+
+func TestFingerprintOverflow(t *testing.T) {
+	// Far more keys than slots: no false negatives.
+	f := NewFingerprint(10, 7, 2)
+	n := make([]byte, 4)
+	for i := uint32(0); i < 100; i++ {
+		binary.BigEndian.PutUint32(n, i)
+		f.Add(n)
+	}
+	for i := uint32(0); i < 100; i++ {
+		binary.BigEndian.PutUint32(n, i)
+		if !f.Test(n) {
+			t.Errorf("%v should be in.", i)
+		}
+	}
+	f.ClearAll()
+	for i := uint32(0); i < 100; i++ {
+		binary.BigEndian.PutUint32(n, i)
+		if f.Test(n) {
+			t.Errorf("%v should not be in after ClearAll.", i)
+		}
+	}
+}
+
+func TestFingerprintFPP(t *testing.T) {
+	f := NewFingerprintWithEstimates(1000, 0.001)
+	n := make([]byte, 4)
+	for i := uint32(0); i < 1000; i++ {
+		binary.BigEndian.PutUint32(n, i)
+		f.Add(n)
+	}
+	count := 0
+	for i := uint32(0); i < 10000; i++ {
+		binary.BigEndian.PutUint32(n, i+1000)
+		if f.Test(n) {
+			count++
+		}
+	}
+	if float64(count)/10000.0 > 0.002 {
+		t.Errorf("Excessive fpp %v", float64(count)/10000.0)
+	}
+}
+
+func TestFingerprintSharedFingerprint(t *testing.T) {
+	f := NewFingerprint(64, 4, 2)
+	f.Add([]byte("a0")).Add([]byte("b450"))
+	f.Remove([]byte("a0"))
+	if !f.Test([]byte("b450")) {
+		t.Error("b450 should be in after removing a0")
+	}
+
+	// With 2-bit fingerprints, most keys share their fingerprint with others:
+	// removing half of the keys must leave the other half.
+	f = NewFingerprint(200, 2, 4)
+	n := make([]byte, 4)
+	for i := uint32(0); i < 400; i++ {
+		binary.BigEndian.PutUint32(n, i)
+		f.Add(n)
+	}
+	for i := uint32(0); i < 400; i += 2 {
+		binary.BigEndian.PutUint32(n, i)
+		f.Remove(n)
+	}
+	for i := uint32(1); i < 400; i += 2 {
+		binary.BigEndian.PutUint32(n, i)
+		if !f.Test(n) {
+			t.Errorf("%v should be in.", i)
+		}
+	}
+}
+
+func TestFingerprintDuplicates(t *testing.T) {
+	f := NewFingerprint(100, 12, 4)
+	n := []byte("Bess")
+	f.Add(n).Add(n)
+	if !f.Remove(n) || !f.Test(n) {
+		t.Errorf("%v was added twice and should be in after one removal.", n)
+	}
+	if !f.Remove(n) || f.Test(n) {
+		t.Errorf("%v should not be in after two removals.", n)
+	}
+}
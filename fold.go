@@ -0,0 +1,74 @@
+package bloom
+
+import "fmt"
+
+// Fold returns a new Bloom filter with m/factor bits, holding the keys of
+// the filter, which is not modified. The bits of the filter are OR-folded:
+// the bits which the keys set in the new filter are exactly those that
+// Add would set, so it is a regular filter, e.g., one which may be merged
+// with a filter created by New(m/factor, k) with the same hash functions.
+// This is meant to shrink over-provisioned filters, e.g., before sending
+// them over the network. m must be a multiple of factor.
+//
+// The new filter has the false positive rate of a filter with m/factor bits
+// holding the same keys, (1 - exp(-k*n*factor/m))^k for n keys, which grows
+// quickly with the factor: k was chosen for m bits, and is too large for
+// m/factor bits. Folding a filter by a factor of 2 is only reasonable if it
+// holds at most about half of the keys it was sized for.
+func (f *BloomFilter) Fold(factor uint) (*BloomFilter, error) {
+	if factor == 0 || f.m%factor != 0 {
+		return nil, fmt.Errorf("bloom: cannot fold m=%d by a factor of %d", f.m, factor)
+	}
+	m := f.m / factor
+	g := New(m, f.k)
+	g.hashing = f.hashing
+	g.fastRange = f.fastRange
+	words := f.b.Words()
+	switch {
+	case f.fastRange:
+		// The fast range reduction of a location to m/factor bits is the
+		// reduction to m bits divided by factor.
+		for i, ok := f.b.NextSet(0); ok && i < f.m; i, ok = f.b.NextSet(i + 1) {
+			g.b.Set(i / factor)
+		}
+	case m%64 == 0:
+		folded := g.b.Words()
+		for i, w := range words {
+			folded[i%len(folded)] |= w
+		}
+	default:
+		for i, ok := f.b.NextSet(0); ok && i < f.m; i, ok = f.b.NextSet(i + 1) {
+			g.b.Set(i % m)
+		}
+	}
+	return g, nil
+}
+
+// MergeFold merges the keys of another Bloom filter, like Merge, except
+// that the filters may have different sizes, as long as the larger m is a
+// multiple of the smaller one (e.g., both are powers of two): the larger
+// filter is folded down to the size of the smaller one before they are
+// merged, see Fold. The filter thus shrinks if g is the smaller one. The
+// filters must have the same k and hash functions, and g is not modified.
+func (f *BloomFilter) MergeFold(g *BloomFilter) error {
+	switch {
+	case f.m > g.m && f.m%g.m == 0:
+		folded, err := f.Fold(f.m / g.m)
+		if err != nil {
+			return err
+		}
+		err = folded.Merge(g)
+		if err != nil {
+			return err
+		}
+		*f = *folded
+		return nil
+	case f.m < g.m && g.m%f.m == 0:
+		folded, err := g.Fold(g.m / f.m)
+		if err != nil {
+			return err
+		}
+		return f.Merge(folded)
+	}
+	return f.Merge(g)
+}
@@ -0,0 +1,74 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestFold(t *testing.T) {
+	key := make([]byte, 4)
+	for _, c := range []struct {
+		create func(m, k uint) *BloomFilter
+		m      uint
+		factor uint
+	}{
+		{New, 1 << 14, 4}, // words are folded
+		{New, 3000, 3},    // bits are folded
+		{New, 3000, 1},    // copy
+		{NewPow2, 1 << 14, 2},
+		{NewFastRange, 3000, 2},
+		{func(m, k uint) *BloomFilter { return NewWithSeed(m, k, 42) }, 1 << 12, 2},
+	} {
+		f := c.create(c.m, 5)
+		g := c.create(c.m/c.factor, 5)
+		for i := uint32(0); i < 200; i++ {
+			binary.BigEndian.PutUint32(key, i)
+			f.Add(key)
+			g.Add(key)
+		}
+		folded, err := f.Fold(c.factor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !folded.Equal(g) {
+			t.Errorf("m=%d folded by %d should have the bits of a filter of m=%d", c.m, c.factor, c.m/c.factor)
+		}
+		if f.Cap() != c.m {
+			t.Error("the filter should not be modified")
+		}
+	}
+	if _, err := New(1000, 3).Fold(3); err == nil {
+		t.Error("m should be a multiple of the factor")
+	}
+	if _, err := New(1000, 3).Fold(0); err == nil {
+		t.Error("the factor should not be zero")
+	}
+}
+
+func TestMergeFold(t *testing.T) {
+	small := New(1<<10, 4).AddString("a")
+	large := New(1<<12, 4).AddString("b")
+	f := small.Copy()
+	if err := f.MergeFold(large); err != nil {
+		t.Fatal(err)
+	}
+	if f.Cap() != 1<<10 || !f.TestString("a") || !f.TestString("b") {
+		t.Error("the larger filter should be folded into the smaller one")
+	}
+	g := large.Copy()
+	if err := g.MergeFold(small); err != nil {
+		t.Fatal(err)
+	}
+	if !g.Equal(f) || large.Cap() != 1<<12 {
+		t.Error("the filter should be folded down before the merge")
+	}
+	if err := small.Copy().MergeFold(New(3000, 4)); err == nil {
+		t.Error("There should be an error when m's are not multiples")
+	}
+	if err := large.Copy().MergeFold(New(1<<10, 5)); err == nil {
+		t.Error("There should be an error for mismatched k")
+	}
+	if err := small.Copy().MergeFold(small); err != nil {
+		t.Errorf("filters of the same size should be merged: %v", err)
+	}
+}
@@ -0,0 +1,266 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Filters hashed with the default hash functions are serialized in the
+// original format: m and k as big-endian 64-bit words, followed by the
+// bitset. It is the format of the v2 and v3 releases, which hash keys the
+// same way, so their filters are read as is (see testdata). Other filters start with an extended header: a magic word, which
+// cannot be the m of the original format, and a version, followed by m, k
+// and the options of the filter as (tag, value) pairs ending with a zero tag.
+// Older versions of the package thus reject, instead of misreading, filters
+// they could not query correctly.
+//
+// The framed format of WriteFramedTo always uses the extended header, names
+// the hash functions, and ends with a CRC-32C checksum of the header and of
+// the bitset, so that corrupted and truncated filters are detected.
+const (
+	formatMagic   = 0x424c4f4d // "BLOM"
+	formatVersion = 1
+)
+
+// Tags of the options of the extended header
+const (
+	optionEnd      = 0
+	optionHash     = 1 // the hash functions, see hashMurmur and hashSipHash
+	optionSeed     = 2 // the murmur3 seed
+	optionRange    = 3 // the range reduction, see rangeModulo and rangeFastRange
+	optionEncoding = 4 // the encoding of the bitset, an Encoding
+	optionChecksum = 5 // the checksum following the bitset, see checksumCRC32C
+	optionScheme   = 6 // the derivation of the locations, a LocationScheme
+)
+
+// Values of optionHash
+const (
+	hashMurmur  = 0
+	hashSipHash = 1
+)
+
+// Values of optionChecksum
+const (
+	checksumCRC32C = 1
+)
+
+// Values of optionRange
+const (
+	rangeModulo    = 0
+	rangeFastRange = 1
+)
+
+// errUnsupportedFormat is returned for headers written by a later version
+// of the package.
+var errUnsupportedFormat = errors.New("bloom: unsupported serialized filter format")
+
+// errTooLarge is returned when reading a filter of which m or k do not fit in
+// a uint, as may happen on 32-bit platforms
+var errTooLarge = errors.New("bloom: serialized filter is too large for this platform")
+
+// A header describes a serialized filter, up to its bitset.
+type header struct {
+	m, k      uint64
+	seed      uint64
+	keyed     bool
+	fastRange bool
+	encoding  Encoding
+	checksum  bool
+	scheme    LocationScheme
+}
+
+// header returns the header of the serialized filter
+func (f *BloomFilter) header() header {
+	return header{
+		m:         uint64(f.m),
+		k:         uint64(f.k),
+		seed:      f.seed,
+		keyed:     f.key != nil,
+		fastRange: f.fastRange,
+		scheme:    f.scheme,
+	}
+}
+
+// A HashFingerprint identifies the hash functions of a filter, and the
+// version of the format it is serialized in: filters may only be merged or
+// compared if their fingerprints are the same. It is stored in the header of
+// the serialized filters, see WriteTo. The key of keyed filters is secret and
+// not part of the fingerprint.
+type HashFingerprint struct {
+	Hash      string         // "murmur3", or "siphash" for keyed filters
+	Seed      uint64         // murmur3 seed, see NewWithSeed
+	Scheme    LocationScheme // see NewWithScheme
+	FastRange bool           // see NewFastRange
+	Version   uint32         // 0 for the original format, which only has m and k
+}
+
+// String returns a description of the fingerprint
+func (p HashFingerprint) String() string {
+	reduction := "modulo"
+	if p.FastRange {
+		reduction = "fastrange"
+	}
+	return fmt.Sprintf("%s, seed %d, %s scheme, %s reduction, format %d", p.Hash, p.Seed, p.Scheme, reduction, p.Version)
+}
+
+// mismatch returns an error describing the first difference between two
+// fingerprints, or nil if they are the same
+func (p HashFingerprint) mismatch(q HashFingerprint) error {
+	switch {
+	case p.Hash != q.Hash:
+		return fmt.Errorf("hash functions don't match: %s != %s", p.Hash, q.Hash)
+	case p.Seed != q.Seed:
+		return fmt.Errorf("hash functions don't match: seeds %d != %d", p.Seed, q.Seed)
+	case p.Scheme != q.Scheme:
+		return fmt.Errorf("hash functions don't match: location schemes %s != %s", p.Scheme, q.Scheme)
+	case p.FastRange != q.FastRange:
+		return errors.New("range reductions don't match")
+	case p.Version != q.Version:
+		return fmt.Errorf("format versions don't match: %d != %d", p.Version, q.Version)
+	}
+	return nil
+}
+
+// fingerprint returns the fingerprint of the hash functions of the header
+func (h header) fingerprint() HashFingerprint {
+	p := HashFingerprint{Hash: "murmur3", Seed: h.seed, Scheme: h.scheme, FastRange: h.fastRange}
+	if h.keyed {
+		p.Hash = "siphash"
+	}
+	// Encoding and checksum do not change the hash functions.
+	h.encoding, h.checksum = EncodingRaw, false
+	if h.extended() {
+		p.Version = formatVersion
+	}
+	return p
+}
+
+// Fingerprint returns the fingerprint of the hash functions of the filter
+func (f *BloomFilter) Fingerprint() HashFingerprint {
+	return f.header().fingerprint()
+}
+
+// extended returns true if the header needs the extended format
+func (h header) extended() bool {
+	return h.keyed || h.seed != 0 || h.fastRange || h.encoding != EncodingRaw || h.checksum ||
+		h.scheme != SchemeDefault
+}
+
+// writeTo writes the header to an i/o stream and returns the number of
+// bytes written
+func (h header) writeTo(stream io.Writer) (int64, error) {
+	var buf []byte
+	if h.extended() {
+		buf = make([]byte, 24, 24+6*9+1)
+		binary.BigEndian.PutUint32(buf, formatMagic)
+		binary.BigEndian.PutUint32(buf[4:], formatVersion)
+		binary.BigEndian.PutUint64(buf[8:], h.m)
+		binary.BigEndian.PutUint64(buf[16:], h.k)
+		if h.keyed {
+			buf = appendOption(buf, optionHash, hashSipHash)
+		} else if h.checksum {
+			// Framed filters name their hash functions.
+			buf = appendOption(buf, optionHash, hashMurmur)
+		}
+		if h.seed != 0 {
+			buf = appendOption(buf, optionSeed, h.seed)
+		}
+		if h.fastRange {
+			buf = appendOption(buf, optionRange, rangeFastRange)
+		}
+		if h.encoding != EncodingRaw {
+			buf = appendOption(buf, optionEncoding, uint64(h.encoding))
+		}
+		if h.checksum {
+			buf = appendOption(buf, optionChecksum, checksumCRC32C)
+		}
+		if h.scheme != SchemeDefault {
+			buf = appendOption(buf, optionScheme, uint64(h.scheme))
+		}
+		buf = append(buf, optionEnd)
+	} else {
+		buf = make([]byte, 16)
+		binary.BigEndian.PutUint64(buf, h.m)
+		binary.BigEndian.PutUint64(buf[8:], h.k)
+	}
+	n, err := stream.Write(buf)
+	return int64(n), err
+}
+
+// appendOption appends a tag and its value to an extended header
+func appendOption(buf []byte, tag byte, value uint64) []byte {
+	buf = append(buf, tag, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint64(buf[len(buf)-8:], value)
+	return buf
+}
+
+// fitsUint returns true if m and k fit in a uint
+func (h header) fitsUint() bool {
+	return h.m <= uint64(^uint(0)) && h.k <= uint64(^uint(0))
+}
+
+// readHeader reads a header, in either format, from an i/o stream. It
+// returns the header and the number of bytes read.
+func readHeader(stream io.Reader) (header, int64, error) {
+	var h header
+	var words [2]uint64
+	err := binary.Read(stream, binary.BigEndian, &words)
+	if err != nil {
+		return h, 0, err
+	}
+	n := int64(16)
+	if words[0]>>32 != formatMagic {
+		h.m, h.k = words[0], words[1]
+		return h, n, nil
+	}
+	if uint32(words[0]) != formatVersion {
+		return h, n, errUnsupportedFormat
+	}
+	h.m = words[1]
+	err = binary.Read(stream, binary.BigEndian, &h.k)
+	if err != nil {
+		return h, n, err
+	}
+	n += 8
+	var option [9]byte
+	for {
+		_, err := io.ReadFull(stream, option[:1])
+		if err != nil {
+			return h, n, err
+		}
+		n++
+		if option[0] == optionEnd {
+			return h, n, nil
+		}
+		_, err = io.ReadFull(stream, option[1:])
+		if err != nil {
+			return h, n, err
+		}
+		n += 8
+		value := binary.BigEndian.Uint64(option[1:])
+		switch {
+		case option[0] == optionHash && value == hashMurmur:
+		case option[0] == optionHash && value == hashSipHash:
+			h.keyed = true
+		case option[0] == optionSeed:
+			h.seed = value
+		case option[0] == optionRange && value == rangeModulo:
+		case option[0] == optionRange && value == rangeFastRange:
+			h.fastRange = true
+		case option[0] == optionEncoding && value == uint64(EncodingRaw):
+		case option[0] == optionEncoding && value == uint64(EncodingGolomb):
+			h.encoding = EncodingGolomb
+		case option[0] == optionEncoding && value == uint64(EncodingGzip):
+			h.encoding = EncodingGzip
+		case option[0] == optionChecksum && value == checksumCRC32C:
+			h.checksum = true
+		case option[0] == optionScheme && value == uint64(SchemeDefault):
+		case option[0] == optionScheme && value == uint64(SchemeDoubleHashing):
+			h.scheme = SchemeDoubleHashing
+		default:
+			return h, n, fmt.Errorf("%w: option %d=%d", errUnsupportedFormat, option[0], value)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/bits"
+	"strings"
+	"testing"
+)
+
+func TestHeaderLegacy(t *testing.T) {
+	// Filters with the default hash functions keep the original format.
+	f := New(1000, 4)
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if binary.BigEndian.Uint64(data) != 1000 || binary.BigEndian.Uint64(data[8:]) != 4 {
+		t.Errorf("unexpected header %x", data[:16])
+	}
+	h, n, err := readHeader(bytes.NewReader(data))
+	if err != nil || n != 16 || h != f.header() {
+		t.Errorf("unexpected header %v, %d bytes: %v", h, n, err)
+	}
+}
+
+func TestHeaderExtended(t *testing.T) {
+	h := header{m: 1000, k: 4, keyed: true}
+	var buf bytes.Buffer
+	n, err := h.writeTo(&buf)
+	if err != nil || n != int64(buf.Len()) {
+		t.Fatalf("wrote %d bytes: %v", n, err)
+	}
+	data := buf.Bytes()
+	g, m, err := readHeader(bytes.NewReader(data))
+	if err != nil || m != n || g != h {
+		t.Errorf("read %v, %d bytes: %v", g, m, err)
+	}
+
+	for i, c := range []struct {
+		offset int
+		value  byte
+	}{
+		{7, 2},             // version
+		{24, 99},           // unknown option
+		{len(data) - 2, 7}, // unknown hash
+	} {
+		bad := append([]byte(nil), data...)
+		bad[c.offset] = c.value
+		if _, _, err := readHeader(bytes.NewReader(bad)); err == nil {
+			t.Errorf("case %d: the header should not be accepted", i)
+		}
+	}
+	if _, _, err := readHeader(bytes.NewReader(data[:len(data)-1])); err == nil {
+		t.Error("truncated headers should not be accepted")
+	}
+}
+
+func TestReadFromTooLarge(t *testing.T) {
+	if bits.UintSize == 64 {
+		t.Skip("m always fits in a uint on 64-bit platforms")
+	}
+	var data [16]byte
+	binary.BigEndian.PutUint64(data[:], 1<<40)
+	binary.BigEndian.PutUint64(data[8:], 4)
+	var f BloomFilter
+	if _, err := f.ReadFrom(bytes.NewReader(data[:])); err != errTooLarge {
+		t.Errorf("ReadFrom: got %v, want %v", err, errTooLarge)
+	}
+	if err := f.UnmarshalBinaryZeroCopy(data[:]); err != errTooLarge {
+		t.Errorf("UnmarshalBinaryZeroCopy: got %v, want %v", err, errTooLarge)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	if p := New(1000, 4).Fingerprint(); p != (HashFingerprint{Hash: "murmur3"}) {
+		t.Errorf("unexpected fingerprint %v", p)
+	}
+	p := NewWithScheme(1000, 4, SchemeDoubleHashing).Fingerprint()
+	if p != (HashFingerprint{Hash: "murmur3", Scheme: SchemeDoubleHashing, Version: formatVersion}) {
+		t.Errorf("unexpected fingerprint %v", p)
+	}
+	if s := p.String(); s != "murmur3, seed 0, double-hashing scheme, modulo reduction, format 1" {
+		t.Errorf("unexpected description %q", s)
+	}
+	// The encoding of the bitset does not change the fingerprint.
+	f := NewWithSeed(1000, 4, 42).AddString("Love")
+	var buf bytes.Buffer
+	if _, err := f.WriteFramedTo(&buf, EncodingRaw); err != nil {
+		t.Fatal(err)
+	}
+	h, _, err := readHeader(bytes.NewReader(buf.Bytes()))
+	if err != nil || h.fingerprint() != f.Fingerprint() {
+		t.Errorf("the serialized fingerprint %v should be %v", h.fingerprint(), f.Fingerprint())
+	}
+
+	double := NewWithScheme(1000, 4, SchemeDoubleHashing)
+	double.seed = 42
+	for _, c := range []struct {
+		g    *BloomFilter
+		want string
+	}{
+		{NewWithSeed(1000, 4, 43), "seeds 42 != 43"},
+		{NewKeyed(1000, 4, [16]byte{}), "murmur3 != siphash"},
+		{double, "location schemes default != double-hashing"},
+	} {
+		err := f.Merge(c.g)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("Merge: %v should mention %q", err, c.want)
+		}
+		if f.Equal(c.g) {
+			t.Error("filters with different fingerprints should not be equal")
+		}
+		_, err = f.MergeFromReader(bytes.NewReader(mustMarshal(t, c.g)))
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("MergeFromReader: %v should mention %q", err, c.want)
+		}
+	}
+	err = NewKeyed(1000, 4, [16]byte{1}).Merge(NewKeyed(1000, 4, [16]byte{2}))
+	if err == nil || !strings.Contains(err.Error(), "keys") {
+		t.Errorf("unexpected error %v for different keys", err)
+	}
+}
@@ -0,0 +1,84 @@
+package bloom
+
+// frozenProbes is the number of locations that FrozenBloomFilter.Test
+// computes before it loads their words
+const frozenProbes = 16
+
+// A FrozenBloomFilter is an immutable copy of a Bloom filter, for filters
+// which are built once and then only queried. It answers Test as the filter
+// it was frozen from, and is safe for concurrent use without locking.
+//
+// Test reads the words without the bounds checks of the bitset, and computes
+// all the locations of a key before it reads their words, so that the loads
+// of large filters can overlap.
+type FrozenBloomFilter struct {
+	m uint64
+	k uint
+	hashing
+	fastRange bool
+	words     []uint64
+}
+
+// Freeze returns an immutable copy of the filter. Later changes to the
+// filter do not change the copy.
+func (f *BloomFilter) Freeze() *FrozenBloomFilter {
+	return &FrozenBloomFilter{
+		m:         uint64(f.m),
+		k:         f.k,
+		hashing:   f.hashing,
+		fastRange: f.fastRange,
+		words:     append([]uint64(nil), f.b.Words()...),
+	}
+}
+
+// Cap returns the capacity, _m_, of a Bloom filter
+func (f *FrozenBloomFilter) Cap() uint {
+	return uint(f.m)
+}
+
+// K returns the number of hash functions used in the FrozenBloomFilter
+func (f *FrozenBloomFilter) K() uint {
+	return f.k
+}
+
+// reduce maps a hashed location to one of the m bits of the filter, as
+// BloomFilter.reduce does
+func (f *FrozenBloomFilter) reduce(l uint64) uint64 {
+	if f.fastRange {
+		return fastRange(l, f.m)
+	}
+	if f.m&(f.m-1) == 0 {
+		return l & (f.m - 1)
+	}
+	return l % f.m
+}
+
+// Test returns true if the data is in the filter, false otherwise.
+// If true, the result might be a false positive. If false, the data
+// is definitely not in the set.
+func (f *FrozenBloomFilter) Test(data []byte) bool {
+	h := f.hashes(data)
+	var locations [frozenProbes]uint64
+	for i := uint(0); i < f.k; i += frozenProbes {
+		n := f.k - i
+		if n > frozenProbes {
+			n = frozenProbes
+		}
+		for j := uint(0); j < n; j++ {
+			locations[j] = f.reduce(location(h, i+j))
+		}
+		for _, l := range locations[:n] {
+			if f.words[l>>6]&(1<<(l&63)) == 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// TestString returns true if the string is in the filter, false otherwise.
+// If true, the result might be a false positive. If false, the data
+// is definitely not in the set.
+func (f *FrozenBloomFilter) TestString(data string) bool {
+	return f.Test(stringToBytes(data))
+}
@@ -0,0 +1,60 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"strconv"
+	"testing"
+)
+
+func TestFreeze(t *testing.T) {
+	for _, f := range []*BloomFilter{
+		NewWithEstimates(10000, 0.01),
+		New(1<<16, 5),
+		New(1, 3),
+		New(1000, 40),
+		NewWithSeed(1000, 4, 42),
+		NewKeyed(1000, 4, [16]byte{1}),
+		NewFastRangeWithEstimates(1000, 0.001),
+	} {
+		for i := 0; i < 1000; i += 2 {
+			f.AddString(strconv.Itoa(i))
+		}
+		g := f.Freeze()
+		if g.Cap() != f.Cap() || g.K() != f.K() {
+			t.Fatalf("%d bits and %d hash functions instead of %d and %d", g.Cap(), g.K(), f.Cap(), f.K())
+		}
+		for i := 0; i < 2000; i++ {
+			key := strconv.Itoa(i)
+			if g.TestString(key) != f.TestString(key) {
+				t.Fatalf("m=%d, k=%d, %s: Test should return %v", f.Cap(), f.K(), key, f.TestString(key))
+			}
+		}
+		g = f.Copy().ClearAll().Freeze()
+		f.ClearAll().AddString("Love")
+		if g.TestString("Love") {
+			t.Error("the frozen filter should not change")
+		}
+	}
+}
+
+func BenchmarkFrozenTest(b *testing.B) {
+	f := NewWithEstimates(10000000, 0.01)
+	key := make([]byte, 4)
+	for i := uint32(0); i < 10000000; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		f.Add(key)
+	}
+	g := f.Freeze()
+	b.Run("BloomFilter", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			binary.BigEndian.PutUint32(key, uint32(i))
+			f.Test(key)
+		}
+	})
+	b.Run("Frozen", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			binary.BigEndian.PutUint32(key, uint32(i))
+			g.Test(key)
+		}
+	})
+}
@@ -0,0 +1,345 @@
+/*
+Package fuse implements a binary fuse filter, as described in Graf and
+Lemire, "Binary Fuse Filters: Fast and Smaller Than Xor Filters" (2022).
+
+Like a Bloom filter, a binary fuse filter answers approximate membership
+queries with false positives but no false negatives. But it is built once
+from all its keys and cannot be modified: keys cannot be added later. In
+exchange, it is smaller and faster: it stores an 8-bit fingerprint per
+location, with 1.125 to 1.2 locations per key for sets of more than 100,000
+keys, and a key is tested with exactly three memory accesses. Its false
+positive rate is about 1/256, that is 0.39%, for which a Bloom filter needs
+about 11.5 bits per key instead of 9 to 10.
+
+It is meant for read-only data, such as block lists distributed with a
+binary:
+
+	f, err := fuse.Build(keys)
+	...
+	if f.TestString("Love") {
+		...
+	}
+
+The binary representation is a small header followed by the fingerprints,
+so a filter can be used in place, e.g., from a memory-mapped file, with
+FromBytes.
+*/
+package fuse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"sort"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// maxSegmentLength is the largest length of a segment, 2^18
+const maxSegmentLength = 1 << 18
+
+// headerSize is the size of the binary header: the seed, the length of a
+// segment and the number of locations of the first segments.
+const headerSize = 16
+
+// maxAttempts is the number of seeds tried by Build
+const maxAttempts = 100
+
+// A Filter is a binary fuse filter with 8-bit fingerprints. It is immutable
+// and thus safe for concurrent use.
+type Filter struct {
+	seed          uint64
+	segmentLength uint32
+	// segmentCountLength is the number of locations of the segments in
+	// which the first location of a key may be.
+	segmentCountLength uint32
+	fingerprints       []uint8
+}
+
+// parameters returns the length of the segments and the number of segments
+// in which the first location of a key may be, for size keys, following
+// the reference implementation.
+func parameters(size int) (segmentLength, segmentCount uint32) {
+	n := math.Max(float64(size), 2)
+	segmentLength = 1 << uint(math.Floor(math.Log(n)/math.Log(3.33)+2.25))
+	if segmentLength > maxSegmentLength {
+		segmentLength = maxSegmentLength
+	}
+	sizeFactor := math.Max(1.125, 0.875+0.25*math.Log(1e6)/math.Log(n))
+	capacity := int(math.Round(float64(size) * sizeFactor))
+	count := (capacity+int(segmentLength)-1)/int(segmentLength) - 2
+	if count < 1 {
+		count = 1
+	}
+	return segmentLength, uint32(count)
+}
+
+// mix returns the hash of a key for a seed, murmur3's finalizer
+func mix(key, seed uint64) uint64 {
+	h := key + seed
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// fingerprint returns the fingerprint of a hash
+func fingerprint(hash uint64) uint8 {
+	return uint8(hash ^ hash>>32)
+}
+
+// locations returns the three locations of a hash, one in each of three
+// consecutive segments.
+func (f *Filter) locations(hash uint64) [3]uint32 {
+	hi, _ := bits.Mul64(hash, uint64(f.segmentCountLength))
+	h0 := uint32(hi)
+	h1 := h0 + f.segmentLength
+	h2 := h1 + f.segmentLength
+	mask := f.segmentLength - 1
+	h1 ^= uint32(hash>>18) & mask
+	h2 ^= uint32(hash) & mask
+	return [3]uint32{h0, h1, h2}
+}
+
+// keyHash returns the 64-bit hash of a key, before it is mixed with the seed
+func keyHash(data []byte) uint64 {
+	return bloom.Locations(data, 1)[0]
+}
+
+// Build creates a binary fuse filter holding the keys. Duplicate keys are
+// allowed. It only fails, with a negligible probability, if the keys have
+// many colliding 64-bit hashes.
+func Build(keys [][]byte) (*Filter, error) {
+	hashes := make([]uint64, len(keys))
+	for i, key := range keys {
+		hashes[i] = keyHash(key)
+	}
+	// Duplicate hashes would never be peeled.
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+	n := 0
+	for i, h := range hashes {
+		if i == 0 || h != hashes[n-1] {
+			hashes[n] = h
+			n++
+		}
+	}
+	hashes = hashes[:n]
+
+	segmentLength, segmentCount := parameters(len(hashes))
+	f := &Filter{
+		segmentLength:      segmentLength,
+		segmentCountLength: segmentCount * segmentLength,
+		fingerprints:       make([]uint8, (segmentCount+2)*segmentLength),
+	}
+	size := len(f.fingerprints)
+	counts := make([]uint32, size)
+	xors := make([]uint64, size)
+	queue := make([]uint32, 0, size)
+	stack := make([]uint64, 0, len(hashes)) // peeled hashes
+	alone := make([]uint32, 0, len(hashes)) // their location of their own
+	for attempt := uint64(1); ; attempt++ {
+		if attempt > maxAttempts {
+			return nil, errors.New("fuse: cannot build the filter, too many colliding keys")
+		}
+		f.seed = mix(attempt, 0x9e3779b97f4a7c15)
+		for i := range counts {
+			counts[i] = 0
+			xors[i] = 0
+		}
+		for _, h := range hashes {
+			hash := mix(h, f.seed)
+			for _, l := range f.locations(hash) {
+				counts[l]++
+				xors[l] ^= hash
+			}
+		}
+		// Peel the locations of a single key, which may leave other
+		// locations with a single key.
+		queue, stack, alone = queue[:0], stack[:0], alone[:0]
+		for l, c := range counts {
+			if c == 1 {
+				queue = append(queue, uint32(l))
+			}
+		}
+		for len(queue) > 0 {
+			l := queue[len(queue)-1]
+			queue = queue[:len(queue)-1]
+			if counts[l] != 1 {
+				continue
+			}
+			hash := xors[l]
+			stack = append(stack, hash)
+			alone = append(alone, l)
+			for _, o := range f.locations(hash) {
+				counts[o]--
+				xors[o] ^= hash
+				if counts[o] == 1 {
+					queue = append(queue, o)
+				}
+			}
+		}
+		if len(stack) == len(hashes) {
+			break
+		}
+	}
+	// Assign the fingerprints in the reverse order: the location of a key
+	// of its own is then set last, so that the three fingerprints of the
+	// key XOR to its fingerprint.
+	for i := len(stack) - 1; i >= 0; i-- {
+		hash := stack[i]
+		x := fingerprint(hash)
+		for _, l := range f.locations(hash) {
+			x ^= f.fingerprints[l]
+		}
+		f.fingerprints[alone[i]] = x
+	}
+	return f, nil
+}
+
+// BuildStrings creates a binary fuse filter holding the strings. See Build.
+func BuildStrings(keys []string) (*Filter, error) {
+	data := make([][]byte, len(keys))
+	for i, key := range keys {
+		data[i] = []byte(key)
+	}
+	return Build(data)
+}
+
+// Test returns true if the data is in the filter, false otherwise. If true,
+// the result might be a false positive. If false, the data is definitely not
+// in the set.
+func (f *Filter) Test(data []byte) bool {
+	hash := mix(keyHash(data), f.seed)
+	x := fingerprint(hash)
+	for _, l := range f.locations(hash) {
+		x ^= f.fingerprints[l]
+	}
+	return x == 0
+}
+
+// TestString returns true if the string is in the filter, false otherwise.
+// If true, the result might be a false positive. If false, the data is
+// definitely not in the set.
+func (f *Filter) TestString(data string) bool {
+	return f.Test([]byte(data))
+}
+
+// Size returns the number of fingerprints of the filter, that is its size
+// in bytes, without the header.
+func (f *Filter) Size() int {
+	return len(f.fingerprints)
+}
+
+// Equal tests for the equality of two filters
+func (f *Filter) Equal(g *Filter) bool {
+	return f.seed == g.seed && f.segmentLength == g.segmentLength &&
+		f.segmentCountLength == g.segmentCountLength && bytes.Equal(f.fingerprints, g.fingerprints)
+}
+
+// appendHeader appends the binary header of the filter
+func (f *Filter) appendHeader(buf []byte) []byte {
+	var h [headerSize]byte
+	binary.LittleEndian.PutUint64(h[:], f.seed)
+	binary.LittleEndian.PutUint32(h[8:], f.segmentLength)
+	binary.LittleEndian.PutUint32(h[12:], f.segmentCountLength)
+	return append(buf, h[:]...)
+}
+
+// parseHeader returns an empty filter from a binary header and the number
+// of its fingerprints.
+func parseHeader(h []byte) (*Filter, int, error) {
+	f := &Filter{
+		seed:               binary.LittleEndian.Uint64(h),
+		segmentLength:      binary.LittleEndian.Uint32(h[8:]),
+		segmentCountLength: binary.LittleEndian.Uint32(h[12:]),
+	}
+	if f.segmentLength == 0 || f.segmentLength > maxSegmentLength ||
+		f.segmentLength&(f.segmentLength-1) != 0 || f.segmentCountLength == 0 ||
+		f.segmentCountLength%f.segmentLength != 0 || f.segmentCountLength > math.MaxUint32-2*f.segmentLength {
+		return nil, 0, fmt.Errorf("fuse: invalid parameters %d %d", f.segmentLength, f.segmentCountLength)
+	}
+	return f, int(f.segmentCountLength + 2*f.segmentLength), nil
+}
+
+// FromBytes returns the filter whose binary representation (as returned by
+// MarshalBinary) is data, without copying it: the filter uses data in
+// place, which must thus not be modified. It is meant for filters in
+// read-only or memory-mapped files.
+func FromBytes(data []byte) (*Filter, error) {
+	if len(data) < headerSize {
+		return nil, io.ErrUnexpectedEOF
+	}
+	f, size, err := parseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != headerSize+size {
+		return nil, errors.New("fuse: size of the data doesn't match the parameters")
+	}
+	f.fingerprints = data[headerSize:]
+	return f, nil
+}
+
+// WriteTo writes a binary representation of the filter to an i/o stream:
+// the seed, as a little-endian 64-bit word, the length of the segments and
+// the number of locations of all the segments but the last two, as
+// little-endian 32-bit words, followed by the fingerprints. It returns the
+// number of bytes written.
+func (f *Filter) WriteTo(stream io.Writer) (int64, error) {
+	n, err := stream.Write(f.appendHeader(nil))
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := stream.Write(f.fingerprints)
+	return int64(n + m), err
+}
+
+// ReadFrom reads a binary representation of the filter (such as might have
+// been written by WriteTo()) from an i/o stream. It returns the number of
+// bytes read.
+func (f *Filter) ReadFrom(stream io.Reader) (int64, error) {
+	var h [headerSize]byte
+	n, err := io.ReadFull(stream, h[:])
+	if err != nil {
+		return int64(n), err
+	}
+	g, size, err := parseHeader(h[:])
+	if err != nil {
+		return int64(n), err
+	}
+	// Read in chunks, so that a short stream cannot make us allocate a
+	// huge filter.
+	var buf bytes.Buffer
+	m, err := io.CopyN(&buf, stream, int64(size))
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return int64(n) + m, err
+	}
+	g.fingerprints = buf.Bytes()
+	*f = *g
+	return int64(n) + m, nil
+}
+
+// MarshalBinary implements binary.BinaryMarshaler interface.
+func (f *Filter) MarshalBinary() ([]byte, error) {
+	return append(f.appendHeader(make([]byte, 0, headerSize+len(f.fingerprints))), f.fingerprints...), nil
+}
+
+// UnmarshalBinary implements binary.BinaryUnmarshaler interface. Unlike
+// FromBytes, it copies the data.
+func (f *Filter) UnmarshalBinary(data []byte) error {
+	g, err := FromBytes(append([]byte(nil), data...))
+	if err != nil {
+		return err
+	}
+	*f = *g
+	return nil
+}
@@ -0,0 +1,93 @@
+package fuse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func keys(n, offset int) [][]byte {
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = make([]byte, 4)
+		binary.BigEndian.PutUint32(keys[i], uint32(i+offset))
+	}
+	return keys
+}
+
+func TestBuild(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 10, 1000, 100000} {
+		f, err := Build(keys(n, 0))
+		if err != nil {
+			t.Fatalf("%d keys: %v", n, err)
+		}
+		for i, key := range keys(n, 0) {
+			if !f.Test(key) {
+				t.Fatalf("%d keys: key %d should be in the filter", n, i)
+			}
+		}
+		if n < 1000 {
+			continue
+		}
+		fp := 0
+		for _, key := range keys(100000, n) {
+			if f.Test(key) {
+				fp++
+			}
+		}
+		if rate := float64(fp) / 100000; rate > 0.005 {
+			t.Errorf("%d keys: false positive rate %f is too high", n, rate)
+		}
+		if bits := 8 * float64(f.Size()) / float64(n); n == 100000 && bits > 9.6 {
+			t.Errorf("%d keys: %f bits per key", n, bits)
+		}
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+	f, err := BuildStrings([]string{"a", "b", "a", "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.TestString("a") || !f.TestString("b") {
+		t.Error("the keys should be in the filter")
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	f, err := Build(keys(1000, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := FromBytes(data)
+	if err != nil || !g.Equal(f) || !g.Test(keys(1, 0)[0]) {
+		t.Errorf("FromBytes changed the filter: %v", err)
+	}
+	var h Filter
+	if _, err := h.ReadFrom(bytes.NewReader(data)); err != nil || !h.Equal(f) {
+		t.Errorf("ReadFrom changed the filter: %v", err)
+	}
+	var buf bytes.Buffer
+	if n, err := f.WriteTo(&buf); err != nil || n != int64(len(data)) || !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("WriteTo should write the binary representation: %v", err)
+	}
+	var u Filter
+	if err := u.UnmarshalBinary(data); err != nil || !u.Equal(f) {
+		t.Errorf("UnmarshalBinary changed the filter: %v", err)
+	}
+
+	if _, err := FromBytes(data[:len(data)-1]); err == nil {
+		t.Error("truncated filters should be rejected")
+	}
+	if _, err := h.ReadFrom(bytes.NewReader(data[:len(data)-1])); err == nil {
+		t.Error("truncated filters should be rejected")
+	}
+	data[8] = 3 // segment length
+	if _, err := FromBytes(data); err == nil {
+		t.Error("invalid parameters should be rejected")
+	}
+}
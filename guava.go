@@ -0,0 +1,193 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Constants of the Bloom filters of Guava, see
+// https://github.com/google/guava/blob/master/guava/src/com/google/common/hash/BloomFilterStrategies.java
+const (
+	// guavaMitz64 is the ordinal of the MURMUR128_MITZ_64 strategy
+	guavaMitz64     = 1
+	guavaMaxHashes  = 255
+	guavaHeaderSize = 6
+)
+
+// A GuavaBloomFilter is a Bloom filter hashed and serialized as by the
+// BloomFilter of Guava, with the MURMUR128_MITZ_64 strategy, so that filters
+// written by BloomFilter.writeTo can be read, and filters written by WriteTo
+// can be read by BloomFilter.readFrom.
+//
+// Keys are hashed as by a funnel of raw bytes, Funnels.byteArrayFunnel(): Add
+// and Test hash the bytes as given. Other funnels write their own encoding,
+// for instance the UTF-8 bytes for Funnels.stringFunnel(UTF_8) (as AddString
+// and TestString do) and the little-endian bytes for Funnels.longFunnel().
+type GuavaBloomFilter struct {
+	k     uint
+	words []uint64
+}
+
+// NewGuava creates a new filter of at least m bits, rounded up to a multiple
+// of 64 as Guava does, with k hash functions, between 1 and 255.
+func NewGuava(m uint, k uint) *GuavaBloomFilter {
+	if k < 1 {
+		k = 1
+	}
+	if k > guavaMaxHashes {
+		k = guavaMaxHashes
+	}
+	return &GuavaBloomFilter{k: k, words: make([]uint64, max(1, (m+63)/64))}
+}
+
+// NewGuavaWithEstimates creates a new filter for about n items with fp false
+// positive rate, sized as by BloomFilter.create(funnel, n, fp).
+func NewGuavaWithEstimates(n uint, fp float64) *GuavaBloomFilter {
+	if n == 0 {
+		n = 1
+	}
+	if fp <= 0 {
+		fp = math.SmallestNonzeroFloat64
+	}
+	m := uint(math.Min(-float64(n)*math.Log(fp)/(math.Ln2*math.Ln2), float64(maxInt)))
+	k := math.Floor(float64(m)/float64(n)*math.Ln2 + 0.5)
+	return NewGuava(m, uint(math.Min(k, guavaMaxHashes)))
+}
+
+// Cap returns the number of bits of the filter, a multiple of 64
+func (f *GuavaBloomFilter) Cap() uint {
+	return uint(64 * len(f.words))
+}
+
+// K returns the number of hash functions
+func (f *GuavaBloomFilter) K() uint {
+	return f.k
+}
+
+// guavaHashes returns the halves of the 128-bit MurmurHash3 of data with a
+// zero seed, as computed by Hashing.murmur3_128()
+func guavaHashes(data []byte) (h1, h2 uint64) {
+	var d digest128
+	d.bmix(data)
+	length := uint64(len(data))
+	return d.sum128(false, length, data[length-length%block_size:])
+}
+
+// each calls fn with the word and mask of each bit of a key until fn returns
+// false
+func (f *GuavaBloomFilter) each(data []byte, fn func(i uint64, mask uint64) bool) bool {
+	h1, h2 := guavaHashes(data)
+	bits := uint64(f.Cap())
+	combined := h1
+	for i := uint(0); i < f.k; i++ {
+		x := (combined &^ (1 << 63)) % bits
+		if !fn(x>>6, 1<<(x&63)) {
+			return false
+		}
+		combined += h2
+	}
+	return true
+}
+
+// Add the data to the filter, as BloomFilter.put does. Returns the filter
+// (allows chaining)
+func (f *GuavaBloomFilter) Add(data []byte) *GuavaBloomFilter {
+	f.each(data, func(i uint64, mask uint64) bool {
+		f.words[i] |= mask
+		return true
+	})
+	return f
+}
+
+// AddString to the filter, as BloomFilter.put does with a UTF-8 string
+// funnel. Returns the filter (allows chaining)
+func (f *GuavaBloomFilter) AddString(data string) *GuavaBloomFilter {
+	return f.Add(stringToBytes(data))
+}
+
+// Test returns true if the data is in the filter, false otherwise, as
+// BloomFilter.mightContain does. If true, the result might be a false
+// positive. If false, the data is definitely not in the set.
+func (f *GuavaBloomFilter) Test(data []byte) bool {
+	return f.each(data, func(i uint64, mask uint64) bool { return f.words[i]&mask != 0 })
+}
+
+// TestString returns true if the string is in the filter, false otherwise.
+// If true, the result might be a false positive. If false, the data
+// is definitely not in the set.
+func (f *GuavaBloomFilter) TestString(data string) bool {
+	return f.Test(stringToBytes(data))
+}
+
+// ClearAll clears all the data in the filter, removing all keys
+func (f *GuavaBloomFilter) ClearAll() *GuavaBloomFilter {
+	for i := range f.words {
+		f.words[i] = 0
+	}
+	return f
+}
+
+// WriteTo writes the filter to an i/o stream as BloomFilter.writeTo does:
+// the ordinal of the strategy and the number of hash functions as bytes,
+// then the number of words of the bitset and the words, in big-endian order.
+// It returns the number of bytes written.
+func (f *GuavaBloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	data := make([]byte, guavaHeaderSize+8*len(f.words))
+	data[0] = guavaMitz64
+	data[1] = byte(f.k)
+	binary.BigEndian.PutUint32(data[2:], uint32(len(f.words)))
+	for i, w := range f.words {
+		binary.BigEndian.PutUint64(data[guavaHeaderSize+8*i:], w)
+	}
+	n, err := stream.Write(data)
+	return int64(n), err
+}
+
+// ReadFrom reads a filter written by BloomFilter.writeTo or by WriteTo from
+// an i/o stream. Only the MURMUR128_MITZ_64 strategy, the default of
+// BloomFilter.create, is supported. It returns the number of bytes read.
+func (f *GuavaBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	var header [guavaHeaderSize]byte
+	n, err := io.ReadFull(stream, header[:])
+	if err != nil {
+		return int64(n), err
+	}
+	if header[0] != guavaMitz64 {
+		return int64(n), fmt.Errorf("bloom: unsupported Guava strategy %d", int8(header[0]))
+	}
+	k := uint(header[1])
+	length := int32(binary.BigEndian.Uint32(header[2:]))
+	if k == 0 || length <= 0 {
+		return int64(n), errors.New("bloom: invalid Guava Bloom filter")
+	}
+	words, err := readUint64s(stream, uint64(length), binary.BigEndian)
+	if err != nil {
+		return int64(n), err
+	}
+	f.k = k
+	f.words = words
+	return int64(n) + 8*int64(length), nil
+}
+
+// MarshalBinary implements binary.BinaryMarshaler interface.
+func (f *GuavaBloomFilter) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := f.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements binary.BinaryUnmarshaler interface.
+func (f *GuavaBloomFilter) UnmarshalBinary(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := f.ReadFrom(buf)
+
+	return err
+}
@@ -0,0 +1,146 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/twmb/murmur3"
+)
+
+func TestGuavaHashes(t *testing.T) {
+	// Reference values of Hashing.murmur3_128().hashBytes(data).
+	for _, c := range []struct {
+		data   string
+		h1, h2 uint64
+	}{
+		{"", 0, 0},
+		{"hello", 0xcbd8a7b341bd9b02, 0x5b1e906a48ae1d19},
+	} {
+		if h1, h2 := guavaHashes([]byte(c.data)); h1 != c.h1 || h2 != c.h2 {
+			t.Errorf("hashes of %q are %x, %x, expected %x, %x", c.data, h1, h2, c.h1, c.h2)
+		}
+	}
+	r := rand.New(rand.NewSource(1))
+	for length := 0; length < 100; length++ {
+		data := make([]byte, length)
+		r.Read(data)
+		h1, h2 := guavaHashes(data)
+		if e1, e2 := murmur3.Sum128(data); h1 != e1 || h2 != e2 {
+			t.Fatalf("%d bytes: hashes %x, %x, expected %x, %x", length, h1, h2, e1, e2)
+		}
+	}
+}
+
+func TestGuavaBasic(t *testing.T) {
+	f := NewGuava(100, 3)
+	if f.Cap() != 128 || f.K() != 3 {
+		t.Fatalf("%d bits, %d hash functions", f.Cap(), f.K())
+	}
+	f.AddString("hello")
+	if !f.Test([]byte("hello")) || f.TestString("Jane") {
+		t.Error("unexpected membership")
+	}
+	// Bit i of the bitset is bit i%64 of word i/64, as in a LockFreeBitArray.
+	expected := make([]uint64, 2)
+	combined := uint64(0xcbd8a7b341bd9b02)
+	for i := 0; i < 3; i++ {
+		x := (combined &^ (1 << 63)) % 128
+		expected[x/64] |= 1 << (x % 64)
+		combined += 0x5b1e906a48ae1d19
+	}
+	if f.words[0] != expected[0] || f.words[1] != expected[1] {
+		t.Errorf("unexpected bitset %x", f.words)
+	}
+	f.ClearAll()
+	if f.TestString("hello") {
+		t.Error("ClearAll should remove all keys")
+	}
+	for _, c := range []struct{ m, k, bits, hashes uint }{{0, 0, 64, 1}, {64, 300, 64, 255}, {65, 1, 128, 1}} {
+		if g := NewGuava(c.m, c.k); g.Cap() != c.bits || g.K() != c.hashes {
+			t.Errorf("NewGuava(%d, %d) has %d bits and %d hash functions", c.m, c.k, g.Cap(), g.K())
+		}
+	}
+}
+
+func TestGuavaEstimates(t *testing.T) {
+	// As sized by BloomFilter.create(funnel, n, fp).
+	for _, c := range []struct {
+		n          uint
+		fp         float64
+		bits, hash uint
+	}{
+		{1000, 0.01, 9600, 7},
+		{1000, 0.03, 7360, 5},
+		{0, 0.01, 64, 6},
+	} {
+		if f := NewGuavaWithEstimates(c.n, c.fp); f.Cap() != c.bits || f.K() != c.hash {
+			t.Errorf("%d keys at %v: %d bits, %d hash functions", c.n, c.fp, f.Cap(), f.K())
+		}
+	}
+
+	n := 100000
+	f := NewGuavaWithEstimates(uint(n), 0.01)
+	for i := 0; i < n; i++ {
+		f.AddString(strconv.Itoa(i))
+	}
+	positives := 0
+	for i := 0; i < n; i++ {
+		if !f.TestString(strconv.Itoa(i)) {
+			t.Fatalf("key %d should be in", i)
+		}
+		if f.TestString(strconv.Itoa(n + i)) {
+			positives++
+		}
+	}
+	if rate := float64(positives) / float64(n); rate > 0.012 {
+		t.Errorf("false positive rate %f is too high", rate)
+	}
+}
+
+func TestGuavaEncodeDecode(t *testing.T) {
+	f := NewGuava(128, 3).AddString("hello")
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 6+16 || !bytes.Equal(data[:6], []byte{1, 3, 0, 0, 0, 2}) ||
+		binary.BigEndian.Uint64(data[6:]) != f.words[0] || binary.BigEndian.Uint64(data[14:]) != f.words[1] {
+		t.Fatalf("unexpected encoding %x", data)
+	}
+
+	stream := bytes.NewReader(append(data, 1, 2, 3))
+	var g GuavaBloomFilter
+	n, err := g.ReadFrom(stream)
+	if err != nil || n != int64(len(data)) || stream.Len() != 3 {
+		t.Fatalf("read %d bytes: %v", n, err)
+	}
+	if g.K() != 3 || g.Cap() != 128 || !g.TestString("hello") {
+		t.Error("round trip changed the filter")
+	}
+
+	for name, corrupt := range map[string]func([]byte){
+		"strategy": func(b []byte) { b[0] = 0 },
+		"k":        func(b []byte) { b[1] = 0 },
+		"length":   func(b []byte) { b[2] = 0x80 },
+		"empty":    func(b []byte) { b[5] = 0 },
+	} {
+		bad := append([]byte(nil), data...)
+		corrupt(bad)
+		if err := g.UnmarshalBinary(bad); err == nil {
+			t.Errorf("invalid %s should not be accepted", name)
+		}
+	}
+	for i := range data {
+		if err := g.UnmarshalBinary(data[:i]); err == nil {
+			t.Fatalf("%d bytes out of %d should not be accepted", i, len(data))
+		}
+	}
+	// A corrupted length does not allocate more than the stream holds.
+	huge := append([]byte{1, 3, 0x7f, 0xff, 0xff, 0xff}, data[6:]...)
+	if err := g.UnmarshalBinary(huge); err == nil {
+		t.Error("truncated data should not be accepted")
+	}
+}
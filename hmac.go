@@ -0,0 +1,82 @@
+package bloom
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"hash"
+)
+
+// A KeyedTransform is a Bloom filter whose keys are transformed by
+// HMAC-SHA256 with a secret before they are hashed, so that the filter can
+// be published without letting its recipients test arbitrary values: only
+// the holders of the secret can compute the keys to test. Unlike a filter
+// created with NewKeyed, which hashes keys with a secret SipHash key, the
+// underlying filter is a regular one, holding the 32-byte HMACs of the keys:
+// it can be serialized in any format, and tested by other implementations
+// given the HMACs.
+//
+// The secret must be long and random, e.g., 32 bytes from crypto/rand:
+// recipients can otherwise guess it offline from the filter. Like a
+// BloomFilter, a KeyedTransform is not safe for concurrent use.
+type KeyedTransform struct {
+	f   *BloomFilter
+	mac hash.Hash
+	sum [sha256.Size]byte
+}
+
+// NewKeyedTransform returns a KeyedTransform storing the HMACs of its keys
+// with the secret in f.
+func NewKeyedTransform(f *BloomFilter, secret []byte) *KeyedTransform {
+	return &KeyedTransform{f: f, mac: hmac.New(sha256.New, secret)}
+}
+
+// Filter returns the underlying Bloom filter, holding the HMACs of the keys,
+// e.g., to serialize it.
+func (t *KeyedTransform) Filter() *BloomFilter {
+	return t.f
+}
+
+// Transform returns the HMAC of data, the key stored in the underlying
+// filter. The result is only valid until the next call to a method of t.
+func (t *KeyedTransform) Transform(data []byte) []byte {
+	t.mac.Reset()
+	t.mac.Write(data) // #nosec
+	return t.mac.Sum(t.sum[:0])
+}
+
+// Add data to the Bloom filter. Returns the filter (allows chaining)
+func (t *KeyedTransform) Add(data []byte) *KeyedTransform {
+	t.f.Add(t.Transform(data))
+	return t
+}
+
+// AddString to the Bloom filter. Returns the filter (allows chaining)
+func (t *KeyedTransform) AddString(data string) *KeyedTransform {
+	return t.Add(stringToBytes(data))
+}
+
+// Test returns true if the data is in the Bloom filter, false otherwise.
+// If true, the result might be a false positive. If false, the data
+// is definitely not in the set.
+func (t *KeyedTransform) Test(data []byte) bool {
+	return t.f.Test(t.Transform(data))
+}
+
+// TestString returns true if the string is in the Bloom filter, false
+// otherwise. If true, the result might be a false positive. If false, the
+// data is definitely not in the set.
+func (t *KeyedTransform) TestString(data string) bool {
+	return t.Test(stringToBytes(data))
+}
+
+// TestAndAdd is equivalent to calling Test(data) then Add(data).
+// Returns the result of Test.
+func (t *KeyedTransform) TestAndAdd(data []byte) bool {
+	return t.f.TestAndAdd(t.Transform(data))
+}
+
+// TestOrAdd is equivalent to calling Test(data) then if not present
+// Add(data). Returns the result of Test.
+func (t *KeyedTransform) TestOrAdd(data []byte) bool {
+	return t.f.TestOrAdd(t.Transform(data))
+}
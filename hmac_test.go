@@ -0,0 +1,39 @@
+package bloom
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestKeyedTransform(t *testing.T) {
+	secret := []byte("a secret which should be random")
+	k := NewKeyedTransform(NewWithEstimates(1000, 0.001), secret)
+	k.AddString("Love").Add([]byte("is"))
+	if !k.TestString("Love") || !k.Test([]byte("is")) || k.TestString("Hate") {
+		t.Error("unexpected membership")
+	}
+	if k.TestAndAdd([]byte("in")) || !k.TestOrAdd([]byte("in")) {
+		t.Error("in should only be found once added")
+	}
+
+	// The filter holds the HMACs of the keys, not the keys.
+	f := k.Filter()
+	if f.TestString("Love") {
+		t.Error("the filter should not hold the keys")
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("Love"))
+	if !f.Test(mac.Sum(nil)) {
+		t.Error("the filter should hold the HMACs of the keys")
+	}
+	if NewKeyedTransform(f, []byte("another secret")).TestString("Love") {
+		t.Error("another secret should not find the keys")
+	}
+
+	// The purego build tag copies the string written to the HMAC.
+	allocs := testing.AllocsPerRun(100, func() { k.TestString("Love") })
+	if allocs != 0 && !pureGo {
+		t.Errorf("Test should not allocate, got %v allocations", allocs)
+	}
+}
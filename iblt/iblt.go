@@ -0,0 +1,362 @@
+/*
+Package iblt implements an invertible Bloom lookup table, as described in
+Goodrich and Mitzenmacher, "Invertible Bloom Lookup Tables" (2011), and
+used for set reconciliation by Eppstein et al., "What's the Difference?
+Efficient Set Reconciliation without Prior Context" (2011).
+
+Like a counting Bloom filter, a table adds each key to a few of its cells.
+But a cell also keeps the XOR of its keys and of their checksums, so that
+keys can be listed back, as long as there are few enough of them. To
+compute the symmetric difference of two sets, each side inserts its keys
+into a table of the same size, one table is subtracted from the other, and
+Decode lists the keys of each side which are missing from the other side.
+The size of the tables depends on the size of the difference, not on the
+size of the sets:
+
+	a := iblt.NewWithEstimates(100, 32) // up to 100 differences, 32-byte keys
+	for _, key := range localKeys {
+		a.Insert(key)
+	}
+	// ... receive b, built from the remote keys, and then
+	a.Subtract(b)
+	onlyLocal, onlyRemote, err := a.Decode()
+
+Keys have a fixed size: longer or variable-length keys may be replaced by a
+cryptographic digest.
+*/
+package iblt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// hashCount is the number of cells of a key, one in each partition of the
+// cells. With three cells, two keys sharing all their cells are likely
+// enough to make about 4/d of the decodes of d keys fail; four cells make
+// this negligible.
+const hashCount = 4
+
+// FNV-1a parameters of the checksums
+const (
+	fnvOffset = 14695981039346656037
+	fnvPrime  = 1099511628211
+)
+
+// ErrUndecodable is returned by Decode when the table holds too many keys to
+// list them.
+var ErrUndecodable = errors.New("iblt: too many keys to decode")
+
+// A Table is an invertible Bloom lookup table. It is not safe for concurrent
+// use.
+type Table struct {
+	cells   uint
+	keySize int
+	counts  []int64
+	keySums []byte // keySize bytes per cell
+	sums    []uint64
+}
+
+// New creates a new table with at least _cells_ cells, rounded up to a
+// multiple of four, for keys of keySize bytes. We force the number of cells
+// and the key size to be at least one to avoid panics.
+func New(cells uint, keySize int) *Table {
+	if cells < hashCount {
+		cells = hashCount
+	}
+	cells = (cells + hashCount - 1) / hashCount * hashCount
+	if keySize < 1 {
+		keySize = 1
+	}
+	return &Table{
+		cells:   cells,
+		keySize: keySize,
+		counts:  make([]int64, cells),
+		keySums: make([]byte, int(cells)*keySize),
+		sums:    make([]uint64, cells),
+	}
+}
+
+// NewWithEstimates creates a new table from which up to about d keys (for
+// reconciliation, the size of the symmetric difference) can be decoded with
+// a high probability, for keys of keySize bytes: 1.5 cells per key, above
+// the peeling threshold of about 1.3 for four cells per key, and a few more
+// cells for small tables. Less than 1% of the decodes of d keys fail.
+func NewWithEstimates(d uint, keySize int) *Table {
+	return New(d+d/2+estimateExtraCells, keySize)
+}
+
+// estimateExtraCells is the number of cells NewWithEstimates adds to 1.5
+// cells per key, tuned by TestDecodeFailureRate
+const estimateExtraCells = 30
+
+// Cells returns the number of cells of the table
+func (t *Table) Cells() uint {
+	return t.cells
+}
+
+// KeySize returns the size of the keys in bytes
+func (t *Table) KeySize() int {
+	return t.keySize
+}
+
+// checksum returns the checksum of a key, which tells whether a cell holds
+// a single key: its 64-bit FNV-1a hash, computed without allocating
+func checksum(key []byte) uint64 {
+	h := uint64(fnvOffset)
+	for _, b := range key {
+		h ^= uint64(b)
+		h *= fnvPrime
+	}
+	return h
+}
+
+// indexes returns the cells of a key, one in each partition
+func (t *Table) indexes(key []byte) [hashCount]uint64 {
+	var idx [hashCount]uint64
+	width := uint64(t.cells / hashCount)
+	for i, l := range bloom.LocationsInto(key, idx[:]) {
+		idx[i] = uint64(i)*width + l%width
+	}
+	return idx
+}
+
+// update adds a key to its cells, or removes it if delta is -1
+func (t *Table) update(key []byte, delta int64) error {
+	if len(key) != t.keySize {
+		return fmt.Errorf("iblt: key of %d bytes instead of %d", len(key), t.keySize)
+	}
+	sum := checksum(key)
+	for _, i := range t.indexes(key) {
+		t.counts[i] += delta
+		xorBytes(t.keySums[int(i)*t.keySize:int(i+1)*t.keySize], key)
+		t.sums[i] ^= sum
+	}
+	return nil
+}
+
+// xorBytes sets dst to dst XOR src, which have the same length
+func xorBytes(dst, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
+
+// Insert adds a key to the table. It returns an error if the key does not
+// have the size of the keys of the table.
+func (t *Table) Insert(key []byte) error {
+	return t.update(key, 1)
+}
+
+// Delete removes a key from the table. The key does not need to have been
+// inserted: the table then holds it as a deleted key, which Decode lists
+// as such. It returns an error if the key does not have the size of the keys
+// of the table.
+func (t *Table) Delete(key []byte) error {
+	return t.update(key, -1)
+}
+
+// compatible returns an error unless both tables have the same size
+func (t *Table) compatible(g *Table) error {
+	if t.cells != g.cells {
+		return fmt.Errorf("cells don't match: %d != %d", t.cells, g.cells)
+	}
+	if t.keySize != g.keySize {
+		return fmt.Errorf("key sizes don't match: %d != %d", t.keySize, g.keySize)
+	}
+	return nil
+}
+
+// Subtract removes the keys of another table, which must have the same
+// number of cells and key size, as if each of its keys was deleted. The
+// keys of both tables then cancel out, and the table only holds the keys
+// inserted in one table and not in the other.
+func (t *Table) Subtract(g *Table) error {
+	err := t.compatible(g)
+	if err != nil {
+		return err
+	}
+	for i := range t.counts {
+		t.counts[i] -= g.counts[i]
+		t.sums[i] ^= g.sums[i]
+	}
+	xorBytes(t.keySums, g.keySums)
+	return nil
+}
+
+// pure returns the key of a cell if it holds a single key, inserted (1) or
+// deleted (-1)
+func (t *Table) pure(i int) ([]byte, int64) {
+	if t.counts[i] != 1 && t.counts[i] != -1 {
+		return nil, 0
+	}
+	key := t.keySums[i*t.keySize : (i+1)*t.keySize]
+	if checksum(key) != t.sums[i] {
+		return nil, 0
+	}
+	return key, t.counts[i]
+}
+
+// Decode lists the keys of the table: those which were inserted, and those
+// which were deleted (or subtracted) without having been inserted. The
+// table is not modified. If there are too many keys, Decode returns the keys
+// it could list and ErrUndecodable.
+func (t *Table) Decode() (inserted [][]byte, deleted [][]byte, err error) {
+	u := t.Copy()
+	// Peel the cells holding a single key: removing the key from its other
+	// cells may leave them with a single key too.
+	stack := make([]int, 0, len(u.counts))
+	for i := range u.counts {
+		stack = append(stack, i)
+	}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		key, count := u.pure(i)
+		if count == 0 {
+			continue
+		}
+		if len(inserted)+len(deleted) >= len(u.counts) {
+			// A table cannot hold more keys than cells: only checksum
+			// collisions could lead here.
+			return inserted, deleted, ErrUndecodable
+		}
+		key = append([]byte(nil), key...)
+		if count == 1 {
+			inserted = append(inserted, key)
+		} else {
+			deleted = append(deleted, key)
+		}
+		u.update(key, -count) // #nosec
+		for _, j := range u.indexes(key) {
+			stack = append(stack, int(j))
+		}
+	}
+	for i := range u.counts {
+		if u.counts[i] != 0 || u.sums[i] != 0 {
+			return inserted, deleted, ErrUndecodable
+		}
+	}
+	return inserted, deleted, nil
+}
+
+// ClearAll removes all the keys of the table
+func (t *Table) ClearAll() *Table {
+	for i := range t.counts {
+		t.counts[i] = 0
+		t.sums[i] = 0
+	}
+	for i := range t.keySums {
+		t.keySums[i] = 0
+	}
+	return t
+}
+
+// Copy returns a copy of the table
+func (t *Table) Copy() *Table {
+	return &Table{
+		cells:   t.cells,
+		keySize: t.keySize,
+		counts:  append([]int64(nil), t.counts...),
+		keySums: append([]byte(nil), t.keySums...),
+		sums:    append([]uint64(nil), t.sums...),
+	}
+}
+
+// Equal tests for the equality of two tables
+func (t *Table) Equal(g *Table) bool {
+	if t.compatible(g) != nil || !bytes.Equal(t.keySums, g.keySums) {
+		return false
+	}
+	for i := range t.counts {
+		if t.counts[i] != g.counts[i] || t.sums[i] != g.sums[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// header is the header of the binary representation of a table
+type header struct {
+	Cells   uint64
+	KeySize uint64
+}
+
+// WriteTo writes a binary representation of the table to an i/o stream: the
+// number of cells and the key size, followed by each cell, its count, the
+// XOR of its keys and the XOR of their checksums, with integers as
+// big-endian 64-bit words. It returns the number of bytes written.
+func (t *Table) WriteTo(stream io.Writer) (int64, error) {
+	buf := make([]byte, 16, 16+int(t.cells)*(16+t.keySize))
+	binary.BigEndian.PutUint64(buf, uint64(t.cells))
+	binary.BigEndian.PutUint64(buf[8:], uint64(t.keySize))
+	for i := range t.counts {
+		buf = appendUint64(buf, uint64(t.counts[i]))
+		buf = append(buf, t.keySums[i*t.keySize:(i+1)*t.keySize]...)
+		buf = appendUint64(buf, t.sums[i])
+	}
+	n, err := stream.Write(buf)
+	return int64(n), err
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	return append(buf, b[:]...)
+}
+
+// ReadFrom reads a binary representation of the table (such as might have
+// been written by WriteTo()) from an i/o stream. It returns the number of
+// bytes read.
+func (t *Table) ReadFrom(stream io.Reader) (int64, error) {
+	var h header
+	err := binary.Read(stream, binary.BigEndian, &h)
+	if err != nil {
+		return 0, err
+	}
+	if h.Cells == 0 || h.Cells%hashCount != 0 || h.KeySize == 0 ||
+		h.Cells > 1<<40 || h.KeySize > 1<<20 {
+		return 0, fmt.Errorf("iblt: invalid parameters cells=%d key size=%d", h.Cells, h.KeySize)
+	}
+	n := int64(16)
+	g := &Table{cells: uint(h.Cells), keySize: int(h.KeySize)}
+	cell := make([]byte, 16+g.keySize)
+	// Read cell by cell, so that a short stream cannot make us allocate a
+	// huge table.
+	for i := uint64(0); i < h.Cells; i++ {
+		_, err := io.ReadFull(stream, cell)
+		if err != nil {
+			return n, err
+		}
+		n += int64(len(cell))
+		g.counts = append(g.counts, int64(binary.BigEndian.Uint64(cell)))
+		g.keySums = append(g.keySums, cell[8:8+g.keySize]...)
+		g.sums = append(g.sums, binary.BigEndian.Uint64(cell[8+g.keySize:]))
+	}
+	*t = *g
+	return n, nil
+}
+
+// MarshalBinary implements binary.BinaryMarshaler interface.
+func (t *Table) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := t.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements binary.BinaryUnmarshaler interface.
+func (t *Table) UnmarshalBinary(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := t.ReadFrom(buf)
+
+	return err
+}
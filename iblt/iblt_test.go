@@ -0,0 +1,124 @@
+package iblt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"testing"
+)
+
+func key(i uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, i)
+	return k
+}
+
+func sorted(keys [][]byte) [][]byte {
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	return keys
+}
+
+func TestReconcile(t *testing.T) {
+	a := NewWithEstimates(100, 8)
+	b := NewWithEstimates(100, 8)
+	// a holds [0, 10040) and b holds [40, 10080): 40 keys on each side differ.
+	for i := uint64(0); i < 10080; i++ {
+		if i < 10040 {
+			if err := a.Insert(key(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if i >= 40 {
+			b.Insert(key(i)) // #nosec
+		}
+	}
+	if err := a.Subtract(b); err != nil {
+		t.Fatal(err)
+	}
+	onlyA, onlyB, err := a.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(onlyA) != 40 || len(onlyB) != 40 {
+		t.Fatalf("decoded %d and %d keys instead of 40", len(onlyA), len(onlyB))
+	}
+	for i, k := range sorted(onlyA) {
+		if !bytes.Equal(k, key(uint64(i))) {
+			t.Errorf("unexpected key %x", k)
+		}
+	}
+	for i, k := range sorted(onlyB) {
+		if !bytes.Equal(k, key(uint64(10040+i))) {
+			t.Errorf("unexpected key %x", k)
+		}
+	}
+	// Decode does not modify the table.
+	if _, _, err := a.Decode(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDecodeFailureRate(t *testing.T) {
+	const trials = 1000
+	for _, d := range []uint{1, 5, 10, 20, 50, 100, 1000} {
+		failures := 0
+		for trial := uint64(0); trial < trials; trial++ {
+			a := NewWithEstimates(d, 8)
+			for i := uint64(0); i < uint64(d); i++ {
+				a.Insert(key(trial<<32 | i)) // #nosec
+			}
+			if _, _, err := a.Decode(); err != nil {
+				failures++
+			}
+		}
+		if failures > trials/100 {
+			t.Errorf("%d keys: %d of %d decodes failed", d, failures, trials)
+		}
+	}
+}
+
+func TestInsertAllocs(t *testing.T) {
+	a := NewWithEstimates(100, 8)
+	k := key(1)
+	if n := testing.AllocsPerRun(100, func() { a.Insert(k) }); n != 0 { // #nosec
+		t.Errorf("Insert allocates %v times", n)
+	}
+}
+
+func TestUndecodable(t *testing.T) {
+	a := New(30, 8)
+	for i := uint64(0); i < 100; i++ {
+		a.Insert(key(i)) // #nosec
+	}
+	if _, _, err := a.Decode(); err != ErrUndecodable {
+		t.Errorf("unexpected error %v", err)
+	}
+	if a.Insert([]byte("short")) == nil || a.Subtract(New(33, 8)) == nil || a.Subtract(New(30, 4)) == nil {
+		t.Error("mismatched sizes should be rejected")
+	}
+	a.ClearAll()
+	if in, out, err := a.Decode(); err != nil || len(in)+len(out) != 0 {
+		t.Error("ClearAll should remove all keys")
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	a := New(30, 8)
+	a.Insert(key(1)) // #nosec
+	a.Delete(key(2)) // #nosec
+	data, err := a.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b Table
+	if err := b.UnmarshalBinary(data); err != nil || !b.Equal(a) {
+		t.Errorf("binary round trip changed the table: %v", err)
+	}
+	in, out, err := b.Decode()
+	if err != nil || len(in) != 1 || len(out) != 1 || !bytes.Equal(in[0], key(1)) || !bytes.Equal(out[0], key(2)) {
+		t.Errorf("unexpected keys %x %x: %v", in, out, err)
+	}
+	if b.UnmarshalBinary(data[:len(data)-1]) == nil {
+		t.Error("truncated tables should be rejected")
+	}
+}
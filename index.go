@@ -0,0 +1,134 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// An Index routes keys to the children filters that may contain them, e.g.,
+// one filter per partition or segment of a storage engine. Children are
+// grouped and each group is summarized by the union of its children, so that
+// Candidates only tests the children of the groups whose summary matches.
+// All the children must have the same m, k, hash functions and range
+// reduction.
+//
+// Children are not copied: a child must not be modified once it has been
+// added to the index, otherwise its group summary would be stale.
+type Index struct {
+	groupSize uint
+	children  []*BloomFilter
+	summaries []*BloomFilter
+}
+
+// NewIndex creates an empty index summarizing children by groups of
+// _groupSize_. We force _groupSize_ to be at least one.
+func NewIndex(groupSize uint) *Index {
+	return &Index{groupSize: max(1, groupSize)}
+}
+
+// Len returns the number of children in the index
+func (x *Index) Len() int {
+	return len(x.children)
+}
+
+// Child returns the ith child of the index
+func (x *Index) Child(i int) *BloomFilter {
+	return x.children[i]
+}
+
+// Add appends a child to the index and returns its position.
+func (x *Index) Add(child *BloomFilter) (int, error) {
+	if len(x.children) > 0 {
+		if err := x.children[0].compatible(child); err != nil {
+			return 0, err
+		}
+	}
+	i := len(x.children)
+	x.children = append(x.children, child)
+	if uint(i)%x.groupSize == 0 {
+		x.summaries = append(x.summaries, child.Copy())
+	} else {
+		x.summaries[len(x.summaries)-1].b.InPlaceUnion(child.b)
+	}
+	return i, nil
+}
+
+// Candidates returns the positions, in increasing order, of the children
+// which may contain the data.
+func (x *Index) Candidates(data []byte) []int {
+	var candidates []int
+	if len(x.children) == 0 {
+		return nil
+	}
+	h := x.children[0].hashes(data)
+	for g, summary := range x.summaries {
+		if !summary.testHashes(h) {
+			continue
+		}
+		end := (g + 1) * int(x.groupSize)
+		if end > len(x.children) {
+			end = len(x.children)
+		}
+		for i := g * int(x.groupSize); i < end; i++ {
+			if x.children[i].testHashes(h) {
+				candidates = append(candidates, i)
+			}
+		}
+	}
+	return candidates
+}
+
+// WriteTo writes a binary representation of the Index to an i/o stream:
+// the group size and the number of children, followed by the children as
+// written by their WriteTo method. The summaries are not written.
+// It returns the number of bytes written.
+func (x *Index) WriteTo(stream io.Writer) (int64, error) {
+	err := binary.Write(stream, binary.BigEndian, uint64(x.groupSize))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, uint64(len(x.children)))
+	if err != nil {
+		return 0, err
+	}
+	total := int64(2 * binary.Size(uint64(0)))
+	for _, child := range x.children {
+		numBytes, err := child.WriteTo(stream)
+		total += numBytes
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// ReadFrom reads a binary representation of the Index (such as might
+// have been written by WriteTo()) from an i/o stream, rebuilding the
+// summaries. It returns the number of bytes read.
+func (x *Index) ReadFrom(stream io.Reader) (int64, error) {
+	var groupSize, n uint64
+	err := binary.Read(stream, binary.BigEndian, &groupSize)
+	if err != nil {
+		return 0, err
+	}
+	total := int64(binary.Size(groupSize))
+	err = binary.Read(stream, binary.BigEndian, &n)
+	if err != nil {
+		return total, err
+	}
+	total += int64(binary.Size(n))
+	y := NewIndex(uint(groupSize))
+	for i := uint64(0); i < n; i++ {
+		child := &BloomFilter{}
+		numBytes, err := child.ReadFrom(stream)
+		total += numBytes
+		if err != nil {
+			return total, err
+		}
+		if _, err := y.Add(child); err != nil {
+			return total, err
+		}
+	}
+	*x = *y
+	return total, nil
+}
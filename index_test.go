@@ -0,0 +1,114 @@
+package bloom
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func newTestIndex(t *testing.T) *Index {
+	x := NewIndex(4)
+	for i := 0; i < 10; i++ {
+		child := New(1000, 4)
+		child.AddString(fmt.Sprintf("segment-%d", i))
+		child.AddString(fmt.Sprintf("even-%v", i%2 == 0))
+		if _, err := x.Add(child); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return x
+}
+
+func TestIndexCandidates(t *testing.T) {
+	x := newTestIndex(t)
+	if x.Len() != 10 {
+		t.Errorf("unexpected length %d", x.Len())
+	}
+	candidates := x.Candidates([]byte("segment-7"))
+	if len(candidates) != 1 || candidates[0] != 7 {
+		t.Errorf("unexpected candidates %v", candidates)
+	}
+	candidates = x.Candidates([]byte("even-true"))
+	if fmt.Sprint(candidates) != "[0 2 4 6 8]" {
+		t.Errorf("unexpected candidates %v", candidates)
+	}
+	if candidates := x.Candidates([]byte("segment-10")); len(candidates) != 0 {
+		t.Errorf("unexpected candidates %v", candidates)
+	}
+	if !x.Child(7).TestString("segment-7") {
+		t.Error("unexpected child")
+	}
+}
+
+func TestIndexIncompatible(t *testing.T) {
+	x := NewIndex(4)
+	if _, err := x.Add(New(1000, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := x.Add(New(999, 4)); err == nil {
+		t.Error("expected an error for mismatched m")
+	}
+	if _, err := x.Add(New(1000, 5)); err == nil {
+		t.Error("expected an error for mismatched k")
+	}
+	for _, child := range []*BloomFilter{NewWithSeed(1000, 4, 42), NewFastRange(1000, 4),
+		NewKeyed(1000, 4, [16]byte{1}), NewWithScheme(1000, 4, SchemeDoubleHashing)} {
+		if _, err := x.Add(child); err == nil {
+			t.Errorf("expected an error for mismatched hash functions %v", child.Fingerprint())
+		}
+	}
+	if x.Len() != 1 {
+		t.Errorf("unexpected length %d", x.Len())
+	}
+}
+
+func TestIndexWriteToReadFrom(t *testing.T) {
+	x := newTestIndex(t)
+	var buf bytes.Buffer
+	bytesWritten, err := x.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytesWritten != int64(buf.Len()) {
+		t.Errorf("incorrect write length %d != %d", bytesWritten, buf.Len())
+	}
+	var y Index
+	bytesRead, err := y.ReadFrom(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytesRead != bytesWritten {
+		t.Errorf("read unexpected number of bytes %d != %d", bytesRead, bytesWritten)
+	}
+	if y.Len() != x.Len() {
+		t.Fatalf("unexpected length %d", y.Len())
+	}
+	for i := 0; i < x.Len(); i++ {
+		if !y.Child(i).Equal(x.Child(i)) {
+			t.Errorf("child %d differs", i)
+		}
+	}
+	candidates := y.Candidates([]byte("segment-7"))
+	if len(candidates) != 1 || candidates[0] != 7 {
+		t.Errorf("unexpected candidates %v", candidates)
+	}
+}
+
+func TestIndexReadFromTruncated(t *testing.T) {
+	x := newTestIndex(t)
+	var buf bytes.Buffer
+	if _, err := x.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	for _, size := range []int{4, 12, 20, len(data) - 1} {
+		var y Index
+		n, err := y.ReadFrom(bytes.NewReader(data[:size]))
+		if err == nil {
+			t.Errorf("%d bytes: an error was expected", size)
+		}
+		if n > int64(size) || size >= 8 && n < 8 || size >= 16 && n < 16 {
+			t.Errorf("%d bytes: %d bytes read", size, n)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package bloom
+
+import "encoding/binary"
+
+// The methods below add and test integers without allocating: an integer is
+// hashed as its big-endian representation, in a buffer on the stack. They
+// are thus equivalent to Add, Test and TestAndAdd with the bytes written by
+// binary.BigEndian.PutUint64 (or PutUint32), and a filter may mix both.
+// Integers of type int are hashed as 64-bit integers, whatever the platform.
+
+// AddUint64 adds a 64-bit integer to the Bloom Filter. Returns the filter
+// (allows chaining)
+func (f *BloomFilter) AddUint64(x uint64) *BloomFilter {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], x)
+	return f.Add(buf[:])
+}
+
+// TestUint64 returns true if the 64-bit integer is in the BloomFilter, false
+// otherwise. If true, the result might be a false positive. If false, the
+// integer is definitely not in the set.
+func (f *BloomFilter) TestUint64(x uint64) bool {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], x)
+	return f.Test(buf[:])
+}
+
+// TestAndAddUint64 is equivalent to calling TestUint64(x) then AddUint64(x).
+// Returns the result of TestUint64.
+func (f *BloomFilter) TestAndAddUint64(x uint64) bool {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], x)
+	return f.TestAndAdd(buf[:])
+}
+
+// AddUint32 adds a 32-bit integer to the Bloom Filter. Returns the filter
+// (allows chaining)
+func (f *BloomFilter) AddUint32(x uint32) *BloomFilter {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], x)
+	return f.Add(buf[:])
+}
+
+// TestUint32 returns true if the 32-bit integer is in the BloomFilter, false
+// otherwise. If true, the result might be a false positive. If false, the
+// integer is definitely not in the set.
+func (f *BloomFilter) TestUint32(x uint32) bool {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], x)
+	return f.Test(buf[:])
+}
+
+// TestAndAddUint32 is equivalent to calling TestUint32(x) then AddUint32(x).
+// Returns the result of TestUint32.
+func (f *BloomFilter) TestAndAddUint32(x uint32) bool {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], x)
+	return f.TestAndAdd(buf[:])
+}
+
+// AddInt adds an integer to the Bloom Filter, as AddUint64(uint64(x)) would.
+// Returns the filter (allows chaining)
+func (f *BloomFilter) AddInt(x int) *BloomFilter {
+	return f.AddUint64(uint64(x))
+}
+
+// TestInt returns true if the integer is in the BloomFilter, false otherwise.
+// If true, the result might be a false positive. If false, the integer is
+// definitely not in the set.
+func (f *BloomFilter) TestInt(x int) bool {
+	return f.TestUint64(uint64(x))
+}
+
+// TestAndAddInt is equivalent to calling TestInt(x) then AddInt(x).
+// Returns the result of TestInt.
+func (f *BloomFilter) TestAndAddInt(x int) bool {
+	return f.TestAndAddUint64(uint64(x))
+}
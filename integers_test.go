@@ -0,0 +1,54 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestIntegers(t *testing.T) {
+	f := NewWithEstimates(1000, 0.001)
+	if f.TestAndAddUint64(1<<40) || f.TestAndAddUint32(7) || f.TestAndAddInt(-3) {
+		t.Error("integers should not be in an empty filter")
+	}
+	f.AddUint64(1 << 41).AddUint32(8).AddInt(-4)
+	for _, ok := range []bool{
+		f.TestUint64(1 << 40), f.TestUint32(7), f.TestInt(-3),
+		f.TestUint64(1 << 41), f.TestUint32(8), f.TestInt(-4),
+		f.TestUint64(^uint64(2)), // same as -3
+	} {
+		if !ok {
+			t.Error("integers should be in the filter")
+		}
+	}
+	if f.TestUint64(7) || f.TestUint32(1) || f.TestInt(3) {
+		t.Error("integers should not be in the filter")
+	}
+
+	// Integers are hashed as their big-endian representation.
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, 1<<40)
+	if !f.Test(buf) {
+		t.Error("AddUint64 should be equivalent to Add")
+	}
+	binary.BigEndian.PutUint32(buf, 8)
+	if !f.Test(buf[:4]) {
+		t.Error("AddUint32 should be equivalent to Add")
+	}
+}
+
+func TestIntegersDoNotAllocate(t *testing.T) {
+	for _, f := range []*BloomFilter{
+		New(1000, 4),
+		NewKeyed(1000, 4, [16]byte{1}),
+	} {
+		allocs := testing.AllocsPerRun(100, func() {
+			f.AddUint64(1)
+			f.TestUint64(2)
+			f.TestAndAddUint32(3)
+			f.TestAndAddInt(4)
+		})
+		if allocs != 0 {
+			t.Errorf("%v allocations per run", allocs)
+		}
+	}
+}
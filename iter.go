@@ -0,0 +1,19 @@
+//go:build go1.23
+// +build go1.23
+
+package bloom
+
+import "iter"
+
+// SetBits returns an iterator over the locations of the filter whose bits
+// are set, in increasing order, e.g., to export a sparse representation of
+// the filter. The filter must not be modified during the iteration.
+func (f *BloomFilter) SetBits() iter.Seq[uint] {
+	return func(yield func(uint) bool) {
+		for i, ok := f.NextSet(0); ok; i, ok = f.NextSet(i + 1) {
+			if !yield(i) {
+				return
+			}
+		}
+	}
+}
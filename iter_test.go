@@ -0,0 +1,35 @@
+//go:build go1.23
+// +build go1.23
+
+package bloom
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSetBits(t *testing.T) {
+	f := New(1000, 3)
+	if slices.Collect(f.SetBits()) != nil {
+		t.Error("an empty filter has no bits set")
+	}
+	f.AddString("a").AddString("b")
+	var expected []uint
+	for i, ok := f.NextSet(0); ok; i, ok = f.NextSet(i + 1) {
+		expected = append(expected, i)
+	}
+	if len(expected) != int(f.BitSet().Count()) || !slices.IsSorted(expected) {
+		t.Errorf("NextSet should list the bits set in order: %v", expected)
+	}
+	for _, l := range expected {
+		if !f.BitSet().Test(l) {
+			t.Errorf("bit %d is not set", l)
+		}
+	}
+	if got := slices.Collect(f.SetBits()); !slices.Equal(got, expected) {
+		t.Errorf("SetBits returned %v, expected %v", got, expected)
+	}
+	for range f.SetBits() {
+		break
+	}
+}
@@ -0,0 +1,72 @@
+package bloom
+
+// An Oracle is a model scoring how likely a key is to be in a set. Scores
+// are expected to be in [0, 1], higher meaning more likely.
+type Oracle interface {
+	Predict(key []byte) float64
+}
+
+// A LearnedFilter is a learned Bloom filter (Kraska et al., "The Case for
+// Learned Index Structures"). Keys are first routed through an oracle: a
+// key scoring at least the threshold is reported as present. The keys of the
+// set that the oracle misses (its false negatives) are kept in a backup Bloom
+// filter, which is checked for keys scoring below the threshold. Thus, as with
+// a BloomFilter, there are no false negatives as long as the oracle is
+// deterministic.
+//
+// The false positive rate is that of the oracle at the chosen threshold plus
+// that of the backup filter, weighted by the fraction of keys scoring below
+// the threshold. The backup filter only needs to be sized for the oracle's
+// false negatives.
+type LearnedFilter struct {
+	oracle    Oracle
+	threshold float64
+	backup    *BloomFilter
+}
+
+// NewLearned creates a new learned filter using the given oracle, threshold
+// and backup filter.
+func NewLearned(oracle Oracle, threshold float64, backup *BloomFilter) *LearnedFilter {
+	return &LearnedFilter{oracle, threshold, backup}
+}
+
+// Threshold returns the score at or above which the oracle is trusted
+func (f *LearnedFilter) Threshold() float64 {
+	return f.threshold
+}
+
+// Backup returns the backup filter holding the oracle's false negatives.
+func (f *LearnedFilter) Backup() *BloomFilter {
+	return f.backup
+}
+
+// Add data to the filter: if the oracle scores the data below the threshold,
+// it is added to the backup filter. Returns the filter (allows chaining)
+func (f *LearnedFilter) Add(data []byte) *LearnedFilter {
+	if f.oracle.Predict(data) < f.threshold {
+		f.backup.Add(data)
+	}
+	return f
+}
+
+// AddString to the filter. Returns the filter (allows chaining)
+func (f *LearnedFilter) AddString(data string) *LearnedFilter {
+	return f.Add([]byte(data))
+}
+
+// Test returns true if the data is in the filter, false otherwise.
+// If true, the result might be a false positive. If false, the data
+// is definitely not in the set.
+func (f *LearnedFilter) Test(data []byte) bool {
+	if f.oracle.Predict(data) >= f.threshold {
+		return true
+	}
+	return f.backup.Test(data)
+}
+
+// TestString returns true if the string is in the filter, false otherwise.
+// If true, the result might be a false positive. If false, the data
+// is definitely not in the set.
+func (f *LearnedFilter) TestString(data string) bool {
+	return f.Test([]byte(data))
+}
@@ -0,0 +1,44 @@
+package bloom
+
+import (
+	"bytes"
+	"testing"
+)
+
+// prefixOracle is confident about keys with a given prefix.
+type prefixOracle []byte
+
+func (o prefixOracle) Predict(key []byte) float64 {
+	if bytes.HasPrefix(key, o) {
+		return 0.9
+	}
+	return 0.1
+}
+
+func TestLearnedFilter(t *testing.T) {
+	backup := New(1000, 4)
+	f := NewLearned(prefixOracle("user:"), 0.5, backup)
+	f.AddString("user:bess")
+	f.AddString("admin:jane")
+	if f.Threshold() != 0.5 {
+		t.Errorf("unexpected threshold %v", f.Threshold())
+	}
+	if f.Backup() != backup {
+		t.Error("unexpected backup filter")
+	}
+	if backup.TestString("user:bess") {
+		t.Error("keys trusted by the oracle should not go to the backup filter")
+	}
+	if !backup.TestString("admin:jane") {
+		t.Error("keys missed by the oracle should go to the backup filter")
+	}
+	if !f.TestString("user:bess") || !f.TestString("admin:jane") {
+		t.Error("added keys should be in")
+	}
+	if !f.TestString("user:emma") {
+		t.Error("keys trusted by the oracle should be in")
+	}
+	if f.TestString("admin:emma") {
+		t.Error("admin:emma should not be in")
+	}
+}
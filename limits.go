@@ -0,0 +1,59 @@
+package bloom
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// maxReadHashes is the largest k accepted by ReadFromLimited. Optimal
+// filters need fewer than 64 hash functions down to false positive rates of
+// 2^-64, and each one costs a probe per query.
+const maxReadHashes = 1024
+
+// errBitSetLength is returned for serialized bitsets whose length is not
+// within the limits of the reader.
+var errBitSetLength = errors.New("bloom: serialized bitset length is out of bounds")
+
+// A limit bounds the length, in bits, of a serialized bitset, which is
+// checked before the bitset is allocated.
+type limit struct {
+	min, max uint64
+}
+
+// noLimit accepts any bitset which fits in memory
+var noLimit = limit{0, math.MaxUint64}
+
+// check returns an error if a bitset of the given length is not within the
+// limit, or does not fit in the address space
+func (l limit) check(length uint64) error {
+	if length < l.min || length > l.max || length > uint64(^uint(0)) {
+		return errBitSetLength
+	}
+	return nil
+}
+
+// limit checks m and k against the limits of ReadFromLimited and returns
+// the limit of the length of the bitset: m, up to a multiple of 64.
+func (h header) limit(maxBits uint64) (limit, error) {
+	if h.m == 0 || h.m > maxBits {
+		return limit{}, fmt.Errorf("bloom: serialized m %d is not within [1, %d]", h.m, maxBits)
+	}
+	if h.k == 0 || h.k > maxReadHashes {
+		return limit{}, fmt.Errorf("bloom: serialized k %d is not within [1, %d]", h.k, maxReadHashes)
+	}
+	return limit{h.m, (h.m + 63) / 64 * 64}, nil
+}
+
+// ReadFromLimited reads a binary representation of the BloomFilter, like
+// ReadFrom, from a stream which may not be trusted. It returns an error
+// before the bitset is allocated if m is 0 or larger than maxBits, if k is 0
+// or larger than 1024, or if the bitset does not have m bits, up to a
+// multiple of 64, as the bitsets of the filters created by New or From do.
+// Encoded bitsets are checked before they are decoded, so that a small
+// compressed stream cannot decode into a large bitset. It returns the number
+// of bytes read.
+func (f *BloomFilter) ReadFromLimited(stream io.Reader, maxBits uint64) (int64, error) {
+	return f.readFrom(stream, true, maxBits)
+}
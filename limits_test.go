@@ -0,0 +1,95 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/bits-and-blooms/bitset"
+)
+
+// legacyFilter returns a filter in the original format with the given m, k
+// and bitset length, followed by words words.
+func legacyFilter(m, k, length uint64, words int) []byte {
+	data := make([]byte, 24+8*words)
+	binary.BigEndian.PutUint64(data, m)
+	binary.BigEndian.PutUint64(data[8:], k)
+	binary.BigEndian.PutUint64(data[16:], length)
+	return data
+}
+
+func TestReadFromLimited(t *testing.T) {
+	f := NewWithEstimates(1000, 0.01)
+	for i := uint32(0); i < 300; i++ {
+		f.AddUint32(i)
+	}
+	for _, e := range []Encoding{EncodingRaw, EncodingGolomb, EncodingGzip} {
+		var buf bytes.Buffer
+		f.WriteEncodedTo(&buf, e)
+		f.WriteFramedTo(&buf, e)
+		for i := 0; i < 2; i++ {
+			var g BloomFilter
+			if _, err := g.ReadFromLimited(&buf, uint64(f.m)); err != nil || !g.Equal(f) {
+				t.Errorf("encoding %d: filters within the limits should be read: %v", e, err)
+			}
+		}
+		buf.Reset()
+		f.WriteEncodedTo(&buf, e)
+		var g BloomFilter
+		if _, err := g.ReadFromLimited(&buf, uint64(f.m)-1); err == nil {
+			t.Errorf("encoding %d: m above the limit should not be accepted", e)
+		}
+	}
+
+	for name, data := range map[string][]byte{
+		"m = 0":               legacyFilter(0, 4, 0, 0),
+		"k = 0":               legacyFilter(1000, 0, 1000, 16),
+		"large k":             legacyFilter(1000, 1025, 1000, 16),
+		"short bitset":        legacyFilter(1000, 4, 999, 16),
+		"long bitset":         legacyFilter(1000, 4, 1025, 17),
+		"huge bitset":         legacyFilter(1000, 4, 1<<60, 0),
+		"huge m":              legacyFilter(1<<60, 4, 1<<60, 0),
+		"truncated bitset":    legacyFilter(1000, 4, 1000, 15),
+		"truncated header":    legacyFilter(1000, 4, 1000, 0)[:12],
+		"inconsistent header": legacyFilter(2000, 4, 1000, 16),
+	} {
+		var g BloomFilter
+		if _, err := g.ReadFromLimited(bytes.NewReader(data), 1<<20); err == nil {
+			t.Errorf("%s should not be accepted", name)
+		}
+	}
+	var g BloomFilter
+	if _, err := g.ReadFromLimited(bytes.NewReader(legacyFilter(1000, 4, 1024, 16)), 1<<20); err != nil {
+		t.Errorf("bitsets rounded up to words should be accepted: %v", err)
+	}
+	// ReadFrom returns an error, rather than panics, on a huge bitset.
+	if _, err := g.ReadFrom(bytes.NewReader(legacyFilter(1000, 4, 1<<60, 0))); err == nil {
+		t.Error("truncated bitsets should not be accepted")
+	}
+}
+
+func TestReadFromLimitedCompressed(t *testing.T) {
+	// A small gzip stream decoding into a bitset much larger than m.
+	var buf bytes.Buffer
+	header{m: 1000, k: 4, encoding: EncodingGzip}.writeTo(&buf)
+	writeGzip(&buf, bitset.New(1<<24))
+	if buf.Len() > 1<<16 {
+		t.Fatalf("%d bytes", buf.Len())
+	}
+	data := buf.Bytes()
+	var g BloomFilter
+	if _, err := g.ReadFromLimited(bytes.NewReader(data), 1<<20); err != errBitSetLength {
+		t.Errorf("bitsets longer than m should not be decoded: %v", err)
+	}
+	if _, err := g.ReadFrom(bytes.NewReader(data)); err != nil || g.b.Len() != 1<<24 {
+		t.Errorf("ReadFrom should decode the bitset: %v", err)
+	}
+
+	// A Golomb coded bitset with no set bit but a huge length.
+	buf.Reset()
+	header{m: 1000, k: 4, encoding: EncodingGolomb}.writeTo(&buf)
+	binary.Write(&buf, binary.BigEndian, []uint64{1 << 50, 0, 0, 0})
+	if _, err := g.ReadFromLimited(&buf, 1<<20); err != errBitSetLength {
+		t.Errorf("bitsets longer than m should not be decoded: %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package bloom
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bits-and-blooms/bitset"
+)
+
+// mergeChunk is the number of words which each goroutine of MergeAll takes
+// at once: 64 KB of each filter.
+const mergeChunk = 8192
+
+// MergeAll merges the data of several Bloom filters into dst, as calling
+// Merge for each of them would. The filters are checked up front: if one of
+// them does not have the m, k and hash functions of dst, MergeAll returns
+// the error Merge would, and dst is not modified. Large filters are merged
+// by up to GOMAXPROCS goroutines, each ORing all the filters into a range of
+// the words of dst in turn. The filters must not be modified until MergeAll
+// returns.
+func MergeAll(dst *BloomFilter, srcs ...*BloomFilter) error {
+	return mergeAll(dst, runtime.GOMAXPROCS(0), srcs)
+}
+
+// mergeAll is MergeAll with at most the given number of goroutines
+func mergeAll(dst *BloomFilter, parallelism int, srcs []*BloomFilter) error {
+	for _, src := range srcs {
+		if err := dst.compatible(src); err != nil {
+			return err
+		}
+	}
+	dst.changedAll()
+	for _, src := range srcs {
+		if src.b.Len() != dst.b.Len() {
+			// The bitsets may hold more than m bits, see FromBitSetWithM,
+			// which InPlaceUnion extends dst with.
+			for _, src := range srcs {
+				dst.b.InPlaceUnion(src.b)
+			}
+			return nil
+		}
+	}
+	words := dst.b.Words()
+	if chunks := (len(words) + mergeChunk - 1) / mergeChunk; parallelism > chunks {
+		parallelism = chunks
+	}
+	merge := func(start, end int) {
+		for _, src := range srcs {
+			for i, w := range src.b.Words()[start:end] {
+				words[start+i] |= w
+			}
+		}
+	}
+	if parallelism <= 1 {
+		merge(0, len(words))
+		return nil
+	}
+	var next int64
+	var wg sync.WaitGroup
+	for g := 0; g < parallelism; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				start := int(atomic.AddInt64(&next, mergeChunk)) - mergeChunk
+				if start >= len(words) {
+					return
+				}
+				end := start + mergeChunk
+				if end > len(words) {
+					end = len(words)
+				}
+				merge(start, end)
+			}
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// MergeFromReader merges the filter read from an i/o stream, such as written
+// by WriteTo, into this filter. The words are ORed as they are read, so no
+// intermediate filter is built, unless the bitset is encoded or framed (see
+// WriteEncodedTo and WriteFramedTo). Like Merge, it returns an error if the m's,
+// the k's or the hash functions don't match; the keys of keyed filters are
+// not serialized, so they are assumed to be the same. The filter may be
+// partially merged if the stream turns out to be truncated or invalid.
+// It returns the number of bytes read.
+func (f *BloomFilter) MergeFromReader(stream io.Reader) (int64, error) {
+	h, headerSize, err := readHeader(stream)
+	if err != nil {
+		return 0, err
+	}
+	if uint64(f.m) != h.m {
+		return 0, fmt.Errorf("m's don't match: %d != %d", f.m, h.m)
+	}
+	if uint64(f.k) != h.k {
+		return 0, fmt.Errorf("k's don't match: %d != %d", f.k, h.k)
+	}
+	if err := f.Fingerprint().mismatch(h.fingerprint()); err != nil {
+		return 0, err
+	}
+	f.changedAll()
+	if h.encoding != EncodingRaw || h.checksum {
+		// Encoded bitsets are decoded, and framed ones checked, before they
+		// are merged.
+		b, n, err := readPayload(stream, h, noLimit)
+		if err != nil {
+			return 0, err
+		}
+		if _, ok := b.NextSet(f.b.Len()); ok {
+			return 0, errors.New("bloom: merged filter has bits beyond m")
+		}
+		for i, ok := b.NextSet(0); ok; i, ok = b.NextSet(i + 1) {
+			f.b.Set(i)
+		}
+		return headerSize + n, nil
+	}
+	var length uint64
+	err = binary.Read(stream, bitset.BinaryOrder(), &length)
+	if err != nil {
+		return 0, err
+	}
+	words := f.b.Words()
+	n := length/64 + (length%64+63)/64
+	buffer := make([]byte, 128*8)
+	for i := uint64(0); i < n; {
+		chunk := n - i
+		if chunk > 128 {
+			chunk = 128
+		}
+		if _, err := io.ReadFull(stream, buffer[:8*chunk]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		for j := uint64(0); j < chunk; j, i = j+1, i+1 {
+			word := bitset.BinaryOrder().Uint64(buffer[8*j:])
+			if i < uint64(len(words)) {
+				words[i] |= word
+			} else if word != 0 {
+				return 0, errors.New("bloom: merged filter has bits beyond m")
+			}
+		}
+	}
+	return headerSize + int64(binary.Size(length)) + int64(8*n), nil
+}
+
+// MergeDir reads every filter file (as written by WriteTo) in the directory
+// whose name matches the pattern (see filepath.Match) and returns their
+// union. The files are streamed in lexical order with MergeFromReader, and
+// must all have the same m and k. Keyed filters are not supported.
+func MergeDir(path string, pattern string) (*BloomFilter, error) {
+	names, err := filepath.Glob(filepath.Join(path, pattern))
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("bloom: no filter matches %s", filepath.Join(path, pattern))
+	}
+	sort.Strings(names)
+	var f *BloomFilter
+	for _, name := range names {
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		r := bufio.NewReader(file)
+		if f == nil {
+			f = &BloomFilter{}
+			_, err = f.ReadFrom(r)
+		} else {
+			_, err = f.MergeFromReader(r)
+		}
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("bloom: %s: %w", name, err)
+		}
+	}
+	return f, nil
+}
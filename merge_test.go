@@ -0,0 +1,143 @@
+package bloom
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMergeFromReader(t *testing.T) {
+	f := New(1000, 4)
+	f.AddString("f")
+	g := New(1000, 4)
+	g.AddString("g")
+	var buf bytes.Buffer
+	bytesWritten, err := g.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytesRead, err := f.MergeFromReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytesRead != bytesWritten {
+		t.Errorf("read unexpected number of bytes %d != %d", bytesRead, bytesWritten)
+	}
+	if !f.TestString("f") || !f.TestString("g") {
+		t.Error("merged values should be in")
+	}
+	for _, h := range []*BloomFilter{New(999, 4), New(1000, 5)} {
+		buf.Reset()
+		if _, err := h.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.MergeFromReader(&buf); err == nil {
+			t.Errorf("expected an error merging m=%d k=%d", h.m, h.k)
+		}
+	}
+	buf.Reset()
+	if _, err := g.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.MergeFromReader(bytes.NewReader(buf.Bytes()[:buf.Len()-1])); err == nil {
+		t.Error("expected an error for a truncated filter")
+	}
+}
+
+func TestMergeDir(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 5; i++ {
+		f := New(1000, 4)
+		f.AddString(fmt.Sprintf("shard-%d", i))
+		data, err := f.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("part-%d.bloom", i)), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("not a filter"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := MergeDir(dir, "part-*.bloom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if !f.TestString(fmt.Sprintf("shard-%d", i)) {
+			t.Errorf("shard-%d should be in", i)
+		}
+	}
+	if _, err := MergeDir(dir, "*.missing"); err == nil {
+		t.Error("expected an error when no file matches")
+	}
+	if _, err := MergeDir(dir, "*"); err == nil {
+		t.Error("expected an error for an invalid file")
+	}
+}
+
+func TestMergeAll(t *testing.T) {
+	m := uint(3*mergeChunk*64 + 100)
+	shards := make([]*BloomFilter, 64)
+	for i := range shards {
+		shards[i] = NewWithSeed(m, 4, 42)
+		for j := 0; j < 1000; j++ {
+			shards[i].AddString(fmt.Sprintf("%d-%d", i, j))
+		}
+	}
+	want := NewWithSeed(m, 4, 42)
+	for _, shard := range shards {
+		if err := want.Merge(shard); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, parallelism := range []int{1, 2, 4, 8} {
+		f := NewWithSeed(m, 4, 42).AddString("Love")
+		if err := mergeAll(f, parallelism, shards); err != nil {
+			t.Fatal(err)
+		}
+		if !f.TestString("Love") || f.Equal(want) || !f.Equal(want.Copy().AddString("Love")) {
+			t.Errorf("%d goroutines: MergeAll should merge as Merge does", parallelism)
+		}
+	}
+	if err := MergeAll(New(m, 4)); err != nil {
+		t.Error(err)
+	}
+
+	// Incompatible filters are found before anything is merged.
+	f := NewWithSeed(m, 4, 42)
+	if err := MergeAll(f, shards[0], New(m, 4)); err == nil || f.b.Any() {
+		t.Errorf("unexpected error %v, or filter modified", err)
+	}
+
+	// Bitsets longer than m are merged as Merge does.
+	g := FromBitSetWithM(New(200, 1).BitSet(), 100, 1).AddString("a")
+	h := FromBitSetWithM(New(300, 1).BitSet(), 100, 1).AddString("b")
+	h.b.Set(250)
+	if err := MergeAll(g, h); err != nil || !g.b.Test(250) || !g.TestString("b") {
+		t.Errorf("unexpected error %v, or bits not merged", err)
+	}
+}
+
+func BenchmarkMergeAll(b *testing.B) {
+	shards := make([]*BloomFilter, 64)
+	for i := range shards {
+		shards[i] = New(1<<24, 4)
+	}
+	f := New(1<<24, 4)
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, shard := range shards {
+				f.Merge(shard)
+			}
+		}
+	})
+	b.Run("MergeAll", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			MergeAll(f, shards...)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package bloom
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// An InstrumentedBloomFilter is a Bloom filter which counts the operations
+// made on it, so that its health can be monitored: see Metrics, which can be
+// called from another goroutine, e.g., by a Prometheus collector or an expvar
+// function, while keys are added or tested:
+//
+//	f := bloom.NewInstrumented(bloom.NewWithEstimates(1000000, 0.001))
+//	expvar.Publish("seen", expvar.Func(func() interface{} { return f.Metrics() }))
+//
+// Apart from Metrics, it is not safe for concurrent use, like a BloomFilter.
+type InstrumentedBloomFilter struct {
+	// The counters are first, so that they are 64-bit aligned on 32-bit
+	// platforms.
+	adds      uint64
+	tests     uint64
+	positives uint64
+	bitsSet   uint64
+	f         *BloomFilter
+}
+
+// Metrics are the counters of an InstrumentedBloomFilter, and the health of
+// its filter they imply.
+type Metrics struct {
+	Adds      uint64 // keys added
+	Tests     uint64 // keys tested
+	Positives uint64 // keys tested which were found in the filter
+
+	BitsSet           uint64  // bits set in the filter
+	FillRatio         float64 // fraction of the bits set, see FillRatio
+	FalsePositiveRate float64 // see CurrentFalsePositiveRate
+}
+
+// NewInstrumented returns an InstrumentedBloomFilter which counts the
+// operations on f. The filter must then only be modified through the
+// InstrumentedBloomFilter, so that the count of its bits set stays exact.
+func NewInstrumented(f *BloomFilter) *InstrumentedBloomFilter {
+	return &InstrumentedBloomFilter{f: f, bitsSet: uint64(f.b.Count())}
+}
+
+// Filter returns the underlying Bloom filter, e.g., to serialize it. It must
+// not be modified directly.
+func (f *InstrumentedBloomFilter) Filter() *BloomFilter {
+	return f.f
+}
+
+// Add data to the Bloom filter. Returns the filter (allows chaining)
+func (f *InstrumentedBloomFilter) Add(data []byte) *InstrumentedBloomFilter {
+	f.set(f.f.hashes(data))
+	atomic.AddUint64(&f.adds, 1)
+	return f
+}
+
+// AddString to the Bloom filter. Returns the filter (allows chaining)
+func (f *InstrumentedBloomFilter) AddString(data string) *InstrumentedBloomFilter {
+	return f.Add(stringToBytes(data))
+}
+
+// Test returns true if the data is in the Bloom filter, false otherwise.
+// If true, the result might be a false positive. If false, the data
+// is definitely not in the set.
+func (f *InstrumentedBloomFilter) Test(data []byte) bool {
+	present := f.f.Test(data)
+	f.tested(present)
+	return present
+}
+
+// TestString returns true if the string is in the Bloom filter, false
+// otherwise. If true, the result might be a false positive. If false, the
+// data is definitely not in the set.
+func (f *InstrumentedBloomFilter) TestString(data string) bool {
+	return f.Test(stringToBytes(data))
+}
+
+// TestOrAdd is equivalent to calling Test(data) then if not present
+// Add(data), and is counted as such. Returns the result of Test.
+func (f *InstrumentedBloomFilter) TestOrAdd(data []byte) bool {
+	h := f.f.hashes(data)
+	present := f.f.testHashes(h)
+	f.tested(present)
+	if !present {
+		f.set(h)
+		atomic.AddUint64(&f.adds, 1)
+	}
+	return present
+}
+
+// TestOrAddString is equivalent to calling TestString(data) then if not
+// present AddString(data), and is counted as such. Returns the result of
+// TestString.
+func (f *InstrumentedBloomFilter) TestOrAddString(data string) bool {
+	return f.TestOrAdd(stringToBytes(data))
+}
+
+// set sets the locations of the hashes, counting the bits which were not set
+func (f *InstrumentedBloomFilter) set(h [4]uint64) {
+	var set uint64
+	for i := uint(0); i < f.f.k; i++ {
+		l := f.f.location(h, i)
+		if !f.f.b.Test(l) {
+			f.f.set(l)
+			set++
+		}
+	}
+	atomic.AddUint64(&f.bitsSet, set)
+}
+
+// tested counts a test
+func (f *InstrumentedBloomFilter) tested(present bool) {
+	atomic.AddUint64(&f.tests, 1)
+	if present {
+		atomic.AddUint64(&f.positives, 1)
+	}
+}
+
+// Metrics returns the counters of the filter. It is safe to call
+// concurrently with the other methods, and takes constant time: the bits set
+// are counted as they are set.
+func (f *InstrumentedBloomFilter) Metrics() Metrics {
+	bitsSet := atomic.LoadUint64(&f.bitsSet)
+	fill := float64(bitsSet) / float64(f.f.m)
+	return Metrics{
+		Adds:              atomic.LoadUint64(&f.adds),
+		Tests:             atomic.LoadUint64(&f.tests),
+		Positives:         atomic.LoadUint64(&f.positives),
+		BitsSet:           bitsSet,
+		FillRatio:         fill,
+		FalsePositiveRate: math.Pow(fill, float64(f.f.k)),
+	}
+}
@@ -0,0 +1,50 @@
+package bloom
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestInstrumented(t *testing.T) {
+	g := New(1000, 4).AddString("before")
+	f := NewInstrumented(g)
+	if m := f.Metrics(); m.BitsSet != 4 || m.Adds != 0 {
+		t.Errorf("the bits set before should be counted: %+v", m)
+	}
+	f.AddString("a").AddString("b").AddString("a")
+	f.TestString("a")
+	f.TestString("c")
+	if f.TestOrAddString("d") || !f.TestOrAddString("d") {
+		t.Error("d should only be found once added")
+	}
+	m := f.Metrics()
+	if m.Adds != 4 || m.Tests != 4 || m.Positives != 2 {
+		t.Errorf("unexpected counters %+v", m)
+	}
+	if m.BitsSet != uint64(g.BitSet().Count()) || m.FillRatio != g.FillRatio() ||
+		m.FalsePositiveRate != g.CurrentFalsePositiveRate() {
+		t.Errorf("unexpected fill %+v", m)
+	}
+	if f.Filter() != g {
+		t.Error("Filter should return the underlying filter")
+	}
+}
+
+func TestInstrumentedMetricsConcurrently(t *testing.T) {
+	f := NewInstrumented(NewWithEstimates(1000, 0.01))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			f.Metrics()
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		f.TestOrAdd(batchKeys(1, i)[0])
+	}
+	wg.Wait()
+	if m := f.Metrics(); m.Adds+m.Positives != 1000 {
+		t.Errorf("unexpected counters %+v", m)
+	}
+}
@@ -0,0 +1,84 @@
+package bloom
+
+import (
+	"time"
+)
+
+// A Migrator wraps an old and a new filter during a change of parameters
+// (m, k, seed...). During an overlap window, writes go to both filters and
+// a key is reported as present if either filter contains it, so that keys
+// added before the migration keep testing positive. Once the window has
+// elapsed, the old filter is dropped and only the new one is used.
+//
+// The window should be long enough for the new filter to receive every key
+// that matters, e.g., the TTL of the entries it describes. During the
+// window, the false positive rate is about the sum of the rates of the two
+// filters.
+//
+// Like the BloomFilter, a Migrator is not safe for concurrent use.
+type Migrator struct {
+	old   *BloomFilter
+	new   *BloomFilter
+	until time.Time
+	now   func() time.Time
+}
+
+// NewMigrator starts migrating from the old to the new filter, keeping the
+// old one for the given overlap window.
+func NewMigrator(old, new *BloomFilter, overlap time.Duration) *Migrator {
+	return &Migrator{old, new, time.Now().Add(overlap), time.Now}
+}
+
+// current drops the old filter when the overlap window has elapsed and
+// returns it otherwise.
+func (m *Migrator) current() *BloomFilter {
+	if m.old != nil && !m.now().Before(m.until) {
+		m.old = nil
+	}
+	return m.old
+}
+
+// Migrating returns true while the old filter is still in use.
+func (m *Migrator) Migrating() bool {
+	return m.current() != nil
+}
+
+// Finish drops the old filter immediately.
+func (m *Migrator) Finish() {
+	m.old = nil
+}
+
+// Filter returns the new filter.
+func (m *Migrator) Filter() *BloomFilter {
+	return m.new
+}
+
+// Add data to the filters. Returns the migrator (allows chaining)
+func (m *Migrator) Add(data []byte) *Migrator {
+	if old := m.current(); old != nil {
+		old.Add(data)
+	}
+	m.new.Add(data)
+	return m
+}
+
+// Test returns true if the data is in either filter, false otherwise.
+// If true, the result might be a false positive. If false, the data
+// is definitely not in the set.
+func (m *Migrator) Test(data []byte) bool {
+	if m.new.Test(data) {
+		return true
+	}
+	old := m.current()
+	return old != nil && old.Test(data)
+}
+
+// TestAndAdd is equivalent to calling Test(data) then Add(data).
+// Returns the result of Test.
+func (m *Migrator) TestAndAdd(data []byte) bool {
+	present := m.new.TestAndAdd(data)
+	if old := m.current(); old != nil {
+		present = old.TestAndAdd(data) || present
+	}
+	return present
+}
@@ -0,0 +1,59 @@
+package bloom
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMigrator(t *testing.T) {
+	old := New(1000, 4)
+	old.AddString("before")
+	now := time.Now()
+	m := NewMigrator(old, New(2000, 5), time.Hour)
+	m.now = func() time.Time { return now }
+
+	m.Add([]byte("during"))
+	if !m.Migrating() {
+		t.Error("the migration should be in progress")
+	}
+	if !m.Test([]byte("before")) || !m.Test([]byte("during")) {
+		t.Error("keys added before and during the migration should be in")
+	}
+	if !old.TestString("during") || !m.Filter().TestString("during") {
+		t.Error("writes should go to both filters")
+	}
+	if m.TestAndAdd([]byte("also during")) {
+		t.Error("'also during' should not be in the first time we look")
+	}
+	if !m.TestAndAdd([]byte("before")) {
+		t.Error("'before' should be in")
+	}
+
+	now = now.Add(2 * time.Hour)
+	if m.Migrating() {
+		t.Error("the migration should be over")
+	}
+	if m.Test([]byte("before")) && !m.Filter().TestString("before") {
+		t.Error("the old filter should not be consulted anymore")
+	}
+	if !m.Test([]byte("during")) {
+		t.Error("'during' should be in")
+	}
+}
+
+func TestMigratorFinish(t *testing.T) {
+	old := New(1000, 4)
+	old.AddString("before")
+	m := NewMigrator(old, New(2000, 5), time.Hour)
+	m.Finish()
+	if m.Migrating() {
+		t.Error("the migration should be over")
+	}
+	if m.Test([]byte("before")) {
+		t.Error("'before' should not be in")
+	}
+	m.Add([]byte("after"))
+	if old.TestString("after") {
+		t.Error("writes should not go to the old filter")
+	}
+}
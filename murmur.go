@@ -41,7 +41,6 @@ package bloom
 import (
 	"encoding/binary"
 	"math/bits"
-	"unsafe"
 )
 
 const (
@@ -56,20 +55,25 @@ type digest128 struct {
 	h2 uint64 // Unfinalized running hash part 2.
 }
 
-// bmix will hash blocks (16 bytes)
+// bmix will hash blocks (16 bytes). The state is kept in registers and
+// the blocks are sliced off the data, which avoids bounds checks: hashing is
+// bound by the chain of dependencies between the blocks, which assembly
+// would not shorten.
 func (d *digest128) bmix(p []byte) {
-	nblocks := len(p) / block_size
-	for i := 0; i < nblocks; i++ {
-		b := (*[16]byte)(unsafe.Pointer(&p[i*block_size]))
-		k1, k2 := binary.LittleEndian.Uint64(b[:8]), binary.LittleEndian.Uint64(b[8:])
-		d.bmix_words(k1, k2)
+	h1, h2 := d.h1, d.h2
+	for ; len(p) >= block_size; p = p[block_size:] {
+		h1, h2 = mix128(h1, h2, binary.LittleEndian.Uint64(p), binary.LittleEndian.Uint64(p[8:]))
 	}
+	d.h1, d.h2 = h1, h2
 }
 
 // bmix_words will hash two 64-bit words (16 bytes)
 func (d *digest128) bmix_words(k1, k2 uint64) {
-	h1, h2 := d.h1, d.h2
+	d.h1, d.h2 = mix128(d.h1, d.h2, k1, k2)
+}
 
+// mix128 mixes a block of two 64-bit words into the state
+func mix128(h1, h2, k1, k2 uint64) (uint64, uint64) {
 	k1 *= c1_128
 	k1 = bits.RotateLeft64(k1, 31)
 	k1 *= c2_128
@@ -87,7 +91,7 @@ func (d *digest128) bmix_words(k1, k2 uint64) {
 	h2 = bits.RotateLeft64(h2, 31)
 	h2 += h1
 	h2 = h2*5 + 0x38495ab5
-	d.h1, d.h2 = h1, h2
+	return h1, h2
 }
 
 // sum128 computers two 64-bit hash value. It is assumed that
@@ -97,7 +101,7 @@ func (d *digest128) bmix_words(k1, k2 uint64) {
 // there is an extra element with value 1 appended to the tail.
 // The length parameter represents the full length of the data (including
 // the blocks of 16 bytes, and, if pad_tail is true, an extra byte).
-func (d *digest128) sum128(pad_tail bool, length uint, tail []byte) (h1, h2 uint64) {
+func (d *digest128) sum128(pad_tail bool, length uint64, tail []byte) (h1, h2 uint64) {
 	h1, h2 = d.h1, d.h2
 
 	var k1, k2 uint64
@@ -219,8 +223,8 @@ func (d *digest128) sum128(pad_tail bool, length uint, tail []byte) (h1, h2 uint
 		h1 ^= k1
 	}
 
-	h1 ^= uint64(length)
-	h2 ^= uint64(length)
+	h1 ^= length
+	h2 ^= length
 
 	h1 += h2
 	h2 += h1
@@ -255,16 +259,23 @@ func fmix64(k uint64) uint64 {
 //	         hasher.Write(a1) // #nosec
 //	         v3, v4 := hasher.Sum128()
 //
-// See TestHashRandom.
-func (d *digest128) sum256(data []byte) (hash1, hash2, hash3, hash4 uint64) {
-	// We always start from zero.
-	d.h1, d.h2 = 0, 0
+// See TestHashRandom. The seed initializes both halves of the state, like
+// the seed of the reference implementation; it is zero by default.
+func (d *digest128) sum256(data []byte, seed uint64) (hash1, hash2, hash3, hash4 uint64) {
+	// We always start from the seed, zero by default.
+	d.h1, d.h2 = seed, seed
 	// Process as many bytes as possible.
 	d.bmix(data)
+	length := uint64(len(data))
+	return d.finish256(data[length-length%block_size:], length)
+}
+
+// finish256 computes the 4 64-bit hash values of sum256 once bmix was called
+// on the complete blocks of 16 bytes of the data. The tail holds the
+// remaining bytes, fewer than 16, and length is the length of the data.
+func (d *digest128) finish256(tail []byte, length uint64) (hash1, hash2, hash3, hash4 uint64) {
 	// We have enough to compute the first two 64-bit numbers
-	length := uint(len(data))
-	tail_length := length % block_size
-	tail := data[length-tail_length:]
+	tail_length := uint64(len(tail))
 	hash1, hash2 = d.sum128(false, length, tail)
 	// Next we want to 'virtually' append 1 to the input, but,
 	// we do not want to append to an actual array!!!
@@ -277,7 +288,7 @@ func (d *digest128) sum256(data []byte) (hash1, hash2, hash3, hash4 uint64) {
 		word2 = word2 | (uint64(1) << 56)
 		// We process the resulting 2 words.
 		d.bmix_words(word1, word2)
-		tail := data[length:] // empty slice, deliberate.
+		tail := tail[tail_length:] // empty slice, deliberate.
 		hash3, hash4 = d.sum128(false, length+1, tail)
 	} else {
 		// We still have a tail (fewer than 15 bytes) but we
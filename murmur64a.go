@@ -0,0 +1,34 @@
+package bloom
+
+import "encoding/binary"
+
+// The MurmurHash64A algorithm of MurmurHash2, see
+// https://github.com/aappleby/smhasher. It is used by RedisBloom.
+const (
+	murmur64aM = 0xc6a4a7935bd1e995
+	murmur64aR = 47
+)
+
+// murmurHash64A returns the 64-bit MurmurHash64A of data with the given seed,
+// reading its words in little-endian order as on x86 and ARM.
+func murmurHash64A(data []byte, seed uint64) uint64 {
+	h := seed ^ uint64(len(data))*murmur64aM
+	for ; len(data) >= 8; data = data[8:] {
+		k := binary.LittleEndian.Uint64(data)
+		k *= murmur64aM
+		k ^= k >> murmur64aR
+		k *= murmur64aM
+		h ^= k
+		h *= murmur64aM
+	}
+	if len(data) > 0 {
+		for i := len(data) - 1; i >= 0; i-- {
+			h ^= uint64(data[i]) << (8 * uint(i))
+		}
+		h *= murmur64aM
+	}
+	h ^= h >> murmur64aR
+	h *= murmur64aM
+	h ^= h >> murmur64aR
+	return h
+}
@@ -2,6 +2,7 @@ package bloom
 
 import (
 	"math/rand"
+	"strconv"
 	"testing"
 
 	"github.com/twmb/murmur3"
@@ -17,7 +18,7 @@ func TestHashBasic(t *testing.T) {
 	for length := 0; length <= 1000; length++ {
 		data := bigdata[:length]
 		var d digest128
-		h1, h2, h3, h4 := d.sum256(data)
+		h1, h2, h3, h4 := d.sum256(data, 0)
 		//
 		a1 := []byte{1} // to grab another bit of data
 		hasher := murmur3.New128()
@@ -31,9 +32,27 @@ func TestHashBasic(t *testing.T) {
 	}
 }
 
+func TestHashSeed(t *testing.T) {
+	data := make([]byte, 100)
+	for length := 0; length <= 100; length++ {
+		rand.Read(data[:length])
+		seed := rand.Uint64()
+		var d digest128
+		h1, h2, h3, h4 := d.sum256(data[:length], seed)
+		hasher := murmur3.SeedNew128(seed, seed)
+		hasher.Write(data[:length]) // #nosec
+		v1, v2 := hasher.Sum128()
+		hasher.Write([]byte{1}) // #nosec
+		v3, v4 := hasher.Sum128()
+		if v1 != h1 || v2 != h2 || v3 != h3 || v4 != h4 {
+			t.Fatalf("seeded hash of %d bytes differs from murmur3", length)
+		}
+	}
+}
+
 func TestDocumentation(t *testing.T) {
 	filter := NewWithEstimates(10000, 0.01)
-	got := EstimateFalsePositiveRate(filter.m, filter.k, 10000)
+	got := SimulateFalsePositiveRate(filter.m, filter.k, 10000)
 	if got > 0.011 || got < 0.009 {
 		t.Errorf("Bad false positive rate %v", got)
 	}
@@ -48,7 +67,7 @@ func TestHashRandom(t *testing.T) {
 		for trial := 1; trial < 10; trial++ {
 			rand.Read(data)
 			var d digest128
-			h1, h2, h3, h4 := d.sum256(data)
+			h1, h2, h3, h4 := d.sum256(data, 0)
 			//
 			a1 := []byte{1} // to grab another bit of data
 			hasher := murmur3.New128()
@@ -62,3 +81,82 @@ func TestHashRandom(t *testing.T) {
 		}
 	}
 }
+
+func BenchmarkHash(b *testing.B) {
+	for _, size := range []int{4, 16, 64, 256, 1024} {
+		data := make([]byte, size)
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				baseHashes(data)
+			}
+		})
+	}
+}
+
+// hashingFilters returns a filter for each choice of hash functions
+func hashingFilters() []struct {
+	name string
+	f    *BloomFilter
+} {
+	keyedDouble := NewKeyed(10000, 7, [16]byte{1})
+	keyedDouble.scheme = SchemeDoubleHashing
+	return []struct {
+		name string
+		f    *BloomFilter
+	}{
+		{"default", New(10000, 7)},
+		{"seeded", NewWithSeed(10000, 7, 42)},
+		{"keyed", NewKeyed(10000, 7, [16]byte{1})},
+		{"double", NewWithScheme(10000, 7, SchemeDoubleHashing)},
+		{"keyed-double", keyedDouble},
+		{"fastrange", NewFastRange(10000, 7)},
+		{"pow2", New(8192, 7)},
+	}
+}
+
+// hashingSizes are key lengths around the blocks of 16 bytes of murmur3
+var hashingSizes = []int{0, 1, 15, 16, 17, 31, 32, 33, 100, 1024, 1 << 20}
+
+func TestHashingNoAllocation(t *testing.T) {
+	for _, c := range hashingFilters() {
+		name, f := c.name, c.f
+		for _, size := range hashingSizes {
+			key := make([]byte, size)
+			s := string(key)
+			allocs := testing.AllocsPerRun(10, func() {
+				f.Add(key)
+				f.Test(key)
+				f.TestAndAdd(key)
+				f.TestOrAdd(key)
+				f.TestString(s)
+				f.TestAndAddString(s)
+			})
+			if allocs != 0 {
+				t.Errorf("%s, %d bytes: got %v allocations", name, size, allocs)
+			}
+		}
+	}
+}
+
+// BenchmarkHashingAllocs measures Add and Test with each choice of hash
+// functions, and fails if they allocate.
+func BenchmarkHashingAllocs(b *testing.B) {
+	for _, c := range hashingFilters() {
+		for _, size := range []int{16, 100, 1024} {
+			f, key := c.f, make([]byte, size)
+			b.Run(c.name+"/"+strconv.Itoa(size), func(b *testing.B) {
+				if n := testing.AllocsPerRun(10, func() { f.TestAndAdd(key) }); n != 0 {
+					b.Fatalf("TestAndAdd allocates %v times", n)
+				}
+				b.ReportAllocs()
+				b.SetBytes(int64(size))
+				for i := 0; i < b.N; i++ {
+					key[0] = byte(i)
+					f.Add(key)
+					f.Test(key)
+				}
+			})
+		}
+	}
+}
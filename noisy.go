@@ -0,0 +1,129 @@
+package bloom
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// ExportNoisy returns a copy of the filter in which each of the m bits is
+// flipped with probability 1/(1+exp(epsilon)), as in randomized response.
+// Each bit of the copy is then epsilon-differentially private; since an item
+// sets up to k bits, the guarantee for an item is k*epsilon. The filter itself
+// is left unchanged.
+//
+// The noisy copy has both false positives and false negatives: serialize and
+// share it, but do not use it for exact membership queries. Randomness comes
+// from crypto/rand.
+func (f *BloomFilter) ExportNoisy(epsilon float64) (*BloomFilter, error) {
+	if !(epsilon >= 0) {
+		return nil, errors.New("bloom: epsilon must be non-negative")
+	}
+	g := f.Copy()
+	p := 1 / (1 + math.Exp(epsilon))
+	if p == 0 {
+		return g, nil
+	}
+	// The gaps between flipped bits follow a geometric distribution.
+	logq := math.Log1p(-p)
+	for i := uint64(0); ; i++ {
+		u, err := randomFloat()
+		if err != nil {
+			return nil, err
+		}
+		skip := math.Floor(math.Log(u) / logq)
+		if skip >= float64(uint64(g.m)-i) {
+			break
+		}
+		i += uint64(skip)
+		g.b.Flip(uint(i))
+	}
+	return g, nil
+}
+
+// randomFloat returns a uniform number in (0, 1] from crypto/rand.
+func randomFloat() (float64, error) {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return 0, err
+	}
+	return float64(binary.LittleEndian.Uint64(buf[:])>>11+1) / (1 << 53), nil
+}
+
+// NoisyFlipProbability returns the probability with which ExportNoisy flips
+// each bit, 1/(1+exp(epsilon)).
+func NoisyFlipProbability(epsilon float64) float64 {
+	return 1 / (1 + math.Exp(epsilon))
+}
+
+// The Denoised estimators are meant for the recipient of a filter exported
+// by ExportNoisy with a known epsilon: they correct aggregate statistics for
+// the flipped bits, as in RAPPOR. A bit observed set is counted as
+// (1-p)/(1-2p), and a bit observed clear as -p/(1-2p), where p is the flip
+// probability, so that the expected count of a bit is its value in the
+// original filter. The estimates are unbiased but noisy, more so for small
+// epsilons; with epsilon = 0, the export carries no information and they
+// return NaN.
+
+// DenoisedBitsSet returns an estimate of the number of bits set in the
+// original of a filter exported by ExportNoisy.
+func (f *BloomFilter) DenoisedBitsSet(epsilon float64) float64 {
+	p := NoisyFlipProbability(epsilon)
+	if !(p < 0.5) {
+		return math.NaN()
+	}
+	return (float64(f.b.Count()) - p*float64(f.m)) / (1 - 2*p)
+}
+
+// DenoisedSize returns an estimate of the number of items in the original of
+// a filter exported by ExportNoisy, as ApproximatedSize does for the bits
+// set estimated by DenoisedBitsSet.
+func (f *BloomFilter) DenoisedSize(epsilon float64) float64 {
+	x := f.DenoisedBitsSet(epsilon)
+	if math.IsNaN(x) {
+		return x
+	}
+	m := float64(f.m)
+	x = math.Max(0, math.Min(x, m-1))
+	return -m / float64(f.k) * math.Log(1-x/m)
+}
+
+// DenoisedMatches returns an estimate of the number of keys for which Test
+// returns true on the original of a filter exported by ExportNoisy, e.g., to
+// estimate the size of the intersection of a list of keys with the set of
+// the filter. The estimate of each key is the product of the estimates of
+// its distinct locations, whose variance grows exponentially with k: it is
+// only meaningful over many keys.
+func (f *BloomFilter) DenoisedMatches(keys [][]byte, epsilon float64) float64 {
+	p := NoisyFlipProbability(epsilon)
+	if !(p < 0.5) {
+		return math.NaN()
+	}
+	set, clear := (1-p)/(1-2*p), -p/(1-2*p)
+	locations := make([]uint, 0, f.k)
+	total := 0.0
+	for _, key := range keys {
+		h := f.hashes(key)
+		locations = locations[:0]
+		estimate := 1.0
+	probes:
+		for i := uint(0); i < f.k; i++ {
+			l := f.location(h, i)
+			// The noise of a location counted twice would bias the product.
+			for _, seen := range locations {
+				if seen == l {
+					continue probes
+				}
+			}
+			locations = append(locations, l)
+			if f.b.Test(l) {
+				estimate *= set
+			} else {
+				estimate *= clear
+			}
+		}
+		total += estimate
+	}
+	return total
+}
@@ -0,0 +1,85 @@
+package bloom
+
+import (
+	"math"
+	"testing"
+)
+
+func TestExportNoisy(t *testing.T) {
+	f := New(100000, 4)
+	for i := uint(0); i < 100000; i += 2 {
+		f.b.Set(i)
+	}
+	before := f.b.Clone()
+	g, err := f.ExportNoisy(math.Log(3)) // flip probability 1/4
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.b.Equal(before) {
+		t.Error("the filter should be unchanged")
+	}
+	if g.Cap() != f.Cap() || g.K() != f.K() {
+		t.Error("the noisy copy should have the same parameters")
+	}
+	flipped := float64(g.b.SymmetricDifferenceCardinality(f.b)) / float64(f.m)
+	if flipped < 0.24 || flipped > 0.26 {
+		t.Errorf("unexpected fraction of flipped bits %v", flipped)
+	}
+	if g.b.Len() != f.b.Len() {
+		t.Error("bits beyond m should not be flipped")
+	}
+}
+
+func TestExportNoisyExtremes(t *testing.T) {
+	f := New(1000, 4)
+	f.AddString("Love")
+	g, err := f.ExportNoisy(math.Inf(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !g.Equal(f) {
+		t.Error("an infinite epsilon should not add noise")
+	}
+	if _, err := f.ExportNoisy(-1); err == nil {
+		t.Error("expected an error for a negative epsilon")
+	}
+	if _, err := f.ExportNoisy(math.NaN()); err == nil {
+		t.Error("expected an error for NaN")
+	}
+}
+
+func TestDenoised(t *testing.T) {
+	const n = 10000
+	f := NewWithEstimates(n, 0.01)
+	keys := batchKeys(n, 0)
+	f.AddBatch(keys)
+	epsilon := 2.0
+	g, err := f.ExportNoisy(epsilon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NoisyFlipProbability(epsilon)
+	if p != 1/(1+math.Exp(2)) {
+		t.Errorf("unexpected flip probability %v", p)
+	}
+	// The tolerances are about five standard deviations.
+	bits := g.DenoisedBitsSet(epsilon)
+	if sd := math.Sqrt(float64(f.m)*p*(1-p)) / (1 - 2*p); math.Abs(bits-float64(f.b.Count())) > 5*sd {
+		t.Errorf("estimated %v bits set, expected %d", bits, f.b.Count())
+	}
+	if size := g.DenoisedSize(epsilon); math.Abs(size-n) > 0.05*n {
+		t.Errorf("estimated %v items, expected %d", size, n)
+	}
+	candidates := append(batchKeys(1000, 0), batchKeys(1000, n)...)
+	if matches := g.DenoisedMatches(candidates, epsilon); math.Abs(matches-1000) > 250 {
+		t.Errorf("estimated %v matches, expected about 1000", matches)
+	}
+	if !math.IsNaN(g.DenoisedBitsSet(0)) || !math.IsNaN(g.DenoisedSize(0)) || !math.IsNaN(g.DenoisedMatches(candidates, 0)) {
+		t.Error("the estimates should be NaN without information")
+	}
+	// Without noise, the estimates are exact.
+	if f.DenoisedBitsSet(math.Inf(1)) != float64(f.b.Count()) ||
+		f.DenoisedMatches(candidates[:1000], math.Inf(1)) != 1000 {
+		t.Error("the estimates should be exact without noise")
+	}
+}
@@ -0,0 +1,173 @@
+package bloom
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ErrUnachievable is returned by NewWithOptions, with WithStrict, when the
+// limits set by the options do not allow the requested false positive rate
+var ErrUnachievable = errors.New("bloom: the false positive rate cannot be achieved within the limits")
+
+// options are the parameters of NewWithOptions
+type options struct {
+	minBits   uint
+	maxBits   uint
+	multiple  uint
+	pow2      bool
+	maxHashes uint
+	strict    bool
+	hashing
+	fastRange bool
+
+	compactThreshold float64
+	compactPeriod    time.Duration
+}
+
+// An Option sets a parameter of a filter created by NewWithOptions
+type Option func(*options)
+
+// WithMinBits sets the minimum number of bits of the filter. Very small
+// filters, for a handful of items with a low false positive rate, have more
+// false positives than EstimateFalsePositiveRate predicts: a minimum of a few
+// hundred bits avoids them.
+func WithMinBits(m uint) Option {
+	return func(o *options) { o.minBits = m }
+}
+
+// WithMaxBits sets the maximum number of bits of the filter
+func WithMaxBits(m uint) Option {
+	return func(o *options) { o.maxBits = m }
+}
+
+// WithRoundUp rounds the number of bits of the filter up to a multiple of
+// the given number, for instance 64 so that the last word is not partly
+// used. The maximum number of bits is rounded down to it. WithPow2 takes
+// precedence.
+func WithRoundUp(multiple uint) Option {
+	return func(o *options) { o.multiple = multiple }
+}
+
+// WithPow2 rounds the number of bits of the filter up to a power of two, see
+// NewPow2. The maximum number of bits is rounded down to one.
+func WithPow2() Option {
+	return func(o *options) { o.pow2 = true }
+}
+
+// WithMaxHashes sets the maximum number of hash functions of the filter,
+// which bounds the time taken by Add and Test
+func WithMaxHashes(k uint) Option {
+	return func(o *options) { o.maxHashes = k }
+}
+
+// WithStrict makes NewWithOptions return ErrUnachievable, instead of a
+// filter with a higher false positive rate, when the maximum number of bits
+// or of hash functions does not allow the requested rate
+func WithStrict() Option {
+	return func(o *options) { o.strict = true }
+}
+
+// WithSeed sets the murmur3 seed of the filter, see NewWithSeed
+func WithSeed(seed uint64) Option {
+	return func(o *options) { o.seed = seed }
+}
+
+// WithKey selects the SipHash hash functions with the given key, see
+// NewKeyed
+func WithKey(key [16]byte) Option {
+	return func(o *options) { o.key = newSipKey(key) }
+}
+
+// WithScheme sets the location scheme of the filter, see NewWithScheme
+func WithScheme(scheme LocationScheme) Option {
+	return func(o *options) { o.scheme = scheme }
+}
+
+// WithFastRange maps locations to bits with a multiplication, see
+// NewFastRange
+func WithFastRange() Option {
+	return func(o *options) { o.fastRange = true }
+}
+
+// WithAutoCompact makes a filter created by NewCompacting fold itself in
+// half when it has held fewer than threshold times the keys it is sized for
+// during period, see CompactingBloomFilter. The threshold must be within
+// (0, 1), and at most 0.5 so that folding does not raise the false positive
+// rate. NewWithOptions ignores it.
+func WithAutoCompact(threshold float64, period time.Duration) Option {
+	return func(o *options) {
+		o.compactThreshold = threshold
+		o.compactPeriod = period
+	}
+}
+
+// NewWithOptions creates a new Bloom filter for about n items with fp false
+// positive rate, as NewWithEstimates does, within the limits set by the
+// options. It returns an error if n is 0, if fp is not within (0, 1), or if
+// the options contradict each other.
+//
+// Once m is chosen, k is the number of hash functions which minimizes the
+// false positive rate of m bits, up to the maximum set by WithMaxHashes.
+// When the limits do not allow the rate fp, the filter has a higher rate,
+// unless WithStrict is given.
+func NewWithOptions(n uint, fp float64, opts ...Option) (*BloomFilter, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if n == 0 {
+		return nil, errors.New("bloom: the number of items must be positive")
+	}
+	if !(fp > 0 && fp < 1) {
+		return nil, fmt.Errorf("bloom: the false positive rate %v is not within (0, 1)", fp)
+	}
+	if o.multiple == 0 || o.pow2 {
+		o.multiple = 1
+	}
+	maxBits := o.maxBits
+	if maxBits == 0 {
+		maxBits = ^uint(0)
+	}
+	maxBits -= maxBits % o.multiple
+	if o.pow2 {
+		maxBits = roundUpPow2(maxBits/2 + 1)
+	}
+	if maxBits == 0 || o.minBits > maxBits {
+		return nil, fmt.Errorf("bloom: the minimum number of bits %d is larger than the maximum %d", o.minBits, maxBits)
+	}
+
+	wantBits, wantHashes := EstimateParameters(n, fp)
+	m := max(wantBits, o.minBits)
+	if r := m % o.multiple; r != 0 && m <= maxBits-(o.multiple-r) {
+		m += o.multiple - r
+	}
+	if o.pow2 && m <= maxBits {
+		m = roundUpPow2(m)
+	}
+	if m > maxBits {
+		m = maxBits
+	}
+	k := optimalHashes(m, n)
+	if o.maxHashes > 0 && k > o.maxHashes {
+		k = o.maxHashes
+	}
+	if o.strict && EstimateFalsePositiveRate(m, k, n) > EstimateFalsePositiveRate(wantBits, wantHashes, n) {
+		return nil, fmt.Errorf("%w: %d bits and %d hash functions give a rate of %v", ErrUnachievable, m, k, EstimateFalsePositiveRate(m, k, n))
+	}
+	f := New(m, k)
+	f.hashing = o.hashing
+	f.fastRange = o.fastRange
+	return f, nil
+}
+
+// optimalHashes returns the number of hash functions which minimizes the
+// false positive rate of m bits holding n items
+func optimalHashes(m, n uint) uint {
+	k := max(1, uint(math.Floor(math.Log(2)*float64(m)/float64(n))))
+	if EstimateFalsePositiveRate(m, k+1, n) < EstimateFalsePositiveRate(m, k, n) {
+		k++
+	}
+	return k
+}
@@ -0,0 +1,88 @@
+package bloom
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	f, err := NewWithOptions(1000, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := EstimateParameters(1000, 0.01); f.Cap() != m || f.K() != 7 {
+		t.Errorf("m = %d, k = %d, should be as NewWithEstimates", f.Cap(), f.K())
+	}
+
+	// A tiny filter is grown to the minimum, and its hashes capped.
+	f, err = NewWithOptions(1, 1e-9, WithMinBits(512), WithMaxHashes(8))
+	if err != nil || f.Cap() != 512 || f.K() != 8 {
+		t.Errorf("m = %v, k = %v, err = %v", f.Cap(), f.K(), err)
+	}
+	f, err = NewWithOptions(1000, 0.01, WithRoundUp(64))
+	if err != nil || f.Cap() != 9600 {
+		t.Errorf("m = %v, err = %v, should be rounded up to 9600", f.Cap(), err)
+	}
+	f, err = NewWithOptions(1000, 0.01, WithPow2(), WithRoundUp(3))
+	if err != nil || f.Cap() != 16384 {
+		t.Errorf("m = %v, err = %v, should be rounded up to 16384", f.Cap(), err)
+	}
+	f, err = NewWithOptions(1000, 0.01, WithPow2(), WithMaxBits(10000))
+	if err != nil || f.Cap() != 8192 {
+		t.Errorf("m = %v, err = %v, should be capped at 8192", f.Cap(), err)
+	}
+
+	// The limits may not allow the rate, which WithStrict reports.
+	f, err = NewWithOptions(1000, 0.01, WithMaxBits(5000), WithRoundUp(64))
+	if err != nil || f.Cap() != 4992 || f.K() != optimalHashes(4992, 1000) {
+		t.Errorf("m = %v, k = %v, err = %v", f.Cap(), f.K(), err)
+	}
+	for _, opts := range [][]Option{
+		{WithMaxBits(5000)},
+		{WithMaxHashes(2)},
+	} {
+		if _, err := NewWithOptions(1000, 0.01, append(opts, WithStrict())...); !errors.Is(err, ErrUnachievable) {
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+	if _, err := NewWithOptions(1000, 0.01, WithMaxHashes(7), WithMinBits(20000), WithStrict()); err != nil {
+		t.Errorf("more bits should make up for fewer hashes: %v", err)
+	}
+
+	for _, c := range []struct {
+		n    uint
+		fp   float64
+		opts []Option
+	}{
+		{0, 0.01, nil},
+		{1000, 0, nil},
+		{1000, 1, nil},
+		{1000, 0.01, []Option{WithMinBits(2000), WithMaxBits(1000)}},
+		{1000, 0.01, []Option{WithMaxBits(100), WithRoundUp(128)}},
+	} {
+		if _, err := NewWithOptions(c.n, c.fp, c.opts...); err == nil {
+			t.Errorf("n = %d, fp = %v: an error was expected", c.n, c.fp)
+		}
+	}
+}
+
+func TestNewWithOptionsHashing(t *testing.T) {
+	key := [16]byte{1, 2, 3}
+	for _, c := range []struct {
+		opt Option
+		g   *BloomFilter
+	}{
+		{WithSeed(42), NewWithSeed(9586, 7, 42)},
+		{WithKey(key), NewKeyed(9586, 7, key)},
+		{WithScheme(SchemeDoubleHashing), NewWithScheme(9586, 7, SchemeDoubleHashing)},
+		{WithFastRange(), NewFastRange(9586, 7)},
+	} {
+		f, err := NewWithOptions(1000, 0.01, c.opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !f.AddString("Love").Equal(c.g.AddString("Love")) {
+			t.Error("the options should select the hash functions")
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/bits-and-blooms/bitset"
+)
+
+// A PartitionedBloomFilter is a Bloom filter whose _m_ bits are split into
+// _k_ partitions of m/k bits, the ith hash function of a key setting a bit
+// of the ith partition only, as described by Almeida et al., "Scalable Bloom
+// Filters" (2007). Each key sets exactly k bits, so the fill of the
+// partitions, and the false positive rate, are more predictable; partitions
+// can be processed independently, e.g., in parallel, and the layout is the
+// one several other tools exchange.
+//
+// Partition i holds the bits from i*m/k to (i+1)*m/k-1 of the bitset. The
+// false positive rate is about that of a BloomFilter with the same _m_ and
+// _k_.
+type PartitionedBloomFilter struct {
+	m    uint
+	k    uint
+	size uint // bits per partition
+	b    *bitset.BitSet
+}
+
+// NewPartitioned creates a new partitioned Bloom filter with _m_ bits,
+// rounded up to a multiple of _k_, and _k_ hashing functions. We force _m_
+// and _k_ to be at least one bit per partition and one function.
+func NewPartitioned(m uint, k uint) *PartitionedBloomFilter {
+	k = max(1, k)
+	size := max(1, (m+k-1)/k)
+	return &PartitionedBloomFilter{m: size * k, k: k, size: size, b: bitset.New(size * k)}
+}
+
+// NewPartitionedWithEstimates creates a new partitioned Bloom filter for
+// about n items with fp false positive rate
+func NewPartitionedWithEstimates(n uint, fp float64) *PartitionedBloomFilter {
+	m, k := EstimateParameters(n, fp)
+	return NewPartitioned(m, k)
+}
+
+// Cap returns the capacity, _m_, of a partitioned Bloom filter
+func (f *PartitionedBloomFilter) Cap() uint {
+	return f.m
+}
+
+// K returns the number of hash functions, and of partitions, of the
+// PartitionedBloomFilter
+func (f *PartitionedBloomFilter) K() uint {
+	return f.k
+}
+
+// PartitionSize returns the number of bits of each partition, m/k
+func (f *PartitionedBloomFilter) PartitionSize() uint {
+	return f.size
+}
+
+// BitSet returns the underlying bitset for this filter.
+func (f *PartitionedBloomFilter) BitSet() *bitset.BitSet {
+	return f.b
+}
+
+// location returns the ith location of a key, in the ith partition
+func (f *PartitionedBloomFilter) location(h [4]uint64, i uint) uint {
+	return i*f.size + uint(location(h, i)%uint64(f.size))
+}
+
+// Add data to the Bloom Filter. Returns the filter (allows chaining)
+func (f *PartitionedBloomFilter) Add(data []byte) *PartitionedBloomFilter {
+	h := baseHashes(data)
+	for i := uint(0); i < f.k; i++ {
+		f.b.Set(f.location(h, i))
+	}
+	return f
+}
+
+// AddString to the Bloom Filter. Returns the filter (allows chaining)
+func (f *PartitionedBloomFilter) AddString(data string) *PartitionedBloomFilter {
+	return f.Add(stringToBytes(data))
+}
+
+// Test returns true if the data is in the PartitionedBloomFilter, false
+// otherwise. If true, the result might be a false positive. If false, the
+// data is definitely not in the set.
+func (f *PartitionedBloomFilter) Test(data []byte) bool {
+	h := baseHashes(data)
+	for i := uint(0); i < f.k; i++ {
+		if !f.b.Test(f.location(h, i)) {
+			return false
+		}
+	}
+	return true
+}
+
+// TestString returns true if the string is in the PartitionedBloomFilter,
+// false otherwise. If true, the result might be a false positive. If false,
+// the data is definitely not in the set.
+func (f *PartitionedBloomFilter) TestString(data string) bool {
+	return f.Test(stringToBytes(data))
+}
+
+// TestAndAdd is equivalent to calling Test(data) then Add(data).
+// Returns the result of Test.
+func (f *PartitionedBloomFilter) TestAndAdd(data []byte) bool {
+	h := baseHashes(data)
+	present := true
+	for i := uint(0); i < f.k; i++ {
+		l := f.location(h, i)
+		if !f.b.Test(l) {
+			present = false
+			f.b.Set(l)
+		}
+	}
+	return present
+}
+
+// PartitionFillRatio returns the fraction of the bits of the ith partition
+// which are set. A key sets one bit of each partition, so their fill ratios
+// are about the same; the false positive rate is their product.
+func (f *PartitionedBloomFilter) PartitionFillRatio(i uint) float64 {
+	count, end := 0, (i+1)*f.size
+	for j, ok := f.b.NextSet(i * f.size); ok && j < end; j, ok = f.b.NextSet(j + 1) {
+		count++
+	}
+	return float64(count) / float64(f.size)
+}
+
+// Merge the data from two partitioned Bloom filters.
+func (f *PartitionedBloomFilter) Merge(g *PartitionedBloomFilter) error {
+	if f.m != g.m {
+		return fmt.Errorf("m's don't match: %d != %d", f.m, g.m)
+	}
+	if f.k != g.k {
+		return fmt.Errorf("k's don't match: %d != %d", f.k, g.k)
+	}
+	f.b.InPlaceUnion(g.b)
+	return nil
+}
+
+// ClearAll clears all the data in a partitioned Bloom filter, removing all
+// keys
+func (f *PartitionedBloomFilter) ClearAll() *PartitionedBloomFilter {
+	f.b.ClearAll()
+	return f
+}
+
+// Equal tests for the equality of two partitioned Bloom filters
+func (f *PartitionedBloomFilter) Equal(g *PartitionedBloomFilter) bool {
+	return f.m == g.m && f.k == g.k && f.b.Equal(g.b)
+}
+
+// WriteTo writes a binary representation of the PartitionedBloomFilter to an
+// i/o stream: m and k followed by the words of the bitset, all as big-endian
+// 64-bit words. It returns the number of bytes written.
+func (f *PartitionedBloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	err := binary.Write(stream, binary.BigEndian, [2]uint64{uint64(f.m), uint64(f.k)})
+	if err != nil {
+		return 0, err
+	}
+	words := f.b.Words()
+	err = binary.Write(stream, binary.BigEndian, words)
+	if err != nil {
+		return 16, err
+	}
+	return int64(8 * (2 + len(words))), nil
+}
+
+// ReadFrom reads a binary representation of the PartitionedBloomFilter (such
+// as might have been written by WriteTo()) from an i/o stream. It returns the
+// number of bytes read.
+func (f *PartitionedBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	var parameters [2]uint64
+	err := binary.Read(stream, binary.BigEndian, &parameters)
+	if err != nil {
+		return 0, err
+	}
+	m, k := parameters[0], parameters[1]
+	if m == 0 || k == 0 || m%k != 0 || uint64(uint(m)) != m {
+		return 0, fmt.Errorf("bloom: invalid parameters m=%d k=%d", m, k)
+	}
+	words, err := readUint64s(stream, (m+63)/64, binary.BigEndian)
+	if err != nil {
+		return 0, err
+	}
+	*f = PartitionedBloomFilter{m: uint(m), k: uint(k), size: uint(m / k), b: bitset.FromWithLength(uint(m), words)}
+	return int64(8 * (2 + len(words))), nil
+}
+
+// MarshalBinary implements binary.BinaryMarshaler interface.
+func (f *PartitionedBloomFilter) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := f.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements binary.BinaryUnmarshaler interface.
+func (f *PartitionedBloomFilter) UnmarshalBinary(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := f.ReadFrom(buf)
+
+	return err
+}
@@ -0,0 +1,89 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func TestPartitionedBasic(t *testing.T) {
+	f := NewPartitioned(1000, 3)
+	if f.Cap() != 1002 || f.K() != 3 || f.PartitionSize() != 334 {
+		t.Errorf("unexpected parameters %d %d %d", f.Cap(), f.K(), f.PartitionSize())
+	}
+	if f.TestAndAdd([]byte("Love")) || !f.TestAndAdd([]byte("Love")) || !f.TestString("Love") {
+		t.Error("Love should only be found once added")
+	}
+	if f.TestString("Hate") {
+		t.Error("Hate should not be in the filter")
+	}
+	// A key sets one bit in each partition.
+	for i := uint(0); i < f.K(); i++ {
+		if r := f.PartitionFillRatio(i); r != 1.0/334 {
+			t.Errorf("partition %d: unexpected fill ratio %v", i, r)
+		}
+	}
+	if f.BitSet().Count() != 3 {
+		t.Errorf("unexpected bits set %d", f.BitSet().Count())
+	}
+	if NewPartitioned(0, 0).Cap() != 1 {
+		t.Error("the filter should have at least one bit")
+	}
+}
+
+func TestPartitionedFPP(t *testing.T) {
+	const n = 10000
+	f := NewPartitionedWithEstimates(n, 0.01)
+	keys := batchKeys(n, 0)
+	for _, key := range keys {
+		f.Add(key)
+	}
+	for _, key := range keys {
+		if !f.Test(key) {
+			t.Fatalf("%v should be in the filter", key)
+		}
+	}
+	fp := 0
+	for _, key := range batchKeys(n, n) {
+		if f.Test(key) {
+			fp++
+		}
+	}
+	rate := float64(fp) / n
+	expected := math.Pow(f.PartitionFillRatio(0), float64(f.K()))
+	if rate > 0.015 || math.Abs(rate-expected) > 0.005 {
+		t.Errorf("false positive rate %v, expected about %v", rate, expected)
+	}
+}
+
+func TestPartitionedMergeEncodeDecode(t *testing.T) {
+	f := NewPartitionedWithEstimates(1000, 0.01).AddString("a")
+	g := NewPartitionedWithEstimates(1000, 0.01).AddString("b")
+	if err := f.Merge(g); err != nil || !f.TestString("b") {
+		t.Errorf("Merge should add the keys of g (%v)", err)
+	}
+	if f.Merge(NewPartitioned(1000, 3)) == nil {
+		t.Error("filters with different parameters should not be merged")
+	}
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &PartitionedBloomFilter{}
+	if err := h.UnmarshalBinary(data); err != nil || !h.Equal(f) {
+		t.Errorf("the filter should be decoded (%v)", err)
+	}
+	if h.ClearAll().TestString("a") || h.Equal(f) {
+		t.Error("ClearAll should remove the keys")
+	}
+	for _, data := range [][]byte{data[:len(data)-1], data[:10]} {
+		if (&PartitionedBloomFilter{}).UnmarshalBinary(data) == nil {
+			t.Error("truncated data should be rejected")
+		}
+	}
+	binary.BigEndian.PutUint64(data[8:], uint64(f.Cap())+1) // k does not divide m
+	if _, err := (&PartitionedBloomFilter{}).ReadFrom(bytes.NewReader(data)); err == nil {
+		t.Error("invalid parameters should be rejected")
+	}
+}
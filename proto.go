@@ -0,0 +1,171 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/bits-and-blooms/bitset"
+)
+
+// Field numbers of the BloomFilter message of bloom.proto
+const (
+	protoM         = 1
+	protoK         = 2
+	protoHash      = 3
+	protoSeed      = 4
+	protoReduction = 5
+	protoLength    = 6
+	protoWords     = 7
+	protoScheme    = 8
+)
+
+// Wire types of protocol buffers
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+var errInvalidProto = errors.New("bloom: invalid protocol buffers message")
+
+// MarshalProto encodes the filter as a BloomFilter message of bloom.proto,
+// in the protocol buffers wire format, so that it can be decoded by code
+// generated from bloom.proto, or embedded in a message as a bytes field. As
+// in the binary format, the key of keyed filters is not encoded.
+func (f *BloomFilter) MarshalProto() ([]byte, error) {
+	words := f.b.Words()
+	buf := make([]byte, 0, 7*11+binary.MaxVarintLen64+8*len(words))
+	buf = appendProtoVarint(buf, protoM, uint64(f.m))
+	buf = appendProtoVarint(buf, protoK, uint64(f.k))
+	if f.key != nil {
+		buf = appendProtoVarint(buf, protoHash, hashSipHash)
+	}
+	buf = appendProtoVarint(buf, protoSeed, f.seed)
+	if f.fastRange {
+		buf = appendProtoVarint(buf, protoReduction, rangeFastRange)
+	}
+	buf = appendProtoVarint(buf, protoScheme, uint64(f.scheme))
+	buf = appendProtoVarint(buf, protoLength, uint64(f.b.Len()))
+	if len(words) > 0 {
+		buf = appendUvarint(buf, protoWords<<3|protoBytes)
+		buf = appendUvarint(buf, uint64(8*len(words)))
+		for _, w := range words {
+			buf = append(buf, 0, 0, 0, 0, 0, 0, 0, 0)
+			binary.LittleEndian.PutUint64(buf[len(buf)-8:], w)
+		}
+	}
+	return buf, nil
+}
+
+// appendProtoVarint appends a varint field, unless it has the default value
+func appendProtoVarint(buf []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return buf
+	}
+	buf = appendUvarint(buf, uint64(field)<<3|protoVarint)
+	return appendUvarint(buf, v)
+}
+
+// appendUvarint appends a varint
+func appendUvarint(buf []byte, v uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+// UnmarshalProto decodes a BloomFilter message of bloom.proto, such as
+// encoded by MarshalProto. Unknown fields are skipped. Like ReadFrom, it
+// decodes keyed filters only into filters created with NewKeyed.
+func (f *BloomFilter) UnmarshalProto(data []byte) error {
+	var h header
+	var length uint64
+	var words []uint64
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 || tag>>3 == 0 {
+			return errInvalidProto
+		}
+		data = data[n:]
+		field, wire := tag>>3, tag&7
+		var v uint64
+		var value []byte
+		switch wire {
+		case protoVarint:
+			v, n = binary.Uvarint(data)
+			if n <= 0 {
+				return errInvalidProto
+			}
+		case protoFixed64:
+			if len(data) < 8 {
+				return errInvalidProto
+			}
+			v, n = binary.LittleEndian.Uint64(data), 8
+		case protoBytes:
+			size, m := binary.Uvarint(data)
+			if m <= 0 || size > uint64(len(data)-m) {
+				return errInvalidProto
+			}
+			value, n = data[m:m+int(size)], m+int(size)
+		case protoFixed32:
+			if len(data) < 4 {
+				return errInvalidProto
+			}
+			n = 4
+		default:
+			return errInvalidProto
+		}
+		data = data[n:]
+
+		switch {
+		case field == protoM && wire == protoVarint:
+			h.m = v
+		case field == protoK && wire == protoVarint:
+			h.k = v
+		case field == protoHash && wire == protoVarint:
+			if v > hashSipHash {
+				return errInvalidProto
+			}
+			h.keyed = v == hashSipHash
+		case field == protoSeed && wire == protoVarint:
+			h.seed = v
+		case field == protoReduction && wire == protoVarint:
+			if v > rangeFastRange {
+				return errInvalidProto
+			}
+			h.fastRange = v == rangeFastRange
+		case field == protoLength && wire == protoVarint:
+			length = v
+		case field == protoScheme && wire == protoVarint:
+			if v > uint64(SchemeDoubleHashing) {
+				return errInvalidProto
+			}
+			h.scheme = LocationScheme(v)
+		case field == protoWords && wire == protoFixed64:
+			words = append(words, v)
+		case field == protoWords && wire == protoBytes:
+			// packed
+			if len(value)%8 != 0 {
+				return errInvalidProto
+			}
+			for ; len(value) > 0; value = value[8:] {
+				words = append(words, binary.LittleEndian.Uint64(value))
+			}
+		case field <= protoScheme:
+			return errInvalidProto
+		}
+	}
+	if h.m > uint64(^uint(0)) || h.k > uint64(^uint(0)) || length/64+(length%64+63)/64 != uint64(len(words)) {
+		return errInvalidProto
+	}
+	if err := f.checkKeyed(h.keyed); err != nil {
+		return err
+	}
+	f.changedAll()
+	f.m = uint(h.m)
+	f.k = uint(h.k)
+	f.b = bitset.FromWithLength(uint(length), words)
+	f.seed = h.seed
+	f.fastRange = h.fastRange
+	f.scheme = h.scheme
+	return nil
+}
@@ -0,0 +1,99 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"testing"
+)
+
+func TestProto(t *testing.T) {
+	for _, create := range []func() *BloomFilter{
+		func() *BloomFilter { return New(1, 1) },
+		func() *BloomFilter { return NewWithEstimates(1000, 0.01) },
+		func() *BloomFilter { return NewWithEstimatesAndSeed(1000, 0.01, 42) },
+		func() *BloomFilter { return NewFastRangeWithEstimates(1000, 0.01) },
+		func() *BloomFilter { return NewKeyed(1000, 7, [16]byte{1}) },
+		func() *BloomFilter { return FromWithM(make([]uint64, 2), 1000, 4) },
+	} {
+		f := create()
+		for i := uint32(0); i < 100; i++ {
+			f.AddUint32(i)
+		}
+		data, err := f.MarshalProto()
+		if err != nil {
+			t.Fatal(err)
+		}
+		g := create()
+		if err := g.UnmarshalProto(data); err != nil || !f.Equal(g) || f.b.Len() != g.b.Len() {
+			t.Errorf("%d, %d: protocol buffers round trip changed the filter: %v", f.m, f.k, err)
+		}
+	}
+
+	if data, _ := NewKeyed(1000, 7, [16]byte{1}).MarshalProto(); new(BloomFilter).UnmarshalProto(data) == nil {
+		t.Error("keyed filters should only be decoded into keyed filters")
+	}
+}
+
+func TestProtoWireFormat(t *testing.T) {
+	f := New(64, 3)
+	f.b.Set(1)
+	data, err := f.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// m=64, k=3, length=64, then the words, packed.
+	expected := "0840" + "1003" + "3040" + "3a08" + "0200000000000000"
+	if hex.EncodeToString(data) != expected {
+		t.Errorf("unexpected encoding %x", data)
+	}
+
+	for name, encoded := range map[string]string{
+		"unpacked words": "0840" + "1003" + "3040" + "39" + "0200000000000000",
+		"unknown fields": "0840" + "7801" + "1003" + "8501" + "01000000" + "3040" +
+			"a20102" + "ffff" + "3a08" + "0200000000000000",
+		"fields out of order": "3a08" + "0200000000000000" + "3040" + "1003" + "0840",
+	} {
+		data, _ := hex.DecodeString(encoded)
+		var g BloomFilter
+		if err := g.UnmarshalProto(data); err != nil || !g.Equal(f) {
+			t.Errorf("%s: unexpected filter: %v", name, err)
+		}
+	}
+
+	for name, encoded := range map[string]string{
+		"missing words":    "0840" + "1003" + "3040",
+		"too many words":   "0840" + "1003" + "3a08" + "0200000000000000",
+		"odd packed words": "0840" + "1003" + "3040" + "3a07" + "02000000000000",
+		"hash scheme":      "0840" + "1003" + "1802",
+		"range reduction":  "0840" + "1003" + "2802",
+		"wire type of m":   "0d" + "40000000",
+		"wire type 3":      "0b",
+		"field 0":          "0040",
+		"truncated varint": "08",
+		"truncated bytes":  "3a08" + "02",
+	} {
+		data, _ := hex.DecodeString(encoded)
+		var g BloomFilter
+		if err := g.UnmarshalProto(data); err == nil {
+			t.Errorf("%s should not be accepted", name)
+		}
+	}
+}
+
+func TestProtoSchema(t *testing.T) {
+	// The field numbers of bloom.proto match the encoder.
+	schema, err := os.ReadFile("bloom.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{
+		"uint64 m = 1;", "uint64 k = 2;", "HashScheme hash = 3;", "uint64 seed = 4;",
+		"RangeReduction reduction = 5;", "uint64 length = 6;", "repeated fixed64 words = 7;",
+		"HASH_SCHEME_SIPHASH = 1;", "RANGE_REDUCTION_FAST_RANGE = 1;",
+	} {
+		if !bytes.Contains(schema, []byte(field)) {
+			t.Errorf("bloom.proto should declare %q", field)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+//go:build purego
+// +build purego
+
+package bloom
+
+import (
+	"encoding/binary"
+	"runtime"
+)
+
+// pureGo is true when the package is built with the purego build tag, which
+// replaces the functions using unsafe with the ones of this file
+const pureGo = true
+
+// stringToBytes returns a copy of the bytes of a string. Hashing string keys
+// then allocates for keys longer than 32 bytes.
+func stringToBytes(s string) []byte {
+	return []byte(s)
+}
+
+// nativeOrder is the byte order of the platform
+var nativeOrder = func() binary.ByteOrder {
+	switch runtime.GOARCH {
+	case "armbe", "arm64be", "m68k", "mips", "mips64", "mips64p32", "ppc", "ppc64",
+		"s390", "s390x", "shbe", "sparc", "sparc64":
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}()
+
+// wordsToBytes returns a copy of the bytes of the words, in the byte order of
+// the platform
+func wordsToBytes(words []uint64) []byte {
+	if len(words) == 0 {
+		return nil
+	}
+	data := make([]byte, 8*len(words))
+	for i, w := range words {
+		nativeOrder.PutUint64(data[8*i:], w)
+	}
+	return data
+}
+
+// bytesToWords returns nil: the words cannot be used in place without unsafe
+func bytesToWords(data []byte) []uint64 {
+	return nil
+}
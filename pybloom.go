@@ -0,0 +1,258 @@
+package bloom
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+)
+
+// pyBloomHeaderSize is the size of the header of the files of pybloom, see
+// https://github.com/joseph-fox/python-bloomfilter
+const pyBloomHeaderSize = 40
+
+// A PyBloomFilter is a Bloom filter hashed and serialized as by the
+// BloomFilter of the pybloom and pybloom_live Python packages, so that
+// filters written by BloomFilter.tofile can be read, and filters written by
+// WriteTo can be read by BloomFilter.fromfile.
+//
+// The bits are split in one slice per hash function. Keys are hashed with
+// salted SHA-1, SHA-2 or, if all their hashes fit in 128 bits, MD5, as
+// pybloom does; releases of pybloom_live which use xxh128 instead of MD5 are
+// not supported.
+//
+// pybloom hashes the UTF-8 encoding of str keys, which Add and Test take,
+// and the UTF-8 encoding of str(key) for other keys: for instance, the
+// bytes b'abc' are hashed as "b'abc'" and the integer 42 as "42".
+type PyBloomFilter struct {
+	errorRate    float64
+	slices       uint64
+	bitsPerSlice uint64
+	capacity     uint64
+	count        uint64
+	bits         []byte
+	hash         func() hash.Hash
+	chunkSize    int
+	salts        [][]byte
+}
+
+// NewPyBloom creates a new filter as BloomFilter(capacity, errorRate) does.
+func NewPyBloom(capacity uint, errorRate float64) (*PyBloomFilter, error) {
+	if capacity == 0 || !(errorRate > 0 && errorRate < 1) {
+		return nil, fmt.Errorf("bloom: invalid pybloom capacity %d or error rate %v", capacity, errorRate)
+	}
+	slices := math.Ceil(math.Log(1/errorRate) / math.Log(2))
+	bitsPerSlice := math.Ceil(float64(capacity) * math.Abs(math.Log(errorRate)) / (slices * math.Ln2 * math.Ln2))
+	if slices*bitsPerSlice > float64(maxInt) {
+		return nil, fmt.Errorf("bloom: pybloom filter of %v bits is too large", slices*bitsPerSlice)
+	}
+	f := &PyBloomFilter{
+		errorRate:    errorRate,
+		slices:       uint64(slices),
+		bitsPerSlice: uint64(bitsPerSlice),
+		capacity:     uint64(capacity),
+	}
+	if err := f.setup(); err != nil {
+		return nil, err
+	}
+	f.bits = make([]byte, (f.slices*f.bitsPerSlice+7)/8)
+	return f, nil
+}
+
+// setup checks the size of the filter and prepares its hash functions, as
+// make_hashfuncs does
+func (f *PyBloomFilter) setup() error {
+	if f.slices == 0 || f.slices > maxReadHashes || f.bitsPerSlice == 0 ||
+		f.bitsPerSlice > uint64(maxInt)/f.slices {
+		return fmt.Errorf("bloom: invalid pybloom filter of %d slices of %d bits", f.slices, f.bitsPerSlice)
+	}
+	f.chunkSize = 2
+	if f.bitsPerSlice >= 1<<31 {
+		f.chunkSize = 8
+	} else if f.bitsPerSlice >= 1<<15 {
+		f.chunkSize = 4
+	}
+	switch bits := 8 * f.slices * uint64(f.chunkSize); {
+	case bits > 384:
+		f.hash = sha512.New
+	case bits > 256:
+		f.hash = sha512.New384
+	case bits > 160:
+		f.hash = sha256.New
+	case bits > 128:
+		f.hash = sha1.New
+	default:
+		f.hash = md5.New
+	}
+	// Each key is hashed after the hash of the index of the salt, and each
+	// hash yields several indices.
+	perSalt := uint64(f.hash().Size() / f.chunkSize)
+	f.salts = make([][]byte, (f.slices+perSalt-1)/perSalt)
+	for i := range f.salts {
+		var index [4]byte
+		binary.LittleEndian.PutUint32(index[:], uint32(i))
+		h := f.hash()
+		h.Write(index[:])
+		f.salts[i] = h.Sum(nil)
+	}
+	return nil
+}
+
+// each calls fn with the byte and mask of the bit of a key in each slice
+// until fn returns false
+func (f *PyBloomFilter) each(data []byte, fn func(i uint64, mask byte) bool) bool {
+	var offset uint64
+	h := f.hash()
+	var sum []byte
+	for _, salt := range f.salts {
+		h.Reset()
+		h.Write(salt)
+		h.Write(data)
+		sum = h.Sum(sum[:0])
+		for ; len(sum) >= f.chunkSize && offset < f.slices*f.bitsPerSlice; sum = sum[f.chunkSize:] {
+			var v uint64
+			switch f.chunkSize {
+			case 2:
+				v = uint64(binary.LittleEndian.Uint16(sum))
+			case 4:
+				v = uint64(binary.LittleEndian.Uint32(sum))
+			default:
+				v = binary.LittleEndian.Uint64(sum)
+			}
+			x := offset + v%f.bitsPerSlice
+			if !fn(x>>3, 1<<(x&7)) {
+				return false
+			}
+			offset += f.bitsPerSlice
+		}
+	}
+	return true
+}
+
+// Cap returns the number of bits of the filter
+func (f *PyBloomFilter) Cap() uint64 {
+	return f.slices * f.bitsPerSlice
+}
+
+// K returns the number of hash functions, that is of slices
+func (f *PyBloomFilter) K() uint64 {
+	return f.slices
+}
+
+// Count returns the number of keys added to the filter
+func (f *PyBloomFilter) Count() uint64 {
+	return f.count
+}
+
+// Add the data to the filter, as BloomFilter.add does. It returns true if
+// the key was not in the filter, and ErrFull if the filter holds more keys
+// than its capacity.
+func (f *PyBloomFilter) Add(data []byte) (bool, error) {
+	if f.count > f.capacity {
+		return false, ErrFull
+	}
+	added := false
+	f.each(data, func(i uint64, mask byte) bool {
+		added = added || f.bits[i]&mask == 0
+		f.bits[i] |= mask
+		return true
+	})
+	if added {
+		f.count++
+	}
+	return added, nil
+}
+
+// AddString to the filter, as BloomFilter.add does with a str key.
+func (f *PyBloomFilter) AddString(data string) (bool, error) {
+	return f.Add(stringToBytes(data))
+}
+
+// Test returns true if the data is in the filter, false otherwise. If true,
+// the result might be a false positive. If false, the data is definitely
+// not in the set.
+func (f *PyBloomFilter) Test(data []byte) bool {
+	return f.each(data, func(i uint64, mask byte) bool { return f.bits[i]&mask != 0 })
+}
+
+// TestString returns true if the string is in the filter, false otherwise.
+// If true, the result might be a false positive. If false, the data
+// is definitely not in the set.
+func (f *PyBloomFilter) TestString(data string) bool {
+	return f.Test(stringToBytes(data))
+}
+
+// WriteTo writes the filter to an i/o stream as BloomFilter.tofile does: the
+// error rate, the number of slices, the bits per slice, the capacity and the
+// count in little-endian order, then the bits, the first of each byte in its
+// least significant bit. It returns the number of bytes written.
+func (f *PyBloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	var header [pyBloomHeaderSize]byte
+	binary.LittleEndian.PutUint64(header[0:], math.Float64bits(f.errorRate))
+	binary.LittleEndian.PutUint64(header[8:], f.slices)
+	binary.LittleEndian.PutUint64(header[16:], f.bitsPerSlice)
+	binary.LittleEndian.PutUint64(header[24:], f.capacity)
+	binary.LittleEndian.PutUint64(header[32:], f.count)
+	n, err := stream.Write(header[:])
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := stream.Write(f.bits)
+	return int64(n + m), err
+}
+
+// ReadFrom reads a filter written by BloomFilter.tofile or by WriteTo from an
+// i/o stream. It returns the number of bytes read.
+func (f *PyBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	var header [pyBloomHeaderSize]byte
+	n, err := io.ReadFull(stream, header[:])
+	if err != nil {
+		return int64(n), err
+	}
+	g := PyBloomFilter{
+		errorRate:    math.Float64frombits(binary.LittleEndian.Uint64(header[0:])),
+		slices:       binary.LittleEndian.Uint64(header[8:]),
+		bitsPerSlice: binary.LittleEndian.Uint64(header[16:]),
+		capacity:     binary.LittleEndian.Uint64(header[24:]),
+		count:        binary.LittleEndian.Uint64(header[32:]),
+	}
+	if err := g.setup(); err != nil {
+		return int64(n), err
+	}
+	// The bits are buffered as they are read, so that a corrupted size does
+	// not allocate more than the stream holds.
+	size := int64((g.Cap() + 7) / 8)
+	var buf bytes.Buffer
+	m, err := io.CopyN(&buf, stream, size)
+	if err != nil {
+		return int64(n) + m, unexpectedEOF(err)
+	}
+	g.bits = buf.Bytes()
+	*f = g
+	return int64(n) + m, nil
+}
+
+// MarshalBinary implements binary.BinaryMarshaler interface.
+func (f *PyBloomFilter) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := f.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements binary.BinaryUnmarshaler interface.
+func (f *PyBloomFilter) UnmarshalBinary(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := f.ReadFrom(buf)
+
+	return err
+}
@@ -0,0 +1,161 @@
+package bloom
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestPyBloomFixtures(t *testing.T) {
+	// The fixtures in testdata hold the keys of legacyKeys, added in Python to
+	// BloomFilter(capacity, error_rate), and are written by tofile.
+	for _, c := range []struct {
+		name       string
+		capacity   uint
+		errorRate  float64
+		k, perHash uint64
+	}{
+		{"md5", 100, 0.01, 7, 8},
+		{"sha1", 1000, 0.001, 10, 10},
+		{"sha512", 100, 1e-10, 34, 32},
+	} {
+		raw, err := os.ReadFile("testdata/pybloom-" + c.name + ".bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var f PyBloomFilter
+		if n, err := f.ReadFrom(bytes.NewReader(raw)); err != nil || n != int64(len(raw)) {
+			t.Fatalf("%s: read %d bytes out of %d: %v", c.name, n, len(raw), err)
+		}
+		if f.K() != c.k || f.Count() != uint64(len(legacyKeys)) || uint64(f.hash().Size()/f.chunkSize) != c.perHash {
+			t.Errorf("%s: %d slices, %d keys", c.name, f.K(), f.Count())
+		}
+		for _, key := range legacyKeys {
+			if !f.TestString(key) {
+				t.Errorf("%s: %s should be in the filter", c.name, key)
+			}
+		}
+		if f.TestString("Jane") {
+			t.Errorf("%s: Jane should not be in the filter", c.name)
+		}
+
+		// The same filter built in Go is written as in Python.
+		g, err := NewPyBloom(c.capacity, c.errorRate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range legacyKeys {
+			g.AddString(key)
+		}
+		if data, _ := g.MarshalBinary(); !bytes.Equal(data, raw) {
+			t.Errorf("%s: unexpected encoding %x", c.name, data)
+		}
+	}
+}
+
+func TestPyBloomBasic(t *testing.T) {
+	f, err := NewPyBloom(1000, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added, err := f.AddString("Bess"); !added || err != nil {
+		t.Fatalf("the key should be added: %v", err)
+	}
+	if added, _ := f.AddString("Bess"); added || f.Count() != 1 {
+		t.Error("the key should only be added once")
+	}
+	if !f.Test([]byte("Bess")) || f.TestString("Jane") {
+		t.Error("unexpected membership")
+	}
+
+	n := 1000
+	for i := 1; i < n; i++ {
+		f.AddString(strconv.Itoa(i))
+	}
+	positives := 0
+	for i := 1; i < n; i++ {
+		if !f.TestString(strconv.Itoa(i)) {
+			t.Fatalf("key %d should be in", i)
+		}
+		if f.TestString(strconv.Itoa(n + i)) {
+			positives++
+		}
+	}
+	if rate := float64(positives) / float64(n); rate > 0.02 {
+		t.Errorf("false positive rate %f is too high", rate)
+	}
+	// Like in Python, keys can be added until the count exceeds the capacity.
+	for i := n; err == nil; i++ {
+		_, err = f.AddString(strconv.Itoa(i))
+	}
+	if err != ErrFull || f.Count() != 1001 {
+		t.Errorf("unexpected count %d when full: %v", f.Count(), err)
+	}
+
+	for _, c := range []struct {
+		capacity uint
+		rate     float64
+	}{{0, 0.01}, {100, 0}, {100, 1}} {
+		if _, err := NewPyBloom(c.capacity, c.rate); err == nil {
+			t.Errorf("capacity %d and error rate %v should not be accepted", c.capacity, c.rate)
+		}
+	}
+}
+
+func TestPyBloomHashes(t *testing.T) {
+	// pybloom picks the smallest hash which yields the indices of enough
+	// slices, of 2, 4 or 8 bytes depending on the bits per slice.
+	for _, c := range []struct {
+		slices, bitsPerSlice uint64
+		size, chunkSize      int
+		salts                int
+	}{
+		{8, 100, 16, 2, 1},
+		{9, 100, 20, 2, 1},
+		{11, 100, 32, 2, 1},
+		{12, 1 << 15, 48, 4, 1},
+		{17, 1 << 15, 64, 4, 2},
+		{13, 1 << 31, 64, 8, 2},
+	} {
+		if c.slices*c.bitsPerSlice > uint64(maxInt) {
+			continue // too large for 32-bit platforms
+		}
+		f := PyBloomFilter{slices: c.slices, bitsPerSlice: c.bitsPerSlice}
+		if err := f.setup(); err != nil {
+			t.Fatal(err)
+		}
+		if f.hash().Size() != c.size || f.chunkSize != c.chunkSize || len(f.salts) != c.salts {
+			t.Errorf("%d slices of %d bits: hash of %d bytes, indices of %d bytes, %d salts",
+				c.slices, c.bitsPerSlice, f.hash().Size(), f.chunkSize, len(f.salts))
+		}
+	}
+}
+
+func TestPyBloomInvalid(t *testing.T) {
+	raw, err := os.ReadFile("testdata/pybloom-md5.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f PyBloomFilter
+	for name, corrupt := range map[string]func([]byte){
+		"slices":         func(b []byte) { b[8] = 0 },
+		"bits per slice": func(b []byte) { b[16], b[17] = 0, 0 },
+		"size":           func(b []byte) { b[23] = 0x7f },
+	} {
+		bad := append([]byte(nil), raw...)
+		corrupt(bad)
+		if err := f.UnmarshalBinary(bad); err == nil {
+			t.Errorf("invalid %s should not be accepted", name)
+		}
+	}
+	for i := range raw {
+		if err := f.UnmarshalBinary(raw[:i]); err == nil {
+			t.Fatalf("%d bytes out of %d should not be accepted", i, len(raw))
+		}
+	}
+	stream := bytes.NewReader(append(raw, "tail"...))
+	if _, err := f.ReadFrom(stream); err != nil || stream.Len() != 4 {
+		t.Errorf("ReadFrom should only read the filter: %v", err)
+	}
+}
@@ -0,0 +1,618 @@
+/*
+Package quotient implements a quotient filter, as described in Bender et al.,
+"Don't Thrash: How to Cache Your Hash on Flash" (2012).
+
+Like a Bloom filter, a quotient filter answers approximate membership
+queries with false positives but no false negatives. It stores a
+fingerprint of q+r bits per key: its q high bits, the quotient, select one
+of the 2^q slots of a table, and its r low bits, the remainder, are stored
+in that slot or, if it is taken, in one of the next slots, along with three
+bits of metadata. The remainders of a quotient are kept sorted in a run of
+consecutive slots, so that a query reads a few adjacent slots, and the
+false positive rate is below 2^-r.
+
+Since the table holds the fingerprints themselves, a quotient filter can
+delete keys, and it can double its number of slots (Resize) or merge with
+another filter (Merge) without the keys: the fingerprints only move a bit
+from their remainder to their quotient, which doubles the false positive
+rate each time.
+
+The filter mirrors the API of bloom.BloomFilter (Add, Test, their String
+variants, ClearAll and the same serialization methods) plus Delete, so that
+one can replace the other with few code changes:
+
+	f := quotient.NewWithEstimates(1000000, 0.001)
+	f.AddString("Love")
+	if f.TestString("Love") {
+		f.DeleteString("Love")
+	}
+
+Unlike a Bloom filter, a quotient filter can be full: Add returns ErrFull
+once 3/4 of the slots are taken, after which queries would slow down. Resize
+then makes room for as many keys again.
+*/
+package quotient
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// The metadata bits of a slot, below its remainder
+const (
+	// occupied is set if the slot is the canonical slot of a key, that is if
+	// the run of its quotient is not empty
+	occupied = 1 << iota
+	// continuation is set if the remainder is not the first of its run
+	continuation
+	// shifted is set if the remainder is not in its canonical slot
+	shifted
+
+	metadataBits = 3
+	metadataMask = 1<<metadataBits - 1
+)
+
+const (
+	// maxQuotientBits is the largest number of quotient bits, 2^40 slots
+	maxQuotientBits = 40
+	// maxRemainderBits is the largest number of remainder bits, so that a
+	// slot fits in a word
+	maxRemainderBits = 64 - metadataBits
+)
+
+var (
+	// ErrFull is returned by Add when the filter cannot hold more keys.
+	ErrFull = errors.New("quotient: filter is full")
+	// ErrMaxSize is returned by Resize and Merge when the fingerprints have
+	// no remainder bit left to move to the quotient.
+	ErrMaxSize = errors.New("quotient: filter cannot grow further")
+)
+
+// A Filter is a quotient filter. It is not safe for concurrent use.
+type Filter struct {
+	q, r  uint     // bits of the quotient and of the remainder
+	count uint     // number of keys
+	words []uint64 // 2^q slots of r+metadataBits bits
+}
+
+// New creates a new quotient filter with 2^q slots and r-bit remainders,
+// that is room for 3/4 * 2^q keys with a false positive rate below 2^-r.
+// The quotient is clamped to [1, 40], and the remainder to [1, 64-q], and
+// to 61 bits at most.
+func New(q, r uint) *Filter {
+	if q < 1 {
+		q = 1
+	}
+	if q > maxQuotientBits {
+		q = maxQuotientBits
+	}
+	if r < 1 {
+		r = 1
+	}
+	if q+r > 64 {
+		r = 64 - q
+	}
+	if r > maxRemainderBits {
+		r = maxRemainderBits
+	}
+	bits := (uint64(1) << q) * uint64(r+metadataBits)
+	return &Filter{q: q, r: r, words: make([]uint64, (bits+63)/64)}
+}
+
+// EstimateParameters estimates the quotient and remainder bits of a filter
+// for n keys and a false positive rate of fp.
+func EstimateParameters(n uint, fp float64) (q, r uint) {
+	q = 1
+	for q < maxQuotientBits && (uint64(1)<<q)*3/4 < uint64(n) {
+		q++
+	}
+	bits := math.Ceil(-math.Log2(fp))
+	if !(bits < 64) {
+		bits = 64
+	}
+	if bits < 1 {
+		bits = 1
+	}
+	return q, uint(bits)
+}
+
+// NewWithEstimates creates a new quotient filter for about n items with fp
+// false positive rate
+func NewWithEstimates(n uint, fp float64) *Filter {
+	return New(EstimateParameters(n, fp))
+}
+
+// Cap returns the capacity of the filter, the number of keys it can hold
+func (f *Filter) Cap() uint {
+	return uint((uint64(1) << f.q) * 3 / 4)
+}
+
+// Count returns the number of keys in the filter
+func (f *Filter) Count() uint {
+	return f.count
+}
+
+// RemainderBits returns the number of bits of the remainders, r, which
+// decreases by one each time the filter grows.
+func (f *Filter) RemainderBits() uint {
+	return f.r
+}
+
+// get returns slot i: its remainder, shifted left by metadataBits, and its
+// metadata bits
+func (f *Filter) get(i uint64) uint64 {
+	w := uint64(f.r + metadataBits)
+	bit := i * w
+	word, off := bit/64, bit%64
+	v := f.words[word] >> off
+	if off+w > 64 {
+		v |= f.words[word+1] << (64 - off)
+	}
+	return v & (1<<w - 1)
+}
+
+// set sets slot i to v
+func (f *Filter) set(i, v uint64) {
+	w := uint64(f.r + metadataBits)
+	mask := uint64(1)<<w - 1
+	bit := i * w
+	word, off := bit/64, bit%64
+	f.words[word] = f.words[word]&^(mask<<off) | v<<off
+	if off+w > 64 {
+		f.words[word+1] = f.words[word+1]&^(mask>>(64-off)) | v>>(64-off)
+	}
+}
+
+// incr returns the slot after slot i; the table wraps around
+func (f *Filter) incr(i uint64) uint64 {
+	return (i + 1) & (uint64(1)<<f.q - 1)
+}
+
+// decr returns the slot before slot i
+func (f *Filter) decr(i uint64) uint64 {
+	return (i - 1) & (uint64(1)<<f.q - 1)
+}
+
+// isRunStart returns true if the slot holds the first remainder of a run
+func isRunStart(v uint64) bool {
+	return v&continuation == 0 && v&(occupied|shifted) != 0
+}
+
+// isClusterStart returns true if the slot holds a remainder in its
+// canonical slot, which starts a cluster of consecutive slots
+func isClusterStart(v uint64) bool {
+	return v&occupied != 0 && v&(continuation|shifted) == 0
+}
+
+// fingerprint returns the q+r-bit fingerprint of a key
+func (f *Filter) fingerprint(data []byte) uint64 {
+	return bloom.Locations(data, 1)[0] >> (64 - f.q - f.r)
+}
+
+// split returns the quotient and the remainder of a fingerprint
+func (f *Filter) split(p uint64) (uint64, uint64) {
+	return p >> f.r, p & (uint64(1)<<f.r - 1)
+}
+
+// runStart returns the slot of the first remainder of the run of quotient
+// fq, or of the slot where it would start if fq had no run yet. The
+// occupied bit of fq must be set.
+func (f *Filter) runStart(fq uint64) uint64 {
+	// Go back to the start of the cluster, then skip a run for each
+	// occupied slot until fq.
+	b := fq
+	for f.get(b)&shifted != 0 {
+		b = f.decr(b)
+	}
+	s := b
+	for b != fq {
+		for {
+			s = f.incr(s)
+			if f.get(s)&continuation == 0 {
+				break
+			}
+		}
+		for {
+			b = f.incr(b)
+			if f.get(b)&occupied != 0 {
+				break
+			}
+		}
+	}
+	return s
+}
+
+// shiftIn stores a remainder in slot s, shifting the next slots up to the
+// first empty slot; the occupied bits stay with their slots.
+func (f *Filter) shiftIn(s, v uint64) {
+	for {
+		prev := f.get(s)
+		empty := prev&metadataMask == 0
+		if !empty {
+			prev |= shifted
+			if prev&occupied != 0 {
+				v |= occupied
+				prev &^= occupied
+			}
+		}
+		f.set(s, v)
+		v = prev
+		s = f.incr(s)
+		if empty {
+			return
+		}
+	}
+}
+
+// shiftOut removes the remainder of slot s, shifting the next slots of its
+// cluster down; fq is the quotient of the remainder.
+func (f *Filter) shiftOut(s, fq uint64) {
+	curr := f.get(s)
+	orig := s
+	for next := f.incr(s); ; next = f.incr(next) {
+		v := f.get(next)
+		if v&metadataMask == 0 || isClusterStart(v) || next == orig {
+			f.set(s, 0)
+			return
+		}
+		if isRunStart(v) {
+			for {
+				fq = f.incr(fq)
+				if f.get(fq)&occupied != 0 {
+					break
+				}
+			}
+			if curr&occupied != 0 && fq == s {
+				// The run moves to its canonical slot.
+				v &^= shifted
+			}
+		}
+		f.set(s, v&^occupied|curr&occupied)
+		s, curr = next, v
+	}
+}
+
+// add inserts a fingerprint; duplicates are stored as many times as they
+// are added.
+func (f *Filter) add(p uint64) {
+	fq, fr := f.split(p)
+	v := fr << metadataBits
+	t := f.get(fq)
+	if t&metadataMask == 0 {
+		f.set(fq, v|occupied)
+		f.count++
+		return
+	}
+	exists := t&occupied != 0
+	if !exists {
+		f.set(fq, t|occupied)
+	}
+	start := f.runStart(fq)
+	s := start
+	if exists {
+		// Keep the run sorted.
+		for f.get(s)>>metadataBits <= fr {
+			s = f.incr(s)
+			if f.get(s)&continuation == 0 {
+				break
+			}
+		}
+		if s == start {
+			f.set(start, f.get(start)|continuation)
+		} else {
+			v |= continuation
+		}
+	}
+	if s != fq {
+		v |= shifted
+	}
+	f.shiftIn(s, v)
+	f.count++
+}
+
+// find returns the slot of a fingerprint and true, or false if the filter
+// does not hold it
+func (f *Filter) find(p uint64) (uint64, bool) {
+	fq, fr := f.split(p)
+	if f.get(fq)&occupied == 0 {
+		return 0, false
+	}
+	s := f.runStart(fq)
+	for {
+		rem := f.get(s) >> metadataBits
+		if rem == fr {
+			return s, true
+		}
+		if rem > fr {
+			return 0, false
+		}
+		s = f.incr(s)
+		if f.get(s)&continuation == 0 {
+			return 0, false
+		}
+	}
+}
+
+// remove deletes one occurrence of a fingerprint and returns true if it was
+// found
+func (f *Filter) remove(p uint64) bool {
+	s, ok := f.find(p)
+	if !ok {
+		return false
+	}
+	fq, _ := f.split(p)
+	runHead := isRunStart(f.get(s))
+	if runHead && f.get(f.incr(s))&continuation == 0 {
+		// The run becomes empty.
+		f.set(fq, f.get(fq)&^occupied)
+	}
+	f.shiftOut(s, fq)
+	if runHead {
+		// The next remainder of the run, if any, becomes its head.
+		v := f.get(s)
+		u := v &^ continuation
+		if s == fq && isRunStart(u) {
+			u &^= shifted
+		}
+		if u != v {
+			f.set(s, u)
+		}
+	}
+	f.count--
+	return true
+}
+
+// each calls fn with the fingerprints of the filter, in increasing order
+// from the start of the first cluster of the table
+func (f *Filter) each(fn func(p uint64)) {
+	if f.count == 0 {
+		return
+	}
+	i := uint64(0)
+	for !isClusterStart(f.get(i)) {
+		i = f.incr(i)
+	}
+	fq := i
+	for n := uint(0); n < f.count; i = f.incr(i) {
+		v := f.get(i)
+		if isClusterStart(v) {
+			fq = i
+		} else if isRunStart(v) {
+			for {
+				fq = f.incr(fq)
+				if f.get(fq)&occupied != 0 {
+					break
+				}
+			}
+		}
+		if v&metadataMask != 0 {
+			fn(fq<<f.r | v>>metadataBits)
+			n++
+		}
+	}
+}
+
+// Add data to the filter. Adding the same key twice stores it twice, and it
+// must then be deleted twice. It returns ErrFull, and leaves the filter
+// unchanged, if the filter is full.
+func (f *Filter) Add(data []byte) error {
+	if f.count >= f.Cap() {
+		return ErrFull
+	}
+	f.add(f.fingerprint(data))
+	return nil
+}
+
+// AddString to the filter. See Add.
+func (f *Filter) AddString(data string) error {
+	return f.Add([]byte(data))
+}
+
+// Test returns true if the data is in the filter, false otherwise.
+// If true, the result might be a false positive. If false, the data
+// is definitely not in the set.
+func (f *Filter) Test(data []byte) bool {
+	_, ok := f.find(f.fingerprint(data))
+	return ok
+}
+
+// TestString returns true if the string is in the filter, false otherwise.
+// If true, the result might be a false positive. If false, the data
+// is definitely not in the set.
+func (f *Filter) TestString(data string) bool {
+	return f.Test([]byte(data))
+}
+
+// Delete removes the data from the filter and returns true if it was found.
+// Only delete keys that were added: deleting a false positive deletes the
+// key it collides with.
+func (f *Filter) Delete(data []byte) bool {
+	return f.remove(f.fingerprint(data))
+}
+
+// DeleteString removes a string from the filter. See Delete.
+func (f *Filter) DeleteString(data string) bool {
+	return f.Delete([]byte(data))
+}
+
+// grow returns an empty filter with 2^q slots for the fingerprints of f
+func (f *Filter) grow(q uint) (*Filter, error) {
+	if q > maxQuotientBits || q >= f.q+f.r {
+		return nil, ErrMaxSize
+	}
+	return New(q, f.q+f.r-q), nil
+}
+
+// Resize doubles the number of slots of the filter, and thus its capacity,
+// without the keys: a bit of each fingerprint moves from the remainder to
+// the quotient, which doubles the false positive rate. It returns
+// ErrMaxSize, and leaves the filter unchanged, if the remainders have a
+// single bit or the filter has 2^40 slots.
+func (f *Filter) Resize() error {
+	g, err := f.grow(f.q + 1)
+	if err != nil {
+		return err
+	}
+	f.each(g.add)
+	*f = *g
+	return nil
+}
+
+// Merge adds the keys of g to f, without the keys. Both filters must have
+// fingerprints of the same size, q+r bits, as filters created with the same
+// parameters have after any number of calls to Resize. f takes the larger
+// number of slots of the two filters, doubled until it can hold the keys of
+// both, which may return ErrMaxSize.
+func (f *Filter) Merge(g *Filter) error {
+	if f.q+f.r != g.q+g.r {
+		return fmt.Errorf("quotient: fingerprint sizes don't match: %d != %d", f.q+f.r, g.q+g.r)
+	}
+	q := f.q
+	if g.q > q {
+		q = g.q
+	}
+	for (uint64(1)<<q)*3/4 < uint64(f.count+g.count) {
+		q++
+	}
+	h, err := f.grow(q)
+	if err != nil {
+		return err
+	}
+	f.each(h.add)
+	g.each(h.add)
+	*f = *h
+	return nil
+}
+
+// ClearAll clears all the data in the filter, removing all keys
+func (f *Filter) ClearAll() *Filter {
+	for i := range f.words {
+		f.words[i] = 0
+	}
+	f.count = 0
+	return f
+}
+
+// Equal tests for the equality of two quotient filters
+func (f *Filter) Equal(g *Filter) bool {
+	if f.q != g.q || f.r != g.r || f.count != g.count {
+		return false
+	}
+	for i := range f.words {
+		if f.words[i] != g.words[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// header is the fixed-size part of the binary representation
+type header struct {
+	Q     uint64
+	R     uint64
+	Count uint64
+}
+
+// check returns an error if the header cannot describe a filter
+func (h header) check() error {
+	if h.Q < 1 || h.Q > maxQuotientBits || h.R < 1 || h.R > maxRemainderBits || h.Q+h.R > 64 {
+		return fmt.Errorf("quotient: invalid quotient and remainder bits %d, %d", h.Q, h.R)
+	}
+	if h.Count > (uint64(1)<<h.Q)*3/4 {
+		return errors.New("quotient: invalid filter")
+	}
+	return nil
+}
+
+// check returns an error if the slots do not match the number of keys, so
+// that the operations on the filter terminate
+func (f *Filter) check() error {
+	var n uint
+	start := false
+	for i := uint64(0); i < uint64(1)<<f.q; i++ {
+		v := f.get(i)
+		if v&metadataMask != 0 {
+			n++
+		}
+		start = start || isClusterStart(v)
+	}
+	if n != f.count || (n > 0 && !start) {
+		return errors.New("quotient: invalid filter")
+	}
+	return nil
+}
+
+// WriteTo writes a binary representation of the filter to an i/o stream.
+// It returns the number of bytes written.
+func (f *Filter) WriteTo(stream io.Writer) (int64, error) {
+	h := header{uint64(f.q), uint64(f.r), uint64(f.count)}
+	err := binary.Write(stream, binary.BigEndian, h)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, f.words)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.Size(h) + 8*len(f.words)), nil
+}
+
+// ReadFrom reads a binary representation of the filter (such as might
+// have been written by WriteTo()) from an i/o stream. It returns the number
+// of bytes read.
+func (f *Filter) ReadFrom(stream io.Reader) (int64, error) {
+	var h header
+	err := binary.Read(stream, binary.BigEndian, &h)
+	if err != nil {
+		return 0, err
+	}
+	if err := h.check(); err != nil {
+		return 0, err
+	}
+	g := New(uint(h.Q), uint(h.R))
+	g.count = uint(h.Count)
+	err = binary.Read(stream, binary.BigEndian, g.words)
+	if err != nil {
+		return 0, err
+	}
+	if err := g.check(); err != nil {
+		return 0, err
+	}
+	*f = *g
+	return int64(binary.Size(h) + 8*len(f.words)), nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (f *Filter) GobEncode() ([]byte, error) {
+	return f.MarshalBinary()
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (f *Filter) GobDecode(data []byte) error {
+	return f.UnmarshalBinary(data)
+}
+
+// MarshalBinary implements binary.BinaryMarshaler interface.
+func (f *Filter) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := f.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements binary.BinaryUnmarshaler interface.
+func (f *Filter) UnmarshalBinary(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := f.ReadFrom(buf)
+
+	return err
+}
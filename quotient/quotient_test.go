@@ -0,0 +1,323 @@
+package quotient
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestBasic(t *testing.T) {
+	f := New(10, 16)
+	n1 := []byte("Bess")
+	n2 := []byte("Jane")
+	if err := f.Add(n1); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Test(n1) {
+		t.Errorf("%v should be in.", n1)
+	}
+	if f.Test(n2) {
+		t.Errorf("%v should not be in.", n2)
+	}
+	if f.Delete(n2) {
+		t.Errorf("%v should not have been deleted.", n2)
+	}
+	if !f.Delete(n1) || f.Test(n1) || f.Count() != 0 {
+		t.Errorf("%v should not be in after deletion.", n1)
+	}
+	if err := f.AddString("Emma"); err != nil {
+		t.Fatal(err)
+	}
+	if !f.TestString("Emma") || !f.DeleteString("Emma") || f.TestString("Emma") {
+		t.Error("strings should be added and deleted")
+	}
+}
+
+func TestEstimateParameters(t *testing.T) {
+	for _, c := range []struct {
+		n    uint
+		fp   float64
+		q, r uint
+	}{
+		{0, 0.5, 1, 1},
+		{1000, 0.001, 11, 10},
+		{1536, 0.01, 11, 7},
+		{1537, 0.01, 12, 7},
+		{1000, 0, 11, 53},
+		{1000, 2, 11, 1},
+		{1, 0, 1, 61},
+	} {
+		f := NewWithEstimates(c.n, c.fp)
+		if f.q != c.q || f.r != c.r {
+			t.Errorf("%d keys at %v: got q=%d r=%d, expected q=%d r=%d", c.n, c.fp, f.q, f.r, c.q, c.r)
+		}
+		if f.Cap() < c.n {
+			t.Errorf("capacity %d for %d keys", f.Cap(), c.n)
+		}
+	}
+}
+
+// checkFingerprints checks that the filter holds the fingerprints counted
+// by model, and only them.
+func checkFingerprints(t *testing.T, f *Filter, model map[uint64]int) {
+	t.Helper()
+	var got, expected []uint64
+	f.each(func(p uint64) { got = append(got, p) })
+	for p, n := range model {
+		for i := 0; i < n; i++ {
+			expected = append(expected, p)
+		}
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+	sort.Slice(expected, func(i, j int) bool { return expected[i] < expected[j] })
+	if len(got) != len(expected) || f.Count() != uint(len(expected)) {
+		t.Fatalf("%d fingerprints, count %d, expected %d", len(got), f.Count(), len(expected))
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Fatalf("fingerprint %x, expected %x", got[i], expected[i])
+		}
+	}
+	for p := uint64(0); p < uint64(1)<<(f.q+f.r); p++ {
+		if _, ok := f.find(p); ok != (model[p] > 0) {
+			t.Fatalf("find(%x) = %v, expected %v", p, ok, model[p] > 0)
+		}
+	}
+}
+
+func TestRandomOperations(t *testing.T) {
+	// Few remainder bits, so that runs hold equal remainders, and a small
+	// table, so that clusters are long and wrap around.
+	r := rand.New(rand.NewSource(1))
+	f := New(6, 3)
+	model := map[uint64]int{}
+	for i := 0; i < 20000; i++ {
+		p := uint64(r.Intn(1 << 9))
+		if r.Intn(2) == 0 && f.Count() < f.Cap() {
+			f.add(p)
+			model[p]++
+		} else if f.remove(p) != (model[p] > 0) {
+			t.Fatalf("remove(%x) with %d occurrences", p, model[p])
+		} else if model[p] > 0 {
+			model[p]--
+		}
+		if i%100 == 0 {
+			checkFingerprints(t, f, model)
+		}
+	}
+	checkFingerprints(t, f, model)
+}
+
+func TestFill(t *testing.T) {
+	n := uint32(100000)
+	f := NewWithEstimates(uint(n), 0.001)
+	key := make([]byte, 4)
+	for i := uint32(0); i < n; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		if err := f.Add(key); err != nil {
+			t.Fatalf("key %d: %v", i, err)
+		}
+	}
+	if f.Count() != uint(n) {
+		t.Errorf("count %d, expected %d", f.Count(), n)
+	}
+	for i := uint32(0); i < n; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		if !f.Test(key) {
+			t.Fatalf("key %d should be in", i)
+		}
+	}
+	positives := 0
+	for i := n; i < 11*n; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		if f.Test(key) {
+			positives++
+		}
+	}
+	if rate := float64(positives) / float64(10*n); rate > 0.001 {
+		t.Errorf("false positive rate %f is too high", rate)
+	}
+	for i := uint32(0); i < n; i += 2 {
+		binary.BigEndian.PutUint32(key, i)
+		if !f.Delete(key) {
+			t.Fatalf("key %d should have been deleted", i)
+		}
+	}
+	for i := uint32(1); i < n; i += 2 {
+		binary.BigEndian.PutUint32(key, i)
+		if !f.Test(key) {
+			t.Fatalf("key %d should still be in", i)
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	f := New(4, 10)
+	key := make([]byte, 4)
+	var i uint32
+	for ; i < 1000; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		if f.Add(key) == ErrFull {
+			if err := f.Resize(); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.Add(key); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if f.q != 11 || f.r != 3 || f.RemainderBits() != 3 || f.Count() != 1000 {
+		t.Fatalf("q=%d r=%d count=%d after resizing", f.q, f.r, f.Count())
+	}
+	for j := uint32(0); j < i; j++ {
+		binary.BigEndian.PutUint32(key, j)
+		if !f.Test(key) {
+			t.Fatalf("key %d should be in", j)
+		}
+	}
+	// Resizing and adding the keys give the same fingerprints.
+	g := New(11, 3)
+	for j := uint32(0); j < i; j++ {
+		binary.BigEndian.PutUint32(key, j)
+		g.Add(key)
+	}
+	model := map[uint64]int{}
+	g.each(func(p uint64) { model[p]++ })
+	checkFingerprints(t, f, model)
+
+	h := New(10, 1)
+	if h.Resize() != ErrMaxSize || h.q != 10 {
+		t.Error("filters with 1-bit remainders cannot be resized")
+	}
+	h = &Filter{q: maxQuotientBits, r: 24}
+	if h.Resize() != ErrMaxSize {
+		t.Error("filters with 2^40 slots cannot be resized")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	f, g := New(8, 8), New(8, 8)
+	key := make([]byte, 4)
+	for i := uint32(0); i < 150; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		f.Add(key)
+		binary.BigEndian.PutUint32(key, i+1000)
+		g.Add(key)
+	}
+	if err := g.Resize(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Merge(g); err != nil {
+		t.Fatal(err)
+	}
+	if f.q != 9 || f.Count() != 300 {
+		t.Fatalf("q=%d count=%d after merging", f.q, f.Count())
+	}
+	for i := uint32(0); i < 150; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		if !f.Test(key) {
+			t.Fatalf("key %d should be in", i)
+		}
+		binary.BigEndian.PutUint32(key, i+1000)
+		if !f.Test(key) {
+			t.Fatalf("key %d should be in", i+1000)
+		}
+	}
+	// The filter doubles until it can hold both sets of keys.
+	if err := f.Merge(f.copy()); err != nil {
+		t.Fatal(err)
+	}
+	if f.q != 10 || f.Count() != 600 {
+		t.Fatalf("q=%d count=%d after merging", f.q, f.Count())
+	}
+	if err := f.Merge(New(8, 9)); err == nil {
+		t.Error("filters with different fingerprint sizes should not merge")
+	}
+}
+
+// copy returns a copy of the filter
+func (f *Filter) copy() *Filter {
+	g := *f
+	g.words = append([]uint64(nil), f.words...)
+	return &g
+}
+
+func TestFull(t *testing.T) {
+	f := New(7, 8)
+	key := make([]byte, 4)
+	var i uint32
+	for ; ; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		if f.Add(key) == ErrFull {
+			break
+		}
+	}
+	if f.Count() != uint(i) || f.Count() != 96 {
+		t.Fatalf("count %d after %d keys", f.Count(), i)
+	}
+	binary.BigEndian.PutUint32(key, 0)
+	if !f.Delete(key) || f.Add(key) != nil {
+		t.Error("deleting a key should make room again")
+	}
+	f.ClearAll()
+	if f.Count() != 0 || f.Test(key) || f.Add(key) != nil {
+		t.Error("ClearAll should empty the filter")
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	f := New(8, 12)
+	key := make([]byte, 4)
+	for i := uint32(0); i < 150; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		f.Add(key)
+	}
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := append([]byte(nil), buf.Bytes()...)
+	var g Filter
+	if _, err := g.ReadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Equal(&g) {
+		t.Error("binary round trip changed the filter")
+	}
+
+	buf.Reset()
+	if err := gob.NewEncoder(&buf).Encode(f); err != nil {
+		t.Fatal(err)
+	}
+	var h Filter
+	if err := gob.NewDecoder(&buf).Decode(&h); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Equal(&h) || !h.Test(key) {
+		t.Error("gob round trip changed the filter")
+	}
+
+	for name, corrupt := range map[string]func([]byte){
+		"quotient bits":  func(b []byte) { b[7] = 41 },
+		"remainder bits": func(b []byte) { b[15] = 57 },
+		"count":          func(b []byte) { b[23]++ },
+		"slots": func(b []byte) {
+			for i := 24; i < len(b); i++ {
+				b[i] = 0
+			}
+		},
+	} {
+		bad := append([]byte(nil), data...)
+		corrupt(bad)
+		if err := h.UnmarshalBinary(bad); err == nil {
+			t.Errorf("invalid %s should not be accepted", name)
+		}
+	}
+	if err := h.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Error("truncated data should not be accepted")
+	}
+}
@@ -0,0 +1,135 @@
+package bloom
+
+import (
+	"errors"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/bits-and-blooms/bitset"
+)
+
+// A ReaderAtBloomFilter is a Bloom filter serialized by WriteTo in a file or
+// an object of which only the words holding the bits of a key are read, or
+// updated in place: for instance, an object in a storage service read with
+// range requests. Offsets returns the byte ranges needed by a key, so that
+// they can be fetched in a single request.
+//
+// Keyed and encoded filters (see NewKeyed and WriteEncodedTo) are not
+// supported. Framed filters (see WriteFramedTo) can be tested, but not
+// updated, since their checksum would not match.
+type ReaderAtBloomFilter struct {
+	serializedHeader
+	r io.ReaderAt
+}
+
+// NewReaderAt reads the header of a filter written by WriteTo or
+// MarshalBinary at the start of r, and returns a filter which reads its
+// words from r as they are needed.
+func NewReaderAt(r io.ReaderAt) (*ReaderAtBloomFilter, error) {
+	h, err := readSerializedHeader(io.NewSectionReader(r, 0, math.MaxInt64))
+	if err != nil {
+		return nil, err
+	}
+	return &ReaderAtBloomFilter{serializedHeader: h, r: r}, nil
+}
+
+// Cap returns the capacity, _m_, of the filter
+func (f *ReaderAtBloomFilter) Cap() uint64 {
+	return f.m
+}
+
+// K returns the number of hash functions used in the filter
+func (f *ReaderAtBloomFilter) K() uint64 {
+	return f.k
+}
+
+// Offsets returns the offsets, in increasing order, of the 8-byte words
+// holding the bits of the key in the serialized filter.
+func (f *ReaderAtBloomFilter) Offsets(data []byte) []int64 {
+	h := f.hashes(data)
+	offsets := make([]int64, 0, f.k)
+	for i := uint64(0); i < f.k; i++ {
+		offsets = append(offsets, f.offset+int64(8*(f.location(h, i)/64)))
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	unique := offsets[:0]
+	for i, offset := range offsets {
+		if i == 0 || offset != offsets[i-1] {
+			unique = append(unique, offset)
+		}
+	}
+	return unique
+}
+
+// Test returns true if the data is in the filter, false otherwise. If true,
+// the result might be a false positive. If false, the data is definitely not
+// in the set. It reads the words holding the bits of the key one at a time,
+// and stops at the first bit which is not set.
+func (f *ReaderAtBloomFilter) Test(data []byte) (bool, error) {
+	h := f.hashes(data)
+	for i := uint64(0); i < f.k; i++ {
+		l := f.location(h, i)
+		word, err := f.wordAt(f.offset + int64(8*(l/64)))
+		if err != nil {
+			return false, err
+		}
+		if word&(1<<(l%64)) == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// wordAt reads the word at the given offset
+func (f *ReaderAtBloomFilter) wordAt(offset int64) (uint64, error) {
+	var word [8]byte
+	// ReadAt may return io.EOF with the last word.
+	if n, err := f.r.ReadAt(word[:], offset); n < len(word) {
+		return 0, unexpectedEOF(err)
+	}
+	return bitset.BinaryOrder().Uint64(word[:]), nil
+}
+
+// TestString returns true if the string is in the filter, false otherwise.
+// If true, the result might be a false positive. If false, the data
+// is definitely not in the set.
+func (f *ReaderAtBloomFilter) TestString(data string) (bool, error) {
+	return f.Test(stringToBytes(data))
+}
+
+// AddAt adds the data to the filter serialized in w, which must be the same
+// file or object as the one the filter reads: the words holding the bits of
+// the key are read, and the modified ones written back. Concurrent updates of
+// the same filter must be serialized by the caller.
+func (f *ReaderAtBloomFilter) AddAt(w io.WriterAt, data []byte) error {
+	if f.checksum {
+		return errors.New("bloom: framed filters cannot be updated in place")
+	}
+	h := f.hashes(data)
+	masks := make(map[int64]uint64, f.k)
+	for i := uint64(0); i < f.k; i++ {
+		l := f.location(h, i)
+		masks[f.offset+int64(8*(l/64))] |= 1 << (l % 64)
+	}
+	offsets := make([]int64, 0, len(masks))
+	for offset := range masks {
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	var word [8]byte
+	for _, offset := range offsets {
+		v, err := f.wordAt(offset)
+		if err != nil {
+			return err
+		}
+		if v|masks[offset] == v {
+			continue
+		}
+		bitset.BinaryOrder().PutUint64(word[:], v|masks[offset])
+		if _, err := w.WriteAt(word[:], offset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package bloom
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// countingReaderAt counts the bytes read from a ReaderAt
+type countingReaderAt struct {
+	r *bytes.Reader
+	n int
+}
+
+func (r *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.r.ReadAt(p, off)
+	r.n += n
+	return n, err
+}
+
+func TestReaderAt(t *testing.T) {
+	for _, f := range []*BloomFilter{
+		NewWithEstimates(10000, 0.01),
+		NewWithSeed(1000, 4, 42),
+		NewFastRangeWithEstimates(1000, 0.001),
+	} {
+		for i := 0; i < 100; i++ {
+			f.AddString(strconv.Itoa(i))
+		}
+		data := mustMarshal(t, f)
+		r := &countingReaderAt{r: bytes.NewReader(data)}
+		g, err := NewReaderAt(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g.Cap() != uint64(f.Cap()) || g.K() != uint64(f.K()) {
+			t.Fatalf("%d bits and %d hash functions instead of %d and %d", g.Cap(), g.K(), f.Cap(), f.K())
+		}
+		for i := 0; i < 1000; i++ {
+			key := strconv.Itoa(i)
+			r.n = 0
+			found, err := g.TestString(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found != f.TestString(key) {
+				t.Fatalf("%s: Test should return %v", key, f.TestString(key))
+			}
+			if r.n > 8*int(f.K()) {
+				t.Fatalf("%d bytes read to test a key", r.n)
+			}
+			// The offsets are those of the words of the locations.
+			h := f.hashes([]byte(key))
+			offsets := g.Offsets([]byte(key))
+			for j := uint(0); j < f.K(); j++ {
+				offset := g.offset + int64(8*(f.location(h, j)/64))
+				k := 0
+				for k < len(offsets) && offsets[k] != offset {
+					k++
+				}
+				if k == len(offsets) {
+					t.Fatalf("%s: offset %d is missing", key, offset)
+				}
+			}
+			for k := 1; k < len(offsets); k++ {
+				if offsets[k] <= offsets[k-1] {
+					t.Fatalf("%s: offsets %v should be sorted and unique", key, offsets)
+				}
+			}
+		}
+	}
+}
+
+func TestReaderAtAddAt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter")
+	f := NewWithEstimates(1000, 0.01)
+	f.AddString("Love")
+	if err := os.WriteFile(path, mustMarshal(t, f), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	g, err := NewReaderAt(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if err := g.AddAt(file, []byte(strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+		f.AddString(strconv.Itoa(i))
+	}
+	data, _ := os.ReadFile(path)
+	if !bytes.Equal(data, mustMarshal(t, f)) {
+		t.Error("AddAt should update the file as Add updates the filter")
+	}
+
+	// Framed filters can be tested, not updated.
+	var buf bytes.Buffer
+	f.WriteFramedTo(&buf, EncodingRaw)
+	framed := buf.Bytes()
+	g, err = NewReaderAt(bytes.NewReader(framed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found, err := g.TestString("Love"); !found || err != nil {
+		t.Errorf("Love should be in the framed filter: %v", err)
+	}
+	if err := g.AddAt(file, []byte("Hate")); err == nil {
+		t.Error("framed filters should not be updated")
+	}
+}
+
+func TestReaderAtInvalid(t *testing.T) {
+	f := NewWithEstimates(1000, 0.01).AddString("Love")
+	data := mustMarshal(t, f)
+	for i := 0; i < 24; i++ {
+		if _, err := NewReaderAt(bytes.NewReader(data[:i])); err == nil {
+			t.Errorf("%d bytes out of %d should not be accepted", i, len(data))
+		}
+	}
+	// Words are only read by Test.
+	g, err := NewReaderAt(bytes.NewReader(data[:len(data)-8]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := false
+	for i := 0; i < 100 && !failed; i++ {
+		_, err := g.TestString(strconv.Itoa(i))
+		failed = err != nil
+	}
+	if !failed {
+		t.Error("missing words should return an error")
+	}
+	var buf bytes.Buffer
+	NewKeyed(1000, 4, [16]byte{1}).WriteTo(&buf)
+	if _, err := NewReaderAt(bytes.NewReader(buf.Bytes())); err == nil {
+		t.Error("keyed filters should not be accepted")
+	}
+}
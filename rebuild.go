@@ -0,0 +1,33 @@
+package bloom
+
+// Rebuild returns a new Bloom filter with _m_ bits and _k_ hashing functions
+// holding the keys supplied by src, which is called once with a function to
+// call for each key. A filter cannot list its keys, so they must come from
+// the source of the data, e.g.,
+//
+//	g := f.Rebuild(2*f.Cap(), f.K(), func(yield func([]byte)) {
+//		for _, key := range keys {
+//			yield(key)
+//		}
+//	})
+//
+// The new filter uses the same hash functions and range reduction as the
+// filter, which is not modified, so that it is serialized in the same format
+// and may be used in its place, e.g., when it is saturated (see FillRatio).
+// The keys passed to yield are not retained.
+func (f *BloomFilter) Rebuild(m uint, k uint, src func(yield func([]byte))) *BloomFilter {
+	g := New(m, k)
+	g.hashing = f.hashing
+	g.fastRange = f.fastRange
+	src(func(key []byte) {
+		g.Add(key)
+	})
+	return g
+}
+
+// RebuildWithEstimates is like Rebuild, for a filter sized for about n items
+// with fp false positive rate.
+func (f *BloomFilter) RebuildWithEstimates(n uint, fp float64, src func(yield func([]byte))) *BloomFilter {
+	m, k := EstimateParameters(n, fp)
+	return f.Rebuild(m, k, src)
+}
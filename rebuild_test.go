@@ -0,0 +1,46 @@
+package bloom
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRebuild(t *testing.T) {
+	keys := []string{"a", "b", "c"}
+	src := func(yield func([]byte)) {
+		for _, key := range keys {
+			yield([]byte(key))
+		}
+	}
+	f := NewWithSeed(64, 3, 42)
+	for _, key := range keys {
+		f.AddString(key)
+	}
+	g := f.Rebuild(1000, 4, src)
+	if g.Cap() != 1000 || g.K() != 4 || g.Seed() != 42 || f.Cap() != 64 {
+		t.Error("the filter should be rebuilt with the new parameters and the same seed")
+	}
+	for _, key := range keys {
+		if !g.TestString(key) {
+			t.Errorf("%s should be in the rebuilt filter", key)
+		}
+	}
+	h := NewWithSeed(1000, 4, 42)
+	for _, key := range keys {
+		h.AddString(key)
+	}
+	if !g.Equal(h) {
+		t.Error("the rebuilt filter should be equal to a new filter with the keys")
+	}
+	data, err := g.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := h.MarshalBinary()
+	if !bytes.Equal(data, expected) {
+		t.Error("the rebuilt filter should be serialized as a new filter")
+	}
+	if e := f.RebuildWithEstimates(100, 0.01, src); !e.TestString("a") || e.Seed() != 42 {
+		t.Error("RebuildWithEstimates should rebuild the filter")
+	}
+}
@@ -0,0 +1,407 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Options of RedisBloom filters, see
+// https://github.com/RedisBloom/RedisBloom/blob/master/deps/bloom/bloom.h
+const (
+	redisNoRound   = 1
+	redisForce64   = 4
+	redisNoScaling = 8
+)
+
+// Constants of the RedisBloom filters and of their SCANDUMP encoding
+const (
+	// redisTightening is the ratio between the error rates of consecutive
+	// links of a scaling filter
+	redisTightening = 0.5
+	// redisDefaultExpansion is the growth of filters created with
+	// NONSCALING, which is stored but not used
+	redisDefaultExpansion = 2
+	redisHeaderSize       = 20
+	redisLinkSize         = 53
+)
+
+// maxInt is the largest int, which bounds the size of the links
+const maxInt = int(^uint(0) >> 1)
+
+// ErrFull is returned when adding a key to a full filter which cannot grow.
+var ErrFull = errors.New("bloom: filter is full")
+
+// redisLink is one of the Bloom filters of a RedisBloom chain
+type redisLink struct {
+	bits    uint64 // 8 * len(data)
+	size    uint64 // keys added to the link
+	entries uint64 // capacity of the link
+	errRate float64
+	bpe     float64 // bits per entry
+	hashes  uint32
+	n2      uint8 // if not zero, bit positions are reduced modulo 1<<n2
+	data    []byte
+}
+
+// newRedisLink returns an empty link sized as by RedisBloom
+func newRedisLink(entries uint64, errRate float64) (redisLink, error) {
+	if entries < 1 || !(errRate > 0 && errRate < 1) {
+		return redisLink{}, fmt.Errorf("bloom: invalid RedisBloom capacity %d or error rate %v", entries, errRate)
+	}
+	// RedisBloom rounds ln(2) and ln(2)^2 to these values.
+	bpe := -math.Log(errRate) / 0.480453013918201
+	bits := math.Max(1, float64(entries)*bpe)
+	if bits > float64(maxInt) {
+		return redisLink{}, fmt.Errorf("bloom: RedisBloom filter of %v bits is too large", bits)
+	}
+	// bloom_init truncates the number of bits, then rounds it up to whole
+	// 64-bit words.
+	numBytes := (uint64(bits) + 63) / 64 * 8
+	return redisLink{
+		bits:    8 * numBytes,
+		entries: entries,
+		errRate: errRate,
+		bpe:     bpe,
+		hashes:  uint32(math.Ceil(0.693147180559945 * bpe)),
+		data:    make([]byte, numBytes),
+	}, nil
+}
+
+// each calls f with the byte and mask of each bit of a hash in the link
+// until f returns false
+func (l *redisLink) each(a, b uint64, f func(i uint64, mask byte) bool) bool {
+	mod := l.bits
+	if l.n2 > 0 {
+		mod = 1 << l.n2
+	}
+	for i := uint64(0); i < uint64(l.hashes); i++ {
+		x := (a + i*b) % mod
+		if !f(x>>3, 1<<(x&7)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *redisLink) test(a, b uint64) bool {
+	return l.each(a, b, func(i uint64, mask byte) bool { return l.data[i]&mask != 0 })
+}
+
+func (l *redisLink) add(a, b uint64) {
+	l.each(a, b, func(i uint64, mask byte) bool {
+		l.data[i] |= mask
+		return true
+	})
+}
+
+// A RedisBloomFilter is a scalable Bloom filter laid out and hashed as by
+// RedisBloom (the BF.* commands of Redis Stack), so that filters can be
+// mirrored between Go and Redis with BF.SCANDUMP and BF.LOADCHUNK.
+//
+// Like in RedisBloom, the filter is a chain of Bloom filters: once the last
+// one holds its capacity, a filter with expansion times its capacity and half
+// its error rate is appended. Keys are hashed with MurmurHash64A, which
+// RedisBloom uses for the filters it has created since version 2.0; older
+// filters, hashed with 32-bit MurmurHash2, are not supported.
+type RedisBloomFilter struct {
+	size    uint64
+	options uint32
+	growth  uint32
+	links   []redisLink
+}
+
+// NewRedisBloom creates a new filter as by BF.RESERVE key errorRate capacity
+// EXPANSION expansion. If expansion is 0, the filter is created as with
+// NONSCALING instead: it holds at most capacity keys.
+func NewRedisBloom(capacity uint, errorRate float64, expansion uint) (*RedisBloomFilter, error) {
+	if !(errorRate > 0 && errorRate < 1) {
+		return nil, fmt.Errorf("bloom: invalid RedisBloom error rate %v", errorRate)
+	}
+	f := &RedisBloomFilter{options: redisForce64 | redisNoRound, growth: uint32(expansion)}
+	tightening := redisTightening
+	if expansion == 0 {
+		f.options |= redisNoScaling
+		f.growth = redisDefaultExpansion
+		tightening = 1
+	}
+	link, err := newRedisLink(uint64(capacity), errorRate*tightening)
+	if err != nil {
+		return nil, err
+	}
+	f.links = []redisLink{link}
+	return f, nil
+}
+
+// Count returns the number of keys added to the filter, as BF.CARD does
+func (f *RedisBloomFilter) Count() uint64 {
+	return f.size
+}
+
+// NumLinks returns the number of Bloom filters in the chain of the filter
+func (f *RedisBloomFilter) NumLinks() int {
+	return len(f.links)
+}
+
+// redisHashes returns the two hashes from which RedisBloom derives the bits
+// of a key
+func redisHashes(data []byte) (a, b uint64) {
+	a = murmurHash64A(data, murmur64aM)
+	return a, murmurHash64A(data, a)
+}
+
+// Add the data to the filter, as BF.ADD does. It returns true if the key was
+// not in the filter, and ErrFull if the filter is full and cannot scale.
+func (f *RedisBloomFilter) Add(data []byte) (bool, error) {
+	a, b := redisHashes(data)
+	for i := len(f.links) - 1; i >= 0; i-- {
+		if f.links[i].test(a, b) {
+			return false, nil
+		}
+	}
+	cur := &f.links[len(f.links)-1]
+	if cur.size >= cur.entries {
+		if f.options&redisNoScaling != 0 {
+			return false, ErrFull
+		}
+		link, err := newRedisLink(cur.entries*uint64(f.growth), cur.errRate*redisTightening)
+		if err != nil {
+			return false, err
+		}
+		f.links = append(f.links, link)
+		cur = &f.links[len(f.links)-1]
+	}
+	cur.add(a, b)
+	cur.size++
+	f.size++
+	return true, nil
+}
+
+// AddString to the filter, as BF.ADD does.
+func (f *RedisBloomFilter) AddString(data string) (bool, error) {
+	return f.Add(stringToBytes(data))
+}
+
+// Test returns true if the data is in the filter, false otherwise, as
+// BF.EXISTS does. If true, the result might be a false positive. If false,
+// the data is definitely not in the set.
+func (f *RedisBloomFilter) Test(data []byte) bool {
+	a, b := redisHashes(data)
+	for i := len(f.links) - 1; i >= 0; i-- {
+		if f.links[i].test(a, b) {
+			return true
+		}
+	}
+	return false
+}
+
+// TestString returns true if the string is in the filter, false otherwise.
+// If true, the result might be a false positive. If false, the data
+// is definitely not in the set.
+func (f *RedisBloomFilter) TestString(data string) bool {
+	return f.Test(stringToBytes(data))
+}
+
+// header returns the header of the filter, as BF.SCANDUMP returns it in its
+// first chunk: the packed, little-endian structs of the chain and of its
+// links.
+func (f *RedisBloomFilter) header() []byte {
+	b := make([]byte, redisHeaderSize, redisHeaderSize+redisLinkSize*len(f.links))
+	binary.LittleEndian.PutUint64(b, f.size)
+	binary.LittleEndian.PutUint32(b[8:], uint32(len(f.links)))
+	binary.LittleEndian.PutUint32(b[12:], f.options)
+	binary.LittleEndian.PutUint32(b[16:], f.growth)
+	for _, l := range f.links {
+		var link [redisLinkSize]byte
+		binary.LittleEndian.PutUint64(link[0:], uint64(len(l.data)))
+		binary.LittleEndian.PutUint64(link[8:], l.bits)
+		binary.LittleEndian.PutUint64(link[16:], l.size)
+		binary.LittleEndian.PutUint64(link[24:], math.Float64bits(l.errRate))
+		binary.LittleEndian.PutUint64(link[32:], math.Float64bits(l.bpe))
+		binary.LittleEndian.PutUint32(link[40:], l.hashes)
+		binary.LittleEndian.PutUint64(link[44:], l.entries)
+		link[52] = l.n2
+		b = append(b, link[:]...)
+	}
+	return b
+}
+
+// readHeader reads the header of a filter, and allocates its links. It
+// returns the number of bytes read.
+func (f *RedisBloomFilter) readHeader(stream io.Reader) (int64, error) {
+	var head [redisHeaderSize]byte
+	n, err := io.ReadFull(stream, head[:])
+	read := int64(n)
+	if err != nil {
+		return read, err
+	}
+	g := RedisBloomFilter{
+		size:    binary.LittleEndian.Uint64(head[0:]),
+		options: binary.LittleEndian.Uint32(head[12:]),
+		growth:  binary.LittleEndian.Uint32(head[16:]),
+	}
+	if g.options&^(redisNoRound|redisForce64|redisNoScaling) != 0 || g.options&redisForce64 == 0 {
+		return read, fmt.Errorf("bloom: unsupported RedisBloom options %#x", g.options)
+	}
+	nfilters := binary.LittleEndian.Uint32(head[8:])
+	if nfilters == 0 {
+		return read, errors.New("bloom: RedisBloom filter without links")
+	}
+	var size, total uint64
+	for i := uint32(0); i < nfilters; i++ {
+		var link [redisLinkSize]byte
+		n, err := io.ReadFull(stream, link[:])
+		read += int64(n)
+		if err != nil {
+			return read, err
+		}
+		numBytes := binary.LittleEndian.Uint64(link[0:])
+		l := redisLink{
+			bits:    binary.LittleEndian.Uint64(link[8:]),
+			size:    binary.LittleEndian.Uint64(link[16:]),
+			errRate: math.Float64frombits(binary.LittleEndian.Uint64(link[24:])),
+			bpe:     math.Float64frombits(binary.LittleEndian.Uint64(link[32:])),
+			hashes:  binary.LittleEndian.Uint32(link[40:]),
+			entries: binary.LittleEndian.Uint64(link[44:]),
+			n2:      link[52],
+		}
+		if numBytes == 0 || numBytes > uint64(maxInt)-total || l.bits != 8*numBytes ||
+			l.n2 > 63 || l.n2 > 0 && uint64(1)<<l.n2 > l.bits ||
+			l.hashes == 0 || l.hashes > maxReadHashes {
+			return read, fmt.Errorf("bloom: invalid RedisBloom link of %d bytes, %d bits and %d hashes", numBytes, l.bits, l.hashes)
+		}
+		total += numBytes
+		size += l.size
+		g.links = append(g.links, l)
+	}
+	if size != g.size {
+		return read, fmt.Errorf("bloom: RedisBloom filter of %d keys has links of %d keys", g.size, size)
+	}
+	for i := range g.links {
+		g.links[i].data = make([]byte, g.links[i].bits/8)
+	}
+	*f = g
+	return read, nil
+}
+
+// A RedisBloomChunk is a chunk of the encoding of a RedisBloomFilter, as
+// returned by BF.SCANDUMP and passed to BF.LOADCHUNK.
+type RedisBloomChunk struct {
+	Iterator int64
+	Data     []byte
+}
+
+// ScanDump returns the chunks which BF.SCANDUMP would return for the filter,
+// with data of at most maxChunkSize bytes. A filter is restored in Redis by
+// calling BF.LOADCHUNK key Iterator Data for each chunk, in order.
+//
+// The first chunk is the header of the filter, and the others the bitsets of
+// its links, which no chunk overlaps.
+func (f *RedisBloomFilter) ScanDump(maxChunkSize int) []RedisBloomChunk {
+	if maxChunkSize < 1 {
+		maxChunkSize = 1
+	}
+	chunks := []RedisBloomChunk{{Iterator: 1, Data: f.header()}}
+	iter := int64(1)
+	for _, l := range f.links {
+		for data := l.data; len(data) > 0; {
+			n := len(data)
+			if n > maxChunkSize {
+				n = maxChunkSize
+			}
+			iter += int64(n)
+			chunks = append(chunks, RedisBloomChunk{Iterator: iter, Data: append([]byte(nil), data[:n]...)})
+			data = data[n:]
+		}
+	}
+	return chunks
+}
+
+// LoadChunk loads a chunk returned by BF.SCANDUMP, as BF.LOADCHUNK does. The
+// chunk with iterator 1, the header, replaces the filter and must be loaded
+// first; the other chunks fill its bitsets.
+func (f *RedisBloomFilter) LoadChunk(iterator int64, data []byte) error {
+	if iterator == 1 {
+		r := bytes.NewReader(data)
+		var g RedisBloomFilter
+		if _, err := g.readHeader(r); err != nil {
+			return err
+		}
+		if r.Len() != 0 {
+			return errors.New("bloom: invalid RedisBloom header size")
+		}
+		*f = g
+		return nil
+	}
+	if len(f.links) == 0 {
+		return errors.New("bloom: the RedisBloom header must be loaded first")
+	}
+	pos := iterator - int64(len(data)) - 1
+	if pos < 0 {
+		return fmt.Errorf("bloom: invalid RedisBloom iterator %d", iterator)
+	}
+	for i := range f.links {
+		l := &f.links[i]
+		if uint64(pos) < uint64(len(l.data)) {
+			if len(data) > len(l.data)-int(pos) {
+				return fmt.Errorf("bloom: RedisBloom chunk at iterator %d is too large for its link", iterator)
+			}
+			copy(l.data[pos:], data)
+			return nil
+		}
+		pos -= int64(len(l.data))
+	}
+	return fmt.Errorf("bloom: RedisBloom iterator %d is past the end of the filter", iterator)
+}
+
+// WriteTo writes the filter to an i/o stream as the concatenation of the
+// chunks of BF.SCANDUMP: its header, then the bitsets of its links. It
+// returns the number of bytes written.
+func (f *RedisBloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	n, err := stream.Write(f.header())
+	written := int64(n)
+	for i := 0; err == nil && i < len(f.links); i++ {
+		n, err = stream.Write(f.links[i].data)
+		written += int64(n)
+	}
+	return written, err
+}
+
+// ReadFrom reads a filter written by WriteTo from an i/o stream. It returns
+// the number of bytes read.
+func (f *RedisBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	var g RedisBloomFilter
+	read, err := g.readHeader(stream)
+	for i := 0; err == nil && i < len(g.links); i++ {
+		var n int
+		n, err = io.ReadFull(stream, g.links[i].data)
+		read += int64(n)
+	}
+	if err != nil {
+		return read, err
+	}
+	*f = g
+	return read, nil
+}
+
+// MarshalBinary implements binary.BinaryMarshaler interface.
+func (f *RedisBloomFilter) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := f.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements binary.BinaryUnmarshaler interface.
+func (f *RedisBloomFilter) UnmarshalBinary(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := f.ReadFrom(buf)
+
+	return err
+}
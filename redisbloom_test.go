@@ -0,0 +1,273 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestMurmurHash64A(t *testing.T) {
+	// Reference values of the hashes of RedisBloom: MurmurHash64A with its
+	// multiplier as seed, then with the first hash as seed.
+	for _, c := range []struct {
+		data string
+		a, b uint64
+	}{
+		{"", 0x1ab11ea5a7b2c56e, 0xbbddcb5ab56dd547},
+		{"a", 0x4292cee227b9150a, 0x7e9b527031f50c11},
+		{"abc", 0xca52f3863690cd7b, 0x492e507dc7ce3d23},
+		{"Hello, world!", 0x965f7f1da1388e05, 0x9c958907567a41fc},
+		{"Nobody inspects the spammish repetition", 0xcd9b32f686dbf4cb, 0xf07c1c82e6b0c16b},
+	} {
+		if a, b := redisHashes([]byte(c.data)); a != c.a || b != c.b {
+			t.Errorf("hashes of %q are %x, %x, expected %x, %x", c.data, a, b, c.a, c.b)
+		}
+	}
+}
+
+func TestRedisBloomBasic(t *testing.T) {
+	f, err := NewRedisBloom(100, 0.01, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 100 keys at 0.01 take 958 bits, rounded up to 15 words.
+	if l := f.links[0]; l.bits != 960 || len(l.data) != 120 || l.hashes != 7 {
+		t.Fatalf("%d bits, %d bytes, %d hashes", l.bits, len(l.data), l.hashes)
+	}
+	if added, err := f.AddString("abc"); !added || err != nil {
+		t.Fatalf("the key should be added: %v", err)
+	}
+	if added, _ := f.AddString("abc"); added || f.Count() != 1 {
+		t.Error("the key should only be added once")
+	}
+	if !f.TestString("abc") || f.TestString("Hello, world!") {
+		t.Error("unexpected membership")
+	}
+	// Bit x of the bitset is bit x%8 of byte x/8.
+	a, b := uint64(0xca52f3863690cd7b), uint64(0x492e507dc7ce3d23)
+	expected := make([]byte, 120)
+	for i := uint64(0); i < 7; i++ {
+		x := (a + i*b) % 960
+		expected[x/8] |= 1 << (x % 8)
+	}
+	if !bytes.Equal(f.links[0].data, expected) {
+		t.Errorf("unexpected bitset %x", f.links[0].data)
+	}
+
+	for _, c := range []struct {
+		capacity uint
+		rate     float64
+	}{{0, 0.01}, {100, 0}, {100, 1}, {100, math.NaN()}} {
+		if _, err := NewRedisBloom(c.capacity, c.rate, 2); err == nil {
+			t.Errorf("capacity %d and error rate %v should not be accepted", c.capacity, c.rate)
+		}
+	}
+}
+
+func TestRedisBloomScaling(t *testing.T) {
+	f, _ := NewRedisBloom(100, 0.01, 2)
+	n := 1000
+	for i := 0; i < n; i++ {
+		f.AddString(strconv.Itoa(i))
+	}
+	// Keys which are false positives are not added, as with BF.ADD.
+	if f.NumLinks() != 4 || f.Count() > uint64(n) || f.Count() < uint64(n)*97/100 {
+		t.Fatalf("%d links, %d keys", f.NumLinks(), f.Count())
+	}
+	// Each link has twice the capacity and half the error rate of the
+	// previous one; the first one has half the error rate of the chain.
+	for i, l := range f.links {
+		if l.entries != 100<<uint(i) || l.errRate != 0.005/float64(int(1)<<uint(i)) {
+			t.Errorf("link %d: capacity %d, error rate %v", i, l.entries, l.errRate)
+		}
+	}
+	positives := 0
+	for i := 0; i < n; i++ {
+		if !f.TestString(strconv.Itoa(i)) {
+			t.Fatalf("key %d should be in", i)
+		}
+		if f.TestString(strconv.Itoa(n + i)) {
+			positives++
+		}
+	}
+	if rate := float64(positives) / float64(n); rate > 0.02 {
+		t.Errorf("false positive rate %f is too high", rate)
+	}
+
+	g, _ := NewRedisBloom(100, 0.01, 0)
+	var err error
+	for i := 0; err == nil; i++ {
+		_, err = g.AddString(strconv.Itoa(i))
+	}
+	if err != ErrFull || g.Count() != 100 || g.NumLinks() != 1 {
+		t.Errorf("non-scaling filters should hold their capacity: %v, %d keys", err, g.Count())
+	}
+}
+
+func TestRedisBloomScanDump(t *testing.T) {
+	f, _ := NewRedisBloom(100, 0.01, 2)
+	for i := 0; i < 400; i++ {
+		f.AddString(strconv.Itoa(i))
+	}
+	chunks := f.ScanDump(1000)
+	header := chunks[0]
+	if header.Iterator != 1 || len(header.Data) != 20+53*3 {
+		t.Fatalf("unexpected header chunk of %d bytes at %d", len(header.Data), header.Iterator)
+	}
+	h := header.Data
+	if binary.LittleEndian.Uint64(h) != f.Count() || binary.LittleEndian.Uint32(h[8:]) != 3 ||
+		binary.LittleEndian.Uint32(h[12:]) != redisForce64|redisNoRound || binary.LittleEndian.Uint32(h[16:]) != 2 {
+		t.Errorf("unexpected header %x", h[:20])
+	}
+	link := h[20:]
+	if binary.LittleEndian.Uint64(link) != 144 || binary.LittleEndian.Uint64(link[8:]) != 1152 ||
+		binary.LittleEndian.Uint64(link[16:]) != 100 || math.Float64frombits(binary.LittleEndian.Uint64(link[24:])) != 0.005 ||
+		binary.LittleEndian.Uint32(link[40:]) != 8 || binary.LittleEndian.Uint64(link[44:]) != 100 || link[52] != 0 {
+		t.Errorf("unexpected link %x", link[:53])
+	}
+
+	// The bitsets are split at the end of each link: 144, 312 and 696 bytes.
+	var sizes []int
+	iter := int64(1)
+	var data []byte
+	for _, c := range chunks[1:] {
+		iter += int64(len(c.Data))
+		if c.Iterator != iter {
+			t.Errorf("iterator %d, expected %d", c.Iterator, iter)
+		}
+		sizes = append(sizes, len(c.Data))
+		data = append(data, c.Data...)
+	}
+	if len(sizes) != 3 || sizes[0] != 144 || sizes[1] != 312 || sizes[2] != 696 {
+		t.Errorf("unexpected chunks of %v bytes", sizes)
+	}
+
+	for _, size := range []int{0, 7, 1000} {
+		var g RedisBloomFilter
+		for _, c := range f.ScanDump(size) {
+			if err := g.LoadChunk(c.Iterator, c.Data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if g.Count() != f.Count() || g.NumLinks() != 3 {
+			t.Fatalf("chunks of %d bytes: %d keys, %d links", size, g.Count(), g.NumLinks())
+		}
+		for i := 0; i < 400; i++ {
+			if !g.TestString(strconv.Itoa(i)) {
+				t.Fatalf("chunks of %d bytes: key %d should be in", size, i)
+			}
+		}
+	}
+
+	// WriteTo writes the chunks one after the other.
+	raw, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(raw, append(append([]byte(nil), h...), data...)) {
+		t.Error("WriteTo should write the chunks of ScanDump")
+	}
+	stream := bytes.NewReader(append(raw, "tail"...))
+	var g RedisBloomFilter
+	if n, err := g.ReadFrom(stream); err != nil || n != int64(len(raw)) || stream.Len() != 4 {
+		t.Fatalf("read %d bytes out of %d: %v", n, len(raw), err)
+	}
+	if again, _ := g.MarshalBinary(); !bytes.Equal(again, raw) {
+		t.Error("binary round trip changed the filter")
+	}
+	// A restored filter keeps scaling as the original one.
+	for i := 400; i < 1000; i++ {
+		g.AddString(strconv.Itoa(i))
+	}
+	if g.NumLinks() != 4 || !g.TestString("999") || g.links[3].errRate != 0.000625 {
+		t.Errorf("%d links after adding keys to the restored filter", g.NumLinks())
+	}
+}
+
+func TestRedisBloomFixture(t *testing.T) {
+	// testdata/redisbloom.bin holds the chunks of BF.SCANDUMP after
+	// BF.RESERVE key 0.01 100 and BF.ADD of legacyKeys. It was written by a
+	// Python port of bloom_init (deps/bloom/bloom.c) and of SB_NewChain and
+	// SBChain_GetEncodedHeader (src/sb.c), independent of this package, since
+	// no Redis server could be run to capture it.
+	raw, err := os.ReadFile("testdata/redisbloom.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f RedisBloomFilter
+	if n, err := f.ReadFrom(bytes.NewReader(raw)); err != nil || n != int64(len(raw)) {
+		t.Fatalf("read %d bytes out of %d: %v", n, len(raw), err)
+	}
+	if l := f.links[0]; l.bits != 1152 || len(l.data) != 144 || l.hashes != 8 || l.entries != 100 {
+		t.Errorf("%d bits, %d bytes, %d hashes, capacity %d", l.bits, len(l.data), l.hashes, l.entries)
+	}
+	g, err := NewRedisBloom(100, 0.01, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range legacyKeys {
+		if !f.TestString(key) {
+			t.Errorf("%v should be in the fixture", key)
+		}
+		g.AddString(key)
+	}
+	if again, _ := g.MarshalBinary(); !bytes.Equal(again, raw) {
+		t.Errorf("the filter differs from the fixture:\n%x\n%x", again, raw)
+	}
+}
+
+func TestRedisBloomInvalid(t *testing.T) {
+	f, _ := NewRedisBloom(100, 0.01, 2)
+	f.AddString("a")
+	chunks := f.ScanDump(100)
+	header := chunks[0].Data
+
+	for name, corrupt := range map[string]func([]byte){
+		"options":  func(b []byte) { b[12] = redisNoRound },
+		"links":    func(b []byte) { b[8] = 0 },
+		"size":     func(b []byte) { b[0] = 2 },
+		"bytes":    func(b []byte) { b[20] = 143 },
+		"bits":     func(b []byte) { b[28] = 0 },
+		"hashes":   func(b []byte) { b[60] = 0 },
+		"exponent": func(b []byte) { b[72] = 12 },
+	} {
+		bad := append([]byte(nil), header...)
+		corrupt(bad)
+		var g RedisBloomFilter
+		if err := g.LoadChunk(1, bad); err == nil {
+			t.Errorf("invalid %s should not be accepted", name)
+		}
+		if err := g.UnmarshalBinary(bad); err == nil {
+			t.Errorf("invalid %s should not be read", name)
+		}
+	}
+
+	var g RedisBloomFilter
+	if err := g.LoadChunk(chunks[1].Iterator, chunks[1].Data); err == nil {
+		t.Error("chunks should not be loaded before the header")
+	}
+	if err := g.LoadChunk(1, append(header, 0)); err == nil {
+		t.Error("headers with trailing data should not be accepted")
+	}
+	if err := g.LoadChunk(1, header); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []RedisBloomChunk{
+		{0, nil},
+		{100, make([]byte, 100)},
+		{150, make([]byte, 100)}, // past the end of the first link
+		{1000, make([]byte, 1)},
+	} {
+		if err := g.LoadChunk(c.Iterator, c.Data); err == nil {
+			t.Errorf("a chunk of %d bytes at %d should not be accepted", len(c.Data), c.Iterator)
+		}
+	}
+
+	raw, _ := f.MarshalBinary()
+	if err := g.UnmarshalBinary(raw[:len(raw)-1]); err == nil {
+		t.Error("truncated data should not be accepted")
+	}
+}
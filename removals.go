@@ -0,0 +1,109 @@
+package bloom
+
+import (
+	"bytes"
+	"io"
+)
+
+// A SetWithRemovals pairs a main filter with a filter of removed keys, a
+// cheap way to support deletion without counters. A key is reported as
+// present if it is in the main filter and not in the removal filter.
+//
+// Accuracy: a key is a false positive if it is a false positive of the main
+// filter and not of the removal filter. Removal is permanent: a removed key
+// which is added again still tests negative. Moreover, false positives of
+// the removal filter are false negatives of the set: an added key that was
+// never removed may test negative, with a probability equal to the false
+// positive rate of the removal filter. Size the removal filter accordingly.
+type SetWithRemovals struct {
+	main    *BloomFilter
+	removed *BloomFilter
+}
+
+// NewSetWithRemovals creates a set from a main filter and a removal filter.
+func NewSetWithRemovals(main, removed *BloomFilter) *SetWithRemovals {
+	return &SetWithRemovals{main, removed}
+}
+
+// Main returns the filter of the added keys.
+func (s *SetWithRemovals) Main() *BloomFilter {
+	return s.main
+}
+
+// Removed returns the filter of the removed keys.
+func (s *SetWithRemovals) Removed() *BloomFilter {
+	return s.removed
+}
+
+// Add data to the set. Returns the set (allows chaining)
+func (s *SetWithRemovals) Add(data []byte) *SetWithRemovals {
+	s.main.Add(data)
+	return s
+}
+
+// Remove data from the set. Returns the set (allows chaining)
+func (s *SetWithRemovals) Remove(data []byte) *SetWithRemovals {
+	s.removed.Add(data)
+	return s
+}
+
+// Test returns true if the data is in the main filter and not in the
+// removal filter, false otherwise. See SetWithRemovals for the accuracy.
+func (s *SetWithRemovals) Test(data []byte) bool {
+	h := s.main.hashes(data)
+	if !s.main.testHashes(h) {
+		return false
+	}
+	if !s.removed.hashing.same(s.main.hashing) {
+		h = s.removed.hashes(data)
+	}
+	return !s.removed.testHashes(h)
+}
+
+// WriteTo writes a binary representation of the set to an i/o stream:
+// the main filter followed by the removal filter, as written by their
+// WriteTo method. It returns the number of bytes written.
+func (s *SetWithRemovals) WriteTo(stream io.Writer) (int64, error) {
+	n1, err := s.main.WriteTo(stream)
+	if err != nil {
+		return n1, err
+	}
+	n2, err := s.removed.WriteTo(stream)
+	return n1 + n2, err
+}
+
+// ReadFrom reads a binary representation of the set (such as might have
+// been written by WriteTo()) from an i/o stream. It returns the number of
+// bytes read.
+func (s *SetWithRemovals) ReadFrom(stream io.Reader) (int64, error) {
+	main, removed := &BloomFilter{}, &BloomFilter{}
+	n1, err := main.ReadFrom(stream)
+	if err != nil {
+		return 0, err
+	}
+	n2, err := removed.ReadFrom(stream)
+	if err != nil {
+		return 0, err
+	}
+	s.main, s.removed = main, removed
+	return n1 + n2, nil
+}
+
+// MarshalBinary implements binary.BinaryMarshaler interface.
+func (s *SetWithRemovals) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := s.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements binary.BinaryUnmarshaler interface.
+func (s *SetWithRemovals) UnmarshalBinary(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := s.ReadFrom(buf)
+
+	return err
+}
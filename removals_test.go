@@ -0,0 +1,56 @@
+package bloom
+
+import (
+	"testing"
+)
+
+func TestSetWithRemovals(t *testing.T) {
+	s := NewSetWithRemovals(New(1000, 4), New(1000, 4))
+	n1 := []byte("Bess")
+	n2 := []byte("Jane")
+	n3 := []byte("Emma")
+	s.Add(n1).Add(n2)
+	if !s.Test(n1) || !s.Test(n2) {
+		t.Error("added keys should be in")
+	}
+	if s.Test(n3) {
+		t.Errorf("%v should not be in.", n3)
+	}
+	s.Remove(n1)
+	if s.Test(n1) {
+		t.Errorf("%v should not be in after removal.", n1)
+	}
+	if !s.Test(n2) {
+		t.Errorf("%v should still be in.", n2)
+	}
+	s.Add(n1)
+	if s.Test(n1) {
+		t.Errorf("%v should not be in: removal is permanent.", n1)
+	}
+	if !s.Main().Test(n1) || !s.Removed().Test(n1) {
+		t.Error("unexpected filters")
+	}
+}
+
+func TestSetWithRemovalsEncodeDecode(t *testing.T) {
+	s := NewSetWithRemovals(New(1000, 4), New(500, 3))
+	s.Add([]byte("one")).Add([]byte("two"))
+	s.Remove([]byte("two"))
+	data, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var g SetWithRemovals
+	if err := g.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !g.Main().Equal(s.Main()) || !g.Removed().Equal(s.Removed()) {
+		t.Error("filters are not equal")
+	}
+	if !g.Test([]byte("one")) || g.Test([]byte("two")) {
+		t.Error("unexpected membership after decoding")
+	}
+	if err := g.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Error("expected an error for truncated data")
+	}
+}
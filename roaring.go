@@ -0,0 +1,200 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// Constants of the portable roaring format, see
+// https://github.com/RoaringBitmap/RoaringFormatSpec
+const (
+	roaringCookieNoRuns     = 12346
+	roaringCookie           = 12347
+	roaringNoOffsetMax      = 4
+	roaringArrayMax         = 4096
+	roaringBitmapWords      = 1024
+	roaringContainerBitSize = 1 << 16
+)
+
+var errRoaringTruncated = errors.New("bloom: roaring bitmap is truncated")
+
+// ToRoaring returns the positions of the set bits of the filter as a roaring
+// bitmap in the portable serialization format, which the roaring libraries
+// (Go, Java, C, ...) read with their ReadFrom or deserialize methods. Sparse
+// filters are much smaller in this format. Roaring bitmaps hold 32-bit
+// positions, so m must be at most 2^32.
+func (f *BloomFilter) ToRoaring() ([]byte, error) {
+	if uint64(f.m) > 1<<32 {
+		return nil, fmt.Errorf("bloom: m=%d is too large for a roaring bitmap", f.m)
+	}
+	words := f.b.Words()
+	// Each container holds the bits of 1024 words.
+	type container struct {
+		key         uint16
+		cardinality int
+		words       []uint64
+	}
+	var containers []container
+	for start := 0; start < len(words); start += roaringBitmapWords {
+		end := start + roaringBitmapWords
+		if end > len(words) {
+			end = len(words)
+		}
+		cardinality := 0
+		for _, w := range words[start:end] {
+			cardinality += bits.OnesCount64(w)
+		}
+		if cardinality > 0 {
+			containers = append(containers, container{uint16(start / roaringBitmapWords), cardinality, words[start:end]})
+		}
+	}
+
+	data := make([]byte, 8, 8+8*len(containers))
+	binary.LittleEndian.PutUint32(data, roaringCookieNoRuns)
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(containers)))
+	for _, c := range containers {
+		data = appendUint16(data, c.key)
+		data = appendUint16(data, uint16(c.cardinality-1))
+	}
+	offset := len(data) + 4*len(containers)
+	for _, c := range containers {
+		data = appendUint32(data, uint32(offset))
+		if c.cardinality > roaringArrayMax {
+			offset += 8 * roaringBitmapWords
+		} else {
+			offset += 2 * c.cardinality
+		}
+	}
+	for _, c := range containers {
+		if c.cardinality > roaringArrayMax {
+			for i := 0; i < roaringBitmapWords; i++ {
+				var w uint64
+				if i < len(c.words) {
+					w = c.words[i]
+				}
+				data = appendUint64(data, w)
+			}
+			continue
+		}
+		for i, w := range c.words {
+			for w != 0 {
+				data = appendUint16(data, uint16(64*i+bits.TrailingZeros64(w)))
+				w &= w - 1
+			}
+		}
+	}
+	return data, nil
+}
+
+// FromRoaring creates a new Bloom filter with _m_ bits and _k_ hashing
+// functions from the positions of its set bits, given as a roaring bitmap in
+// the portable serialization format (see ToRoaring). All three kinds of
+// roaring containers (arrays, bitmaps and runs) are supported.
+func FromRoaring(data []byte, m, k uint) (*BloomFilter, error) {
+	f := New(m, k)
+	if len(data) < 4 {
+		return nil, errRoaringTruncated
+	}
+	var size int
+	var runs []byte
+	cookie := binary.LittleEndian.Uint32(data)
+	pos := 4
+	switch {
+	case cookie == roaringCookieNoRuns:
+		if len(data) < 8 {
+			return nil, errRoaringTruncated
+		}
+		size = int(binary.LittleEndian.Uint32(data[4:]))
+		pos = 8
+	case cookie&0xffff == roaringCookie:
+		size = int(cookie>>16) + 1
+		if len(data) < pos+(size+7)/8 {
+			return nil, errRoaringTruncated
+		}
+		runs = data[pos : pos+(size+7)/8]
+		pos += (size + 7) / 8
+	default:
+		return nil, errors.New("bloom: not a roaring bitmap")
+	}
+	if size > roaringContainerBitSize || len(data) < pos+4*size {
+		return nil, errRoaringTruncated
+	}
+	header := data[pos : pos+4*size]
+	pos += 4 * size
+	if runs == nil || size >= roaringNoOffsetMax {
+		// Skip the offsets: the containers are contiguous.
+		pos += 4 * size
+	}
+
+	set := func(p uint64) error {
+		if p >= uint64(f.m) {
+			return fmt.Errorf("bloom: roaring bitmap holds position %d beyond m=%d", p, f.m)
+		}
+		f.b.Set(uint(p))
+		return nil
+	}
+	for i := 0; i < size; i++ {
+		base := uint64(binary.LittleEndian.Uint16(header[4*i:])) << 16
+		cardinality := int(binary.LittleEndian.Uint16(header[4*i+2:])) + 1
+		switch {
+		case runs != nil && runs[i/8]&(1<<(i%8)) != 0:
+			if len(data) < pos+2 {
+				return nil, errRoaringTruncated
+			}
+			n := int(binary.LittleEndian.Uint16(data[pos:]))
+			pos += 2
+			if len(data) < pos+4*n {
+				return nil, errRoaringTruncated
+			}
+			for j := 0; j < n; j++ {
+				start := uint64(binary.LittleEndian.Uint16(data[pos+4*j:]))
+				length := uint64(binary.LittleEndian.Uint16(data[pos+4*j+2:]))
+				for p := start; p <= start+length; p++ {
+					if err := set(base + p); err != nil {
+						return nil, err
+					}
+				}
+			}
+			pos += 4 * n
+		case cardinality > roaringArrayMax:
+			if len(data) < pos+8*roaringBitmapWords {
+				return nil, errRoaringTruncated
+			}
+			for j := 0; j < roaringBitmapWords; j++ {
+				w := binary.LittleEndian.Uint64(data[pos+8*j:])
+				for w != 0 {
+					if err := set(base + uint64(64*j+bits.TrailingZeros64(w))); err != nil {
+						return nil, err
+					}
+					w &= w - 1
+				}
+			}
+			pos += 8 * roaringBitmapWords
+		default:
+			if len(data) < pos+2*cardinality {
+				return nil, errRoaringTruncated
+			}
+			for j := 0; j < cardinality; j++ {
+				if err := set(base + uint64(binary.LittleEndian.Uint16(data[pos+2*j:]))); err != nil {
+					return nil, err
+				}
+			}
+			pos += 2 * cardinality
+		}
+	}
+	return f, nil
+}
+
+func appendUint16(data []byte, v uint16) []byte {
+	return append(data, byte(v), byte(v>>8))
+}
+
+func appendUint32(data []byte, v uint32) []byte {
+	return append(data, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func appendUint64(data []byte, v uint64) []byte {
+	return appendUint32(appendUint32(data, uint32(v)), uint32(v>>32))
+}
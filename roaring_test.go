@@ -0,0 +1,57 @@
+package bloom
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestToFromRoaring(t *testing.T) {
+	for _, n := range []int{0, 10, 3000, 100000} {
+		f := New(1<<20+17, 3)
+		for i := 0; i < n; i++ {
+			f.AddString(fmt.Sprint(i))
+		}
+		data, err := f.ToRoaring()
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := FromRoaring(data, f.Cap(), f.K())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !g.Equal(f) {
+			t.Errorf("%d items: filters are not equal", n)
+		}
+	}
+}
+
+func TestFromRoaringRuns(t *testing.T) {
+	// Bits 10 to 14, as a single run container.
+	data := []byte{
+		0x3b, 0x30, 0x00, 0x00, // cookie, one container
+		0x01,                   // the container is a run container
+		0x00, 0x00, 0x04, 0x00, // key 0, cardinality 5
+		0x01, 0x00, 0x0a, 0x00, 0x04, 0x00, // one run: start 10, length 5
+	}
+	f, err := FromRoaring(data, 64, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.b.Count() != 5 {
+		t.Errorf("unexpected number of bits %d", f.b.Count())
+	}
+	for i := uint(10); i < 15; i++ {
+		if !f.b.Test(i) {
+			t.Errorf("bit %d should be set", i)
+		}
+	}
+	if _, err := FromRoaring(data, 12, 3); err == nil {
+		t.Error("expected an error for positions beyond m")
+	}
+	if _, err := FromRoaring(data[:len(data)-1], 64, 3); err == nil {
+		t.Error("expected an error for a truncated bitmap")
+	}
+	if _, err := FromRoaring([]byte{1, 2, 3, 4, 5, 6, 7, 8}, 64, 3); err == nil {
+		t.Error("expected an error for an invalid cookie")
+	}
+}
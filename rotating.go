@@ -0,0 +1,255 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// A RotatingBloomFilter is a Bloom filter which forgets old keys, e.g., to
+// tell whether a key was seen in the last minutes. It is made of several
+// generations, plain Bloom filters of the same size: keys are added to the
+// current generation and tested against all of them. Rotate clears the
+// oldest generation, which becomes the current one, so that a key is
+// forgotten after as many rotations as there are generations.
+//
+// Rotations may be automatic, see SetInterval. With g generations rotated
+// every d, a key is then remembered for at least (g-1)*d and at most g*d.
+// Each generation must be sized for the keys added between two rotations;
+// the false positive rate is about g times that of a generation.
+type RotatingBloomFilter struct {
+	generations []*BloomFilter
+	current     int           // index of the generation which receives keys
+	interval    time.Duration // time between automatic rotations, if positive
+	last        time.Time     // time of the last automatic rotation
+	now         func() time.Time
+}
+
+// NewRotating creates a new rotating Bloom filter with the given number of
+// generations, each with _m_ bits and _k_ hashing functions. We force the
+// number of generations to be at least one.
+func NewRotating(generations uint, m uint, k uint) *RotatingBloomFilter {
+	r := &RotatingBloomFilter{now: time.Now}
+	for i := uint(0); i < max(1, generations); i++ {
+		r.generations = append(r.generations, New(m, k))
+	}
+	return r
+}
+
+// NewRotatingWithEstimates creates a new rotating Bloom filter with the
+// given number of generations, each for about n items with fp false
+// positive rate.
+func NewRotatingWithEstimates(generations uint, n uint, fp float64) *RotatingBloomFilter {
+	m, k := EstimateParameters(n, fp)
+	return NewRotating(generations, m, k)
+}
+
+// Generations returns the number of generations of the filter
+func (r *RotatingBloomFilter) Generations() int {
+	return len(r.generations)
+}
+
+// Cap returns the capacity, _m_, of each generation
+func (r *RotatingBloomFilter) Cap() uint {
+	return r.generations[0].Cap()
+}
+
+// K returns the number of hash functions used in each generation
+func (r *RotatingBloomFilter) K() uint {
+	return r.generations[0].K()
+}
+
+// SetInterval makes the filter rotate every d, starting now: the methods of
+// the filter first rotate it once for each interval elapsed since the last
+// rotation, so that no goroutine is needed. A zero interval disables
+// automatic rotations.
+func (r *RotatingBloomFilter) SetInterval(d time.Duration) {
+	r.interval = d
+	r.last = r.now()
+}
+
+// Interval returns the time between automatic rotations, zero if they are
+// disabled.
+func (r *RotatingBloomFilter) Interval() time.Duration {
+	return r.interval
+}
+
+// expire performs the automatic rotations which are due
+func (r *RotatingBloomFilter) expire() {
+	if r.interval <= 0 {
+		return
+	}
+	elapsed := r.now().Sub(r.last)
+	if elapsed < r.interval {
+		return
+	}
+	n := elapsed / r.interval
+	r.last = r.last.Add(n * r.interval)
+	if n > time.Duration(len(r.generations)) {
+		n = time.Duration(len(r.generations))
+	}
+	for ; n > 0; n-- {
+		r.Rotate()
+	}
+}
+
+// Rotate clears the oldest generation, forgetting its keys, and makes it
+// the current one. Returns the filter (allows chaining)
+func (r *RotatingBloomFilter) Rotate() *RotatingBloomFilter {
+	r.current = (r.current + 1) % len(r.generations)
+	r.generations[r.current].ClearAll()
+	return r
+}
+
+// Add data to the current generation. Returns the filter (allows chaining)
+func (r *RotatingBloomFilter) Add(data []byte) *RotatingBloomFilter {
+	r.expire()
+	r.generations[r.current].Add(data)
+	return r
+}
+
+// AddString to the current generation. Returns the filter (allows chaining)
+func (r *RotatingBloomFilter) AddString(data string) *RotatingBloomFilter {
+	return r.Add(stringToBytes(data))
+}
+
+// Test returns true if the data is in any generation of the filter, false
+// otherwise. If true, the result might be a false positive. If false, the
+// data is definitely not in the set.
+func (r *RotatingBloomFilter) Test(data []byte) bool {
+	r.expire()
+	h := baseHashes(data)
+	for _, f := range r.generations {
+		if f.testHashes(h) {
+			return true
+		}
+	}
+	return false
+}
+
+// TestString returns true if the string is in any generation of the filter,
+// false otherwise. If true, the result might be a false positive. If false,
+// the data is definitely not in the set.
+func (r *RotatingBloomFilter) TestString(data string) bool {
+	return r.Test(stringToBytes(data))
+}
+
+// TestAndAdd is equivalent to calling Test(data) then Add(data).
+// Returns the result of Test.
+func (r *RotatingBloomFilter) TestAndAdd(data []byte) bool {
+	present := r.Test(data)
+	r.generations[r.current].Add(data)
+	return present
+}
+
+// ClearAll clears all the generations, removing all keys
+func (r *RotatingBloomFilter) ClearAll() *RotatingBloomFilter {
+	for _, f := range r.generations {
+		f.ClearAll()
+	}
+	return r
+}
+
+// rotatingHeader is the header of the binary representation of a
+// RotatingBloomFilter
+type rotatingHeader struct {
+	Generations uint64
+	Current     uint64
+	Interval    int64 // nanoseconds
+	Last        int64 // Unix time in nanoseconds, if Interval is positive
+}
+
+// WriteTo writes a binary representation of the RotatingBloomFilter to an
+// i/o stream: the number of generations, the current one, the interval and
+// the time of the last automatic rotation, followed by each generation as
+// written by BloomFilter.WriteTo. It returns the number of bytes written.
+func (r *RotatingBloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	header := rotatingHeader{
+		Generations: uint64(len(r.generations)),
+		Current:     uint64(r.current),
+		Interval:    int64(r.interval),
+	}
+	if r.interval > 0 {
+		header.Last = r.last.UnixNano()
+	}
+	err := binary.Write(stream, binary.BigEndian, &header)
+	if err != nil {
+		return 0, err
+	}
+	n := int64(binary.Size(&header))
+	for _, f := range r.generations {
+		numBytes, err := f.WriteTo(stream)
+		n += numBytes
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// ReadFrom reads a binary representation of the RotatingBloomFilter (such as
+// might have been written by WriteTo()) from an i/o stream. It returns the
+// number of bytes read. Automatic rotations resume from the time of the last
+// rotation, so the keys which have expired since the filter was written are
+// forgotten.
+func (r *RotatingBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	var header rotatingHeader
+	err := binary.Read(stream, binary.BigEndian, &header)
+	if err != nil {
+		return 0, err
+	}
+	if header.Generations == 0 || header.Current >= header.Generations ||
+		uint64(int(header.Generations)) != header.Generations || header.Interval < 0 {
+		return 0, errors.New("bloom: invalid rotating filter parameters")
+	}
+	g := &RotatingBloomFilter{
+		current:  int(header.Current),
+		interval: time.Duration(header.Interval),
+		now:      r.now,
+	}
+	if g.now == nil {
+		g.now = time.Now
+	}
+	if g.interval > 0 {
+		g.last = time.Unix(0, header.Last)
+	}
+	n := int64(binary.Size(&header))
+	for i := uint64(0); i < header.Generations; i++ {
+		f := &BloomFilter{}
+		numBytes, err := f.ReadFrom(stream)
+		n += numBytes
+		if err != nil {
+			return n, err
+		}
+		if f.hashing != (hashing{}) {
+			return n, errors.New("bloom: generations must use the default hash functions")
+		}
+		if i > 0 && (f.m != g.generations[0].m || f.k != g.generations[0].k) {
+			return n, errors.New("bloom: generations have different parameters")
+		}
+		g.generations = append(g.generations, f)
+	}
+	*r = *g
+	return n, nil
+}
+
+// MarshalBinary implements binary.BinaryMarshaler interface.
+func (r *RotatingBloomFilter) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := r.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements binary.BinaryUnmarshaler interface.
+func (r *RotatingBloomFilter) UnmarshalBinary(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := r.ReadFrom(buf)
+
+	return err
+}
@@ -0,0 +1,82 @@
+package bloom
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRotating(t *testing.T) {
+	r := NewRotatingWithEstimates(3, 100, 0.01)
+	if r.Generations() != 3 || r.Cap() == 0 || r.K() == 0 {
+		t.Fatal("unexpected parameters")
+	}
+	if r.TestAndAdd([]byte("a")) {
+		t.Error("a should not be in an empty filter")
+	}
+	r.Rotate().AddString("b")
+	r.Rotate()
+	if !r.TestString("a") || !r.TestString("b") {
+		t.Error("keys should be remembered for as many rotations as generations")
+	}
+	r.Rotate()
+	if r.TestString("a") || !r.TestString("b") {
+		t.Error("the oldest keys should be forgotten")
+	}
+	r.ClearAll()
+	if r.TestString("b") {
+		t.Error("ClearAll should forget all keys")
+	}
+}
+
+func TestRotatingInterval(t *testing.T) {
+	now := time.Unix(1000, 0)
+	r := NewRotating(2, 1000, 4)
+	r.now = func() time.Time { return now }
+	r.SetInterval(time.Minute)
+	r.AddString("a")
+	now = now.Add(90 * time.Second)
+	r.AddString("b")
+	if !r.TestString("a") || !r.TestString("b") {
+		t.Error("keys should be remembered for at least one interval")
+	}
+	now = now.Add(40 * time.Second)
+	if r.TestString("a") || !r.TestString("b") {
+		t.Error("keys should be forgotten after two intervals")
+	}
+	now = now.Add(time.Hour)
+	if r.TestString("b") || r.Interval() != time.Minute {
+		t.Error("all keys should be forgotten after many intervals")
+	}
+}
+
+func TestRotatingEncodeDecode(t *testing.T) {
+	now := time.Unix(1000, 0)
+	r := NewRotating(3, 1000, 4)
+	r.now = func() time.Time { return now }
+	r.SetInterval(time.Minute)
+	r.AddString("a")
+	now = now.Add(time.Minute)
+	r.AddString("b")
+	data, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &RotatingBloomFilter{now: r.now}
+	if err := g.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if g.Generations() != 3 || g.current != r.current || !g.last.Equal(r.last) || g.Interval() != time.Minute {
+		t.Error("the rotation state should be preserved")
+	}
+	if !g.TestString("a") || !g.TestString("b") {
+		t.Error("the keys should be preserved")
+	}
+	now = now.Add(2 * time.Minute)
+	if g.TestString("a") || !g.TestString("b") {
+		t.Error("rotations should resume after decoding")
+	}
+	data[15] = 3 // current generation
+	if err := g.UnmarshalBinary(data); err == nil {
+		t.Error("invalid parameters should be rejected")
+	}
+}
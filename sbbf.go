@@ -0,0 +1,245 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Constants of the split block Bloom filters of Apache Parquet, see
+// https://github.com/apache/parquet-format/blob/master/BloomFilter.md
+const (
+	sbbfBlockBytes = 32
+	sbbfMinBytes   = sbbfBlockBytes
+	sbbfMaxBytes   = 128 << 20
+)
+
+// sbbfSalt holds the odd constants that derive the eight bits of a key in
+// its block
+var sbbfSalt = [8]uint32{
+	0x47b6137b, 0x44974d91, 0x8824ad5b, 0xa2b7289d,
+	0x705495c7, 0x2df1424b, 0x9efc4947, 0x5c6bfb31,
+}
+
+// A SplitBlockBloomFilter is a split block Bloom filter (SBBF), the Bloom
+// filter of Apache Parquet column chunks. Its bits are grouped in blocks of
+// 256 bits, seen as eight 32-bit words, and each key sets one bit in every
+// word of one block. Keys are hashed with xxHash64, so that filters are
+// interchangeable with those written by other Parquet implementations (Spark,
+// Arrow, parquet-mr, ...).
+//
+// Parquet hashes the plain encoding of values: the bytes of a BYTE_ARRAY or
+// FIXED_LEN_BYTE_ARRAY, and the little-endian bytes of an INT32, INT64,
+// FLOAT or DOUBLE. Add and Test take that encoding; AddHash and TestHash take
+// its xxHash64 directly.
+type SplitBlockBloomFilter struct {
+	words []uint32
+}
+
+// NewSplitBlock creates a new split block Bloom filter of numBytes bytes,
+// rounded up to a power of two between 32 bytes and 128 MiB as Parquet
+// writers do.
+func NewSplitBlock(numBytes uint) *SplitBlockBloomFilter {
+	n := uint(sbbfMinBytes)
+	for n < numBytes && n < sbbfMaxBytes {
+		n *= 2
+	}
+	return &SplitBlockBloomFilter{words: make([]uint32, n/4)}
+}
+
+// NewSplitBlockWithEstimates creates a new split block Bloom filter for about
+// n items with fp false positive rate, sized as by Parquet writers. Like that
+// of a BlockedBloomFilter, the actual rate is a bit higher than fp.
+func NewSplitBlockWithEstimates(n uint, fp float64) *SplitBlockBloomFilter {
+	// With 8 bits per key, the false positive rate of m bits holding n keys
+	// is about (1 - exp(-8n/m))^8.
+	bits := -8 * float64(n) / math.Log(1-math.Pow(fp, 1.0/8))
+	return NewSplitBlock(uint(math.Min(math.Ceil(bits/8), sbbfMaxBytes)))
+}
+
+// NewSplitBlockFromBytes creates a split block Bloom filter from its bitset,
+// as stored in a Parquet file after the header. The length of the data must
+// be a multiple of 32 bytes. The data is copied.
+func NewSplitBlockFromBytes(data []byte) (*SplitBlockBloomFilter, error) {
+	if len(data) == 0 || len(data)%sbbfBlockBytes != 0 || len(data) > sbbfMaxBytes {
+		return nil, fmt.Errorf("bloom: invalid split block Bloom filter size %d", len(data))
+	}
+	f := &SplitBlockBloomFilter{words: make([]uint32, len(data)/4)}
+	for i := range f.words {
+		f.words[i] = binary.LittleEndian.Uint32(data[4*i:])
+	}
+	return f, nil
+}
+
+// NumBytes returns the size of the bitset of the filter in bytes
+func (f *SplitBlockBloomFilter) NumBytes() int {
+	return 4 * len(f.words)
+}
+
+// Bytes returns the bitset of the filter, as stored in a Parquet file after
+// the header: the words of the blocks, in little-endian order.
+func (f *SplitBlockBloomFilter) Bytes() []byte {
+	data := make([]byte, 4*len(f.words))
+	for i, w := range f.words {
+		binary.LittleEndian.PutUint32(data[4*i:], w)
+	}
+	return data
+}
+
+// block returns the words of the block of a hash, selected by its high bits
+func (f *SplitBlockBloomFilter) block(h uint64) []uint32 {
+	blocks := uint64(len(f.words) / 8)
+	i := (h >> 32) * blocks >> 32
+	return f.words[8*i : 8*i+8]
+}
+
+// AddHash adds the xxHash64 of a value to the filter. Returns the filter
+// (allows chaining)
+func (f *SplitBlockBloomFilter) AddHash(h uint64) *SplitBlockBloomFilter {
+	b := f.block(h)
+	for i, salt := range sbbfSalt {
+		b[i] |= 1 << ((uint32(h) * salt) >> 27)
+	}
+	return f
+}
+
+// TestHash returns true if the xxHash64 of a value is in the filter, false
+// otherwise. If true, the result might be a false positive. If false, the
+// value is definitely not in the set.
+func (f *SplitBlockBloomFilter) TestHash(h uint64) bool {
+	b := f.block(h)
+	for i, salt := range sbbfSalt {
+		if b[i]&(1<<((uint32(h)*salt)>>27)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Add the plain encoding of a value to the filter. Returns the filter (allows
+// chaining)
+func (f *SplitBlockBloomFilter) Add(data []byte) *SplitBlockBloomFilter {
+	return f.AddHash(xxhash64(data, 0))
+}
+
+// AddString to the filter. Returns the filter (allows chaining)
+func (f *SplitBlockBloomFilter) AddString(data string) *SplitBlockBloomFilter {
+	return f.Add(stringToBytes(data))
+}
+
+// Test returns true if the plain encoding of a value is in the filter, false
+// otherwise. If true, the result might be a false positive. If false, the
+// value is definitely not in the set.
+func (f *SplitBlockBloomFilter) Test(data []byte) bool {
+	return f.TestHash(xxhash64(data, 0))
+}
+
+// TestString returns true if the string is in the filter, false otherwise.
+// If true, the result might be a false positive. If false, the data
+// is definitely not in the set.
+func (f *SplitBlockBloomFilter) TestString(data string) bool {
+	return f.Test(stringToBytes(data))
+}
+
+// ClearAll clears all the data in the filter, removing all keys
+func (f *SplitBlockBloomFilter) ClearAll() *SplitBlockBloomFilter {
+	for i := range f.words {
+		f.words[i] = 0
+	}
+	return f
+}
+
+// sbbfHeader returns the BloomFilterHeader of a Parquet file, in the Thrift
+// compact protocol: numBytes, then the BLOCK algorithm, the XXHASH hash and
+// UNCOMPRESSED compression, which are unions of empty structs.
+func sbbfHeader(numBytes int) []byte {
+	header := []byte{0x15}
+	v := uint32(int32(numBytes)<<1) ^ uint32(int32(numBytes)>>31)
+	for ; v >= 0x80; v >>= 7 {
+		header = append(header, byte(v)|0x80)
+	}
+	header = append(header, byte(v))
+	return append(header,
+		0x1c, 0x1c, 0x00, 0x00, // algorithm: BLOCK
+		0x1c, 0x1c, 0x00, 0x00, // hash: XXHASH
+		0x1c, 0x1c, 0x00, 0x00, // compression: UNCOMPRESSED
+		0x00)
+}
+
+// WriteTo writes the filter to an i/o stream as in a Parquet file: a Thrift
+// BloomFilterHeader followed by the bitset. It returns the number of bytes
+// written.
+func (f *SplitBlockBloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	n, err := stream.Write(sbbfHeader(f.NumBytes()))
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := stream.Write(f.Bytes())
+	return int64(n + m), err
+}
+
+// ReadFrom reads a filter (such as might have been written by WriteTo(), or
+// found in a Parquet file at the bloom_filter_offset of a column chunk) from
+// an i/o stream. It reads no more than the header and the bitset, and returns
+// the number of bytes read.
+func (f *SplitBlockBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	r := &thriftReader{r: stream}
+	numBytes := -1
+	err := r.fields(func(id int16, typ byte) error {
+		switch {
+		case id == 1 && typ == thriftI32:
+			v, err := r.varint()
+			numBytes = int(int32(uint32(v>>1) ^ -uint32(v&1)))
+			return err
+		case id >= 2 && id <= 4 && typ == thriftStruct:
+			// BLOCK, XXHASH and UNCOMPRESSED are all the first field of
+			// their union.
+			found := false
+			err := r.fields(func(id int16, typ byte) error {
+				found = found || id == 1 && typ == thriftStruct
+				return r.skip(typ)
+			})
+			if err == nil && !found {
+				err = errors.New("bloom: unsupported Parquet Bloom filter algorithm, hash or compression")
+			}
+			return err
+		}
+		return r.skip(typ)
+	})
+	if err != nil {
+		return r.n, err
+	}
+	if numBytes <= 0 || numBytes%sbbfBlockBytes != 0 || numBytes > sbbfMaxBytes {
+		return r.n, fmt.Errorf("bloom: invalid split block Bloom filter size %d", numBytes)
+	}
+	data := make([]byte, numBytes)
+	n, err := io.ReadFull(stream, data)
+	if err != nil {
+		return r.n + int64(n), err
+	}
+	g, _ := NewSplitBlockFromBytes(data)
+	*f = *g
+	return r.n + int64(n), nil
+}
+
+// MarshalBinary implements binary.BinaryMarshaler interface.
+func (f *SplitBlockBloomFilter) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := f.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements binary.BinaryUnmarshaler interface.
+func (f *SplitBlockBloomFilter) UnmarshalBinary(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := f.ReadFrom(buf)
+
+	return err
+}
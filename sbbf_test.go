@@ -0,0 +1,139 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestXXHash64(t *testing.T) {
+	// Reference values of xxHash64 with a zero seed.
+	for _, c := range []struct {
+		data     string
+		expected uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"abc", 0x44bc2cf5ad770999},
+		{"Nobody inspects the spammish repetition", 0xfbcea83c8a378bf1},
+	} {
+		if h := xxhash64([]byte(c.data), 0); h != c.expected {
+			t.Errorf("xxhash64(%q) = %x, expected %x", c.data, h, c.expected)
+		}
+	}
+}
+
+func TestSplitBlockBasic(t *testing.T) {
+	f := NewSplitBlock(1000)
+	if f.NumBytes() != 1024 {
+		t.Errorf("size %d, expected 1024", f.NumBytes())
+	}
+	n1 := []byte("Bess")
+	n2 := []byte("Jane")
+	f.Add(n1)
+	if !f.Test(n1) {
+		t.Errorf("%v should be in.", n1)
+	}
+	if f.Test(n2) {
+		t.Errorf("%v should not be in.", n2)
+	}
+	f.AddString("Jane")
+	if !f.TestString("Jane") || !f.TestHash(xxhash64(n2, 0)) {
+		t.Errorf("%v should be in.", n2)
+	}
+	// Each key sets one bit in each word of its block.
+	g := NewSplitBlock(64).AddHash(0)
+	if !bytes.Equal(g.Bytes()[:32], []byte{
+		1, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0,
+		1, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0,
+	}) {
+		t.Errorf("unexpected bitset %v", g.Bytes())
+	}
+	f.ClearAll()
+	if f.Test(n1) || f.Test(n2) {
+		t.Error("ClearAll should remove all keys")
+	}
+}
+
+func TestSplitBlockSizes(t *testing.T) {
+	for _, c := range []struct{ numBytes, expected uint }{{0, 32}, {32, 32}, {33, 64}, {1 << 30, 128 << 20}} {
+		if n := NewSplitBlock(c.numBytes).NumBytes(); n != int(c.expected) {
+			t.Errorf("NewSplitBlock(%d) has %d bytes, expected %d", c.numBytes, n, c.expected)
+		}
+	}
+	if _, err := NewSplitBlockFromBytes(make([]byte, 48)); err == nil {
+		t.Error("the size should be a multiple of 32 bytes")
+	}
+}
+
+func TestSplitBlockFPP(t *testing.T) {
+	n := uint32(100000)
+	f := NewSplitBlockWithEstimates(uint(n), 0.01)
+	key := make([]byte, 8)
+	for i := uint32(0); i < n; i++ {
+		binary.LittleEndian.PutUint64(key, uint64(i))
+		f.Add(key)
+	}
+	positives := 0
+	for i := n; i < 2*n; i++ {
+		binary.LittleEndian.PutUint64(key, uint64(i))
+		if f.Test(key) {
+			positives++
+		}
+	}
+	// Like other blocked filters, the rate is a bit higher than the target.
+	if rate := float64(positives) / float64(n); rate > 0.0125 {
+		t.Errorf("false positive rate %f is too high", rate)
+	}
+}
+
+func TestSplitBlockEncodeDecode(t *testing.T) {
+	f := NewSplitBlock(1024)
+	f.AddString("a").AddString("b")
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := []byte{
+		0x15, 0x80, 0x10, // numBytes: 1024
+		0x1c, 0x1c, 0x00, 0x00, // algorithm: BLOCK
+		0x1c, 0x1c, 0x00, 0x00, // hash: XXHASH
+		0x1c, 0x1c, 0x00, 0x00, // compression: UNCOMPRESSED
+		0x00,
+	}
+	if !bytes.Equal(data[:len(header)], header) || !bytes.Equal(data[len(header):], f.Bytes()) {
+		t.Fatalf("unexpected header %x", data[:len(header)])
+	}
+
+	// Trailing data, such as the next page of a Parquet file, is not read.
+	stream := bytes.NewReader(append(data, 1, 2, 3))
+	var g SplitBlockBloomFilter
+	n, err := g.ReadFrom(stream)
+	if err != nil || n != int64(len(data)) || stream.Len() != 3 {
+		t.Fatalf("read %d bytes: %v", n, err)
+	}
+	if !bytes.Equal(g.Bytes(), f.Bytes()) || !g.TestString("a") {
+		t.Error("round trip changed the filter")
+	}
+
+	// Unknown fields are skipped.
+	extended := append([]byte{0x15, 0x80, 0x10,
+		0x1c, 0x1c, 0x00, 0x00,
+		0x1c, 0x1c, 0x00, 0x18, 0x02, 'h', 'i', 0x00, // hash: XXHASH, then an unknown binary field
+		0x1c, 0x1c, 0x00, 0x00,
+		0x19, 0x25, 0x02, 0x04, // an unknown list of i32
+		0x00,
+	}, f.Bytes()...)
+	if err := g.UnmarshalBinary(extended); err != nil || !g.TestString("b") {
+		t.Errorf("unknown fields should be skipped: %v", err)
+	}
+
+	unsupported := append([]byte(nil), data...)
+	unsupported[8] = 0x2c // hash: field 2, not XXHASH
+	if err := g.UnmarshalBinary(unsupported); err == nil {
+		t.Error("unsupported hashes should not be accepted")
+	}
+	if err := g.UnmarshalBinary(data[:100]); err == nil {
+		t.Error("truncated data should not be accepted")
+	}
+}
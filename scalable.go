@@ -0,0 +1,265 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// A ScalableBloomFilter is a Bloom filter which grows as keys are added,
+// following Almeida et al., "Scalable Bloom Filters" (2007). It is a chain
+// of plain Bloom filters: when the last one holds as many keys as it was
+// sized for, a new filter is appended, _growth_ times larger and with a false
+// positive rate _tightening_ times smaller. The false positive rate of the
+// whole chain thus stays below the target rate, however many keys are added,
+// so there is no need to know the number of keys in advance.
+//
+// A key is tested against every filter of the chain, so queries get slower
+// as the filter grows; a larger initial estimate or growth factor means
+// fewer filters. SetMaxFilters caps the number of filters, and thus the
+// cost of queries, at the expense of the false positive rate.
+type ScalableBloomFilter struct {
+	n          uint
+	fp         float64
+	growth     uint
+	tightening float64
+	maxFilters uint // maximum number of filters, or 0 for no limit
+	filters    []*BloomFilter
+	capacity   uint // number of keys the last filter is sized for
+	count      uint // number of keys added to the last filter
+}
+
+// NewScalable creates a new scalable Bloom filter which starts with a filter
+// for about n items and keeps the false positive rate below fp. Each new
+// filter is twice as large as the previous one and has a false positive rate
+// tightened by 0.8.
+func NewScalable(n uint, fp float64) *ScalableBloomFilter {
+	return NewScalableWithGrowth(n, fp, 2, 0.8)
+}
+
+// NewScalableWithGrowth is like NewScalable with a custom growth factor and
+// tightening ratio. A larger growth factor means fewer filters to query, at
+// the cost of memory; a tightening ratio closer to one means larger filters
+// and fewer of them, since the first filters get more of the false positive
+// budget. We force _n_ and _growth_ to be at least one, and the tightening
+// ratio to be the default 0.8 if it is not strictly between zero and one.
+func NewScalableWithGrowth(n uint, fp float64, growth uint, tightening float64) *ScalableBloomFilter {
+	if !(tightening > 0 && tightening < 1) {
+		tightening = 0.8
+	}
+	s := &ScalableBloomFilter{
+		n:          max(1, n),
+		fp:         fp,
+		growth:     max(1, growth),
+		tightening: tightening,
+	}
+	s.grow()
+	return s
+}
+
+// grow appends a new filter to the chain. The ith filter holds about
+// n * growth^i keys at a false positive rate of fp * (1 - r) * r^i, where r
+// is the tightening ratio, so that the rates add up to at most fp.
+func (s *ScalableBloomFilter) grow() {
+	i := len(s.filters)
+	if i == 0 {
+		s.capacity = s.n
+	} else {
+		s.capacity *= s.growth
+	}
+	fp := s.fp * (1 - s.tightening) * math.Pow(s.tightening, float64(i))
+	s.filters = append(s.filters, NewWithEstimates(s.capacity, fp))
+	s.count = 0
+}
+
+// SetMaxFilters caps the number of filters in the chain: once it is
+// reached, keys are added to the last filter, whose false positive rate then
+// rises above its share of the target rate. Zero removes the cap. A cap
+// smaller than the current number of filters stops the growth, but does not
+// drop any filter. Returns the filter (allows chaining)
+func (s *ScalableBloomFilter) SetMaxFilters(n uint) *ScalableBloomFilter {
+	s.maxFilters = n
+	return s
+}
+
+// MaxFilters returns the maximum number of filters in the chain, or 0 if
+// there is no limit
+func (s *ScalableBloomFilter) MaxFilters() uint {
+	return s.maxFilters
+}
+
+// Filters returns the number of filters in the chain
+func (s *ScalableBloomFilter) Filters() int {
+	return len(s.filters)
+}
+
+// Cap returns the total capacity, in bits, of the filters in the chain
+func (s *ScalableBloomFilter) Cap() uint {
+	var m uint
+	for _, f := range s.filters {
+		m += f.Cap()
+	}
+	return m
+}
+
+// Add data to the scalable Bloom filter. Returns the filter (allows chaining)
+// Keys which are already in the filter are not added again, so that
+// duplicates do not make the filter grow.
+func (s *ScalableBloomFilter) Add(data []byte) *ScalableBloomFilter {
+	h := baseHashes(data)
+	for _, f := range s.filters {
+		if f.testHashes(h) {
+			return s
+		}
+	}
+	if s.count >= s.capacity && (s.maxFilters == 0 || uint(len(s.filters)) < s.maxFilters) {
+		s.grow()
+	}
+	f := s.filters[len(s.filters)-1]
+	for i := uint(0); i < f.k; i++ {
+		f.b.Set(f.location(h, i))
+	}
+	s.count++
+	return s
+}
+
+// AddString to the scalable Bloom filter. Returns the filter (allows chaining)
+func (s *ScalableBloomFilter) AddString(data string) *ScalableBloomFilter {
+	return s.Add(stringToBytes(data))
+}
+
+// Test returns true if the data is in the ScalableBloomFilter, false
+// otherwise. If true, the result might be a false positive. If false, the
+// data is definitely not in the set.
+func (s *ScalableBloomFilter) Test(data []byte) bool {
+	h := baseHashes(data)
+	for _, f := range s.filters {
+		if f.testHashes(h) {
+			return true
+		}
+	}
+	return false
+}
+
+// TestString returns true if the string is in the ScalableBloomFilter, false
+// otherwise. If true, the result might be a false positive. If false, the
+// data is definitely not in the set.
+func (s *ScalableBloomFilter) TestString(data string) bool {
+	return s.Test(stringToBytes(data))
+}
+
+// TestAndAdd is equivalent to calling Test(data) then Add(data).
+// Returns the result of Test.
+func (s *ScalableBloomFilter) TestAndAdd(data []byte) bool {
+	present := s.Test(data)
+	if !present {
+		s.Add(data)
+	}
+	return present
+}
+
+// ClearAll clears all the data in a scalable Bloom filter, removing all keys
+// and shrinking it back to a single filter.
+func (s *ScalableBloomFilter) ClearAll() *ScalableBloomFilter {
+	s.filters = nil
+	s.grow()
+	return s
+}
+
+// scalableHeader is the fixed-size part of the binary representation
+type scalableHeader struct {
+	N          uint64
+	FP         float64
+	Growth     uint64
+	Tightening float64
+	MaxFilters uint64
+	Count      uint64
+	Filters    uint64
+}
+
+// WriteTo writes a binary representation of the ScalableBloomFilter to an
+// i/o stream: its parameters, including the maximum number of filters, the
+// number of keys in the last filter and the number of filters, followed by
+// each filter as written by BloomFilter.WriteTo. It returns the number of
+// bytes written.
+func (s *ScalableBloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	header := scalableHeader{
+		uint64(s.n), s.fp, uint64(s.growth), s.tightening,
+		uint64(s.maxFilters), uint64(s.count), uint64(len(s.filters)),
+	}
+	err := binary.Write(stream, binary.BigEndian, &header)
+	if err != nil {
+		return 0, err
+	}
+	n := int64(binary.Size(&header))
+	for _, f := range s.filters {
+		numBytes, err := f.WriteTo(stream)
+		n += numBytes
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// ReadFrom reads a binary representation of the ScalableBloomFilter (such as
+// might have been written by WriteTo()) from an i/o stream. It returns the
+// number of bytes read.
+func (s *ScalableBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	var header scalableHeader
+	err := binary.Read(stream, binary.BigEndian, &header)
+	if err != nil {
+		return 0, err
+	}
+	if header.N == 0 || header.Growth == 0 || header.Filters == 0 ||
+		uint64(uint(header.N)) != header.N || uint64(uint(header.Growth)) != header.Growth ||
+		uint64(uint(header.MaxFilters)) != header.MaxFilters ||
+		!(header.Tightening > 0 && header.Tightening < 1) {
+		return 0, errors.New("bloom: invalid scalable filter parameters")
+	}
+	g := &ScalableBloomFilter{
+		n:          uint(header.N),
+		fp:         header.FP,
+		growth:     uint(header.Growth),
+		tightening: header.Tightening,
+		maxFilters: uint(header.MaxFilters),
+		capacity:   uint(header.N),
+	}
+	n := int64(binary.Size(&header))
+	for i := uint64(0); i < header.Filters; i++ {
+		f := &BloomFilter{}
+		numBytes, err := f.ReadFrom(stream)
+		n += numBytes
+		if err != nil {
+			return n, err
+		}
+		if i > 0 {
+			g.capacity *= g.growth
+		}
+		g.filters = append(g.filters, f)
+	}
+	g.count = uint(header.Count)
+	*s = *g
+	return n, nil
+}
+
+// MarshalBinary implements binary.BinaryMarshaler interface.
+func (s *ScalableBloomFilter) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := s.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements binary.BinaryUnmarshaler interface.
+func (s *ScalableBloomFilter) UnmarshalBinary(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := s.ReadFrom(buf)
+
+	return err
+}
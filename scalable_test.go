@@ -0,0 +1,152 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestScalableGrows(t *testing.T) {
+	s := NewScalable(1000, 0.01)
+	if s.Filters() != 1 {
+		t.Fatalf("expected a single filter, got %d", s.Filters())
+	}
+	n := uint32(100000)
+	key := make([]byte, 4)
+	for i := uint32(0); i < n; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		s.Add(key)
+	}
+	if s.Filters() < 5 {
+		t.Errorf("expected the filter to grow, got %d filters", s.Filters())
+	}
+	for i := uint32(0); i < n; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		if !s.Test(key) {
+			t.Fatalf("key %d should be in", i)
+		}
+	}
+	positives := 0
+	for i := n; i < 2*n; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		if s.Test(key) {
+			positives++
+		}
+	}
+	if rate := float64(positives) / float64(n); rate > 0.01 {
+		t.Errorf("false positive rate %f should stay below 0.01", rate)
+	}
+}
+
+func TestScalableDuplicates(t *testing.T) {
+	s := NewScalableWithGrowth(10, 0.01, 4, 0.5)
+	for i := 0; i < 1000; i++ {
+		s.AddString("same")
+	}
+	if s.Filters() != 1 {
+		t.Errorf("duplicates should not make the filter grow, got %d filters", s.Filters())
+	}
+	if !s.TestAndAdd([]byte("same")) || s.TestAndAdd([]byte("other")) || !s.TestString("other") {
+		t.Error("unexpected TestAndAdd results")
+	}
+	s.ClearAll()
+	if s.TestString("same") || s.Filters() != 1 {
+		t.Error("ClearAll should reset the filter")
+	}
+}
+
+func TestScalableParameters(t *testing.T) {
+	s := NewScalableWithGrowth(0, 0.01, 0, 1.5)
+	if s.n != 1 || s.growth != 1 || s.tightening != 0.8 {
+		t.Errorf("unexpected parameters %d %d %f", s.n, s.growth, s.tightening)
+	}
+}
+
+func TestScalableEncodeDecode(t *testing.T) {
+	s := NewScalableWithGrowth(100, 0.001, 3, 0.9)
+	key := make([]byte, 4)
+	for i := uint32(0); i < 1000; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		s.Add(key)
+	}
+	data, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var g ScalableBloomFilter
+	if err := g.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if g.Filters() != s.Filters() || g.Cap() != s.Cap() || g.capacity != s.capacity || g.count != s.count {
+		t.Fatalf("decoded filter differs: %d filters, capacity %d, count %d", g.Filters(), g.capacity, g.count)
+	}
+	for i := range s.filters {
+		if !s.filters[i].Equal(g.filters[i]) {
+			t.Errorf("filter %d differs", i)
+		}
+	}
+	// Both keep growing the same way.
+	for i := uint32(1000); i < 5000; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		s.Add(key)
+		g.Add(key)
+	}
+	if g.Filters() != s.Filters() {
+		t.Errorf("decoded filter grows differently: %d != %d", g.Filters(), s.Filters())
+	}
+
+	if err := g.UnmarshalBinary(data[:20]); err == nil {
+		t.Error("truncated data should not be accepted")
+	}
+	bad := append([]byte(nil), data...)
+	binary.BigEndian.PutUint64(bad[16:], 0)
+	if _, err := g.ReadFrom(bytes.NewReader(bad)); err == nil {
+		t.Error("a zero growth factor should not be accepted")
+	}
+}
+
+func TestScalableMaxFilters(t *testing.T) {
+	s := NewScalable(100, 0.01).SetMaxFilters(3)
+	key := make([]byte, 4)
+	for i := uint32(0); i < 2000; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		s.Add(key)
+	}
+	if s.Filters() != 3 || s.MaxFilters() != 3 {
+		t.Fatalf("the chain should stop at 3 filters, got %d", s.Filters())
+	}
+	for i := uint32(0); i < 2000; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		if !s.Test(key) {
+			t.Fatalf("%d should be in the filter", i)
+		}
+	}
+
+	data, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var g ScalableBloomFilter
+	if err := g.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if g.MaxFilters() != 3 {
+		t.Errorf("the cap should be decoded, got %d", g.MaxFilters())
+	}
+	for i := uint32(2000); i < 4000; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		g.Add(key)
+	}
+	if g.Filters() != 3 {
+		t.Errorf("the decoded filter should not grow past the cap, got %d filters", g.Filters())
+	}
+
+	s.SetMaxFilters(0)
+	for i := uint32(2000); i < 2100; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		s.Add(key)
+	}
+	if s.Filters() != 4 {
+		t.Errorf("without a cap the chain should grow, got %d filters", s.Filters())
+	}
+}
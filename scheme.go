@@ -0,0 +1,67 @@
+package bloom
+
+import "fmt"
+
+// A LocationScheme derives the k locations of a key from its hash values.
+type LocationScheme uint8
+
+const (
+	// SchemeDefault derives the locations from four 64-bit hash values, as
+	// described in Locations.
+	SchemeDefault LocationScheme = iota
+	// SchemeDoubleHashing is the double hashing of Kirsch and Mitzenmacher,
+	// used by many other implementations: the ith location is h1 + i*h2,
+	// modulo 2^64, where h1 and h2 are the two halves of the 128-bit x64
+	// MurmurHash3 of the key with the seed of the filter (or of its 128-bit
+	// SipHash, for keyed filters). Locations are then reduced to m bits as
+	// with the default scheme.
+	SchemeDoubleHashing
+)
+
+// String returns the name of the scheme
+func (s LocationScheme) String() string {
+	switch s {
+	case SchemeDefault:
+		return "default"
+	case SchemeDoubleHashing:
+		return "double-hashing"
+	}
+	return fmt.Sprintf("LocationScheme(%d)", uint8(s))
+}
+
+// NewWithScheme creates a new Bloom filter with _m_ bits and _k_ hashing
+// functions, whose locations are derived with the given scheme, e.g., to
+// match the bits set by another implementation. The scheme is serialized
+// with the filter.
+func NewWithScheme(m uint, k uint, scheme LocationScheme) *BloomFilter {
+	f := New(m, k)
+	f.scheme = scheme
+	return f
+}
+
+// NewWithEstimatesAndScheme creates a new Bloom filter for about n items with
+// fp false positive rate, whose locations are derived with the given scheme.
+func NewWithEstimatesAndScheme(n uint, fp float64, scheme LocationScheme) *BloomFilter {
+	m, k := EstimateParameters(n, fp)
+	return NewWithScheme(m, k, scheme)
+}
+
+// Scheme returns the scheme deriving the locations of the filter
+func (f *BloomFilter) Scheme() LocationScheme {
+	return f.scheme
+}
+
+// doubleHashes returns the hash values of the double hashing scheme, h1 and
+// h2, arranged so that location(h, i) is h1 + i*h2.
+func doubleHashes(h1, h2 uint64) [4]uint64 {
+	return [4]uint64{h1, h1, h2, h2}
+}
+
+// seededHashes128 returns the 128-bit x64 MurmurHash3 of data with a seed
+func seededHashes128(data []byte, seed uint64) (uint64, uint64) {
+	var d digest128
+	d.h1, d.h2 = seed, seed
+	d.bmix(data)
+	length := uint64(len(data))
+	return d.sum128(false, length, data[length-length%block_size:])
+}
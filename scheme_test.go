@@ -0,0 +1,117 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/twmb/murmur3"
+)
+
+func TestDoubleHashing(t *testing.T) {
+	for _, seed := range []uint64{0, 42} {
+		for _, s := range []string{"", "Love", "fifteen bytes!!", "a string which is longer than thirty-two bytes"} {
+			f := NewWithScheme(1000, 7, SchemeDoubleHashing)
+			f.seed = seed
+			f.AddString(s)
+			// The bits set by other implementations of double hashing.
+			h1, h2 := murmur3.SeedSum128(seed, seed, []byte(s))
+			g := New(1000, 7)
+			for i := uint64(0); i < 7; i++ {
+				g.b.Set(uint((h1 + i*h2) % 1000))
+			}
+			if !f.b.Equal(g.b) {
+				t.Errorf("%q, seed %d: the filter should set the bits h1 + i*h2", s, seed)
+			}
+		}
+	}
+
+	f := NewWithEstimatesAndScheme(1000, 0.01, SchemeDoubleHashing)
+	keyed := NewKeyedWithEstimates(1000, 0.01, [16]byte{1})
+	keyed.scheme = SchemeDoubleHashing
+	for _, f := range []*BloomFilter{f, keyed} {
+		keys := batchKeys(1000, 0)
+		f.AddBatch(keys)
+		for _, key := range keys {
+			if !f.Test(key) {
+				t.Fatalf("%v should be in the filter", key)
+			}
+		}
+		if fp := f.CurrentFalsePositiveRate(); fp > 0.02 {
+			t.Errorf("unexpected false positive rate %v", fp)
+		}
+	}
+	if f.Scheme() != SchemeDoubleHashing || New(10, 1).Scheme() != SchemeDefault {
+		t.Error("unexpected scheme")
+	}
+	if err := f.Merge(NewWithEstimates(1000, 0.01)); err == nil {
+		t.Error("filters with different schemes should not be merged")
+	}
+}
+
+func TestDoubleHashingSerialization(t *testing.T) {
+	f := NewWithEstimatesAndScheme(1000, 0.01, SchemeDoubleHashing)
+	f.AddBatch(batchKeys(100, 0))
+	decode := []func() (*BloomFilter, error){
+		func() (*BloomFilter, error) {
+			g := &BloomFilter{}
+			return g, g.UnmarshalBinary(mustMarshal(t, f))
+		},
+		func() (*BloomFilter, error) {
+			var buf bytes.Buffer
+			if _, err := f.WriteFramedTo(&buf, EncodingGolomb); err != nil {
+				return nil, err
+			}
+			g := &BloomFilter{}
+			_, err := g.ReadFrom(&buf)
+			return g, err
+		},
+		func() (*BloomFilter, error) {
+			data, err := json.Marshal(f)
+			if err != nil {
+				return nil, err
+			}
+			g := &BloomFilter{}
+			return g, json.Unmarshal(data, g)
+		},
+		func() (*BloomFilter, error) {
+			data, err := f.MarshalProto()
+			if err != nil {
+				return nil, err
+			}
+			g := &BloomFilter{}
+			return g, g.UnmarshalProto(data)
+		},
+	}
+	for i, decode := range decode {
+		g, err := decode()
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if g.Scheme() != SchemeDoubleHashing || !g.Equal(f) {
+			t.Errorf("%d: the scheme should be serialized", i)
+		}
+	}
+
+	r, err := NewReadOnly(mustMarshal(t, f))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range batchKeys(200, 0) {
+		if r.Test(key) != f.Test(key) {
+			t.Errorf("%v: NewReadOnly should use the scheme", key)
+		}
+	}
+
+	// Unknown schemes are rejected.
+	data := mustMarshal(t, f)
+	i := bytes.Index(data, []byte{optionScheme, 0, 0, 0, 0, 0, 0, 0, byte(SchemeDoubleHashing)})
+	if i < 0 {
+		t.Fatal("the scheme option should be written")
+	}
+	data[i+8] = 2
+	if err := (&BloomFilter{}).UnmarshalBinary(data); !errors.Is(err, errUnsupportedFormat) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
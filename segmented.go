@@ -0,0 +1,343 @@
+package bloom
+
+import (
+	"bufio"
+	"errors"
+	"io"
+
+	"github.com/bits-and-blooms/bitset"
+)
+
+// segmentWords is the number of words of a segment of a
+// SegmentedBloomFilter: segments are 1 MB
+const segmentWords = 1 << 17
+
+// A SegmentedBloomFilter is a Bloom filter of which the bits are split in
+// segments of 1 MB, allocated the first time one of their bits is set, instead
+// of a single slice. It is meant for filters of several gigabytes, for which
+// allocating a contiguous slice may fail, or stall the garbage collector. It
+// answers Test as a BloomFilter with the same m and k, and the same hash
+// functions, would.
+//
+// Its number of bits is a uint64, so that on 32-bit platforms, where a
+// BloomFilter holds at most 4 Gbits, it may hold larger filters: see
+// NewSegmented64 and Cap64.
+//
+// A SegmentedBloomFilter is not safe for concurrent use, but Test may be
+// called concurrently as long as no key is added.
+type SegmentedBloomFilter struct {
+	m uint64
+	k uint
+	hashing
+	fastRange bool
+	segments  [][]uint64 // nil until a bit of the segment is set
+}
+
+// NewSegmented creates a new segmented Bloom filter with _m_ bits and _k_
+// hashing functions. No segment is allocated until a key is added. We force
+// _m_ and _k_ to be at least one to avoid panics.
+func NewSegmented(m uint, k uint) *SegmentedBloomFilter {
+	return NewSegmented64(uint64(m), k)
+}
+
+// NewSegmented64 is like NewSegmented with a 64-bit _m_, which may exceed
+// 4 Gbits on 32-bit platforms. Only the segments holding bits set take
+// memory, but the filter keeps a table with an entry for each 8 Mbits.
+func NewSegmented64(m uint64, k uint) *SegmentedBloomFilter {
+	if m == 0 {
+		m = 1
+	}
+	segments := (wordsOf(m) + segmentWords - 1) / segmentWords
+	return &SegmentedBloomFilter{
+		m:        m,
+		k:        max(1, k),
+		segments: make([][]uint64, segments),
+	}
+}
+
+// NewSegmentedWithEstimates creates a new segmented Bloom filter for about n
+// items with fp false positive rate
+func NewSegmentedWithEstimates(n uint, fp float64) *SegmentedBloomFilter {
+	return NewSegmentedWithEstimates64(uint64(n), fp)
+}
+
+// NewSegmentedWithEstimates64 is like NewSegmentedWithEstimates for a 64-bit
+// number of items, see EstimateParameters64
+func NewSegmentedWithEstimates64(n uint64, fp float64) *SegmentedBloomFilter {
+	m, k := EstimateParameters64(n, fp)
+	return NewSegmented64(m, k)
+}
+
+// NewSegmentedFrom creates a new segmented Bloom filter holding a copy of the
+// keys of a Bloom filter, with the same hash functions. The segments of which
+// no bit is set are not allocated.
+func NewSegmentedFrom(f *BloomFilter) *SegmentedBloomFilter {
+	g := NewSegmented(f.m, f.k)
+	words := f.b.Words()
+	for i := range g.segments {
+		start := i * segmentWords
+		if start >= len(words) {
+			break
+		}
+		end := start + segmentWords
+		if end > len(words) {
+			end = len(words)
+		}
+		for _, w := range words[start:end] {
+			if w != 0 {
+				copy(g.segment(uint64(i)), words[start:end])
+				break
+			}
+		}
+	}
+	g.hashing = f.hashing
+	g.fastRange = f.fastRange
+	return g
+}
+
+// Cap returns the capacity, _m_, of a Bloom filter, or the largest uint if
+// it does not fit in a uint, see Cap64
+func (f *SegmentedBloomFilter) Cap() uint {
+	if f.m > uint64(^uint(0)) {
+		return ^uint(0)
+	}
+	return uint(f.m)
+}
+
+// Cap64 returns the capacity, _m_, of a Bloom filter
+func (f *SegmentedBloomFilter) Cap64() uint64 {
+	return f.m
+}
+
+// K returns the number of hash functions used in the SegmentedBloomFilter
+func (f *SegmentedBloomFilter) K() uint {
+	return f.k
+}
+
+// wordsOf returns the number of 64-bit words holding m bits, without
+// overflowing
+func wordsOf(m uint64) uint64 {
+	return m/64 + (m%64+63)/64
+}
+
+// location returns the ith hashed location using the four base hash values
+func (f *SegmentedBloomFilter) location(h [4]uint64, i uint) uint64 {
+	if f.fastRange {
+		return fastRange(location(h, i), f.m)
+	}
+	return location(h, i) % f.m
+}
+
+// segmentSize returns the number of words of the ith segment
+func (f *SegmentedBloomFilter) segmentSize(i uint64) uint64 {
+	size := wordsOf(f.m) - i*segmentWords
+	if size > segmentWords {
+		size = segmentWords
+	}
+	return size
+}
+
+// segment returns the ith segment, which it allocates if needed
+func (f *SegmentedBloomFilter) segment(i uint64) []uint64 {
+	if f.segments[i] == nil {
+		f.segments[i] = make([]uint64, f.segmentSize(i))
+	}
+	return f.segments[i]
+}
+
+// AllocatedBytes returns the number of bytes of the segments allocated so far
+func (f *SegmentedBloomFilter) AllocatedBytes() uint64 {
+	var n uint64
+	for _, s := range f.segments {
+		n += 8 * uint64(len(s))
+	}
+	return n
+}
+
+// Add data to the filter, allocating the segments it needs.
+// Returns the filter (allows chaining)
+func (f *SegmentedBloomFilter) Add(data []byte) *SegmentedBloomFilter {
+	h := f.hashes(data)
+	for i := uint(0); i < f.k; i++ {
+		w := f.location(h, i)
+		l := w % 64
+		w /= 64
+		f.segment(w / segmentWords)[w%segmentWords] |= 1 << l
+	}
+	return f
+}
+
+// AddString to the filter, allocating the segments it needs.
+// Returns the filter (allows chaining)
+func (f *SegmentedBloomFilter) AddString(data string) *SegmentedBloomFilter {
+	return f.Add(stringToBytes(data))
+}
+
+// Test returns true if the data is in the filter, false otherwise.
+// If true, the result might be a false positive. If false, the data
+// is definitely not in the set.
+func (f *SegmentedBloomFilter) Test(data []byte) bool {
+	h := f.hashes(data)
+	for i := uint(0); i < f.k; i++ {
+		w := f.location(h, i)
+		l := w % 64
+		w /= 64
+		s := f.segments[w/segmentWords]
+		if s == nil || s[w%segmentWords]&(1<<l) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// TestString returns true if the string is in the filter, false otherwise.
+// If true, the result might be a false positive. If false, the data
+// is definitely not in the set.
+func (f *SegmentedBloomFilter) TestString(data string) bool {
+	return f.Test(stringToBytes(data))
+}
+
+// TestAndAdd is equivalent to calling Test(data) then Add(data).
+// Returns the result of Test.
+func (f *SegmentedBloomFilter) TestAndAdd(data []byte) bool {
+	present := true
+	h := f.hashes(data)
+	for i := uint(0); i < f.k; i++ {
+		w := f.location(h, i)
+		l := w % 64
+		w /= 64
+		s := f.segment(w / segmentWords)
+		if s[w%segmentWords]&(1<<l) == 0 {
+			present = false
+		}
+		s[w%segmentWords] |= 1 << l
+	}
+	return present
+}
+
+// TestAndAddString is the equivalent to calling Test(string) then Add(string).
+// Returns the result of Test.
+func (f *SegmentedBloomFilter) TestAndAddString(data string) bool {
+	return f.TestAndAdd(stringToBytes(data))
+}
+
+// ClearAll clears all the data in the filter, and releases its segments
+func (f *SegmentedBloomFilter) ClearAll() *SegmentedBloomFilter {
+	for i := range f.segments {
+		f.segments[i] = nil
+	}
+	return f
+}
+
+// BloomFilter returns a copy of the filter as a Bloom filter. The copy holds
+// its bits in a single slice: use WriteTo to serialize a large filter. It
+// returns nil if _m_ does not fit in a uint, on 32-bit platforms.
+func (f *SegmentedBloomFilter) BloomFilter() *BloomFilter {
+	if f.m > uint64(^uint(0)) {
+		return nil
+	}
+	words := make([]uint64, wordsOf(f.m))
+	for i, s := range f.segments {
+		copy(words[i*segmentWords:], s)
+	}
+	return &BloomFilter{
+		m:         uint(f.m),
+		k:         f.k,
+		b:         bitset.FromWithLength(uint(f.m), words),
+		hashing:   f.hashing,
+		fastRange: f.fastRange,
+	}
+}
+
+// header returns the header of the serialized filter
+func (f *SegmentedBloomFilter) header() header {
+	return header{
+		m:         f.m,
+		k:         uint64(f.k),
+		seed:      f.seed,
+		keyed:     f.key != nil,
+		fastRange: f.fastRange,
+		scheme:    f.scheme,
+	}
+}
+
+// WriteTo writes the filter to an i/o stream as BloomFilter.WriteTo would,
+// segment by segment, so that BloomFilter.ReadFrom can read it. The segments
+// which are not allocated are written as zeros. It returns the number of bytes
+// written.
+func (f *SegmentedBloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	n, err := f.header().writeTo(stream)
+	if err != nil {
+		return n, err
+	}
+	w := bufio.NewWriter(stream)
+	order := bitset.BinaryOrder()
+	var word [8]byte
+	order.PutUint64(word[:], f.m)
+	if _, err := w.Write(word[:]); err != nil {
+		return n, err
+	}
+	for i, s := range f.segments {
+		size := f.segmentSize(uint64(i))
+		for j := uint64(0); j < size; j++ {
+			var v uint64
+			if s != nil {
+				v = s[j]
+			}
+			order.PutUint64(word[:], v)
+			if _, err := w.Write(word[:]); err != nil {
+				return n, err
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return n, err
+	}
+	return n + 8 + 8*int64(wordsOf(f.m)), nil
+}
+
+// ReadFrom reads a filter written by WriteTo, or by BloomFilter.WriteTo, from
+// an i/o stream, segment by segment: the segments of which no bit is set are
+// not allocated. Keyed, encoded and framed filters are not supported, see
+// NewSegmentedFrom. Unlike BloomFilter.ReadFrom, it reads filters of more
+// than 4 Gbits on 32-bit platforms. It returns the number of bytes read.
+func (f *SegmentedBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	h, n, err := readHeader(stream)
+	if err != nil {
+		return n, err
+	}
+	if h.k > uint64(^uint(0)) || (wordsOf(h.m)+segmentWords-1)/segmentWords > uint64(maxInt) {
+		return n, errTooLarge
+	}
+	if h.keyed || h.encoding != EncodingRaw || h.checksum {
+		return n, errors.New("bloom: only raw filters can be read into a SegmentedBloomFilter")
+	}
+	var word [8]byte
+	if _, err := io.ReadFull(stream, word[:]); err != nil {
+		return n, unexpectedEOF(err)
+	}
+	n += 8
+	length := bitset.BinaryOrder().Uint64(word[:])
+	if h.m == 0 || wordsOf(length) != wordsOf(h.m) {
+		return n, errors.New("bloom: the length of the bitset does not match m")
+	}
+	g := NewSegmented64(h.m, uint(h.k))
+	for i := range g.segments {
+		words, err := readUint64s(stream, g.segmentSize(uint64(i)), bitset.BinaryOrder())
+		if err != nil {
+			return n, err
+		}
+		n += 8 * int64(len(words))
+		for _, w := range words {
+			if w != 0 {
+				g.segments[i] = words
+				break
+			}
+		}
+	}
+	g.seed = h.seed
+	g.fastRange = h.fastRange
+	g.scheme = h.scheme
+	*f = *g
+	return n, nil
+}
@@ -0,0 +1,143 @@
+package bloom
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"testing"
+)
+
+func TestSegmented(t *testing.T) {
+	// Four segments, the last one shorter.
+	m := uint(3*segmentWords*64 + 1000)
+	f := NewSegmented(m, 4)
+	if f.AllocatedBytes() != 0 || len(f.segments) != 4 {
+		t.Fatalf("%d segments, %d bytes allocated", len(f.segments), f.AllocatedBytes())
+	}
+	if f.TestString("Love") {
+		t.Error("an empty filter should not hold any key")
+	}
+	g := New(m, 4)
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		if f.TestAndAddString(key) != g.TestAndAddString(key) {
+			t.Fatalf("%s: TestAndAdd should match BloomFilter", key)
+		}
+	}
+	if a := f.AllocatedBytes(); a < 3*8*segmentWords || a > 8*((uint64(m)+63)/64) {
+		t.Errorf("%d bytes allocated after 1000 keys", f.AllocatedBytes())
+	}
+	for i := 0; i < 2000; i++ {
+		key := strconv.Itoa(i)
+		if f.TestString(key) != g.TestString(key) {
+			t.Fatalf("%s: Test should match BloomFilter", key)
+		}
+	}
+	if !f.BloomFilter().Equal(g) {
+		t.Error("the segments should hold the same bits as a BloomFilter")
+	}
+
+	var buf bytes.Buffer
+	n, err := f.WriteTo(&buf)
+	if err != nil || n != int64(buf.Len()) {
+		t.Fatalf("WriteTo: %d, %v", n, err)
+	}
+	if !bytes.Equal(buf.Bytes(), mustMarshal(t, g)) {
+		t.Error("WriteTo should write the format of BloomFilter.WriteTo")
+	}
+	var h SegmentedBloomFilter
+	if n, err := h.ReadFrom(bytes.NewReader(buf.Bytes())); err != nil || n != int64(buf.Len()) {
+		t.Fatalf("ReadFrom: %d, %v", n, err)
+	}
+	if !h.BloomFilter().Equal(g) || h.Cap() != m || h.K() != 4 {
+		t.Error("ReadFrom should read the filter written")
+	}
+
+	f.ClearAll()
+	if f.AllocatedBytes() != 0 || f.TestString("1") {
+		t.Error("ClearAll should release the segments")
+	}
+}
+
+func TestSegmentedLazy(t *testing.T) {
+	m := uint(8 * segmentWords * 64)
+	g := NewWithSeed(m, 3, 42).AddString("Love")
+	f := NewSegmentedFrom(g)
+	if f.AllocatedBytes() > 3*8*segmentWords {
+		t.Errorf("%d bytes allocated for a single key", f.AllocatedBytes())
+	}
+	if !f.TestString("Love") || f.TestString("Hate") || !f.BloomFilter().Equal(g) {
+		t.Error("NewSegmentedFrom should copy the filter")
+	}
+	var h SegmentedBloomFilter
+	if _, err := h.ReadFrom(bytes.NewReader(mustMarshal(t, g))); err != nil {
+		t.Fatal(err)
+	}
+	if h.AllocatedBytes() != f.AllocatedBytes() || !h.TestString("Love") {
+		t.Error("ReadFrom should only allocate the segments with bits set")
+	}
+	for _, g := range []*BloomFilter{NewFastRange(3000, 3), NewWithScheme(3000, 3, SchemeDoubleHashing)} {
+		g.AddString("Love")
+		if f := NewSegmentedFrom(g); !f.TestString("Love") || !f.BloomFilter().Equal(g) {
+			t.Error("NewSegmentedFrom should keep the hash functions")
+		}
+	}
+	if _, err := h.ReadFrom(bytes.NewReader(mustMarshal(t, NewKeyed(1000, 4, [16]byte{})))); err == nil {
+		t.Error("keyed filters should not be read")
+	}
+}
+
+func TestSegmentedLarge(t *testing.T) {
+	// More than 4 Gbits, which a BloomFilter cannot hold on 32-bit platforms.
+	f := NewSegmented64(1<<34, 5)
+	if f.Cap64() != 1<<34 || uint64(f.Cap()) != 1<<34 && f.Cap() != ^uint(0) {
+		t.Fatalf("unexpected capacity %d, %d", f.Cap64(), f.Cap())
+	}
+	high := 0
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		f.AddString(key)
+		h := f.hashes([]byte(key))
+		for j := uint(0); j < f.k; j++ {
+			if f.location(h, j) >= 1<<32 {
+				high++
+			}
+		}
+	}
+	if high < 300 {
+		t.Errorf("only %d locations out of 500 are beyond 4 Gbits", high)
+	}
+	if f.AllocatedBytes() > 500*8*segmentWords {
+		t.Errorf("%d bytes allocated for 100 keys", f.AllocatedBytes())
+	}
+	for i := 0; i < 100; i++ {
+		if !f.TestString(strconv.Itoa(i)) {
+			t.Fatalf("%d should be in the filter", i)
+		}
+	}
+	if f.TestString("Love") {
+		t.Error("Love should not be in the filter")
+	}
+	if m, k := EstimateParameters64(1<<32, 0.01); m < 1<<35 || k != 7 {
+		t.Errorf("unexpected parameters %d, %d for 4 billion keys", m, k)
+	}
+
+	if testing.Short() {
+		t.Skip("writes a 512 MB filter")
+	}
+	m := uint64(1)<<32 + 64
+	f = NewSegmented64(m, 5).AddString("Love")
+	r, w := io.Pipe()
+	go func() {
+		_, err := f.WriteTo(w)
+		w.CloseWithError(err)
+	}()
+	var g SegmentedBloomFilter
+	n, err := g.ReadFrom(r)
+	if err != nil || n != 16+8+8*int64(wordsOf(m)) {
+		t.Fatalf("ReadFrom: %d, %v", n, err)
+	}
+	if g.Cap64() != m || g.AllocatedBytes() != f.AllocatedBytes() || !g.TestString("Love") {
+		t.Error("ReadFrom should read the filter written")
+	}
+}
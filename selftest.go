@@ -0,0 +1,130 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"math/rand"
+)
+
+// selfTestBuckets is the largest number of buckets of bits which SelfTest
+// compares, and selfTestBucketWords the smallest number of words in a bucket
+const (
+	selfTestBuckets     = 1024
+	selfTestBucketWords = 4
+)
+
+// A SelfTestReport is the result of SelfTest: the false positive rate
+// measured on random keys, and the uniformity of the bits set, each compared
+// with what hash functions of uniform outputs would give. Both comparisons
+// are expressed as z-scores, the number of standard deviations between the
+// measure and its expectation, so that a canary can alert on values above a
+// threshold, such as 4, without knowing the parameters of the filter.
+type SelfTestReport struct {
+	Samples                   uint    // number of random keys tested
+	FalsePositives            uint    // number of random keys testing positive
+	FalsePositiveRate         float64 // FalsePositives / Samples
+	ExpectedFalsePositiveRate float64 // FillRatio()^k
+	FalsePositiveZ            float64 // z-score of FalsePositives
+
+	Buckets     uint    // number of ranges of words whose bits set are counted
+	ChiSquare   float64 // chi-square statistic of the bits set in the buckets
+	UniformityZ float64 // z-score of ChiSquare, with Buckets-1 degrees of freedom
+}
+
+// Healthy returns true if neither the false positive rate nor the
+// distribution of the bits set are more than maxZ standard deviations above
+// their expectation. Lower than expected rates are healthy.
+func (r SelfTestReport) Healthy(maxZ float64) bool {
+	return r.FalsePositiveZ <= maxZ && r.UniformityZ <= maxZ
+}
+
+// String returns a summary of the report
+func (r SelfTestReport) String() string {
+	return fmt.Sprintf("false positives: %d/%d = %.4g, expected %.4g (z = %.2f); uniformity: chi-square %.1f over %d buckets (z = %.2f)",
+		r.FalsePositives, r.Samples, r.FalsePositiveRate, r.ExpectedFalsePositiveRate, r.FalsePositiveZ,
+		r.ChiSquare, r.Buckets, r.UniformityZ)
+}
+
+// SelfTest measures the false positive rate of the filter on a number of
+// random keys, which are very unlikely to have been added, and compares it
+// with the rate expected from its fill ratio, see CurrentFalsePositiveRate.
+// It also counts the bits set in up to 1024 ranges of words and compares
+// their counts with a uniform distribution. The filter is not modified, and
+// the keys are the same from one call to the next, so that reports can be
+// compared over time. It is meant for canary checks and bug reports, not for
+// hot paths: it takes about as long as testing the samples.
+func (f *BloomFilter) SelfTest(samples uint) SelfTestReport {
+	r := SelfTestReport{Samples: samples, ExpectedFalsePositiveRate: f.CurrentFalsePositiveRate()}
+	rng := rand.New(rand.NewSource(0x626c6f6f6d))
+	var key [16]byte
+	for i := uint(0); i < samples; i++ {
+		binary.LittleEndian.PutUint64(key[:], rng.Uint64())
+		binary.LittleEndian.PutUint64(key[8:], rng.Uint64())
+		if f.Test(key[:]) {
+			r.FalsePositives++
+		}
+	}
+	if samples > 0 {
+		r.FalsePositiveRate = float64(r.FalsePositives) / float64(samples)
+		r.FalsePositiveZ = zScore(float64(r.FalsePositives), float64(samples)*r.ExpectedFalsePositiveRate,
+			float64(samples)*r.ExpectedFalsePositiveRate*(1-r.ExpectedFalsePositiveRate))
+	}
+	r.Buckets, r.ChiSquare = f.uniformity()
+	if r.Buckets > 1 {
+		dof := float64(r.Buckets - 1)
+		r.UniformityZ = (r.ChiSquare - dof) / math.Sqrt(2*dof)
+	}
+	return r
+}
+
+// zScore returns the number of standard deviations between x and its mean,
+// or 0 or +Inf if the variance is 0
+func zScore(x, mean, variance float64) float64 {
+	if variance > 0 {
+		return (x - mean) / math.Sqrt(variance)
+	}
+	if math.Abs(x-mean) < 0.5 {
+		return 0
+	}
+	return math.Inf(1)
+}
+
+// uniformity splits the m bits of the filter in buckets of whole words, and
+// returns the number of buckets and the chi-square statistic of the number
+// of bits set in each. Each bit is set with probability FillRatio(), so the
+// count of a bucket of n bits has a variance of n*r*(1-r).
+func (f *BloomFilter) uniformity() (uint, float64) {
+	words := f.b.Words()
+	if uint64(len(words))*64 > uint64(f.m) {
+		words = words[:(uint64(f.m)+63)/64]
+	}
+	bucketWords := (len(words) + selfTestBuckets - 1) / selfTestBuckets
+	if bucketWords < selfTestBucketWords {
+		bucketWords = selfTestBucketWords
+	}
+	buckets := (len(words) + bucketWords - 1) / bucketWords
+	r := f.FillRatio()
+	if buckets < 2 || r == 0 || r == 1 {
+		return uint(buckets), 0
+	}
+	chi := 0.0
+	for start := 0; start < len(words); start += bucketWords {
+		end := start + bucketWords
+		if end > len(words) {
+			end = len(words)
+		}
+		set := 0
+		for _, w := range words[start:end] {
+			set += bits.OnesCount64(w)
+		}
+		n := float64(64 * (end - start))
+		if end == len(words) {
+			n -= float64(uint64(len(words))*64 - uint64(f.m))
+		}
+		d := float64(set) - n*r
+		chi += d * d / (n * r * (1 - r))
+	}
+	return uint(buckets), chi
+}
@@ -0,0 +1,48 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	for _, c := range hashingFilters() {
+		f := c.f
+		var key [4]byte
+		for i := uint32(0); i < 2000; i++ {
+			binary.BigEndian.PutUint32(key[:], i)
+			f.Add(key[:])
+		}
+		r := f.SelfTest(20000)
+		if !r.Healthy(4) {
+			t.Errorf("%s: %v", c.name, r)
+		}
+		if r.Samples != 20000 || r.FalsePositives == 0 || r.Buckets < 2 {
+			t.Errorf("%s: %v", c.name, r)
+		}
+		if r != f.SelfTest(20000) {
+			t.Errorf("%s: the report should be the same for the same filter", c.name)
+		}
+	}
+
+	r := New(1000, 4).SelfTest(1000)
+	if r.FalsePositives != 0 || r.ExpectedFalsePositiveRate != 0 || !r.Healthy(0) {
+		t.Errorf("empty filter: %v", r)
+	}
+	if r := New(1000, 4).SelfTest(0); r.Samples != 0 || r.FalsePositiveZ != 0 {
+		t.Errorf("no samples: %v", r)
+	}
+}
+
+func TestSelfTestSkewed(t *testing.T) {
+	// Bits set in the first half only are detected, though the false
+	// positive rate is as expected.
+	f := New(1<<16, 3)
+	for i := uint(0); i < 1<<15; i += 3 {
+		f.b.Set(i)
+	}
+	r := f.SelfTest(10000)
+	if r.Healthy(4) || r.UniformityZ < 100 || r.FalsePositiveZ > 4 {
+		t.Errorf("%v", r)
+	}
+}
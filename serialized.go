@@ -0,0 +1,150 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bits-and-blooms/bitset"
+)
+
+// errTruncated is returned when a serialized filter is shorter than its
+// header announces.
+var errTruncated = errors.New("bloom: serialized filter is truncated")
+
+// serializedHeader is the header of a filter tested in its serialized form,
+// with the length of its bitset and the offset of its first word
+type serializedHeader struct {
+	m, k uint64
+	hashing
+	fastRange bool
+	checksum  bool
+	length    uint64
+	offset    int64
+}
+
+// readSerializedHeader reads the header of a filter written by WriteTo, up
+// to the length of its bitset, and checks that it can be tested serialized
+func readSerializedHeader(stream io.Reader) (serializedHeader, error) {
+	header, n, err := readHeader(stream)
+	if err == nil && header.keyed {
+		err = errors.New("bloom: keyed filters cannot be tested serialized")
+	}
+	if err == nil && header.encoding != EncodingRaw {
+		err = errors.New("bloom: encoded filters cannot be tested serialized")
+	}
+	var length uint64
+	if err == nil {
+		err = binary.Read(stream, bitset.BinaryOrder(), &length)
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return serializedHeader{}, errTruncated
+	}
+	if err != nil {
+		return serializedHeader{}, err
+	}
+	if header.m == 0 || header.m > length {
+		return serializedHeader{}, errors.New("bloom: serialized filter has inconsistent m")
+	}
+	if header.k == 0 || header.k > maxReadHashes {
+		return serializedHeader{}, fmt.Errorf("bloom: serialized k %d is not within [1, %d]", header.k, maxReadHashes)
+	}
+	return serializedHeader{
+		m:         header.m,
+		k:         header.k,
+		hashing:   hashing{seed: header.seed, scheme: header.scheme},
+		fastRange: header.fastRange,
+		checksum:  header.checksum,
+		length:    length,
+		offset:    n + 8,
+	}, nil
+}
+
+// location returns the ith location of the key with hashes h
+func (h *serializedHeader) location(hashes [4]uint64, i uint64) uint64 {
+	l := location(hashes, uint(i))
+	if h.fastRange {
+		return fastRange(l, h.m)
+	}
+	return l % h.m
+}
+
+// A ReadOnlyBloomFilter is a Bloom filter tested directly in its serialized
+// form, as written by WriteTo or MarshalBinary. The bits are neither copied
+// nor decoded: data can be a memory-mapped file, shared by many processes,
+// and Test does not allocate.
+//
+// Keyed and encoded filters (see NewKeyed and WriteEncodedTo) are not
+// supported. The checksum of framed filters (see WriteFramedTo) is not
+// verified: that would read all the bits.
+type ReadOnlyBloomFilter struct {
+	serializedHeader
+	words []byte
+	order binary.ByteOrder
+}
+
+// NewReadOnly returns a read-only filter over data, which holds a filter
+// written by WriteTo or MarshalBinary, possibly followed by other data. Only
+// the header is parsed; data must not be modified while the filter is used.
+func NewReadOnly(data []byte) (*ReadOnlyBloomFilter, error) {
+	h, err := readSerializedHeader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	words := data[h.offset:]
+	if uint64(len(words))/8 < h.length/64+(h.length%64+63)/64 {
+		return nil, errTruncated
+	}
+	return &ReadOnlyBloomFilter{
+		serializedHeader: h,
+		words:            words[:8*((h.length+63)/64)],
+		order:            bitset.BinaryOrder(),
+	}, nil
+}
+
+// Cap returns the capacity, _m_, of the filter
+func (f *ReadOnlyBloomFilter) Cap() uint64 {
+	return f.m
+}
+
+// K returns the number of hash functions used in the filter
+func (f *ReadOnlyBloomFilter) K() uint64 {
+	return f.k
+}
+
+// Test returns true if the data is in the filter, false otherwise. If true,
+// the result might be a false positive. If false, the data is definitely not
+// in the set.
+func (f *ReadOnlyBloomFilter) Test(data []byte) bool {
+	h := f.hashes(data)
+	for i := uint64(0); i < f.k; i++ {
+		l := f.location(h, i)
+		if f.order.Uint64(f.words[8*(l/64):])&(1<<(l%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// TestString returns true if the string is in the filter, false otherwise.
+// If true, the result might be a false positive. If false, the data
+// is definitely not in the set.
+func (f *ReadOnlyBloomFilter) TestString(data string) bool {
+	return f.Test(stringToBytes(data))
+}
+
+// TestSerialized returns true if the key is in the filter serialized in data
+// (as written by WriteTo or MarshalBinary), false otherwise. Only the header
+// is parsed and the k bits are probed directly in the buffer, so no
+// BloomFilter is built. It is meant for one-off queries against cold filters;
+// use NewReadOnly or ReadFrom when the filter is queried repeatedly. Keyed
+// and encoded filters (see WriteEncodedTo) are not supported.
+func TestSerialized(data []byte, key []byte) (bool, error) {
+	f, err := NewReadOnly(data)
+	if err != nil {
+		return false, err
+	}
+	return f.Test(key), nil
+}
@@ -0,0 +1,129 @@
+package bloom
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+)
+
+func TestTestSerialized(t *testing.T) {
+	f := NewWithEstimates(1000, 0.001)
+	for _, key := range []string{"Love", "is", "in", "bloom"} {
+		f.AddString(key)
+	}
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"Love", "is", "in", "bloom", "Hate", "was", "out", "blooms"} {
+		got, err := TestSerialized(data, []byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != f.TestString(key) {
+			t.Errorf("%v: TestSerialized returned %v", key, got)
+		}
+	}
+}
+
+func TestTestSerializedInvalid(t *testing.T) {
+	f := New(1000, 4)
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, invalid := range [][]byte{nil, data[:20], data[:len(data)-1]} {
+		if _, err := TestSerialized(invalid, []byte("key")); err == nil {
+			t.Errorf("expected an error for %d bytes", len(invalid))
+		}
+	}
+	g := New(1000, 4)
+	g.m = 2000
+	data, err = g.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := TestSerialized(data, []byte("key")); err == nil {
+		t.Error("expected an error for inconsistent m")
+	}
+	// A hostile k would make a query probe the filter for ever.
+	for _, k := range []uint{0, maxReadHashes + 1, ^uint(0)} {
+		g = New(1000, 4)
+		g.k = k
+		data, err = g.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := TestSerialized(data, []byte("key")); err == nil {
+			t.Errorf("expected an error for k = %d", k)
+		}
+		if _, err := NewReaderAt(bytes.NewReader(data)); err == nil {
+			t.Errorf("NewReaderAt: expected an error for k = %d", k)
+		}
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	for _, f := range []*BloomFilter{
+		NewWithEstimates(1000, 0.001),
+		New(1024, 5),
+		NewWithSeed(1000, 4, 42),
+		NewFastRangeWithEstimates(1000, 0.001),
+	} {
+		for i := 0; i < 100; i++ {
+			f.AddString(strconv.Itoa(i))
+		}
+		var buf bytes.Buffer
+		if _, err := f.WriteFramedTo(&buf, EncodingRaw); err != nil {
+			t.Fatal(err)
+		}
+		for _, data := range [][]byte{buf.Bytes(), append(mustMarshal(t, f), "tail"...)} {
+			r, err := NewReadOnly(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Cap() != uint64(f.Cap()) || r.K() != uint64(f.K()) {
+				t.Fatalf("%d bits and %d hash functions instead of %d and %d", r.Cap(), r.K(), f.Cap(), f.K())
+			}
+			for i := 0; i < 1000; i++ {
+				key := strconv.Itoa(i)
+				if r.TestString(key) != f.TestString(key) {
+					t.Fatalf("%s: Test should return %v", key, f.TestString(key))
+				}
+			}
+			if n := testing.AllocsPerRun(100, func() { r.TestString("1") }); n != 0 {
+				t.Errorf("Test allocates %v times", n)
+			}
+		}
+	}
+
+	// The bits are not copied.
+	f := New(1000, 4)
+	data := mustMarshal(t, f)
+	r, err := NewReadOnly(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.AddString("Love")
+	copy(data, mustMarshal(t, f))
+	if !r.TestString("Love") {
+		t.Error("the filter should be tested in data")
+	}
+
+	for name, g := range map[string]*BloomFilter{
+		"keyed":   NewKeyed(1000, 4, [16]byte{1}),
+		"encoded": New(1000, 4),
+	} {
+		var buf bytes.Buffer
+		e := EncodingRaw
+		if name == "encoded" {
+			e = EncodingGzip
+		}
+		if _, err := g.WriteEncodedTo(&buf, e); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewReadOnly(buf.Bytes()); err == nil {
+			t.Errorf("%s filters should not be accepted", name)
+		}
+	}
+}
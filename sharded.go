@@ -0,0 +1,214 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// A ShardedBloomFilter is a concurrent Bloom filter which partitions keys
+// across several ConcurrentBloomFilter shards: each key is hashed once, to
+// select its shard and its locations in that shard. Goroutines adding
+// different keys mostly write to different shards, and thus contend less on
+// the same cache lines than with a single ConcurrentBloomFilter. It is safe
+// for concurrent use.
+type ShardedBloomFilter struct {
+	shards []*ConcurrentBloomFilter
+}
+
+// NewSharded creates a new sharded Bloom filter with _shards_ shards of _m_
+// bits each and _k_ hashing functions. We force _shards_ to be at least one.
+func NewSharded(shards uint, m uint, k uint) *ShardedBloomFilter {
+	s := &ShardedBloomFilter{shards: make([]*ConcurrentBloomFilter, max(1, shards))}
+	for i := range s.shards {
+		s.shards[i] = NewConcurrent(m, k)
+	}
+	return s
+}
+
+// NewShardedWithEstimates creates a new sharded Bloom filter with _shards_
+// shards, for about n items with fp false positive rate
+func NewShardedWithEstimates(shards uint, n uint, fp float64) *ShardedBloomFilter {
+	shards = max(1, shards)
+	m, k := EstimateParameters((n+shards-1)/shards, fp)
+	return NewSharded(shards, m, k)
+}
+
+// Shards returns the number of shards
+func (s *ShardedBloomFilter) Shards() int {
+	return len(s.shards)
+}
+
+// Cap returns the total capacity, in bits, of the shards
+func (s *ShardedBloomFilter) Cap() uint {
+	return uint(len(s.shards)) * s.shards[0].m
+}
+
+// K returns the number of hash functions used in the ShardedBloomFilter
+func (s *ShardedBloomFilter) K() uint {
+	return s.shards[0].k
+}
+
+// shard returns the shard of a key, derived from its base hash values
+func (s *ShardedBloomFilter) shard(h [4]uint64) *ConcurrentBloomFilter {
+	return s.shards[(fmix64(h[0]^h[1])>>32)*uint64(len(s.shards))>>32]
+}
+
+// Add data to the Bloom Filter. Returns the filter (allows chaining)
+func (s *ShardedBloomFilter) Add(data []byte) *ShardedBloomFilter {
+	s.TestAndAdd(data)
+	return s
+}
+
+// AddString to the Bloom Filter. Returns the filter (allows chaining)
+func (s *ShardedBloomFilter) AddString(data string) *ShardedBloomFilter {
+	return s.Add(stringToBytes(data))
+}
+
+// Test returns true if the data is in the ShardedBloomFilter, false
+// otherwise. If true, the result might be a false positive. If false, the
+// data is definitely not in the set.
+func (s *ShardedBloomFilter) Test(data []byte) bool {
+	h := baseHashes(data)
+	f := s.shard(h)
+	for i := uint(0); i < f.k; i++ {
+		if !f.isSet(location(h, i) % uint64(f.m)) {
+			return false
+		}
+	}
+	return true
+}
+
+// TestString returns true if the string is in the ShardedBloomFilter, false
+// otherwise. If true, the result might be a false positive. If false, the
+// data is definitely not in the set.
+func (s *ShardedBloomFilter) TestString(data string) bool {
+	return s.Test(stringToBytes(data))
+}
+
+// TestAndAdd is equivalent to calling Test(data) then Add(data). See
+// ConcurrentBloomFilter.TestAndAdd.
+func (s *ShardedBloomFilter) TestAndAdd(data []byte) bool {
+	h := baseHashes(data)
+	f := s.shard(h)
+	present := true
+	for i := uint(0); i < f.k; i++ {
+		if !f.set(location(h, i) % uint64(f.m)) {
+			present = false
+		}
+	}
+	return present
+}
+
+// Merge adds the keys of another sharded Bloom filter, which must have the
+// same number of shards, _m_ and _k_. It may be called concurrently with
+// other methods, including Merge.
+func (s *ShardedBloomFilter) Merge(g *ShardedBloomFilter) error {
+	if len(s.shards) != len(g.shards) {
+		return fmt.Errorf("shards are different (%d != %d)", len(s.shards), len(g.shards))
+	}
+	if s.shards[0].m != g.shards[0].m {
+		return fmt.Errorf("m's don't match: %d != %d", s.shards[0].m, g.shards[0].m)
+	}
+	if s.shards[0].k != g.shards[0].k {
+		return fmt.Errorf("k's don't match: %d != %d", s.shards[0].k, g.shards[0].k)
+	}
+	for i, f := range s.shards {
+		for j := range f.words {
+			w := atomic.LoadUint64(&g.shards[i].words[j])
+			addr := &f.words[j]
+			for {
+				old := atomic.LoadUint64(addr)
+				if old|w == old || atomic.CompareAndSwapUint64(addr, old, old|w) {
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ClearAll clears all the data in the Bloom filter, removing all keys. Keys
+// added concurrently may or may not be removed.
+func (s *ShardedBloomFilter) ClearAll() *ShardedBloomFilter {
+	for _, f := range s.shards {
+		f.ClearAll()
+	}
+	return s
+}
+
+// WriteTo writes a binary representation of the ShardedBloomFilter to an i/o
+// stream: the number of shards as a big-endian 64-bit word, followed by a
+// snapshot of each shard in the format of BloomFilter.WriteTo. It returns the
+// number of bytes written.
+func (s *ShardedBloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	err := binary.Write(stream, binary.BigEndian, uint64(len(s.shards)))
+	if err != nil {
+		return 0, err
+	}
+	n := int64(binary.Size(uint64(0)))
+	for _, f := range s.shards {
+		numBytes, err := f.WriteTo(stream)
+		n += numBytes
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// ReadFrom reads a binary representation of the ShardedBloomFilter (such as
+// might have been written by WriteTo()) from an i/o stream. It returns the
+// number of bytes read. It must not be called concurrently with other
+// methods.
+func (s *ShardedBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	var shards uint64
+	err := binary.Read(stream, binary.BigEndian, &shards)
+	if err != nil {
+		return 0, err
+	}
+	if shards == 0 || shards > 1<<32 {
+		return 0, fmt.Errorf("bloom: invalid number of shards %d", shards)
+	}
+	n := int64(binary.Size(uint64(0)))
+	var g ShardedBloomFilter
+	for i := uint64(0); i < shards; i++ {
+		f := &ConcurrentBloomFilter{}
+		numBytes, err := f.ReadFrom(stream)
+		n += numBytes
+		if err != nil {
+			return n, err
+		}
+		if f.hashing != (hashing{}) || f.fastRange {
+			return n, errors.New("bloom: shards must use the default hash functions and range reduction")
+		}
+		if i > 0 && (f.m != g.shards[0].m || f.k != g.shards[0].k) {
+			return n, errors.New("bloom: shards have different parameters")
+		}
+		g.shards = append(g.shards, f)
+	}
+	*s = g
+	return n, nil
+}
+
+// MarshalBinary implements binary.BinaryMarshaler interface.
+func (s *ShardedBloomFilter) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := s.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements binary.BinaryUnmarshaler interface.
+func (s *ShardedBloomFilter) UnmarshalBinary(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := s.ReadFrom(buf)
+
+	return err
+}
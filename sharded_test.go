@@ -0,0 +1,115 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"sync"
+	"testing"
+)
+
+func TestShardedBasic(t *testing.T) {
+	s := NewShardedWithEstimates(4, 1000, 0.01)
+	if s.Shards() != 4 || s.Cap() != 4*s.shards[0].Cap() || s.K() != s.shards[0].K() {
+		t.Fatalf("unexpected parameters %d %d %d", s.Shards(), s.Cap(), s.K())
+	}
+	n1 := []byte("Bess")
+	n2 := []byte("Jane")
+	if s.TestAndAdd(n1) || !s.Test(n1) {
+		t.Errorf("%v should be in.", n1)
+	}
+	if s.Test(n2) {
+		t.Errorf("%v should not be in.", n2)
+	}
+	s.AddString("Jane")
+	if !s.TestString("Jane") {
+		t.Errorf("%v should be in.", n2)
+	}
+	s.ClearAll()
+	if s.Test(n1) || s.Test(n2) {
+		t.Error("ClearAll should remove all keys")
+	}
+	if NewSharded(0, 10, 1).Shards() != 1 {
+		t.Error("there should be at least one shard")
+	}
+}
+
+func TestShardedSpread(t *testing.T) {
+	s := NewShardedWithEstimates(8, 80000, 0.01)
+	var wg sync.WaitGroup
+	for w := uint32(0); w < 8; w++ {
+		wg.Add(1)
+		go func(w uint32) {
+			defer wg.Done()
+			key := make([]byte, 4)
+			for i := w; i < 80000; i += 8 {
+				binary.BigEndian.PutUint32(key, i)
+				s.Add(key)
+			}
+		}(w)
+	}
+	wg.Wait()
+	key := make([]byte, 4)
+	for i := uint32(0); i < 80000; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		if !s.Test(key) {
+			t.Fatalf("key %d should be in", i)
+		}
+	}
+	for i, f := range s.shards {
+		if n := f.Snapshot().ApproximatedSize(); n < 9000 || n > 11000 {
+			t.Errorf("shard %d holds about %d keys, expected 10000", i, n)
+		}
+	}
+	positives := 0
+	for i := uint32(80000); i < 180000; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		if s.Test(key) {
+			positives++
+		}
+	}
+	if rate := float64(positives) / 100000; rate > 0.015 {
+		t.Errorf("false positive rate %f is too high", rate)
+	}
+}
+
+func TestShardedMergeEncodeDecode(t *testing.T) {
+	s := NewSharded(3, 1000, 4)
+	g := NewSharded(3, 1000, 4)
+	s.AddString("a")
+	g.AddString("b")
+	if err := s.Merge(g); err != nil {
+		t.Fatal(err)
+	}
+	if !s.TestString("a") || !s.TestString("b") || g.TestString("a") {
+		t.Error("Merge should add the keys of the other filter")
+	}
+	for _, other := range []*ShardedBloomFilter{NewSharded(2, 1000, 4), NewSharded(3, 999, 4), NewSharded(3, 1000, 3)} {
+		if s.Merge(other) == nil {
+			t.Error("filters with different parameters should not be merged")
+		}
+	}
+
+	data, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var h ShardedBloomFilter
+	if err := h.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if h.Shards() != 3 {
+		t.Fatalf("expected 3 shards, got %d", h.Shards())
+	}
+	for i := range s.shards {
+		if !s.shards[i].Snapshot().Equal(h.shards[i].Snapshot()) {
+			t.Errorf("shard %d differs", i)
+		}
+	}
+	// Each shard is a plain Bloom filter.
+	var f BloomFilter
+	if err := f.UnmarshalBinary(data[8:]); err != nil || f.Cap() != 1000 {
+		t.Errorf("the first shard should be a BloomFilter: %v", err)
+	}
+	if err := h.UnmarshalBinary(make([]byte, 8)); err == nil {
+		t.Error("zero shards should not be accepted")
+	}
+}
@@ -0,0 +1,75 @@
+package bloom
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+)
+
+// A signed filter is a binary filter (see MarshalBinary) wrapped in a
+// versioned header holding a detached ed25519 signature:
+//
+//	magic     4 bytes, "BLSG"
+//	version   1 byte, 1
+//	signature 64 bytes, over the magic, the version and the payload
+//	payload   the binary filter
+var signedMagic = [4]byte{'B', 'L', 'S', 'G'}
+
+const signedVersion = 1
+
+// signedHeaderSize is the size of the header preceding the payload
+const signedHeaderSize = len(signedMagic) + 1 + ed25519.SignatureSize
+
+// ErrInvalidSignature is returned when a signed filter was not signed by the
+// expected key or was tampered with.
+var ErrInvalidSignature = errors.New("bloom: invalid signature")
+
+// Sign wraps a binary filter, such as returned by MarshalBinary, in a signed
+// header, so that consumers can check with UnmarshalSigned that it was
+// published by the holder of the private key.
+func Sign(data []byte, key ed25519.PrivateKey) []byte {
+	signed := make([]byte, signedHeaderSize+len(data))
+	copy(signed, signedMagic[:])
+	signed[len(signedMagic)] = signedVersion
+	copy(signed[signedHeaderSize:], data)
+	signature := ed25519.Sign(key, signedMessage(signed))
+	copy(signed[len(signedMagic)+1:], signature)
+	return signed
+}
+
+// signedMessage returns the signed part of a signed filter: everything but
+// the signature.
+func signedMessage(signed []byte) []byte {
+	message := make([]byte, 0, len(signed)-ed25519.SignatureSize)
+	message = append(message, signed[:len(signedMagic)+1]...)
+	return append(message, signed[signedHeaderSize:]...)
+}
+
+// MarshalSigned encodes the filter in binary form and signs it with the
+// private key. See Sign.
+func (f *BloomFilter) MarshalSigned(key ed25519.PrivateKey) ([]byte, error) {
+	data, err := f.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return Sign(data, key), nil
+}
+
+// UnmarshalSigned checks the signature of a signed filter against the public
+// key and, if it is valid, decodes the filter. It returns ErrInvalidSignature
+// if the filter was not signed by the matching private key or was tampered
+// with; the filter is then left unchanged.
+func (f *BloomFilter) UnmarshalSigned(signed []byte, key ed25519.PublicKey) error {
+	if len(signed) < signedHeaderSize || !bytes.Equal(signed[:len(signedMagic)], signedMagic[:]) {
+		return errors.New("bloom: not a signed filter")
+	}
+	if version := signed[len(signedMagic)]; version != signedVersion {
+		return fmt.Errorf("bloom: unsupported signed filter version %d", version)
+	}
+	signature := signed[len(signedMagic)+1 : signedHeaderSize]
+	if !ed25519.Verify(key, signedMessage(signed), signature) {
+		return ErrInvalidSignature
+	}
+	return f.UnmarshalBinary(signed[signedHeaderSize:])
+}
@@ -0,0 +1,68 @@
+package bloom
+
+import (
+	"crypto/ed25519"
+	"testing"
+)
+
+func TestMarshalUnmarshalSigned(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := New(1000, 4)
+	f.AddString("Love")
+	signed, err := f.MarshalSigned(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var g BloomFilter
+	if err := g.UnmarshalSigned(signed, public); err != nil {
+		t.Fatal(err)
+	}
+	if !g.Equal(f) {
+		t.Error("filters are not equal")
+	}
+	if !g.TestString("Love") {
+		t.Error("missing value 'Love'")
+	}
+}
+
+func TestUnmarshalSignedTampered(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := New(1000, 4)
+	signed, err := f.MarshalSigned(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var g BloomFilter
+	if err := g.UnmarshalSigned(signed, other); err != ErrInvalidSignature {
+		t.Errorf("expected ErrInvalidSignature with the wrong key, got %v", err)
+	}
+	signed[len(signed)-1] ^= 1
+	if err := g.UnmarshalSigned(signed, public); err != ErrInvalidSignature {
+		t.Errorf("expected ErrInvalidSignature for a tampered payload, got %v", err)
+	}
+	signed[len(signed)-1] ^= 1
+	signed[4] = 2
+	if err := g.UnmarshalSigned(signed, public); err == nil {
+		t.Error("expected an error for an unsupported version")
+	}
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.UnmarshalSigned(data, public); err == nil {
+		t.Error("expected an error for an unsigned filter")
+	}
+	if g.b != nil {
+		t.Error("the filter should be left unchanged")
+	}
+}
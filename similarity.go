@@ -0,0 +1,68 @@
+package bloom
+
+import (
+	"errors"
+	"math"
+)
+
+// estimateCount returns the estimated number of keys which set x of the m
+// bits of a filter with k hash functions, see ApproximatedSize.
+func estimateCount(x, m, k uint) float64 {
+	return -float64(m) / float64(k) * math.Log(1-float64(x)/float64(m))
+}
+
+// estimateCounts returns the estimated number of keys of a, of b and of
+// their union.
+func estimateCounts(a, b *BloomFilter) (na, nb, nu float64, err error) {
+	err = a.compatible(b)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	union := a.b.UnionCardinality(b.b)
+	if union >= a.m {
+		return 0, 0, 0, errors.New("bloom: filters are too full to estimate their cardinality")
+	}
+	na = estimateCount(a.b.Count(), a.m, a.k)
+	nb = estimateCount(b.b.Count(), a.m, a.k)
+	nu = estimateCount(union, a.m, a.k)
+	return na, nb, nu, nil
+}
+
+// EstimateUnionCardinality estimates the number of keys in the union of the
+// sets of two Bloom filters, from the number of bits set in their union
+// (Swamidass and Baldi, 2007), without building it. The filters must have
+// the same m, k and hash functions, as for Merge. It returns an error if
+// the union of the filters has all its bits set, since its size is then
+// unknown.
+func EstimateUnionCardinality(a, b *BloomFilter) (float64, error) {
+	_, _, nu, err := estimateCounts(a, b)
+	return nu, err
+}
+
+// EstimateIntersectionCardinality estimates the number of keys in the
+// intersection of the sets of two Bloom filters, as the sum of their
+// estimated sizes minus the estimated size of their union (Swamidass and
+// Baldi, 2007). The estimate is at least zero. The filters must have the
+// same m, k and hash functions. See EstimateUnionCardinality for errors.
+func EstimateIntersectionCardinality(a, b *BloomFilter) (float64, error) {
+	na, nb, nu, err := estimateCounts(a, b)
+	return math.Max(0, na+nb-nu), err
+}
+
+// EstimateJaccard estimates the Jaccard similarity of the sets of keys of
+// two Bloom filters, the size of their intersection divided by the size of
+// their union, from the number of bits set in a, in b and in their union.
+// The filters must have the same m, k and hash functions, as for Merge. The
+// estimate is clamped to [0, 1], and is 1 if both filters are empty. It is
+// accurate while the filters are far from full: it returns an error if the
+// union of the filters has all its bits set, since its size is then unknown.
+func EstimateJaccard(a, b *BloomFilter) (float64, error) {
+	if a.compatible(b) == nil && a.b.None() && b.b.None() {
+		return 1, nil
+	}
+	na, nb, nu, err := estimateCounts(a, b)
+	if err != nil {
+		return 0, err
+	}
+	return math.Max(0, math.Min(1, (na+nb-nu)/nu)), nil
+}
@@ -0,0 +1,76 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func TestEstimateJaccard(t *testing.T) {
+	a := NewWithEstimates(10000, 0.01)
+	b := NewWithEstimates(10000, 0.01)
+	if j, err := EstimateJaccard(a, b); err != nil || j != 1 {
+		t.Errorf("empty filters should be similar: %v %v", j, err)
+	}
+	// a holds [0, 3000) and b holds [1000, 4000): 2000 common keys out of 4000.
+	key := make([]byte, 4)
+	for i := uint32(0); i < 4000; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		if i < 3000 {
+			a.Add(key)
+		}
+		if i >= 1000 {
+			b.Add(key)
+		}
+	}
+	j, err := EstimateJaccard(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(j-0.5) > 0.05 {
+		t.Errorf("similarity %f should be about 0.5", j)
+	}
+	if j, err := EstimateJaccard(a, a); err != nil || math.Abs(j-1) > 1e-9 {
+		t.Errorf("a filter should be similar to itself: %v %v", j, err)
+	}
+
+	if _, err := EstimateJaccard(a, New(a.Cap(), a.K()+1)); err == nil {
+		t.Error("There should be an error for mismatched k")
+	}
+	full := From([]uint64{^uint64(0)}, 3)
+	if _, err := EstimateJaccard(full, From([]uint64{0}, 3)); err == nil {
+		t.Error("There should be an error for full filters")
+	}
+}
+
+func TestEstimateCardinality(t *testing.T) {
+	a := NewWithEstimates(10000, 0.01)
+	b := NewWithEstimates(10000, 0.01)
+	// a holds [0, 3000) and b holds [1000, 4000).
+	key := make([]byte, 4)
+	for i := uint32(0); i < 4000; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		if i < 3000 {
+			a.Add(key)
+		}
+		if i >= 1000 {
+			b.Add(key)
+		}
+	}
+	if n, err := EstimateUnionCardinality(a, b); err != nil || math.Abs(n-4000) > 100 {
+		t.Errorf("union cardinality %f should be about 4000: %v", n, err)
+	}
+	if n, err := EstimateIntersectionCardinality(a, b); err != nil || math.Abs(n-2000) > 100 {
+		t.Errorf("intersection cardinality %f should be about 2000: %v", n, err)
+	}
+	if n, err := EstimateIntersectionCardinality(a, New(a.Cap(), a.K())); err != nil || n > 10 {
+		t.Errorf("intersection cardinality %f should be about 0: %v", n, err)
+	}
+	if _, err := EstimateUnionCardinality(a, New(a.Cap()+1, a.K())); err == nil {
+		t.Error("There should be an error for mismatched m")
+	}
+	full := From([]uint64{^uint64(0)}, 3)
+	if _, err := EstimateIntersectionCardinality(full, full); err == nil {
+		t.Error("There should be an error for full filters")
+	}
+}
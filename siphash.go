@@ -0,0 +1,123 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// A sipKey is a secret 128-bit SipHash key, see NewKeyed.
+type sipKey [2]uint64
+
+// newSipKey converts a key given as bytes, in the byte order of the SipHash
+// reference implementation
+func newSipKey(key [16]byte) *sipKey {
+	return &sipKey{binary.LittleEndian.Uint64(key[:8]), binary.LittleEndian.Uint64(key[8:])}
+}
+
+// sipRound is the SipRound function of SipHash
+func sipRound(v0, v1, v2, v3 uint64) (uint64, uint64, uint64, uint64) {
+	v0 += v1
+	v1 = bits.RotateLeft64(v1, 13)
+	v1 ^= v0
+	v0 = bits.RotateLeft64(v0, 32)
+	v2 += v3
+	v3 = bits.RotateLeft64(v3, 16)
+	v3 ^= v2
+	v0 += v3
+	v3 = bits.RotateLeft64(v3, 21)
+	v3 ^= v0
+	v2 += v1
+	v1 = bits.RotateLeft64(v1, 17)
+	v1 ^= v2
+	v2 = bits.RotateLeft64(v2, 32)
+	return v0, v1, v2, v3
+}
+
+// sum128 returns the 128-bit SipHash-2-4 of data, see
+// https://github.com/veorq/SipHash. It is sipBlocks then sipFinish, inlined
+// since the calls would slow keyed filters down.
+func (key *sipKey) sum128(data []byte) (uint64, uint64) {
+	v0, v1, v2, v3 := key.init()
+
+	b := uint64(len(data)) << 56
+	for ; len(data) >= 8; data = data[8:] {
+		m := binary.LittleEndian.Uint64(data)
+		v3 ^= m
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+		v0 ^= m
+	}
+	for i, c := range data {
+		b |= uint64(c) << (8 * uint(i))
+	}
+	v3 ^= b
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0 ^= b
+
+	v2 ^= 0xee
+	for i := 0; i < 4; i++ {
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	}
+	h1 := v0 ^ v1 ^ v2 ^ v3
+	v1 ^= 0xdd
+	for i := 0; i < 4; i++ {
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	}
+	h2 := v0 ^ v1 ^ v2 ^ v3
+	return h1, h2
+}
+
+// init returns the initial state of SipHash-2-4 with a 128-bit output
+func (key *sipKey) init() (v0, v1, v2, v3 uint64) {
+	return key[0] ^ 0x736f6d6570736575, key[1] ^ 0x646f72616e646f6d ^ 0xee,
+		key[0] ^ 0x6c7967656e657261, key[1] ^ 0x7465646279746573
+}
+
+// sipBlocks compresses the complete blocks of 8 bytes of data into the state
+func sipBlocks(v0, v1, v2, v3 uint64, data []byte) (uint64, uint64, uint64, uint64) {
+	for ; len(data) >= 8; data = data[8:] {
+		m := binary.LittleEndian.Uint64(data)
+		v3 ^= m
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+		v0 ^= m
+	}
+	return v0, v1, v2, v3
+}
+
+// sipFinish compresses the last block, made of the tail, fewer than 8 bytes,
+// and of the length of the data, and returns the 128-bit hash
+func sipFinish(v0, v1, v2, v3 uint64, tail []byte, length uint64) (uint64, uint64) {
+	b := length << 56
+	for i, c := range tail {
+		b |= uint64(c) << (8 * uint(i))
+	}
+	v3 ^= b
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0 ^= b
+
+	v2 ^= 0xee
+	for i := 0; i < 4; i++ {
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	}
+	h1 := v0 ^ v1 ^ v2 ^ v3
+	v1 ^= 0xdd
+	for i := 0; i < 4; i++ {
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	}
+	h2 := v0 ^ v1 ^ v2 ^ v3
+	return h1, h2
+}
+
+// hashes returns the four hash values of data that are used to create k
+// hashes: the 128-bit SipHash of data, and two values derived from it.
+func (key *sipKey) hashes(data []byte) [4]uint64 {
+	return sipHashes(key.sum128(data))
+}
+
+// sipHashes derives the four hash values from the 128-bit SipHash
+func sipHashes(h1, h2 uint64) [4]uint64 {
+	return [4]uint64{h1, h2, fmix64(h1 ^ h2), fmix64(h1 + h2)}
+}
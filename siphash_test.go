@@ -0,0 +1,123 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+)
+
+func TestSipHash128(t *testing.T) {
+	// Reference vectors of SipHash-2-4 with a 128-bit output, with the key
+	// 00 01 .. 0f and the messages of 0 and 15 bytes 00 01 ..
+	var k [16]byte
+	msg := make([]byte, 15)
+	for i := range k {
+		k[i] = byte(i)
+	}
+	for i := range msg {
+		msg[i] = byte(i)
+	}
+	key := newSipKey(k)
+	for _, c := range []struct {
+		data   []byte
+		h1, h2 uint64
+	}{
+		{nil, 0xe6a825ba047f81a3, 0x930255c71472f66d},
+		{msg, 0x11a8b03399e99354, 0xd9c3cf970fec087e},
+	} {
+		if h1, h2 := key.sum128(c.data); h1 != c.h1 || h2 != c.h2 {
+			t.Errorf("SipHash of %d bytes: %x %x, expected %x %x", len(c.data), h1, h2, c.h1, c.h2)
+		}
+	}
+}
+
+func TestKeyed(t *testing.T) {
+	key1 := [16]byte{1}
+	key2 := [16]byte{2}
+	f := NewKeyedWithEstimates(1000, 0.001, key1)
+	g := NewKeyedWithEstimates(1000, 0.001, key2)
+	h := NewWithEstimates(1000, 0.001)
+	n1 := []byte("Bess")
+	n2 := []byte("Jane")
+	f.Add(n1)
+	g.Add(n1)
+	h.Add(n1)
+	if !f.Test(n1) || !g.Test(n1) || f.Test(n2) {
+		t.Error("keyed filters should behave as filters")
+	}
+	if f.Equal(g) || f.BitSet().Equal(g.BitSet()) || f.BitSet().Equal(h.BitSet()) {
+		t.Error("keys should change the locations")
+	}
+	if f.Merge(g) == nil || f.Merge(h) == nil || h.Merge(f) == nil {
+		t.Error("filters with different keys should not be merged")
+	}
+	c := f.Copy()
+	if !c.Equal(f) || !c.Test(n1) {
+		t.Error("copies should keep the key")
+	}
+	if r := TestAcross(n1, []*BloomFilter{f, h, g}); !r[0] || !r[1] || !r[2] {
+		t.Errorf("TestAcross should hash with the key of each filter: %v", r)
+	}
+	if e := f.Explain(n1); !e.Present() {
+		t.Error("Explain should hash with the key")
+	}
+	if NewConcurrentFrom(f).Test(n1) != true || !NewConcurrentFrom(f).Snapshot().Equal(f) {
+		t.Error("concurrent copies should keep the key")
+	}
+	if f.WriteCHeader(&bytes.Buffer{}, "f") == nil {
+		t.Error("keyed filters should not be exported to C")
+	}
+}
+
+func TestKeyedEncodeDecode(t *testing.T) {
+	key := [16]byte{1}
+	f := NewKeyed(1000, 4, key)
+	f.AddString("a")
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if binary.BigEndian.Uint32(data) != formatMagic {
+		t.Fatalf("keyed filters should use the extended header, got %x", data[:8])
+	}
+
+	var g BloomFilter
+	if err := g.UnmarshalBinary(data); err == nil {
+		t.Error("keyed filters should not be decoded without their key")
+	}
+	h := NewKeyed(1, 1, key)
+	if err := h.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !h.Equal(f) || !h.TestString("a") {
+		t.Error("binary round trip changed the filter")
+	}
+	plain, _ := New(1000, 4).MarshalBinary()
+	if err := h.UnmarshalBinary(plain); err == nil {
+		t.Error("keyed filters should not decode plain filters")
+	}
+
+	m := NewKeyed(1000, 4, key)
+	if _, err := m.MergeFromReader(bytes.NewReader(data)); err != nil || !m.Equal(f) {
+		t.Errorf("MergeFromReader should accept keyed filters: %v", err)
+	}
+	if _, err := New(1000, 4).MergeFromReader(bytes.NewReader(data)); err == nil {
+		t.Error("MergeFromReader should not merge keyed filters into plain ones")
+	}
+	if _, err := TestSerialized(data, []byte("a")); err == nil {
+		t.Error("TestSerialized should not accept keyed filters")
+	}
+
+	js, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(js, &g); err == nil {
+		t.Error("keyed filters should not be decoded without their key")
+	}
+	j := NewKeyed(1, 1, key)
+	if err := json.Unmarshal(js, j); err != nil || !j.Equal(f) {
+		t.Errorf("JSON round trip changed the filter: %v", err)
+	}
+}
@@ -0,0 +1,266 @@
+/*
+Package sketch implements a Count-Min sketch, as described in Cormode and
+Muthukrishnan, "An Improved Data Stream Summary: The Count-Min Sketch and its
+Applications" (2005).
+
+A Count-Min sketch estimates how many times each key was added, with
+estimates which are never too low. It is a matrix of counters with _depth_
+rows of _width_ counters: adding a key increments one counter per row, and
+the count of a key is the minimum of its counters. With a width of e/ε and a
+depth of ln(1/δ), an estimate exceeds the true count by more than ε times
+the total of all counts with a probability of at most δ.
+
+Keys are hashed as in package bloom: the counters of a key in a sketch are at
+the locations of the key in a Bloom filter with as many bits as the width
+and as many hash functions as the depth. The sketch mirrors the API of
+bloom.BloomFilter:
+
+	s := sketch.NewWithEstimates(0.001, 0.01)
+	s.AddString("Love")
+	if s.CountString("Love") > 10 {
+		...
+	}
+*/
+package sketch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// A CountMin is a Count-Min sketch. It is not safe for concurrent use.
+type CountMin struct {
+	width    uint
+	depth    uint
+	total    uint64
+	counters []uint64 // depth rows of width counters
+}
+
+// New creates a new Count-Min sketch with _depth_ rows of _width_ counters.
+// We force _width_ and _depth_ to be at least one to avoid panics.
+func New(width uint, depth uint) *CountMin {
+	if width == 0 {
+		width = 1
+	}
+	if depth == 0 {
+		depth = 1
+	}
+	return &CountMin{
+		width:    width,
+		depth:    depth,
+		counters: make([]uint64, uint64(width)*uint64(depth)),
+	}
+}
+
+// EstimateParameters returns the width and depth of a Count-Min sketch
+// whose estimates exceed the true counts by more than epsilon times the
+// total of the counts with a probability of at most delta.
+func EstimateParameters(epsilon, delta float64) (width uint, depth uint) {
+	width = uint(math.Ceil(math.E / epsilon))
+	depth = uint(math.Ceil(math.Log(1 / delta)))
+	return
+}
+
+// NewWithEstimates creates a new Count-Min sketch whose estimates exceed the
+// true counts by more than epsilon times the total of the counts with a
+// probability of at most delta.
+func NewWithEstimates(epsilon, delta float64) *CountMin {
+	return New(EstimateParameters(epsilon, delta))
+}
+
+// Width returns the number of counters per row
+func (s *CountMin) Width() uint {
+	return s.width
+}
+
+// Depth returns the number of rows, that is of hash functions
+func (s *CountMin) Depth() uint {
+	return s.depth
+}
+
+// Total returns the sum of the counts added to the sketch
+func (s *CountMin) Total() uint64 {
+	return s.total
+}
+
+// index returns the index of the counter of row i at a location
+func (s *CountMin) index(i int, l uint64) uint64 {
+	return uint64(i)*uint64(s.width) + l%uint64(s.width)
+}
+
+// add adds n to the counters at the locations of a key
+func (s *CountMin) add(locs []uint64, n uint64) *CountMin {
+	for i, l := range locs {
+		s.counters[s.index(i, l)] += n
+	}
+	s.total += n
+	return s
+}
+
+// count returns the minimum of the counters at the locations of a key
+func (s *CountMin) count(locs []uint64) uint64 {
+	count := uint64(math.MaxUint64)
+	for i, l := range locs {
+		if c := s.counters[s.index(i, l)]; c < count {
+			count = c
+		}
+	}
+	return count
+}
+
+// AddN adds n to the count of the data. Returns the sketch (allows chaining)
+func (s *CountMin) AddN(data []byte, n uint64) *CountMin {
+	return s.add(bloom.Locations(data, s.depth), n)
+}
+
+// Add increments the count of the data. Returns the sketch (allows chaining)
+func (s *CountMin) Add(data []byte) *CountMin {
+	return s.AddN(data, 1)
+}
+
+// AddString increments the count of the string. Returns the sketch (allows
+// chaining)
+func (s *CountMin) AddString(data string) *CountMin {
+	return s.add(bloom.LocationsString(data, s.depth), 1)
+}
+
+// Count returns an estimate of the count of the data, the minimum of its
+// counters. It is never lower than the true count.
+func (s *CountMin) Count(data []byte) uint64 {
+	return s.count(bloom.Locations(data, s.depth))
+}
+
+// CountString returns an estimate of the count of the string. See Count.
+func (s *CountMin) CountString(data string) uint64 {
+	return s.count(bloom.LocationsString(data, s.depth))
+}
+
+// Merge adds the counts of another sketch, which must have the same width
+// and depth.
+func (s *CountMin) Merge(g *CountMin) error {
+	if s.width != g.width {
+		return fmt.Errorf("widths don't match: %d != %d", s.width, g.width)
+	}
+	if s.depth != g.depth {
+		return fmt.Errorf("depths don't match: %d != %d", s.depth, g.depth)
+	}
+	for i, c := range g.counters {
+		s.counters[i] += c
+	}
+	s.total += g.total
+	return nil
+}
+
+// ClearAll resets all the counts of the sketch
+func (s *CountMin) ClearAll() *CountMin {
+	for i := range s.counters {
+		s.counters[i] = 0
+	}
+	s.total = 0
+	return s
+}
+
+// Equal tests for the equality of two sketches
+func (s *CountMin) Equal(g *CountMin) bool {
+	if s.width != g.width || s.depth != g.depth || s.total != g.total {
+		return false
+	}
+	for i := range s.counters {
+		if s.counters[i] != g.counters[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// header is the header of the binary representation of a sketch
+type header struct {
+	Width uint64
+	Depth uint64
+	Total uint64
+}
+
+// WriteTo writes a binary representation of the sketch to an i/o stream:
+// the width, the depth and the total, followed by the counters row by row,
+// all as big-endian 64-bit words. It returns the number of bytes written.
+func (s *CountMin) WriteTo(stream io.Writer) (int64, error) {
+	err := binary.Write(stream, binary.BigEndian, header{uint64(s.width), uint64(s.depth), s.total})
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, s.counters)
+	if err != nil {
+		return 0, err
+	}
+	return int64(8 * (3 + len(s.counters))), nil
+}
+
+// ReadFrom reads a binary representation of the sketch (such as might have
+// been written by WriteTo()) from an i/o stream. It returns the number of
+// bytes read.
+func (s *CountMin) ReadFrom(stream io.Reader) (int64, error) {
+	var h header
+	err := binary.Read(stream, binary.BigEndian, &h)
+	if err != nil {
+		return 0, err
+	}
+	if h.Width == 0 || h.Depth == 0 || uint64(uint(h.Width)) != h.Width ||
+		uint64(uint(h.Depth)) != h.Depth || h.Width*h.Depth/h.Depth != h.Width {
+		return 0, fmt.Errorf("sketch: invalid parameters width=%d depth=%d", h.Width, h.Depth)
+	}
+	// Read the counters row by row, so that a short stream cannot make us
+	// allocate a huge sketch.
+	var counters []uint64
+	row := make([]uint64, h.Width)
+	for i := uint64(0); i < h.Depth; i++ {
+		err = binary.Read(stream, binary.BigEndian, row)
+		if err != nil {
+			return 0, err
+		}
+		counters = append(counters, row...)
+	}
+	var total uint64
+	for _, c := range counters[:h.Width] {
+		total += c
+	}
+	if total != h.Total {
+		return 0, errors.New("sketch: counters don't match the total")
+	}
+	*s = CountMin{width: uint(h.Width), depth: uint(h.Depth), total: h.Total, counters: counters}
+	return int64(8 * (3 + len(counters))), nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (s *CountMin) GobEncode() ([]byte, error) {
+	return s.MarshalBinary()
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (s *CountMin) GobDecode(data []byte) error {
+	return s.UnmarshalBinary(data)
+}
+
+// MarshalBinary implements binary.BinaryMarshaler interface.
+func (s *CountMin) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := s.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements binary.BinaryUnmarshaler interface.
+func (s *CountMin) UnmarshalBinary(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := s.ReadFrom(buf)
+
+	return err
+}
@@ -0,0 +1,89 @@
+package sketch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"testing"
+)
+
+func TestCountMin(t *testing.T) {
+	s := NewWithEstimates(0.001, 0.01)
+	if s.Width() != 2719 || s.Depth() != 5 {
+		t.Errorf("unexpected parameters %d %d", s.Width(), s.Depth())
+	}
+	if s.CountString("a") != 0 {
+		t.Error("the count of a key which was not added should be zero")
+	}
+	key := make([]byte, 4)
+	for i := uint32(0); i < 1000; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		s.AddN(key, uint64(i%10+1))
+	}
+	s.AddString("a").AddString("a")
+	if s.Total() != 5502 {
+		t.Errorf("unexpected total %d", s.Total())
+	}
+	bound := uint64(0.001 * float64(s.Total()))
+	over := 0
+	for i := uint32(0); i < 1000; i++ {
+		binary.BigEndian.PutUint32(key, i)
+		count := s.Count(key)
+		if count < uint64(i%10+1) {
+			t.Fatalf("the count %d of key %d should be at least %d", count, i, i%10+1)
+		}
+		if count > uint64(i%10+1)+bound {
+			over++
+		}
+	}
+	if over > 10 || s.CountString("a") < 2 {
+		t.Errorf("%d counts exceed the bound", over)
+	}
+}
+
+func TestCountMinMerge(t *testing.T) {
+	s := New(100, 3).AddString("a")
+	g := New(100, 3).AddString("a").AddString("b")
+	if err := s.Merge(g); err != nil {
+		t.Fatal(err)
+	}
+	if s.CountString("a") < 2 || s.CountString("b") < 1 || s.Total() != 3 {
+		t.Error("the counts should be added")
+	}
+	if s.Merge(New(101, 3)) == nil || s.Merge(New(100, 4)) == nil {
+		t.Error("sketches with different parameters should not be merged")
+	}
+	s.ClearAll()
+	if s.CountString("a") != 0 || s.Total() != 0 {
+		t.Error("ClearAll should reset the counts")
+	}
+}
+
+func TestCountMinEncodeDecode(t *testing.T) {
+	s := New(100, 3).AddString("a").AddString("b")
+	data, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var g CountMin
+	if err := g.UnmarshalBinary(data); err != nil || !g.Equal(s) {
+		t.Errorf("binary round trip changed the sketch: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(s); err != nil {
+		t.Fatal(err)
+	}
+	var h CountMin
+	if err := gob.NewDecoder(&buf).Decode(&h); err != nil || !h.Equal(s) {
+		t.Errorf("gob round trip changed the sketch: %v", err)
+	}
+
+	if g.UnmarshalBinary(data[:len(data)-1]) == nil {
+		t.Error("truncated sketches should be rejected")
+	}
+	data[23]++ // total
+	if g.UnmarshalBinary(data) == nil {
+		t.Error("inconsistent sketches should be rejected")
+	}
+}
@@ -0,0 +1,45 @@
+package bloom
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+)
+
+// Value implements driver.Valuer interface, so that filters can be stored in
+// binary columns, such as BYTEA in PostgreSQL or BLOB in MySQL. The value is
+// the binary representation of MarshalBinary, and a nil filter is NULL.
+func (f *BloomFilter) Value() (driver.Value, error) {
+	if f == nil {
+		return nil, nil
+	}
+	return f.MarshalBinary()
+}
+
+// Scan implements sql.Scanner interface. It accepts the binary
+// representations read by ReadFrom, as []byte or string; NULL is not
+// accepted: scan nullable columns into a **BloomFilter, which is set to nil
+// for NULL.
+func (f *BloomFilter) Scan(src interface{}) error {
+	var data []byte
+	switch src := src.(type) {
+	case []byte:
+		data = src
+	case string:
+		data = []byte(src)
+	case nil:
+		return errors.New("bloom: cannot scan NULL into a BloomFilter")
+	default:
+		return fmt.Errorf("bloom: cannot scan %T into a BloomFilter", src)
+	}
+	// The words are copied as they are read, so that drivers can reuse data.
+	buf := bytes.NewBuffer(data)
+	if _, err := f.ReadFrom(buf); err != nil {
+		return err
+	}
+	if buf.Len() != 0 {
+		return errors.New("bloom: unexpected data after the filter")
+	}
+	return nil
+}
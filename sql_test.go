@@ -0,0 +1,66 @@
+package bloom
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+)
+
+var (
+	_ sql.Scanner   = (*BloomFilter)(nil)
+	_ driver.Valuer = (*BloomFilter)(nil)
+)
+
+func TestValueScan(t *testing.T) {
+	f := NewWithEstimates(1000, 0.01)
+	for _, key := range legacyKeys {
+		f.AddString(key)
+	}
+	v, err := f.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, ok := v.([]byte)
+	if !ok || !driver.IsValue(v) {
+		t.Fatalf("unexpected value of type %T", v)
+	}
+	if expected, _ := f.MarshalBinary(); !bytes.Equal(data, expected) {
+		t.Error("the value should be the binary representation")
+	}
+
+	for _, src := range []interface{}{data, string(data)} {
+		var g BloomFilter
+		if err := g.Scan(src); err != nil {
+			t.Fatal(err)
+		}
+		if !g.Equal(f) {
+			t.Errorf("scanning a %T changed the filter", src)
+		}
+	}
+	// The driver may reuse the bytes after Scan.
+	var g BloomFilter
+	g.Scan(data)
+	for i := range data {
+		data[i] = 0
+	}
+	if !g.Equal(f) {
+		t.Error("the filter should not share the scanned bytes")
+	}
+
+	if v, err := (*BloomFilter)(nil).Value(); v != nil || err != nil {
+		t.Errorf("a nil filter should be NULL, not %v: %v", v, err)
+	}
+	data, _ = f.MarshalBinary()
+	for name, src := range map[string]interface{}{
+		"NULL":      nil,
+		"integer":   int64(1),
+		"truncated": data[:len(data)-1],
+		"trailing":  append(data, 0),
+	} {
+		g := *f.Copy()
+		if err := g.Scan(src); err == nil {
+			t.Errorf("%s should not be accepted", name)
+		}
+	}
+}
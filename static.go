@@ -0,0 +1,85 @@
+package bloom
+
+// A StaticBloomFilter is a Bloom filter backed by a caller-provided array of
+// 64-bit words. Once constructed, it never allocates on the heap: Add and Test
+// only hash the key (on the stack) and access the backing array. It relies on
+// neither reflection nor unsafe, so it is suitable for microcontrollers
+// running under TinyGo, where the backing array is typically a global:
+//
+//	var storage [128]uint64 // 8192 bits
+//	var filter = bloom.NewStatic(storage[:], 5)
+//
+// The bit layout is the same as the BloomFilter's, so From(storage[:], k)
+// reads the same filter on a host.
+type StaticBloomFilter struct {
+	m     uint
+	k     uint
+	words []uint64
+}
+
+// NewStatic creates a Bloom filter with len(_words_) * 64 bits and _k_ hashing
+// functions over the given words. The words are not reset and must not be
+// empty. We force _k_ to be at least one.
+func NewStatic(words []uint64, k uint) StaticBloomFilter {
+	return StaticBloomFilter{uint(len(words)) * 64, max(1, k), words}
+}
+
+// Cap returns the capacity, _m_, of a Bloom filter
+func (f *StaticBloomFilter) Cap() uint {
+	return f.m
+}
+
+// K returns the number of hash functions used in the StaticBloomFilter
+func (f *StaticBloomFilter) K() uint {
+	return f.k
+}
+
+// location returns the ith hashed location using the four base hash values
+func (f *StaticBloomFilter) location(h [4]uint64, i uint) uint {
+	return uint(location(h, i) % uint64(f.m))
+}
+
+// Add data to the Bloom Filter.
+func (f *StaticBloomFilter) Add(data []byte) {
+	h := baseHashes(data)
+	for i := uint(0); i < f.k; i++ {
+		l := f.location(h, i)
+		f.words[l>>6] |= 1 << (l & 63)
+	}
+}
+
+// Test returns true if the data is in the StaticBloomFilter, false otherwise.
+// If true, the result might be a false positive. If false, the data
+// is definitely not in the set.
+func (f *StaticBloomFilter) Test(data []byte) bool {
+	h := baseHashes(data)
+	for i := uint(0); i < f.k; i++ {
+		l := f.location(h, i)
+		if f.words[l>>6]&(1<<(l&63)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// TestAndAdd is equivalent to calling Test(data) then Add(data).
+// Returns the result of Test.
+func (f *StaticBloomFilter) TestAndAdd(data []byte) bool {
+	present := true
+	h := baseHashes(data)
+	for i := uint(0); i < f.k; i++ {
+		l := f.location(h, i)
+		if f.words[l>>6]&(1<<(l&63)) == 0 {
+			present = false
+		}
+		f.words[l>>6] |= 1 << (l & 63)
+	}
+	return present
+}
+
+// ClearAll clears all the data in a Bloom filter, removing all keys
+func (f *StaticBloomFilter) ClearAll() {
+	for i := range f.words {
+		f.words[i] = 0
+	}
+}
@@ -0,0 +1,60 @@
+package bloom
+
+import (
+	"testing"
+)
+
+func TestStaticBasic(t *testing.T) {
+	var storage [16]uint64
+	f := NewStatic(storage[:], 4)
+	n1 := []byte("Bess")
+	n2 := []byte("Jane")
+	n3 := []byte("Emma")
+	f.Add(n1)
+	n3a := f.TestAndAdd(n3)
+	if !f.Test(n1) {
+		t.Errorf("%v should be in.", n1)
+	}
+	if f.Test(n2) {
+		t.Errorf("%v should not be in.", n2)
+	}
+	if n3a {
+		t.Errorf("%v should not be in the first time we look.", n3)
+	}
+	if !f.Test(n3) {
+		t.Errorf("%v should be in the second time we look.", n3)
+	}
+	if f.Cap() != 1024 || f.K() != 4 {
+		t.Errorf("unexpected parameters m=%d k=%d", f.Cap(), f.K())
+	}
+	f.ClearAll()
+	if f.Test(n1) {
+		t.Errorf("%v should not be in after ClearAll.", n1)
+	}
+}
+
+func TestStaticMatchesBloomFilter(t *testing.T) {
+	var storage [16]uint64
+	f := NewStatic(storage[:], 4)
+	g := New(1024, 4)
+	for _, key := range []string{"Love", "is", "in", "bloom"} {
+		f.Add([]byte(key))
+		g.Add([]byte(key))
+	}
+	if !g.Equal(From(storage[:], 4)) {
+		t.Error("static filter and BloomFilter should have the same layout")
+	}
+}
+
+func TestStaticNoAllocation(t *testing.T) {
+	var storage [16]uint64
+	f := NewStatic(storage[:], 4)
+	key := []byte("a key that is longer than one murmur block")
+	allocs := testing.AllocsPerRun(100, func() {
+		f.Add(key)
+		f.Test(key)
+	})
+	if allocs != 0 {
+		t.Errorf("Add and Test should not allocate, got %v allocations", allocs)
+	}
+}
@@ -0,0 +1,87 @@
+package bloom
+
+import (
+	"io"
+)
+
+// streamBufferSize is the size of the blocks which AddReader and TestReader
+// read and hash at once. It is a multiple of the blocks of murmur3 and of
+// SipHash.
+const streamBufferSize = 32 << 10
+
+// readerHashes returns the four hash values of the data read from r until
+// io.EOF, as hashes would return for the data. The data is hashed as it is
+// read, in blocks of streamBufferSize bytes.
+func (h hashing) readerHashes(r io.Reader) ([4]uint64, error) {
+	buf := make([]byte, streamBufferSize)
+	var d digest128
+	d.h1, d.h2 = h.seed, h.seed
+	var v0, v1, v2, v3 uint64
+	if h.key != nil {
+		v0, v1, v2, v3 = h.key.init()
+	}
+	var length uint64
+	fill := 0
+	for {
+		n, err := r.Read(buf[fill:])
+		fill += n
+		length += uint64(n)
+		if fill == len(buf) {
+			if h.key != nil {
+				v0, v1, v2, v3 = sipBlocks(v0, v1, v2, v3, buf)
+			} else {
+				d.bmix(buf)
+			}
+			fill = 0
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return [4]uint64{}, err
+		}
+	}
+
+	if h.key != nil {
+		v0, v1, v2, v3 = sipBlocks(v0, v1, v2, v3, buf[:fill])
+		h1, h2 := sipFinish(v0, v1, v2, v3, buf[fill&^7:fill], length)
+		if h.scheme == SchemeDoubleHashing {
+			return doubleHashes(h1, h2), nil
+		}
+		return sipHashes(h1, h2), nil
+	}
+	d.bmix(buf[:fill])
+	tail := buf[fill&^(block_size-1) : fill]
+	if h.scheme == SchemeDoubleHashing {
+		return doubleHashes(d.sum128(false, length, tail)), nil
+	}
+	h1, h2, h3, h4 := d.finish256(tail, length)
+	return [4]uint64{h1, h2, h3, h4}, nil
+}
+
+// AddReader adds the data read from r until io.EOF to the filter, as Add
+// would add all the data, without holding it in memory: the data is hashed
+// as it is read, for instance to add whole files as keys. If reading fails,
+// the filter is not modified and the error is returned.
+func (f *BloomFilter) AddReader(r io.Reader) error {
+	h, err := f.readerHashes(r)
+	if err != nil {
+		return err
+	}
+	for i := uint(0); i < f.k; i++ {
+		f.set(f.location(h, i))
+	}
+	return nil
+}
+
+// TestReader returns true if the data read from r until io.EOF is in the
+// filter, as Test would for all the data, false otherwise. If true, the
+// result might be a false positive. If false, the data is definitely not in
+// the set. The data is hashed as it is read, without holding it in memory.
+func (f *BloomFilter) TestReader(r io.Reader) (bool, error) {
+	h, err := f.readerHashes(r)
+	if err != nil {
+		return false, err
+	}
+	return f.testHashes(h), nil
+}
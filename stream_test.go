@@ -0,0 +1,62 @@
+package bloom
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReaderHashes(t *testing.T) {
+	data := make([]byte, 3*streamBufferSize+100)
+	rand.New(rand.NewSource(1)).Read(data)
+	readers := map[string]func(io.Reader) io.Reader{
+		"whole":    func(r io.Reader) io.Reader { return r },
+		"one byte": iotest.OneByteReader,
+		"half":     iotest.HalfReader,
+		"data err": iotest.DataErrReader,
+	}
+	for _, c := range hashingFilters() {
+		for _, size := range []int{0, 1, 7, 8, 15, 16, 17, 100, streamBufferSize - 1, streamBufferSize,
+			streamBufferSize + 1, 2*streamBufferSize + 15, len(data)} {
+			for name, reader := range readers {
+				if name == "one byte" && size > 1000 {
+					continue
+				}
+				h, err := c.f.readerHashes(reader(bytes.NewReader(data[:size])))
+				if err != nil || h != c.f.hashes(data[:size]) {
+					t.Errorf("%s, %d bytes, %s reader: %x should be %x (%v)", c.name, size, name, h, c.f.hashes(data[:size]), err)
+				}
+			}
+		}
+	}
+}
+
+func TestAddReader(t *testing.T) {
+	f := NewWithEstimates(1000, 0.001)
+	data := bytes.Repeat([]byte("Love"), streamBufferSize)
+	if ok, err := f.TestReader(bytes.NewReader(data)); ok || err != nil {
+		t.Errorf("the data should not be in the filter: %v", err)
+	}
+	if err := f.AddReader(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Test(data) {
+		t.Error("AddReader should add the data as Add")
+	}
+	if ok, err := f.TestReader(bytes.NewReader(data)); !ok || err != nil {
+		t.Errorf("the data should be in the filter: %v", err)
+	}
+
+	failure := errors.New("failure")
+	g := NewWithEstimates(1000, 0.001)
+	r := io.MultiReader(bytes.NewReader(data), iotest.ErrReader(failure))
+	if err := g.AddReader(r); err != failure || g.b.Any() {
+		t.Errorf("unexpected error %v, or filter modified", err)
+	}
+	if _, err := g.TestReader(iotest.ErrReader(failure)); err != failure {
+		t.Errorf("unexpected error %v", err)
+	}
+}
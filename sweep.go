@@ -0,0 +1,162 @@
+package bloom
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// sweepChunks is the number of automatic sweeps per full turn of the clock
+// hand set by SetStaleness
+const sweepChunks = 256
+
+// Sweep moves the clock hand of the filter over the next n counters,
+// decrementing those which are not zero, after the automatic sweeps which
+// are due. Unlike Remove, it also decrements saturated counters, so that
+// every key is eventually forgotten unless it is added again: a key added
+// once, whose counters are not shared, is forgotten after the hand went
+// around the m counters once (see SetStaleness for more). Returns the filter
+// (allows chaining)
+func (f *CountingBloomFilter) Sweep(n uint) *CountingBloomFilter {
+	f.Expire()
+	f.sweepCounters(uint64(n))
+	return f
+}
+
+// SetSweepRate makes the filter sweep n counters (see Sweep) every interval
+// d. The sweeps are applied lazily, by Add, Remove, Sweep and Expire, and
+// taken into account without modifying the filter by Test and Count. A
+// zero n or d stops the automatic sweeps. The sweep rate is not part of the
+// binary or JSON representation of the filter. Returns the filter (allows
+// chaining)
+func (f *CountingBloomFilter) SetSweepRate(n uint, d time.Duration) *CountingBloomFilter {
+	f.Expire()
+	if n == 0 || d <= 0 {
+		n, d = 0, 0
+	}
+	f.sweep, f.interval, f.last = uint64(n), d, f.now()
+	return f
+}
+
+// SweepRate returns the number of counters swept every interval, see
+// SetSweepRate. Both are zero if the filter is not swept automatically.
+func (f *CountingBloomFilter) SweepRate() (uint, time.Duration) {
+	return uint(f.sweep), f.interval
+}
+
+// SetStaleness makes the filter forget the keys which were not added for
+// some time: a key added once is still in the filter minAge later and, if
+// its counters are not shared with other keys, is gone maxAge later. Keys
+// sharing counters, or adding keys several times, make them last longer.
+//
+// Add increments the counters by step = ceil(maxAge/(maxAge-minAge)) and
+// the filter sweeps all its counters once every maxAge/step, so that a
+// counter set by Add reaches zero after between step-1 and step sweeps.
+// Count divides the counters by step, rounding up. The counters must be
+// wide enough to hold step: SetStaleness returns an error otherwise, or if
+// minAge is not within [0, maxAge). Call it before adding keys, since the
+// counters already set are not rescaled.
+func (f *CountingBloomFilter) SetStaleness(minAge, maxAge time.Duration) error {
+	if minAge < 0 || minAge >= maxAge {
+		return fmt.Errorf("bloom: invalid staleness range [%v, %v]", minAge, maxAge)
+	}
+	step := uint64((maxAge + (maxAge - minAge) - 1) / (maxAge - minAge))
+	if step > f.maxCount() {
+		return fmt.Errorf("bloom: %d-bit counters cannot hold the %d increments needed for a staleness of [%v, %v]",
+			f.width, step, minAge, maxAge)
+	}
+	period := maxAge / time.Duration(step)
+	chunks := time.Duration(sweepChunks)
+	if period < chunks {
+		chunks = period
+	}
+	if chunks == 0 {
+		return errors.New("bloom: the staleness is too short")
+	}
+	m := uint64(f.m)
+	n := (m + uint64(chunks) - 1) / uint64(chunks)
+	d := time.Duration(float64(period) * float64(n) / float64(m))
+	f.SetSweepRate(uint(n), maxDuration(d, 1))
+	f.step = step
+	return nil
+}
+
+// Expire applies the automatic sweeps which are due, see SetSweepRate.
+// Returns the filter (allows chaining)
+func (f *CountingBloomFilter) Expire() *CountingBloomFilter {
+	n, periods := f.pending()
+	if periods > 0 {
+		f.sweepCounters(n)
+		f.last = f.last.Add(time.Duration(periods) * f.interval)
+	}
+	return f
+}
+
+// pending returns the number of counters to sweep and the number of
+// intervals elapsed since the last automatic sweep. It does not modify the
+// filter. Sweeping maxCount times each counter clears the filter, so the
+// number of counters is capped.
+func (f *CountingBloomFilter) pending() (uint64, int64) {
+	if f.sweep == 0 || f.interval <= 0 {
+		return 0, 0
+	}
+	periods := int64(f.now().Sub(f.last) / f.interval)
+	if periods <= 0 {
+		return 0, 0
+	}
+	limit := ^uint64(0)
+	if m := uint64(f.m); f.maxCount() <= limit/m {
+		limit = m * f.maxCount()
+	}
+	if uint64(periods) > limit/f.sweep {
+		return limit, periods
+	}
+	return uint64(periods) * f.sweep, periods
+}
+
+// sweepCounters moves the clock hand over n counters and decrements them.
+// Whole turns of the hand are applied to all the counters at once.
+func (f *CountingBloomFilter) sweepCounters(n uint64) {
+	m := uint64(f.m)
+	if turns := n / m; turns > 0 {
+		for l := uint64(0); l < m; l++ {
+			f.add(l, -min64(turns, f.get(l)))
+		}
+	}
+	for n %= m; n > 0; n-- {
+		if f.get(f.hand) > 0 {
+			f.add(f.hand, ^uint64(0))
+		}
+		if f.hand++; f.hand == m {
+			f.hand = 0
+		}
+	}
+}
+
+// swept returns the value the counter at a location would have after
+// sweeping n counters, without modifying the filter
+func (f *CountingBloomFilter) swept(l uint64, n uint64) uint64 {
+	c := f.get(l)
+	m := uint64(f.m)
+	offset := (l + m - f.hand) % m
+	if n <= offset {
+		return c
+	}
+	return c - min64(c, (n-offset-1)/m+1)
+}
+
+// min64 returns the smallest of two uint64
+func min64(x, y uint64) uint64 {
+	if x < y {
+		return x
+	}
+	return y
+}
+
+// maxDuration returns the largest of two durations
+func maxDuration(x, y time.Duration) time.Duration {
+	if x > y {
+		return x
+	}
+	return y
+}
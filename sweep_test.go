@@ -0,0 +1,162 @@
+package bloom
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCountingSweep(t *testing.T) {
+	f := NewCounting(100, 3, 4)
+	f.AddString("Bess").AddString("Bess").AddString("Jane")
+	f.Sweep(100)
+	if !f.TestString("Bess") || f.TestString("Jane") {
+		t.Error("one turn of the hand should forget the keys added once")
+	}
+	if f.CountString("Bess") != 1 {
+		t.Errorf("Bess should have been counted once, got %d", f.CountString("Bess"))
+	}
+	// A partial turn only decrements the counters under the hand.
+	f.ClearAll()
+	f.add(10, 2)
+	f.add(60, 2)
+	f.Sweep(150)
+	if f.get(10) != 0 || f.get(60) != 1 {
+		t.Errorf("unexpected counters %d %d after a turn and a half", f.get(10), f.get(60))
+	}
+	f.Sweep(20)
+	if f.get(60) != 0 || f.hand != 70 {
+		t.Errorf("the hand should be at 70, got counter %d, hand %d", f.get(60), f.hand)
+	}
+}
+
+func TestCountingSweepSaturated(t *testing.T) {
+	f := NewCounting(10, 1, 1)
+	f.AddString("Bess").AddString("Bess")
+	if f.RemoveString("Bess"); !f.TestString("Bess") {
+		t.Fatal("Remove should not decrement saturated counters")
+	}
+	f.Sweep(10)
+	if f.TestString("Bess") {
+		t.Error("Sweep should decrement saturated counters")
+	}
+}
+
+func TestCountingSweepRate(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := NewCounting(1000, 4, 4)
+	f.now = func() time.Time { return now }
+	f.SetSweepRate(100, time.Second)
+	if n, d := f.SweepRate(); n != 100 || d != time.Second {
+		t.Errorf("unexpected sweep rate %d %v", n, d)
+	}
+	for i := 0; i < 100; i++ {
+		f.AddString(fmt.Sprint(i))
+	}
+	now = now.Add(9 * time.Second)
+	before, _ := f.MarshalBinary()
+	present := 0
+	for i := 0; i < 100; i++ {
+		if f.TestString(fmt.Sprint(i)) {
+			present++
+		}
+	}
+	after, _ := f.MarshalBinary()
+	if !bytes.Equal(before, after) {
+		t.Error("Test should not modify the filter")
+	}
+	if present == 0 || present == 100 {
+		t.Errorf("after 900 of 1000 counters were swept, %d keys should not be present", present)
+	}
+	// 15 turns clear 4-bit counters, even those shared by several keys.
+	now = now.Add(141 * time.Second)
+	for i := 0; i < 100; i++ {
+		if f.TestString(fmt.Sprint(i)) {
+			t.Fatalf("%d should have been swept", i)
+		}
+	}
+	f.Expire()
+	if f.hand != 0 || f.last != now {
+		t.Errorf("Expire should have applied the sweeps: hand %d, last %v", f.hand, f.last)
+	}
+	for _, w := range f.counters {
+		if w != 0 {
+			t.Fatal("all counters should be zero")
+		}
+	}
+
+	f.SetSweepRate(0, time.Second)
+	f.AddString("Bess")
+	now = now.Add(time.Hour)
+	if !f.TestString("Bess") {
+		t.Error("a zero rate should stop the sweeps")
+	}
+}
+
+func TestCountingStaleness(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	f := NewCountingWithEstimates(1000, 0.001)
+	f.now = func() time.Time { return now }
+	if err := f.SetStaleness(50*time.Minute, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if f.step != 6 {
+		t.Errorf("the step should be 6, got %d", f.step)
+	}
+	for i := 0; i < 1000; i++ {
+		f.AddString(fmt.Sprint(i))
+	}
+	if f.CountString("0") != 1 {
+		t.Errorf("a key added once should be counted once, got %d", f.CountString("0"))
+	}
+	now = start.Add(49 * time.Minute)
+	for i := 0; i < 1000; i++ {
+		if !f.TestString(fmt.Sprint(i)) {
+			t.Fatalf("%d should still be in the filter", i)
+		}
+	}
+	// Refreshing a key makes it last another staleness period.
+	f.AddString("0")
+	now = start.Add(61 * time.Minute)
+	if !f.TestString("0") {
+		t.Error("0 was added again and should be in the filter")
+	}
+	absent := 0
+	for i := 1; i < 1000; i++ {
+		if !f.TestString(fmt.Sprint(i)) {
+			absent++
+		}
+	}
+	// Keys sharing counters with 0 may last longer.
+	if absent < 990 {
+		t.Errorf("only %d keys are gone after an hour", absent)
+	}
+	// A long pause clears the filter without sweeping for long.
+	now = now.Add(100000 * time.Hour)
+	if f.Expire().TestString("0") {
+		t.Error("all keys should be gone")
+	}
+}
+
+func TestCountingStalenessErrors(t *testing.T) {
+	f := NewCounting(1000, 4, 4)
+	for _, c := range []struct{ minAge, maxAge time.Duration }{
+		{-time.Second, time.Minute},
+		{time.Minute, time.Minute},
+		{2 * time.Minute, time.Minute},
+		{59 * time.Minute, time.Hour}, // a step of 60 doesn't fit in 4 bits
+		{0, 0},
+	} {
+		if f.SetStaleness(c.minAge, c.maxAge) == nil {
+			t.Errorf("[%v, %v] should be rejected", c.minAge, c.maxAge)
+		}
+	}
+	if f.step != 1 {
+		t.Error("a rejected staleness should not change the filter")
+	}
+	if NewCounting(1000, 4, 1).SetStaleness(0, time.Hour) != nil {
+		t.Error("a step of 1 fits in 1-bit counters")
+	}
+}
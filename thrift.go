@@ -0,0 +1,171 @@
+package bloom
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Types of the Thrift compact protocol
+const (
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftByte   = 3
+	thriftI16    = 4
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftDouble = 7
+	thriftBinary = 8
+	thriftList   = 9
+	thriftSet    = 10
+	thriftMap    = 11
+	thriftStruct = 12
+)
+
+// thriftReader decodes the Thrift compact protocol one byte at a time, so
+// that it does not read past the end of a message.
+type thriftReader struct {
+	r     io.Reader
+	n     int64
+	depth int
+	buf   [1]byte
+}
+
+var errThriftDepth = errors.New("bloom: Thrift message is nested too deeply")
+
+func (r *thriftReader) byte() (byte, error) {
+	n, err := io.ReadFull(r.r, r.buf[:])
+	r.n += int64(n)
+	return r.buf[0], err
+}
+
+func (r *thriftReader) varint() (uint64, error) {
+	var v uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		v |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return v, nil
+		}
+	}
+	return 0, errors.New("bloom: invalid Thrift varint")
+}
+
+// fields calls f with the id and type of each field of a struct, which must
+// consume the value of the field, until the end of the struct.
+func (r *thriftReader) fields(f func(id int16, typ byte) error) error {
+	if r.depth++; r.depth > 16 {
+		return errThriftDepth
+	}
+	defer func() { r.depth-- }()
+	var id int16
+	for {
+		b, err := r.byte()
+		if err != nil {
+			return err
+		}
+		if b == 0 {
+			return nil
+		}
+		if delta := int16(b >> 4); delta != 0 {
+			id += delta
+		} else {
+			v, err := r.varint()
+			if err != nil {
+				return err
+			}
+			id = int16(uint16(v>>1) ^ -uint16(v&1))
+		}
+		if err := f(id, b&0x0f); err != nil {
+			return err
+		}
+	}
+}
+
+// skip consumes a value of the given type
+func (r *thriftReader) skip(typ byte) error {
+	switch typ {
+	case thriftTrue, thriftFalse:
+		// Booleans are held by the field header.
+		return nil
+	case thriftByte:
+		_, err := r.byte()
+		return err
+	case thriftI16, thriftI32, thriftI64:
+		_, err := r.varint()
+		return err
+	case thriftDouble, thriftBinary:
+		size := uint64(8)
+		if typ == thriftBinary {
+			var err error
+			if size, err = r.varint(); err != nil {
+				return err
+			}
+		}
+		n, err := io.CopyN(io.Discard, r.r, int64(size))
+		r.n += n
+		return err
+	case thriftList, thriftSet, thriftMap:
+		return r.skipContainer(typ)
+	case thriftStruct:
+		return r.fields(func(id int16, typ byte) error {
+			return r.skip(typ)
+		})
+	}
+	return fmt.Errorf("bloom: invalid Thrift type %d", typ)
+}
+
+// skipContainer consumes a list, a set or a map
+func (r *thriftReader) skipContainer(typ byte) error {
+	if r.depth++; r.depth > 16 {
+		return errThriftDepth
+	}
+	defer func() { r.depth-- }()
+	var size uint64
+	var types []byte
+	b, err := r.byte()
+	if err != nil {
+		return err
+	}
+	if typ == thriftMap {
+		size = uint64(b)
+		if b >= 0x80 {
+			size = uint64(b & 0x7f)
+			v, err := r.varint()
+			if err != nil {
+				return err
+			}
+			size |= v << 7
+		}
+		if size > 0 {
+			kv, err := r.byte()
+			if err != nil {
+				return err
+			}
+			types = []byte{kv >> 4, kv & 0x0f}
+		}
+	} else {
+		size = uint64(b >> 4)
+		if size == 15 {
+			if size, err = r.varint(); err != nil {
+				return err
+			}
+		}
+		types = []byte{b & 0x0f}
+	}
+	for i := uint64(0); i < size; i++ {
+		for _, t := range types {
+			if t == thriftTrue || t == thriftFalse {
+				// Booleans take a byte in containers.
+				t = thriftByte
+			}
+			if err := r.skip(t); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+//go:build go1.18
+// +build go1.18
+
+package bloom
+
+// A Typed Bloom filter holds keys of a single type T, which it converts to
+// bytes with a key function before hashing them. It saves repeating the
+// conversion at each call, and the compiler checks that only keys of type T
+// are added to, or tested against, the filter. For instance,
+//
+//	type User struct{ ID string }
+//	users := bloom.NewTyped(bloom.NewWithEstimates(1000, 0.01),
+//		func(u User) []byte { return []byte(u.ID) })
+//	users.Add(User{ID: "bess"})
+//
+// The key function must return the same bytes for equal keys; the returned
+// slice is not retained, so it may be reused across calls.
+type Typed[T any] struct {
+	f   *BloomFilter
+	key func(T) []byte
+}
+
+// NewTyped creates a typed Bloom filter which stores its keys in f, converted
+// by the key function.
+func NewTyped[T any](f *BloomFilter, key func(T) []byte) *Typed[T] {
+	return &Typed[T]{f: f, key: key}
+}
+
+// Filter returns the underlying Bloom filter, e.g., to serialize it.
+func (t *Typed[T]) Filter() *BloomFilter {
+	return t.f
+}
+
+// Add a key to the Bloom filter. Returns the filter (allows chaining)
+func (t *Typed[T]) Add(x T) *Typed[T] {
+	t.f.Add(t.key(x))
+	return t
+}
+
+// Test returns true if the key is in the Bloom filter, false otherwise.
+// If true, the result might be a false positive. If false, the key
+// is definitely not in the set.
+func (t *Typed[T]) Test(x T) bool {
+	return t.f.Test(t.key(x))
+}
+
+// TestAndAdd is equivalent to calling Test(x) then Add(x).
+// Returns the result of Test.
+func (t *Typed[T]) TestAndAdd(x T) bool {
+	return t.f.TestAndAdd(t.key(x))
+}
+
+// TestOrAdd is equivalent to calling Test(x) then if not present Add(x).
+// Returns the result of Test.
+func (t *Typed[T]) TestOrAdd(x T) bool {
+	return t.f.TestOrAdd(t.key(x))
+}
@@ -0,0 +1,31 @@
+//go:build go1.18
+// +build go1.18
+
+package bloom
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestTyped(t *testing.T) {
+	type user struct {
+		id   uint64
+		name string
+	}
+	var buf [8]byte
+	users := NewTyped(NewWithEstimates(1000, 0.001), func(u user) []byte {
+		binary.BigEndian.PutUint64(buf[:], u.id)
+		return buf[:]
+	})
+	if users.TestAndAdd(user{id: 1, name: "Bess"}) {
+		t.Error("the user should not be in an empty filter")
+	}
+	users.Add(user{id: 2})
+	if !users.Test(user{id: 1}) || !users.TestOrAdd(user{id: 2}) || users.Test(user{id: 3}) {
+		t.Error("users should be identified by their id")
+	}
+	if !users.Filter().TestUint64(1) {
+		t.Error("the keys should be stored in the underlying filter")
+	}
+}
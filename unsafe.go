@@ -0,0 +1,57 @@
+//go:build !purego
+// +build !purego
+
+package bloom
+
+import (
+	"encoding/binary"
+	"unsafe"
+)
+
+// pureGo is true when the package is built with the purego build tag, which
+// replaces the functions of this file with ones which do not use unsafe
+const pureGo = false
+
+// stringToBytes returns the bytes of a string without copying them, so that
+// string keys are hashed without allocating. The returned slice must not be
+// modified.
+func stringToBytes(s string) []byte {
+	return *(*[]byte)(unsafe.Pointer(&struct {
+		string
+		Cap int
+	}{s, len(s)}))
+}
+
+// nativeOrder is the byte order of the platform
+var nativeOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// wordsToBytes returns the bytes of the words, in the byte order of the
+// platform
+func wordsToBytes(words []uint64) []byte {
+	if len(words) == 0 {
+		return nil
+	}
+	return *(*[]byte)(unsafe.Pointer(&struct {
+		data     unsafe.Pointer
+		len, cap int
+	}{unsafe.Pointer(&words[0]), 8 * len(words), 8 * cap(words)}))
+}
+
+// bytesToWords returns the words made of the bytes, which must be 8-byte
+// aligned and a multiple of 8 long, in the byte order of the platform. It
+// returns nil if the bytes are not aligned.
+func bytesToWords(data []byte) []uint64 {
+	if len(data) == 0 || uintptr(unsafe.Pointer(&data[0]))%8 != 0 {
+		return nil
+	}
+	return *(*[]uint64)(unsafe.Pointer(&struct {
+		data     unsafe.Pointer
+		len, cap int
+	}{unsafe.Pointer(&data[0]), len(data) / 8, len(data) / 8}))
+}
@@ -0,0 +1,55 @@
+//go:build go1.23
+// +build go1.23
+
+package bloom
+
+import (
+	"fmt"
+	"iter"
+	"math"
+)
+
+// maxReportedKeys is the number of missing keys kept in a Report.
+const maxReportedKeys = 10
+
+// A Report is the result of verifying a filter against its source keys.
+type Report struct {
+	Keys    uint64   // number of source keys
+	Missing uint64   // number of source keys testing negative
+	Samples [][]byte // copies of the first missing keys, at most 10
+
+	SetBits         uint    // number of bits set in the filter
+	ExpectedSetBits float64 // expected number of bits set for Keys distinct keys
+}
+
+// FillConsistent returns false if the filter has many more bits set than
+// Keys distinct keys would set (by more than four standard deviations plus
+// one percent), which points to keys added from another source or to
+// corruption. Duplicate source keys only make the fill lower than expected.
+func (r Report) FillConsistent() bool {
+	return float64(r.SetBits) <= r.ExpectedSetBits*1.01+4*math.Sqrt(r.ExpectedSetBits)+1
+}
+
+// Verify tests every source key against the filter, to detect corrupted or
+// truncated filters, and compares the number of bits set with the number
+// expected for the source keys. It returns an error if any source key tests
+// negative: a filter holding all the keys never does.
+func Verify(f *BloomFilter, keys iter.Seq[[]byte]) (Report, error) {
+	var r Report
+	for key := range keys {
+		r.Keys++
+		if !f.Test(key) {
+			r.Missing++
+			if len(r.Samples) < maxReportedKeys {
+				r.Samples = append(r.Samples, append([]byte(nil), key...))
+			}
+		}
+	}
+	r.SetBits = f.b.Count()
+	m := float64(f.m)
+	r.ExpectedSetBits = m * -math.Expm1(float64(f.k)*float64(r.Keys)*math.Log1p(-1/m))
+	if r.Missing > 0 {
+		return r, fmt.Errorf("bloom: %d of %d source keys test negative", r.Missing, r.Keys)
+	}
+	return r, nil
+}
@@ -0,0 +1,70 @@
+//go:build go1.23
+// +build go1.23
+
+package bloom
+
+import (
+	"encoding/binary"
+	"iter"
+	"testing"
+)
+
+func uint32Keys(from, to uint32) iter.Seq[[]byte] {
+	return func(yield func([]byte) bool) {
+		n := make([]byte, 4)
+		for i := from; i < to; i++ {
+			binary.BigEndian.PutUint32(n, i)
+			if !yield(n) {
+				return
+			}
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	f := NewWithEstimates(1000, 0.01)
+	for key := range uint32Keys(0, 1000) {
+		f.Add(key)
+	}
+	r, err := Verify(f, uint32Keys(0, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Keys != 1000 || r.Missing != 0 || len(r.Samples) != 0 {
+		t.Errorf("unexpected report %+v", r)
+	}
+	if !r.FillConsistent() {
+		t.Errorf("fill should be consistent: %d bits set, %v expected", r.SetBits, r.ExpectedSetBits)
+	}
+
+	// Keys from another source.
+	for key := range uint32Keys(1000, 2000) {
+		f.Add(key)
+	}
+	r, err = Verify(f, uint32Keys(0, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.FillConsistent() {
+		t.Errorf("fill should be inconsistent: %d bits set, %v expected", r.SetBits, r.ExpectedSetBits)
+	}
+}
+
+func TestVerifyMissing(t *testing.T) {
+	f := NewWithEstimates(1000, 0.01)
+	for key := range uint32Keys(0, 500) {
+		f.Add(key)
+	}
+	r, err := Verify(f, uint32Keys(0, 1000))
+	if err == nil {
+		t.Fatal("expected an error for missing keys")
+	}
+	if r.Missing < 400 || len(r.Samples) != maxReportedKeys {
+		t.Errorf("unexpected report %+v", r)
+	}
+	for _, key := range r.Samples {
+		if f.Test(key) {
+			t.Errorf("%v should not be in", key)
+		}
+	}
+}
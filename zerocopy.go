@@ -0,0 +1,71 @@
+package bloom
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/bits-and-blooms/bitset"
+)
+
+// Words returns the words holding the bits of the filter, without copying
+// them: changes to the words change the filter.
+func (f *BloomFilter) Words() []uint64 {
+	return f.b.Words()
+}
+
+// Bytes returns the bits of the filter as the bytes of its words, in the
+// byte order of the platform, without copying them: changes to the bytes
+// change the filter. With the purego build tag, the bytes are a copy.
+func (f *BloomFilter) Bytes() []byte {
+	return wordsToBytes(f.b.Words())
+}
+
+// UnmarshalBinaryZeroCopy is like UnmarshalBinary, but the filter uses the
+// words of its bitset in place in data, rather than copying them, when
+// possible: the filter must be written by WriteTo or MarshalBinary without
+// encoding nor checksum, in the byte order of the platform (see
+// bitset.LittleEndian), and its words must be 8-byte aligned in data, as
+// they are for filters without a seed, key or fast range reduction if data
+// is. Otherwise, the bitset is copied as UnmarshalBinary does.
+//
+// With the purego build tag, the bitset is always copied.
+//
+// When data is used in place, it must not be modified while the filter is
+// used, and adding keys to the filter modifies data, which must then be
+// writable: a read-only memory mapping makes Add crash.
+func (f *BloomFilter) UnmarshalBinaryZeroCopy(data []byte) error {
+	h, n, err := readHeader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if !h.fitsUint() {
+		return errTooLarge
+	}
+	if err := f.checkKeyed(h.keyed); err != nil {
+		return err
+	}
+	if h.encoding != EncodingRaw || h.checksum || bitset.BinaryOrder() != nativeOrder {
+		return f.UnmarshalBinary(data)
+	}
+	if uint64(len(data)-int(n)) < 8 {
+		return io.ErrUnexpectedEOF
+	}
+	length := nativeOrder.Uint64(data[n:])
+	payload := data[n+8:]
+	words := length/64 + (length%64+63)/64
+	if uint64(len(payload))/8 < words {
+		return io.ErrUnexpectedEOF
+	}
+	inPlace := bytesToWords(payload[:8*words])
+	if words > 0 && inPlace == nil {
+		return f.UnmarshalBinary(data)
+	}
+	f.changedAll()
+	f.m = uint(h.m)
+	f.k = uint(h.k)
+	f.b = bitset.FromWithLength(uint(length), inPlace)
+	f.seed = h.seed
+	f.fastRange = h.fastRange
+	f.scheme = h.scheme
+	return nil
+}
@@ -0,0 +1,92 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/bits-and-blooms/bitset"
+)
+
+func TestWordsAndBytes(t *testing.T) {
+	f := New(1000, 4)
+	f.Words()[0] = 1
+	if !f.BitSet().Test(0) {
+		t.Error("Words should return the words of the filter")
+	}
+	b := f.Bytes()
+	if len(b) != 8*len(f.Words()) {
+		t.Fatalf("unexpected length %d", len(b))
+	}
+	if !pureGo {
+		b[8] = 1
+		if nativeOrder == bitset.BinaryOrder() && !f.BitSet().Test(64) {
+			t.Error("Bytes should return the bytes of the filter")
+		}
+	}
+	if nativeOrder.Uint64(b) != f.Words()[0] || nativeOrder.Uint64(b[8:]) != f.Words()[1] {
+		t.Error("Bytes should be in the byte order of the platform")
+	}
+}
+
+// inData returns true if the words of the filter are in data
+func inData(f *BloomFilter, data []byte) bool {
+	before := append([]byte(nil), data...)
+	f.Words()[0] ^= 1
+	in := !bytes.Equal(before, data)
+	f.Words()[0] ^= 1
+	return in
+}
+
+// setBinaryOrder sets the byte order of the words of serialized bitsets
+func setBinaryOrder(order binary.ByteOrder) {
+	if order == binary.LittleEndian {
+		bitset.LittleEndian()
+	} else {
+		bitset.BigEndian()
+	}
+}
+
+func TestUnmarshalBinaryZeroCopy(t *testing.T) {
+	defer setBinaryOrder(bitset.BinaryOrder())
+	setBinaryOrder(nativeOrder)
+
+	f := NewWithEstimates(1000, 0.01).AddString("a")
+	data := mustMarshal(t, f)
+	g := &BloomFilter{}
+	if err := g.UnmarshalBinaryZeroCopy(data); err != nil {
+		t.Fatal(err)
+	}
+	// The purego build tag always copies the words.
+	if !g.Equal(f) || inData(g, data) == pureGo {
+		t.Error("the filter should use its words in place")
+	}
+	g.AddString("b")
+	h := &BloomFilter{}
+	if err := h.UnmarshalBinary(data); err != nil || h.TestString("b") == pureGo {
+		t.Error("adding keys should modify the data")
+	}
+	for _, n := range []int{20, len(data) - 1} {
+		if err := (&BloomFilter{}).UnmarshalBinaryZeroCopy(data[:n]); err != io.ErrUnexpectedEOF {
+			t.Errorf("truncated to %d: unexpected error %v", n, err)
+		}
+	}
+
+	// Filters which cannot be used in place are copied.
+	seeded := mustMarshal(t, NewWithEstimatesAndSeed(1000, 0.01, 42)) // misaligned words
+	h = &BloomFilter{}
+	if err := h.UnmarshalBinaryZeroCopy(seeded); err != nil || inData(h, seeded) {
+		t.Errorf("the filter should be copied (%v)", err)
+	}
+	if nativeOrder == binary.LittleEndian {
+		setBinaryOrder(binary.BigEndian)
+	} else {
+		setBinaryOrder(binary.LittleEndian)
+	}
+	data = mustMarshal(t, f)
+	g = &BloomFilter{}
+	if err := g.UnmarshalBinaryZeroCopy(data); err != nil || !g.Equal(f) || inData(g, data) {
+		t.Errorf("the filter should be copied (%v)", err)
+	}
+}